@@ -1,12 +1,34 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/dottrip/fpt-swp/internal/apierror"
+	"github.com/dottrip/fpt-swp/internal/chat"
 	"github.com/dottrip/fpt-swp/internal/database"
 	"github.com/dottrip/fpt-swp/internal/handlers"
+	"github.com/dottrip/fpt-swp/internal/jobs"
 	"github.com/dottrip/fpt-swp/internal/middleware"
+	"github.com/dottrip/fpt-swp/internal/models"
+	"github.com/dottrip/fpt-swp/internal/notify"
+	"github.com/dottrip/fpt-swp/internal/openapi"
+	"github.com/dottrip/fpt-swp/internal/pageviews"
+	"github.com/dottrip/fpt-swp/internal/signaling"
+	"github.com/dottrip/fpt-swp/internal/sms"
+	"github.com/dottrip/fpt-swp/internal/spam"
+	"github.com/dottrip/fpt-swp/internal/storage"
+	"github.com/dottrip/fpt-swp/internal/templates"
+	"github.com/dottrip/fpt-swp/internal/upload"
+	"github.com/dottrip/fpt-swp/internal/validation"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 )
@@ -20,14 +42,128 @@ func main() {
 	// Initialize database
 	database.InitDB()
 
+	// Give posts written before slugs existed one made from their title
+	if n, err := models.BackfillBlogPostSlugs(); err != nil {
+		log.Printf("Warning: failed to generate blog post slugs: %v", err)
+	} else if n > 0 {
+		log.Printf("Generated slugs for %d blog posts", n)
+	}
+
+	// Render posts written before content was stored as Markdown
+	if n, err := models.BackfillBlogPostHTML(); err != nil {
+		log.Printf("Warning: failed to render blog posts: %v", err)
+	} else if n > 0 {
+		log.Printf("Rendered %d blog posts", n)
+	}
+
+	// Move the free-text categories and tags of older posts into their tables
+	if n, err := models.BackfillBlogTaxonomy(); err != nil {
+		log.Printf("Warning: failed to migrate blog categories and tags: %v", err)
+	} else if n > 0 {
+		log.Printf("Migrated the categories and tags of %d blog posts", n)
+	}
+
+	// Make posts written before full-text search searchable
+	if n, err := models.BackfillBlogSearchIndex(); err != nil {
+		log.Printf("Warning: failed to index blog posts for search: %v", err)
+	} else if n > 0 {
+		log.Printf("Indexed %d blog posts for search", n)
+	}
+
+	// Load localized message and email templates
+	templates.Init()
+
+	// Start the chat event hub (Postgres LISTEN/NOTIFY or in-memory for SQLite)
+	chat.Init()
+
+	// Start the WebRTC signaling hub on the same kind of bus
+	signaling.Init()
+
+	// Start the notification hub that pushes in-app notifications over SSE
+	notify.Init()
+
+	// Set up file storage for attachments (local filesystem or S3-compatible)
+	// and check download URLs can be signed
+	storage.Init()
+	upload.Init()
+
+	// Set up the SMS provider and send SMS notifications through it
+	sms.Init()
+	if sms.Default != nil {
+		notify.SMS = notify.SMSSender()
+	}
+
+	// Set up the spam classifier for blog comments
+	spam.Init()
+
+	// Count blog post views once per visitor, ignoring bots
+	pageviews.Init()
+
+	// Start periodic maintenance jobs
+	startJobs()
+
+	// Report validation errors by JSON field name, add the custom binding
+	// rules and reject unknown JSON fields
+	apierror.UseJSONFieldNames()
+	if err := validation.Register(); err != nil {
+		log.Fatal("Failed to register validation rules:", err)
+	}
+
 	// Set up router
+	r := newRouter()
+	warnUndocumentedRoutes(r)
+
+	// Get port from environment
+	port := getEnv("PORT", "8080")
+
+	// Start server
+	srv := &http.Server{Addr: ":" + port, Handler: r}
+	go func() {
+		log.Printf("Server running on port %s", port)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("Failed to start server:", err)
+		}
+	}()
+
+	// On SIGINT or SIGTERM, finish the requests in flight and write the blog
+	// post views not flushed yet before exiting
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+	log.Println("Shutting down server...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Warning: server did not shut down cleanly: %v", err)
+	}
+	if n, err := pageviews.Default.Flush(); err != nil {
+		log.Printf("Warning: failed to write blog post views: %v", err)
+	} else if n > 0 {
+		log.Printf("Wrote %d blog post views", n)
+	}
+}
+
+// newRouter sets up the middleware and every API route. Routes added here
+// must also be documented in handlers/openapi.go.
+func newRouter() *gin.Engine {
 	r := gin.Default()
 
+	// Only believe X-Forwarded-For from our own proxies, so clients cannot
+	// pick the IP that view counts and logs see
+	if err := r.SetTrustedProxies(trustedProxies()); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES:", err)
+	}
+
+	// Tag requests with an ID that error responses and logs refer to
+	r.Use(middleware.RequestID())
+
 	// Set up CORS
 	r.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, Last-Event-ID, X-Request-ID, If-Match")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "X-Request-ID, ETag")
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
 			return
@@ -38,16 +174,43 @@ func main() {
 	// Health check endpoint
 	r.GET("/api/health", handlers.HealthCheck)
 
+	// OpenAPI document and API reference page
+	r.GET("/api/openapi.json", handlers.GetOpenAPISpec)
+	r.GET("/api/docs", handlers.GetAPIDocs)
+
+	// Sitemap of the public website, for search engines
+	r.GET("/sitemap.xml", handlers.GetSitemap)
+
 	// Public routes
 	public := r.Group("/api")
 	{
 		public.POST("/register", handlers.Register)
 		public.POST("/login", handlers.Login)
 
+		// Delivery reports from the SMS gateway (authenticated by token)
+		public.GET("/sms/status-callback", handlers.SMSStatusCallback)
+		public.POST("/sms/status-callback", handlers.SMSStatusCallback)
+
 		// Public blog endpoints
 		public.GET("/blog/posts", handlers.GetPublishedBlogPosts)
-		public.GET("/blog/posts/:id", handlers.GetBlogPost)
+		public.GET("/blog/search", handlers.SearchBlogPosts)
+		public.GET("/blog/posts/:id", handlers.GetPublishedBlogPost)
+		public.GET("/blog/posts/by-slug/:slug", handlers.GetBlogPostBySlug)
+		public.GET("/blog/posts/:id/comments", handlers.GetBlogPostComments)
 		public.GET("/blog/categories", handlers.GetBlogCategories)
+		public.GET("/blog/tags", handlers.GetBlogTags)
+		public.GET("/blog/feed.rss", handlers.GetBlogFeedRSS)
+		public.GET("/blog/feed.atom", handlers.GetBlogFeedAtom)
+		public.GET("/blog/feed.json", handlers.GetBlogFeedJSON)
+		public.GET("/blog/categories/:slug/feed.rss", handlers.GetBlogFeedRSS)
+		public.GET("/blog/categories/:slug/feed.atom", handlers.GetBlogFeedAtom)
+		public.GET("/blog/categories/:slug/feed.json", handlers.GetBlogFeedJSON)
+
+		// Public verification of printed prescriptions and visit summaries
+		public.GET("/verify/:code", handlers.VerifyDocument)
+
+		// File downloads, authorized by signed URLs rather than tokens
+		public.GET("/files/:id", handlers.DownloadFile)
 	}
 
 	// Protected routes
@@ -59,14 +222,40 @@ func main() {
 		// Protected blog endpoints (for staff/admin)
 		blogGroup := protected.Group("/blog")
 		{
+			// Reader comments, by any signed-in user
+			blogGroup.POST("/posts/:id/comments", handlers.CreateBlogPostComment)
+
 			// Admin/Staff blog management
 			blogGroup.GET("/manage/posts", handlers.GetBlogPosts)
 			blogGroup.POST("/manage/posts", handlers.CreateBlogPost)
 			blogGroup.GET("/manage/posts/:id", handlers.GetBlogPost)
 			blogGroup.PUT("/manage/posts/:id", handlers.UpdateBlogPost)
+			blogGroup.PATCH("/manage/posts/:id", handlers.PatchBlogPost)
 			blogGroup.DELETE("/manage/posts/:id", handlers.DeleteBlogPost)
 			blogGroup.POST("/manage/posts/:id/publish", handlers.PublishBlogPost)
 			blogGroup.POST("/manage/posts/:id/unpublish", handlers.UnpublishBlogPost)
+			blogGroup.GET("/manage/posts/:id/revisions", handlers.GetBlogRevisions)
+			blogGroup.GET("/manage/posts/:id/revisions/diff", handlers.DiffBlogRevisions)
+			blogGroup.GET("/manage/posts/:id/revisions/:rev", handlers.GetBlogRevision)
+			blogGroup.POST("/manage/posts/:id/revisions/:rev/restore", handlers.RestoreBlogRevision)
+			blogGroup.POST("/manage/posts/:id/review/submit", handlers.SubmitBlogPostForReview)
+			blogGroup.POST("/manage/posts/:id/review/approve", handlers.ApproveBlogPost)
+			blogGroup.POST("/manage/posts/:id/review/request-changes", handlers.RequestBlogPostChanges)
+			blogGroup.GET("/manage/posts/:id/review/comments", handlers.GetBlogReviewComments)
+			blogGroup.POST("/manage/posts/:id/review/comments", handlers.CreateBlogReviewComment)
+			blogGroup.GET("/manage/comments", handlers.GetBlogComments)
+			blogGroup.POST("/manage/comments/:id/approve", handlers.ApproveBlogComment)
+			blogGroup.POST("/manage/comments/:id/reject", handlers.RejectBlogComment)
+			blogGroup.POST("/manage/comments/:id/spam", handlers.MarkBlogCommentSpam)
+			blogGroup.POST("/manage/comments/:id/ban", handlers.BanBlogCommenter)
+			blogGroup.POST("/manage/categories", handlers.CreateBlogCategory)
+			blogGroup.PUT("/manage/categories/:id", handlers.UpdateBlogCategory)
+			blogGroup.DELETE("/manage/categories/:id", handlers.DeleteBlogCategory)
+			blogGroup.POST("/manage/categories/:id/merge", handlers.MergeBlogCategory)
+			blogGroup.POST("/manage/tags", handlers.CreateBlogTag)
+			blogGroup.PUT("/manage/tags/:id", handlers.UpdateBlogTag)
+			blogGroup.DELETE("/manage/tags/:id", handlers.DeleteBlogTag)
+			blogGroup.POST("/manage/tags/:id/merge", handlers.MergeBlogTag)
 			blogGroup.GET("/manage/stats", handlers.GetBlogStats)
 		}
 
@@ -78,18 +267,232 @@ func main() {
 			doctorGroup.GET("/specialties", handlers.GetDoctorSpecialties)
 			doctorGroup.GET("/:id", handlers.GetDoctor)
 			doctorGroup.PUT("/:id", handlers.UpdateDoctor)
+			doctorGroup.PATCH("/:id", handlers.PatchDoctor)
 			doctorGroup.DELETE("/:id", handlers.DeleteDoctor)
 		}
+
+		// Prescription and visit summary endpoints (PDF for print/download)
+		prescriptionGroup := protected.Group("/prescriptions")
+		{
+			prescriptionGroup.POST("", handlers.CreatePrescription)
+			prescriptionGroup.GET("/:id", handlers.GetPrescription)
+			prescriptionGroup.GET("/:id/pdf", handlers.GetPrescriptionPDF)
+		}
+
+		visitSummaryGroup := protected.Group("/visit-summaries")
+		{
+			visitSummaryGroup.POST("", handlers.CreateVisitSummary)
+			visitSummaryGroup.GET("/:id", handlers.GetVisitSummary)
+			visitSummaryGroup.GET("/:id/pdf", handlers.GetVisitSummaryPDF)
+		}
+
+		// Chat conversation endpoints
+		conversationGroup := protected.Group("/conversations")
+		{
+			conversationGroup.GET("", handlers.GetConversations)
+			conversationGroup.POST("", handlers.CreateConversation)
+			conversationGroup.GET("/:id", handlers.GetConversation)
+			conversationGroup.GET("/:id/messages", handlers.GetConversationMessages)
+			conversationGroup.POST("/:id/messages", handlers.SendConversationMessage)
+			conversationGroup.POST("/:id/read", handlers.MarkConversationRead)
+		}
+
+		// Video/voice consultation endpoints
+		consultationGroup := protected.Group("/consultations/sessions")
+		{
+			consultationGroup.POST("", handlers.CreateConsultationSession)
+			consultationGroup.GET("/:id", handlers.GetConsultationSession)
+			consultationGroup.POST("/:id/end", handlers.EndConsultationSession)
+			consultationGroup.GET("/:id/ice-servers", handlers.GetConsultationICEServers)
+		}
+
+		// Consultation queue endpoints
+		consultationRequestGroup := protected.Group("/consultation-requests")
+		{
+			consultationRequestGroup.GET("", handlers.GetConsultationRequests)
+			consultationRequestGroup.POST("", handlers.CreateConsultationRequest)
+			consultationRequestGroup.GET("/:id", handlers.GetConsultationRequest)
+			consultationRequestGroup.POST("/:id/cancel", handlers.CancelConsultationRequest)
+			consultationRequestGroup.PUT("/:id/priority", handlers.SetConsultationRequestPriority)
+			consultationRequestGroup.POST("/:id/release", handlers.ReleaseConsultationRequest)
+			consultationRequestGroup.POST("/:id/complete", handlers.CompleteConsultationRequest)
+		}
+
+		queueGroup := protected.Group("/consultation-queue")
+		{
+			queueGroup.POST("/claim", handlers.ClaimConsultationRequest)
+			queueGroup.GET("/stats", handlers.GetConsultationQueueStats)
+		}
+
+		// File attachment endpoints
+		attachmentGroup := protected.Group("/attachments")
+		{
+			attachmentGroup.POST("", handlers.UploadAttachment)
+			attachmentGroup.GET("/:id", handlers.GetAttachment)
+			attachmentGroup.DELETE("/:id", handlers.DeleteAttachment)
+		}
+
+		// Support ticket endpoints
+		ticketGroup := protected.Group("/support/tickets")
+		{
+			ticketGroup.GET("", handlers.GetSupportTickets)
+			ticketGroup.POST("", handlers.CreateSupportTicket)
+			ticketGroup.GET("/:id", handlers.GetSupportTicket)
+			ticketGroup.POST("/:id/messages", handlers.ReplySupportTicket)
+			ticketGroup.PUT("/:id/assign", handlers.AssignSupportTicket)
+			ticketGroup.PUT("/:id/status", handlers.UpdateSupportTicketStatus)
+			ticketGroup.PUT("/:id/priority", handlers.UpdateSupportTicketPriority)
+		}
+
+		// Staff schedule, shift roster and swap endpoints
+		staffGroup := protected.Group("/staff")
+		{
+			staffGroup.GET("/schedule", handlers.GetStaffSchedule)
+			staffGroup.POST("/schedule/events", handlers.CreateScheduleEvent)
+			staffGroup.GET("/schedule/events/:id", handlers.GetScheduleEvent)
+			staffGroup.PUT("/schedule/events/:id", handlers.UpdateScheduleEvent)
+			staffGroup.DELETE("/schedule/events/:id", handlers.DeleteScheduleEvent)
+			staffGroup.GET("/rosters", handlers.GetShiftRosters)
+			staffGroup.POST("/rosters", handlers.CreateShiftRoster)
+			staffGroup.GET("/rosters/:id", handlers.GetShiftRoster)
+			staffGroup.POST("/rosters/:id/shifts", handlers.AddRosterShift)
+			staffGroup.DELETE("/rosters/:id/shifts/:shiftId", handlers.DeleteRosterShift)
+			staffGroup.POST("/rosters/:id/publish", handlers.PublishShiftRoster)
+			staffGroup.POST("/shifts/:id/swap-requests", handlers.RequestShiftSwap)
+			staffGroup.GET("/swap-requests", handlers.GetShiftSwapRequests)
+			staffGroup.POST("/swap-requests/:id/approve", handlers.ApproveShiftSwap)
+			staffGroup.POST("/swap-requests/:id/reject", handlers.RejectShiftSwap)
+			staffGroup.POST("/swap-requests/:id/cancel", handlers.CancelShiftSwap)
+		}
+
+		// Notification center endpoints
+		notificationGroup := protected.Group("/notifications")
+		{
+			notificationGroup.GET("", handlers.GetNotifications)
+			notificationGroup.POST("/:id/read", handlers.MarkNotificationRead)
+			notificationGroup.POST("/read-all", handlers.MarkAllNotificationsRead)
+			notificationGroup.GET("/preferences", handlers.GetNotificationPreferences)
+			notificationGroup.PUT("/preferences", handlers.UpdateNotificationPreferences)
+			notificationGroup.PUT("/phone", handlers.UpdateNotificationPhone)
+		}
+
+		// SMS log (admin only)
+		protected.GET("/sms/messages", handlers.GetSMSMessages)
+
+		// Template previews (admin only)
+		protected.GET("/admin/templates", handlers.GetTemplates)
+		protected.GET("/admin/templates/email/:name", handlers.PreviewEmailTemplate)
+		protected.POST("/admin/templates/email/:name", handlers.PreviewEmailTemplate)
 	}
 
-	// Get port from environment
-	port := getEnv("PORT", "8080")
+	// WebSocket routes (token may be passed as a query parameter)
+	ws := r.Group("/api/ws")
+	ws.Use(middleware.WebSocketAuthMiddleware())
+	{
+		ws.GET("/chat", handlers.ChatWebSocket)
+		ws.GET("/consultations/:id", handlers.ConsultationSignalWebSocket)
+	}
 
-	// Start server
-	log.Printf("Server running on port %s", port)
-	if err := r.Run(":" + port); err != nil {
-		log.Fatal("Failed to start server:", err)
+	// Server-Sent Event streams; EventSource cannot set headers either, so
+	// they authenticate like WebSocket upgrades
+	streams := r.Group("/api")
+	streams.Use(middleware.WebSocketAuthMiddleware())
+	{
+		streams.GET("/notifications/stream", handlers.NotificationStream)
+	}
+
+	return r
+}
+
+// undocumentedRoutes lists the registered routes missing from the OpenAPI
+// document
+func undocumentedRoutes(r *gin.Engine) (gin.RoutesInfo, error) {
+	doc, err := handlers.OpenAPIDocument()
+	if err != nil {
+		return nil, err
+	}
+	return openapi.Missing(doc, r.Routes()), nil
+}
+
+// warnUndocumentedRoutes logs routes missing from the OpenAPI document
+func warnUndocumentedRoutes(r *gin.Engine) {
+	missing, err := undocumentedRoutes(r)
+	if err != nil {
+		log.Printf("Warning: failed to build the OpenAPI document: %v", err)
+		return
+	}
+	for _, route := range missing {
+		log.Printf("Warning: %s %s is not documented in the OpenAPI document", route.Method, route.Path)
+	}
+}
+
+// startJobs starts the periodic maintenance jobs. Every job is an idempotent
+// database update or writes only what its own replica holds, so running them
+// on several replicas is safe.
+func startJobs() {
+	// Close resolved support tickets nobody has replied to for a while
+	idleHours, err := strconv.Atoi(getEnv("TICKET_AUTO_CLOSE_HOURS", "72"))
+	if err != nil || idleHours <= 0 {
+		idleHours = 72
+	}
+	jobs.Every("ticket auto-close", 10*time.Minute, func() error {
+		closed, err := models.CloseIdleResolvedTickets(time.Duration(idleHours) * time.Hour)
+		if closed > 0 {
+			log.Printf("Auto-closed %d resolved support tickets", closed)
+		}
+		return err
+	})
+
+	// Publish scheduled blog posts and archive expired ones when their time
+	// comes; safe to run on every replica
+	jobs.Every("blog scheduling", 30*time.Second, func() error {
+		changed, err := models.RunBlogSchedule(time.Now())
+		if changed > 0 {
+			log.Printf("Published or archived %d scheduled blog posts", changed)
+		}
+		return err
+	})
+
+	// Prune old blog post revisions; published ones and the latest are kept
+	keep, err := strconv.Atoi(getEnv("BLOG_REVISIONS_KEEP", "50"))
+	if err != nil || keep < 0 {
+		keep = 50
+	}
+	maxAgeDays, err := strconv.Atoi(getEnv("BLOG_REVISIONS_MAX_AGE_DAYS", "0"))
+	if err != nil || maxAgeDays < 0 {
+		maxAgeDays = 0
+	}
+	policy := models.BlogRevisionPolicy{Keep: keep, MaxAge: time.Duration(maxAgeDays) * 24 * time.Hour}
+	jobs.Every("blog revision pruning", time.Hour, func() error {
+		pruned, err := models.PruneBlogRevisions(policy)
+		if pruned > 0 {
+			log.Printf("Pruned %d old blog post revisions", pruned)
+		}
+		return err
+	})
+
+	// Write the blog post views this replica has counted since the last run
+	flushSeconds, err := strconv.Atoi(getEnv("BLOG_VIEW_FLUSH_SECONDS", "30"))
+	if err != nil || flushSeconds <= 0 {
+		flushSeconds = 30
+	}
+	jobs.Every("blog view flush", time.Duration(flushSeconds)*time.Second, func() error {
+		_, err := pageviews.Default.Flush()
+		return err
+	})
+}
+
+// trustedProxies reads TRUSTED_PROXIES, a comma-separated list of the IPs or
+// CIDR ranges of the reverse proxies in front of the server. Without it no
+// proxy is trusted and the client IP is the connection's address.
+func trustedProxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(getEnv("TRUSTED_PROXIES", ""), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
 	}
+	return proxies
 }
 
 // getEnv gets an environment variable or returns a default value
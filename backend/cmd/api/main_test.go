@@ -0,0 +1,24 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/dottrip/fpt-swp/internal/handlers"
+	"github.com/dottrip/fpt-swp/internal/openapi"
+	"github.com/gin-gonic/gin"
+)
+
+// TestOpenAPICoversRoutes fails when a registered route is missing from the
+// OpenAPI document in handlers/openapi.go. Building the router needs no
+// database.
+func TestOpenAPICoversRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	doc, err := handlers.OpenAPIDocument()
+	if err != nil {
+		t.Fatalf("OpenAPIDocument: %v", err)
+	}
+	for _, route := range openapi.Missing(doc, newRouter().Routes()) {
+		t.Errorf("%s %s (%s) is not documented in handlers/openapi.go", route.Method, route.Path, route.Handler)
+	}
+}
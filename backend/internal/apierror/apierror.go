@@ -0,0 +1,227 @@
+// Package apierror defines the errors handlers return to clients. Each has
+// an HTTP status, a stable machine-readable code, and a message key that is
+// translated into the client's language when the response is written.
+// Validation errors also list the offending fields.
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/dottrip/fpt-swp/internal/models"
+	"github.com/go-playground/validator/v10"
+)
+
+// Error codes. Clients may rely on these; messages change with the locale.
+const (
+	CodeBadRequest           = "bad_request"
+	CodeValidation           = "validation_failed"
+	CodeUnauthorized         = "unauthorized"
+	CodeInvalidCredentials   = "invalid_credentials"
+	CodeForbidden            = "forbidden"
+	CodeNotFound             = "not_found"
+	CodeConflict             = "conflict"
+	CodePreconditionFailed   = "precondition_failed"
+	CodePreconditionRequired = "precondition_required"
+	CodeEmailTaken           = "email_taken"
+	CodeUsernameTaken        = "username_taken"
+	CodeRateLimited          = "rate_limited"
+	CodeFileTooLarge         = "file_too_large"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeInternal             = "internal_error"
+)
+
+// FieldError describes one invalid field
+type FieldError struct {
+	Field   string `json:"field"`           // JSON name, dotted for nested fields
+	Code    string `json:"code"`            // rule that failed, e.g. "required", "email", "min"
+	Param   string `json:"param,omitempty"` // rule parameter, e.g. "6" for min=6
+	Message string `json:"message"`
+}
+
+// Error is an error response
+type Error struct {
+	Status int
+	Code   string
+	Key    string      // message template key; defaults to "error.<code>"
+	Data   interface{} // template data for Key
+	Fields []FieldError
+	Err    error // cause; logged for internal errors, never sent
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Code + ": " + e.Err.Error()
+	}
+	return e.Code
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// New creates an error with the generic message for its code
+func New(status int, code string) *Error {
+	return &Error{Status: status, Code: code}
+}
+
+// WithKey replaces the generic message with the message template key
+func (e *Error) WithKey(key string, data interface{}) *Error {
+	e.Key, e.Data = key, data
+	return e
+}
+
+// BadRequest is a request the server could not parse
+func BadRequest(key string) *Error {
+	return New(http.StatusBadRequest, CodeBadRequest).WithKey(key, nil)
+}
+
+// NotFound is a missing resource; key names it, e.g. "error.doctor_not_found"
+func NotFound(key string) *Error {
+	return New(http.StatusNotFound, CodeNotFound).WithKey(key, nil)
+}
+
+// Forbidden is an action the user's role does not allow
+func Forbidden(key string) *Error {
+	return New(http.StatusForbidden, CodeForbidden).WithKey(key, nil)
+}
+
+// Unauthorized is a request without a signed-in user the handler can find
+func Unauthorized() *Error {
+	return New(http.StatusUnauthorized, CodeUnauthorized)
+}
+
+// Conflict is an action the resource's current state does not allow; key
+// says why, e.g. "error.ticket_closed"
+func Conflict(key string) *Error {
+	return New(http.StatusConflict, CodeConflict).WithKey(key, nil)
+}
+
+// PreconditionFailed is a write based on a version of the resource that is
+// no longer current
+func PreconditionFailed() *Error {
+	return New(http.StatusPreconditionFailed, CodePreconditionFailed)
+}
+
+// PreconditionRequired is a write that must name the version it is based on
+// but does not
+func PreconditionRequired() *Error {
+	return New(http.StatusPreconditionRequired, CodePreconditionRequired)
+}
+
+// Internal wraps an unexpected error. Clients only see a generic message.
+func Internal(err error) *Error {
+	return &Error{Status: http.StatusInternalServerError, Code: CodeInternal, Err: err}
+}
+
+// Validation is a request with invalid fields
+func Validation(fields ...FieldError) *Error {
+	return &Error{Status: http.StatusBadRequest, Code: CodeValidation, Fields: fields}
+}
+
+// Field is a validation error for one field that failed rule, e.g.
+// Field("to", "gtfield", "from")
+func Field(field, rule, param string) *Error {
+	return Validation(FieldError{Field: field, Code: rule, Param: param})
+}
+
+// From converts any error to an Error. Model validation errors become
+// validation errors; anything unknown is internal.
+func From(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+
+	if errors.Is(err, models.ErrVersionConflict) {
+		return PreconditionFailed()
+	}
+	if errors.Is(err, models.ErrReviewRequired) {
+		return Conflict("error.blog_review_required")
+	}
+	if errors.Is(err, models.ErrReviewState) {
+		return Conflict("error.blog_review_state")
+	}
+
+	for sentinel, key := range conflictKeys {
+		if errors.Is(err, sentinel) {
+			return Conflict(key)
+		}
+	}
+
+	if errors.Is(err, models.ErrCommentsDisabled) {
+		return Forbidden("error.blog_comments_disabled")
+	}
+	if errors.Is(err, models.ErrCommentBanned) {
+		return Forbidden("error.blog_comment_banned")
+	}
+
+	var ve *models.ValidationError
+	if errors.As(err, &ve) {
+		if ve.Field == "" {
+			// A rule not tied to one field; its message is "validation.<code>",
+			// or the generic one for errors that name no rule
+			e := New(http.StatusBadRequest, CodeValidation)
+			if ve.Code != "invalid" {
+				e.WithKey("validation."+ve.Code, FieldError{Code: ve.Code, Param: ve.Param})
+			}
+			return e
+		}
+		return Validation(FieldError{Field: ve.Field, Code: ve.Code, Param: ve.Param})
+	}
+
+	return Internal(err)
+}
+
+// conflictKeys are the messages of model errors that mean the resource's
+// state does not allow the change
+var conflictKeys = map[error]string{
+	models.ErrShiftConflict:   "error.shift_conflict",
+	models.ErrRosterPublished: "error.roster_published",
+	models.ErrSwapNotPending:  "error.swap_not_pending",
+	models.ErrSwapStale:       "error.swap_stale",
+}
+
+// FromBinding converts an error from gin's ShouldBind* to a validation
+// error listing every failed field, or a bad request for malformed bodies
+func FromBinding(err error) *Error {
+	var verrs validator.ValidationErrors
+	if errors.As(err, &verrs) {
+		fields := make([]FieldError, 0, len(verrs))
+		for _, fe := range verrs {
+			fields = append(fields, FieldError{
+				Field: fieldPath(fe.Namespace()),
+				Code:  fe.Tag(),
+				Param: fe.Param(),
+			})
+		}
+		return Validation(fields...)
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return Validation(FieldError{Field: typeErr.Field, Code: "type", Param: typeErr.Type.String()})
+	}
+
+	// encoding/json has no type for this; the message is its only form
+	if field, ok := strings.CutPrefix(err.Error(), `json: unknown field "`); ok {
+		return Validation(FieldError{Field: strings.TrimSuffix(field, `"`), Code: "unknown"})
+	}
+
+	if errors.Is(err, io.EOF) {
+		return BadRequest("error.empty_body")
+	}
+	return BadRequest("error.malformed_json")
+}
+
+// fieldPath drops the struct name validator puts first in a namespace, so
+// "RegisterInput.email" becomes "email"
+func fieldPath(namespace string) string {
+	if _, path, ok := strings.Cut(namespace, "."); ok {
+		return path
+	}
+	return namespace
+}
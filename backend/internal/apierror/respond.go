@@ -0,0 +1,62 @@
+package apierror
+
+import (
+	"log"
+
+	"github.com/dottrip/fpt-swp/internal/response"
+	"github.com/dottrip/fpt-swp/internal/templates"
+	"github.com/gin-gonic/gin"
+)
+
+// Respond writes err as a JSON error response in the language the client
+// asked for with Accept-Language:
+//
+//	{"success": false, "error": {"code": "validation_failed", "message": "...",
+//	 "details": [{"field": "email", "code": "email", "message": "..."}],
+//	 "request_id": "..."}}
+//
+// Internal errors are logged with the request ID and the client only gets
+// a generic message, so database errors never leak.
+func Respond(c *gin.Context, err error) {
+	e := From(err)
+	requestID := c.GetString("request_id")
+	if e.Code == CodeInternal {
+		log.Printf("request %s: %s %s: %v", requestID, c.Request.Method, c.Request.URL.Path, e)
+	}
+
+	locale := templates.MatchLocale(c.GetHeader("Accept-Language"))
+	set := templates.Default
+
+	fields := make([]FieldError, len(e.Fields))
+	for i, field := range e.Fields {
+		if field.Message == "" {
+			key := "validation." + field.Code
+			if !set.HasMessage(key) {
+				key = "validation.invalid"
+			}
+			field.Message = set.Message(locale, key, field)
+		}
+		fields[i] = field
+	}
+
+	var message string
+	switch {
+	case e.Key != "" && set.HasMessage(e.Key):
+		message = set.Message(locale, e.Key, e.Data)
+	case len(fields) > 0:
+		message = fields[0].Message
+	default:
+		message = set.Message(locale, "error."+e.Code, nil)
+	}
+
+	body := response.Error{
+		Code:      e.Code,
+		Message:   message,
+		RequestID: requestID,
+	}
+	if len(fields) > 0 {
+		body.Details = fields
+	}
+
+	response.Fail(c, e.Status, body)
+}
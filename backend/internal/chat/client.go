@@ -0,0 +1,194 @@
+package chat
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dottrip/fpt-swp/internal/models"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	writeWait      = 10 * time.Second
+	pongWait       = 60 * time.Second
+	pingPeriod     = (pongWait * 9) / 10
+	maxFrameSize   = 16 * 1024
+	sendBufferSize = 64
+)
+
+// Upgrader upgrades chat HTTP requests to WebSocket connections. Requests are
+// authenticated with a bearer token rather than cookies, so any origin may connect.
+var Upgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+	CheckOrigin:     func(r *http.Request) bool { return true },
+}
+
+// frameError is an error caused by the client's frame, safe to report back
+type frameError string
+
+func (e frameError) Error() string { return string(e) }
+
+// clientFrame is a frame sent by a client
+type clientFrame struct {
+	Type           string `json:"type"`
+	ConversationID int    `json:"conversation_id"`
+	Body           string `json:"body"`
+	ClientID       string `json:"client_id"`
+	MessageID      int    `json:"message_id"`
+	Typing         bool   `json:"typing"`
+}
+
+// Client is one WebSocket connection of an authenticated user
+type Client struct {
+	hub    *Hub
+	conn   *websocket.Conn
+	userID int
+	send   chan Event
+}
+
+// ServeConn runs a chat session for userID on an upgraded connection and
+// blocks until the connection closes
+func (h *Hub) ServeConn(conn *websocket.Conn, userID int) {
+	c := &Client{
+		hub:    h,
+		conn:   conn,
+		userID: userID,
+		send:   make(chan Event, sendBufferSize),
+	}
+
+	h.register(c)
+	go c.writePump()
+	c.readPump()
+}
+
+// deliver queues an event for the client, dropping the connection if it
+// cannot keep up rather than blocking the hub
+func (c *Client) deliver(event Event) {
+	select {
+	case c.send <- event:
+	default:
+		log.Printf("chat: dropping slow client of user %d", c.userID)
+		c.conn.Close()
+	}
+}
+
+// readPump handles frames from the client until the connection fails
+func (c *Client) readPump() {
+	defer func() {
+		c.hub.unregister(c)
+		close(c.send)
+		c.conn.Close()
+	}()
+
+	c.conn.SetReadLimit(maxFrameSize)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Printf("chat: read error for user %d: %v", c.userID, err)
+			}
+			return
+		}
+
+		var frame clientFrame
+		if err := json.Unmarshal(data, &frame); err != nil {
+			c.deliverError(frame, frameError("invalid frame"))
+			continue
+		}
+
+		if err := c.handle(frame); err != nil {
+			c.deliverError(frame, err)
+		}
+	}
+}
+
+// handle applies a single client frame
+func (c *Client) handle(frame clientFrame) error {
+	if frame.ConversationID == 0 {
+		return frameError("conversation_id is required")
+	}
+
+	switch frame.Type {
+	case EventMessage:
+		body := strings.TrimSpace(frame.Body)
+		if body == "" {
+			return frameError("message body is required")
+		}
+		if utf8.RuneCountInString(body) > models.MaxMessageLength {
+			return frameError("message is too long")
+		}
+		_, err := c.hub.SendMessage(c.userID, frame.ConversationID, frame.Body, frame.ClientID)
+		return err
+	case EventTyping:
+		return c.hub.SetTyping(c.userID, frame.ConversationID, frame.Typing)
+	case EventRead:
+		if frame.MessageID == 0 {
+			return frameError("message_id is required")
+		}
+		return c.hub.MarkRead(c.userID, frame.ConversationID, frame.MessageID)
+	default:
+		return frameError("unknown frame type")
+	}
+}
+
+// deliverError reports a failed frame back to the client only. Internal
+// errors are logged and replaced with a generic message.
+func (c *Client) deliverError(frame clientFrame, err error) {
+	var fe frameError
+	message := "failed to process request"
+
+	switch {
+	case errors.As(err, &fe):
+		message = fe.Error()
+	case errors.Is(err, models.ErrNotConversationMember), errors.Is(err, models.ErrMessageNotInConversation):
+		message = err.Error()
+	default:
+		log.Printf("chat: failed to handle %q frame from user %d: %v", frame.Type, c.userID, err)
+	}
+
+	c.deliver(Event{
+		Type:           EventError,
+		ConversationID: frame.ConversationID,
+		ClientID:       frame.ClientID,
+		Error:          message,
+	})
+}
+
+// writePump writes queued events and keepalive pings to the connection
+func (c *Client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case event, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.conn.WriteJSON(event); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,216 @@
+// Package chat implements real-time conversations over WebSocket. Messages
+// are persisted through the models package and fanned out to every API
+// replica through a realtime.Bus.
+package chat
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+
+	"github.com/dottrip/fpt-swp/internal/models"
+	"github.com/dottrip/fpt-swp/internal/realtime"
+)
+
+// busChannel is the bus channel used for chat fan-out
+const busChannel = "chat_events"
+
+// Event types exchanged with clients and across replicas
+const (
+	EventMessage = "message"
+	EventTyping  = "typing"
+	EventRead    = "read"
+	EventError   = "error"
+)
+
+// Event is a chat event delivered to the members of a conversation
+type Event struct {
+	Type           string          `json:"type"`
+	ConversationID int             `json:"conversation_id"`
+	UserID         int             `json:"user_id,omitempty"`
+	Message        *models.Message `json:"message,omitempty"`
+	MessageID      int             `json:"message_id,omitempty"`
+	Typing         *bool           `json:"typing,omitempty"`
+	ClientID       string          `json:"client_id,omitempty"` // echoed back so senders can match their own messages
+	Error          string          `json:"error,omitempty"`
+}
+
+// Hub tracks the WebSocket clients connected to this replica and delivers
+// bus events to the ones whose users belong to the event's conversation
+type Hub struct {
+	bus     realtime.Bus
+	mu      sync.RWMutex
+	clients map[int]map[*Client]struct{} // keyed by user ID
+}
+
+// DefaultHub is the hub used by the HTTP handlers
+var DefaultHub *Hub
+
+// Init creates DefaultHub on the bus matching the configured database
+func Init() {
+	bus, err := realtime.New(busChannel)
+	if err != nil {
+		log.Fatal("Failed to start chat event bus:", err)
+	}
+
+	DefaultHub = NewHub(bus)
+	go DefaultHub.Run()
+}
+
+// NewHub creates a hub on top of bus
+func NewHub(bus realtime.Bus) *Hub {
+	return &Hub{
+		bus:     bus,
+		clients: make(map[int]map[*Client]struct{}),
+	}
+}
+
+// Run delivers bus events to local clients until the bus is closed
+func (h *Hub) Run() {
+	for payload := range h.bus.Messages() {
+		var event Event
+		if err := json.Unmarshal(payload, &event); err != nil {
+			log.Printf("chat: invalid event payload: %v", err)
+			continue
+		}
+
+		// Messages too large for the bus arrive as references
+		if event.Type == EventMessage && event.Message == nil && event.MessageID > 0 {
+			message, err := models.GetMessageByID(event.MessageID)
+			if err != nil {
+				log.Printf("chat: failed to load message %d: %v", event.MessageID, err)
+				continue
+			}
+			event.Message = message
+		}
+
+		h.dispatch(event)
+	}
+}
+
+// Publish sends an event to every replica
+func (h *Hub) Publish(event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	err = h.bus.Publish(payload)
+	if errors.Is(err, realtime.ErrPayloadTooLarge) && event.Message != nil {
+		// Send a reference and let each replica load the message itself
+		ref := event
+		ref.MessageID = event.Message.ID
+		ref.Message = nil
+		if payload, err = json.Marshal(ref); err != nil {
+			return err
+		}
+		err = h.bus.Publish(payload)
+	}
+
+	return err
+}
+
+func (h *Hub) register(c *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.clients[c.userID] == nil {
+		h.clients[c.userID] = make(map[*Client]struct{})
+	}
+	h.clients[c.userID][c] = struct{}{}
+}
+
+func (h *Hub) unregister(c *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if clients, ok := h.clients[c.userID]; ok {
+		delete(clients, c)
+		if len(clients) == 0 {
+			delete(h.clients, c.userID)
+		}
+	}
+}
+
+// dispatch delivers an event to the local clients of the conversation's members
+func (h *Hub) dispatch(event Event) {
+	memberIDs, err := models.GetConversationMemberIDs(event.ConversationID)
+	if err != nil {
+		log.Printf("chat: failed to load members of conversation %d: %v", event.ConversationID, err)
+		return
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, userID := range memberIDs {
+		for c := range h.clients[userID] {
+			c.deliver(event)
+		}
+	}
+}
+
+// SendMessage stores a message from userID and publishes it to the conversation
+func (h *Hub) SendMessage(userID, conversationID int, body, clientID string) (*models.Message, error) {
+	message := &models.Message{
+		ConversationID: conversationID,
+		SenderID:       userID,
+		Body:           body,
+	}
+	if err := message.Create(); err != nil {
+		return nil, err
+	}
+
+	err := h.Publish(Event{
+		Type:           EventMessage,
+		ConversationID: conversationID,
+		UserID:         userID,
+		Message:        message,
+		ClientID:       clientID,
+	})
+	if err != nil {
+		// The message is stored; clients will still see it when they page history
+		log.Printf("chat: failed to publish message %d: %v", message.ID, err)
+	}
+
+	return message, nil
+}
+
+// MarkRead records a read receipt and publishes it to the conversation
+func (h *Hub) MarkRead(userID, conversationID, messageID int) error {
+	if err := models.MarkConversationRead(conversationID, userID, messageID); err != nil {
+		return err
+	}
+
+	err := h.Publish(Event{
+		Type:           EventRead,
+		ConversationID: conversationID,
+		UserID:         userID,
+		MessageID:      messageID,
+	})
+	if err != nil {
+		// The marker is stored; other clients pick it up when they reload
+		log.Printf("chat: failed to publish read receipt of user %d: %v", userID, err)
+	}
+
+	return nil
+}
+
+// SetTyping publishes a typing indicator. Typing state is not persisted.
+func (h *Hub) SetTyping(userID, conversationID int, typing bool) error {
+	isMember, err := models.IsConversationMember(conversationID, userID)
+	if err != nil {
+		return err
+	}
+	if !isMember {
+		return models.ErrNotConversationMember
+	}
+
+	return h.Publish(Event{
+		Type:           EventTyping,
+		ConversationID: conversationID,
+		UserID:         userID,
+		Typing:         &typing,
+	})
+}
@@ -14,6 +14,12 @@ import (
 // DB is the database connection
 var DB *sql.DB
 
+// FullTextSearch reports whether blog posts can be searched with the
+// database's full-text index. PostgreSQL needs the unaccent extension;
+// SQLite needs FTS5, which the driver only has when built with
+// -tags sqlite_fts5.
+var FullTextSearch bool
+
 // InitDB initializes the database connection
 func InitDB() {
 	var err error
@@ -59,10 +65,9 @@ func initSQLite() {
 	}
 }
 
-// initPostgreSQL initializes PostgreSQL database connection
-func initPostgreSQL() {
-	var err error
-
+// PostgresDSN builds the PostgreSQL connection string from environment variables.
+// It is also used by components that need their own connection, such as LISTEN/NOTIFY listeners.
+func PostgresDSN() string {
 	// Get database connection parameters from environment variables
 	dbHost := getEnv("DB_HOST", "localhost")
 	dbPort := getEnv("DB_PORT", "5432")
@@ -72,11 +77,16 @@ func initPostgreSQL() {
 	sslMode := getEnv("DB_SSL_MODE", "disable")
 
 	// Create database connection string
-	dbURI := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
 		dbHost, dbPort, dbUser, dbPassword, dbName, sslMode)
+}
+
+// initPostgreSQL initializes PostgreSQL database connection
+func initPostgreSQL() {
+	var err error
 
 	// Connect to database
-	DB, err = sql.Open("postgres", dbURI)
+	DB, err = sql.Open("postgres", PostgresDSN())
 	if err != nil {
 		log.Fatal("Failed to connect to PostgreSQL database:", err)
 	}
@@ -97,6 +107,7 @@ func createTables() {
 			email VARCHAR(100) UNIQUE NOT NULL,
 			password VARCHAR(255) NOT NULL,
 			role VARCHAR(20) DEFAULT 'patient',
+			phone VARCHAR(20),
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 		);`
@@ -108,6 +119,7 @@ func createTables() {
 			email VARCHAR(100) UNIQUE NOT NULL,
 			password VARCHAR(255) NOT NULL,
 			role VARCHAR(20) DEFAULT 'patient',
+			phone VARCHAR(20),
 			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
 			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 		);`
@@ -129,10 +141,66 @@ func createTables() {
 	// Try to add the column (it might already exist, so we ignore errors)
 	DB.Exec(addRoleColumn)
 
+	// Add phone column for SMS notifications
+	if dbType == "sqlite" {
+		DB.Exec(`ALTER TABLE users ADD COLUMN phone VARCHAR(20);`)
+	} else {
+		DB.Exec(`ALTER TABLE users ADD COLUMN IF NOT EXISTS phone VARCHAR(20);`)
+	}
+
 	// Create default admin account if it doesn't exist
 	createDefaultAdmin()
 
-	// Create blog_posts table
+	// Blog categories and tags, created first for blog_posts to refer to.
+	// A post has at most one category and any number of tags, linked through
+	// blog_post_tags; both are found by slug.
+	var taxonomyTables []string
+	if dbType == "sqlite" {
+		taxonomyTables = []string{`
+		CREATE TABLE IF NOT EXISTS blog_categories (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name VARCHAR(100) NOT NULL,
+			slug VARCHAR(100) NOT NULL UNIQUE,
+			description TEXT NOT NULL DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);`, `
+		CREATE TABLE IF NOT EXISTS blog_tags (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name VARCHAR(100) NOT NULL,
+			slug VARCHAR(100) NOT NULL UNIQUE,
+			description TEXT NOT NULL DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);`}
+	} else {
+		taxonomyTables = []string{`
+		CREATE TABLE IF NOT EXISTS blog_categories (
+			id SERIAL PRIMARY KEY,
+			name VARCHAR(100) NOT NULL,
+			slug VARCHAR(100) NOT NULL UNIQUE,
+			description TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		);`, `
+		CREATE TABLE IF NOT EXISTS blog_tags (
+			id SERIAL PRIMARY KEY,
+			name VARCHAR(100) NOT NULL,
+			slug VARCHAR(100) NOT NULL UNIQUE,
+			description TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		);`}
+	}
+	for _, table := range taxonomyTables {
+		if _, err := DB.Exec(table); err != nil {
+			log.Fatal("Failed to create blog taxonomy tables:", err)
+		}
+	}
+
+	// Create blog_posts table. category and tags hold the free-text values
+	// posts had before categories and tags got tables, until they are
+	// migrated.
 	var blogTable string
 
 	if dbType == "sqlite" {
@@ -140,7 +208,8 @@ func createTables() {
 		CREATE TABLE IF NOT EXISTS blog_posts (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			title VARCHAR(255) NOT NULL,
-			content TEXT NOT NULL,
+			content_markdown TEXT NOT NULL,
+			content_html TEXT NOT NULL DEFAULT '',
 			excerpt TEXT,
 			thumbnail VARCHAR(500),
 			author_id INTEGER NOT NULL,
@@ -148,17 +217,31 @@ func createTables() {
 			category VARCHAR(100),
 			tags TEXT,
 			view_count INTEGER DEFAULT 0,
+			version INTEGER NOT NULL DEFAULT 1,
+			slug VARCHAR(255),
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			published_at DATETIME,
-			FOREIGN KEY (author_id) REFERENCES users(id) ON DELETE CASCADE
+			publish_at DATETIME,
+			unpublish_at DATETIME,
+			reviewer_id INTEGER,
+			reviewed_by INTEGER,
+			reviewed_by_name VARCHAR(255),
+			reviewed_at DATETIME,
+			comments_enabled BOOLEAN NOT NULL DEFAULT 1,
+			category_id INTEGER,
+			FOREIGN KEY (author_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY (category_id) REFERENCES blog_categories(id) ON DELETE SET NULL,
+			FOREIGN KEY (reviewer_id) REFERENCES users(id) ON DELETE SET NULL,
+			FOREIGN KEY (reviewed_by) REFERENCES users(id) ON DELETE SET NULL
 		);`
 	} else {
 		blogTable = `
 		CREATE TABLE IF NOT EXISTS blog_posts (
 			id SERIAL PRIMARY KEY,
 			title VARCHAR(255) NOT NULL,
-			content TEXT NOT NULL,
+			content_markdown TEXT NOT NULL,
+			content_html TEXT NOT NULL DEFAULT '',
 			excerpt TEXT,
 			thumbnail VARCHAR(500),
 			author_id INTEGER NOT NULL,
@@ -166,9 +249,20 @@ func createTables() {
 			category VARCHAR(100),
 			tags TEXT,
 			view_count INTEGER DEFAULT 0,
+			version INTEGER NOT NULL DEFAULT 1,
+			slug VARCHAR(255),
 			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
 			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
 			published_at TIMESTAMP WITH TIME ZONE,
+			publish_at TIMESTAMP WITH TIME ZONE,
+			unpublish_at TIMESTAMP WITH TIME ZONE,
+			reviewer_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+			reviewed_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+			reviewed_by_name VARCHAR(255),
+			reviewed_at TIMESTAMP WITH TIME ZONE,
+			comments_enabled BOOLEAN NOT NULL DEFAULT TRUE,
+			category_id INTEGER REFERENCES blog_categories(id) ON DELETE SET NULL,
+			search_vector tsvector,
 			FOREIGN KEY (author_id) REFERENCES users(id) ON DELETE CASCADE
 		);`
 	}
@@ -178,6 +272,296 @@ func createTables() {
 		log.Fatal("Failed to create blog_posts table:", err)
 	}
 
+	// Add version column for optimistic concurrency control
+	if dbType == "sqlite" {
+		DB.Exec(`ALTER TABLE blog_posts ADD COLUMN version INTEGER NOT NULL DEFAULT 1;`)
+	} else {
+		DB.Exec(`ALTER TABLE blog_posts ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;`)
+	}
+
+	// Content is written in Markdown and cached as sanitized HTML. Posts from
+	// before keep their text as the Markdown source; models render the HTML.
+	DB.Exec(`ALTER TABLE blog_posts RENAME COLUMN content TO content_markdown;`)
+	if dbType == "sqlite" {
+		DB.Exec(`ALTER TABLE blog_posts ADD COLUMN content_html TEXT NOT NULL DEFAULT '';`)
+	} else {
+		DB.Exec(`ALTER TABLE blog_posts ADD COLUMN IF NOT EXISTS content_html TEXT NOT NULL DEFAULT '';`)
+	}
+
+	// Add slug column for readable URLs; unique through idx_blog_posts_slug.
+	// Slugs a post had before are kept in blog_post_slugs to redirect from.
+	var slugTable string
+	if dbType == "sqlite" {
+		DB.Exec(`ALTER TABLE blog_posts ADD COLUMN slug VARCHAR(255);`)
+		slugTable = `
+		CREATE TABLE IF NOT EXISTS blog_post_slugs (
+			slug VARCHAR(255) PRIMARY KEY,
+			post_id INTEGER NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (post_id) REFERENCES blog_posts(id) ON DELETE CASCADE
+		);`
+	} else {
+		DB.Exec(`ALTER TABLE blog_posts ADD COLUMN IF NOT EXISTS slug VARCHAR(255);`)
+		slugTable = `
+		CREATE TABLE IF NOT EXISTS blog_post_slugs (
+			slug VARCHAR(255) PRIMARY KEY,
+			post_id INTEGER NOT NULL REFERENCES blog_posts(id) ON DELETE CASCADE,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		);`
+	}
+	if _, err := DB.Exec(slugTable); err != nil {
+		log.Fatal("Failed to create blog_post_slugs table:", err)
+	}
+
+	// Scheduled posts go live at publish_at; published posts with an
+	// unpublish_at are archived then
+	if dbType == "sqlite" {
+		DB.Exec(`ALTER TABLE blog_posts ADD COLUMN publish_at DATETIME;`)
+		DB.Exec(`ALTER TABLE blog_posts ADD COLUMN unpublish_at DATETIME;`)
+	} else {
+		DB.Exec(`ALTER TABLE blog_posts ADD COLUMN IF NOT EXISTS publish_at TIMESTAMP WITH TIME ZONE;`)
+		DB.Exec(`ALTER TABLE blog_posts ADD COLUMN IF NOT EXISTS unpublish_at TIMESTAMP WITH TIME ZONE;`)
+	}
+
+	// Every saved version of a post is kept as a revision, numbered by the
+	// post's version, so edits can be compared and undone
+	var revisionTable string
+	if dbType == "sqlite" {
+		revisionTable = `
+		CREATE TABLE IF NOT EXISTS blog_post_revisions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			post_id INTEGER NOT NULL,
+			version INTEGER NOT NULL,
+			title VARCHAR(255) NOT NULL,
+			content_markdown TEXT NOT NULL,
+			excerpt TEXT,
+			status VARCHAR(20) NOT NULL,
+			editor_id INTEGER,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (post_id, version),
+			FOREIGN KEY (post_id) REFERENCES blog_posts(id) ON DELETE CASCADE,
+			FOREIGN KEY (editor_id) REFERENCES users(id) ON DELETE SET NULL
+		);`
+	} else {
+		revisionTable = `
+		CREATE TABLE IF NOT EXISTS blog_post_revisions (
+			id SERIAL PRIMARY KEY,
+			post_id INTEGER NOT NULL REFERENCES blog_posts(id) ON DELETE CASCADE,
+			version INTEGER NOT NULL,
+			title VARCHAR(255) NOT NULL,
+			content_markdown TEXT NOT NULL,
+			excerpt TEXT,
+			status VARCHAR(20) NOT NULL,
+			editor_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (post_id, version)
+		);`
+	}
+	if _, err := DB.Exec(revisionTable); err != nil {
+		log.Fatal("Failed to create blog_post_revisions table:", err)
+	}
+
+	// Posts from before revisions existed start their history at the
+	// version they are at
+	_, err = DB.Exec(`
+		INSERT INTO blog_post_revisions (post_id, version, title, content_markdown, excerpt, status, editor_id, created_at)
+		SELECT id, version, title, content_markdown, excerpt, COALESCE(status, 'draft'), author_id, updated_at
+		FROM blog_posts bp
+		WHERE NOT EXISTS (SELECT 1 FROM blog_post_revisions r WHERE r.post_id = bp.id)`)
+	if err != nil {
+		log.Printf("Warning: failed to record initial blog post revisions: %v", err)
+	}
+
+	// Medical review: the doctor assigned to review a post, the doctor who
+	// approved its current content, and the comments made during review
+	var reviewTable string
+	if dbType == "sqlite" {
+		DB.Exec(`ALTER TABLE blog_posts ADD COLUMN reviewer_id INTEGER REFERENCES users(id) ON DELETE SET NULL;`)
+		DB.Exec(`ALTER TABLE blog_posts ADD COLUMN reviewed_by INTEGER REFERENCES users(id) ON DELETE SET NULL;`)
+		DB.Exec(`ALTER TABLE blog_posts ADD COLUMN reviewed_by_name VARCHAR(255);`)
+		DB.Exec(`ALTER TABLE blog_posts ADD COLUMN reviewed_at DATETIME;`)
+		reviewTable = `
+		CREATE TABLE IF NOT EXISTS blog_post_review_comments (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			post_id INTEGER NOT NULL,
+			version INTEGER NOT NULL,
+			author_id INTEGER,
+			action VARCHAR(20) NOT NULL DEFAULT 'comment',
+			body TEXT NOT NULL DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (post_id) REFERENCES blog_posts(id) ON DELETE CASCADE,
+			FOREIGN KEY (author_id) REFERENCES users(id) ON DELETE SET NULL
+		);`
+	} else {
+		DB.Exec(`ALTER TABLE blog_posts ADD COLUMN IF NOT EXISTS reviewer_id INTEGER REFERENCES users(id) ON DELETE SET NULL;`)
+		DB.Exec(`ALTER TABLE blog_posts ADD COLUMN IF NOT EXISTS reviewed_by INTEGER REFERENCES users(id) ON DELETE SET NULL;`)
+		DB.Exec(`ALTER TABLE blog_posts ADD COLUMN IF NOT EXISTS reviewed_by_name VARCHAR(255);`)
+		DB.Exec(`ALTER TABLE blog_posts ADD COLUMN IF NOT EXISTS reviewed_at TIMESTAMP WITH TIME ZONE;`)
+		reviewTable = `
+		CREATE TABLE IF NOT EXISTS blog_post_review_comments (
+			id SERIAL PRIMARY KEY,
+			post_id INTEGER NOT NULL REFERENCES blog_posts(id) ON DELETE CASCADE,
+			version INTEGER NOT NULL,
+			author_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+			action VARCHAR(20) NOT NULL DEFAULT 'comment',
+			body TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		);`
+	}
+	if _, err := DB.Exec(reviewTable); err != nil {
+		log.Fatal("Failed to create blog_post_review_comments table:", err)
+	}
+
+	// Reader comments, threaded through parent_id. New comments are pending,
+	// approved or spam as the spam classifier decides; staff moderate the
+	// rest and may ban authors from commenting.
+	var commentTables []string
+	if dbType == "sqlite" {
+		DB.Exec(`ALTER TABLE blog_posts ADD COLUMN comments_enabled BOOLEAN NOT NULL DEFAULT 1;`)
+		commentTables = []string{`
+		CREATE TABLE IF NOT EXISTS blog_comments (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			post_id INTEGER NOT NULL,
+			parent_id INTEGER,
+			author_id INTEGER NOT NULL,
+			body TEXT NOT NULL,
+			status VARCHAR(20) NOT NULL DEFAULT 'pending',
+			spam_reason VARCHAR(255) NOT NULL DEFAULT '',
+			moderated_by INTEGER,
+			moderated_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (post_id) REFERENCES blog_posts(id) ON DELETE CASCADE,
+			FOREIGN KEY (parent_id) REFERENCES blog_comments(id) ON DELETE CASCADE,
+			FOREIGN KEY (author_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY (moderated_by) REFERENCES users(id) ON DELETE SET NULL
+		);`, `
+		CREATE TABLE IF NOT EXISTS blog_comment_bans (
+			user_id INTEGER PRIMARY KEY,
+			banned_by INTEGER,
+			reason TEXT NOT NULL DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY (banned_by) REFERENCES users(id) ON DELETE SET NULL
+		);`}
+	} else {
+		DB.Exec(`ALTER TABLE blog_posts ADD COLUMN IF NOT EXISTS comments_enabled BOOLEAN NOT NULL DEFAULT TRUE;`)
+		commentTables = []string{`
+		CREATE TABLE IF NOT EXISTS blog_comments (
+			id SERIAL PRIMARY KEY,
+			post_id INTEGER NOT NULL REFERENCES blog_posts(id) ON DELETE CASCADE,
+			parent_id INTEGER REFERENCES blog_comments(id) ON DELETE CASCADE,
+			author_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			body TEXT NOT NULL,
+			status VARCHAR(20) NOT NULL DEFAULT 'pending',
+			spam_reason VARCHAR(255) NOT NULL DEFAULT '',
+			moderated_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+			moderated_at TIMESTAMP WITH TIME ZONE,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		);`, `
+		CREATE TABLE IF NOT EXISTS blog_comment_bans (
+			user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+			banned_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+			reason TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		);`}
+	}
+	for _, table := range commentTables {
+		if _, err := DB.Exec(table); err != nil {
+			log.Fatal("Failed to create blog comment tables:", err)
+		}
+	}
+
+	// Link posts to their category and tags
+	var postTagsTable string
+	if dbType == "sqlite" {
+		DB.Exec(`ALTER TABLE blog_posts ADD COLUMN category_id INTEGER REFERENCES blog_categories(id) ON DELETE SET NULL;`)
+		postTagsTable = `
+		CREATE TABLE IF NOT EXISTS blog_post_tags (
+			post_id INTEGER NOT NULL,
+			tag_id INTEGER NOT NULL,
+			PRIMARY KEY (post_id, tag_id),
+			FOREIGN KEY (post_id) REFERENCES blog_posts(id) ON DELETE CASCADE,
+			FOREIGN KEY (tag_id) REFERENCES blog_tags(id) ON DELETE CASCADE
+		);`
+	} else {
+		DB.Exec(`ALTER TABLE blog_posts ADD COLUMN IF NOT EXISTS category_id INTEGER REFERENCES blog_categories(id) ON DELETE SET NULL;`)
+		postTagsTable = `
+		CREATE TABLE IF NOT EXISTS blog_post_tags (
+			post_id INTEGER NOT NULL REFERENCES blog_posts(id) ON DELETE CASCADE,
+			tag_id INTEGER NOT NULL REFERENCES blog_tags(id) ON DELETE CASCADE,
+			PRIMARY KEY (post_id, tag_id)
+		);`
+	}
+	if _, err := DB.Exec(postTagsTable); err != nil {
+		log.Fatal("Failed to create blog_post_tags table:", err)
+	}
+
+	// Full-text search over post titles and bodies, without regard to
+	// accents. SQLite keeps the text, folded by models, in an FTS5 table
+	// whose rowid is the post ID; PostgreSQL keeps a weighted tsvector on
+	// the post, built with a configuration that runs words through unaccent.
+	if dbType == "sqlite" {
+		_, err = DB.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS blog_posts_fts USING fts5(title, body, tokenize = 'unicode61 remove_diacritics 2');`)
+		if err != nil {
+			log.Printf("Warning: Blog search falls back to LIKE; build with -tags sqlite_fts5 for full-text search: %v", err)
+		}
+		FullTextSearch = err == nil
+	} else {
+		_, unaccentErr := DB.Exec(`CREATE EXTENSION IF NOT EXISTS unaccent;`)
+		searchConfig := `
+		DO $$
+		BEGIN
+			IF NOT EXISTS (SELECT 1 FROM pg_ts_config WHERE cfgname = 'blog_search') THEN
+				CREATE TEXT SEARCH CONFIGURATION blog_search (COPY = simple);
+			END IF;
+			IF EXISTS (SELECT 1 FROM pg_ts_dict WHERE dictname = 'unaccent') THEN
+				ALTER TEXT SEARCH CONFIGURATION blog_search ALTER MAPPING FOR hword, hword_part, word WITH unaccent, simple;
+			END IF;
+		END
+		$$;`
+		if _, err := DB.Exec(searchConfig); err != nil {
+			log.Fatal("Failed to create blog_search text search configuration:", err)
+		}
+		_, err = DB.Exec(`ALTER TABLE blog_posts ADD COLUMN IF NOT EXISTS search_vector tsvector;`)
+		if err == nil {
+			_, err = DB.Exec(`CREATE INDEX IF NOT EXISTS idx_blog_posts_search ON blog_posts USING GIN (search_vector);`)
+		}
+		if unaccentErr != nil && err == nil {
+			err = fmt.Errorf("unaccent extension: %w", unaccentErr)
+		}
+		if err != nil {
+			log.Printf("Warning: Blog search falls back to LIKE: %v", err)
+		}
+		FullTextSearch = err == nil
+	}
+
+	// Daily view counts of blog posts by referring site ('' for direct
+	// visits). view_count on the post stays the all-time total.
+	var viewsTable string
+	if dbType == "sqlite" {
+		viewsTable = `
+		CREATE TABLE IF NOT EXISTS blog_post_views (
+			post_id INTEGER NOT NULL,
+			day DATE NOT NULL,
+			referrer VARCHAR(255) NOT NULL DEFAULT '',
+			views INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (post_id, day, referrer),
+			FOREIGN KEY (post_id) REFERENCES blog_posts(id) ON DELETE CASCADE
+		);`
+	} else {
+		viewsTable = `
+		CREATE TABLE IF NOT EXISTS blog_post_views (
+			post_id INTEGER NOT NULL REFERENCES blog_posts(id) ON DELETE CASCADE,
+			day DATE NOT NULL,
+			referrer VARCHAR(255) NOT NULL DEFAULT '',
+			views INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (post_id, day, referrer)
+		);`
+	}
+	if _, err := DB.Exec(viewsTable); err != nil {
+		log.Fatal("Failed to create blog_post_views table:", err)
+	}
+
 	// Create doctors table
 	var doctorTable string
 
@@ -203,6 +587,7 @@ func createTables() {
 			consultation_price INTEGER DEFAULT 0,
 			patient_count INTEGER DEFAULT 0,
 			appointment_count INTEGER DEFAULT 0,
+			version INTEGER NOT NULL DEFAULT 1,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 		);`
@@ -228,6 +613,7 @@ func createTables() {
 			consultation_price INTEGER DEFAULT 0,
 			patient_count INTEGER DEFAULT 0,
 			appointment_count INTEGER DEFAULT 0,
+			version INTEGER NOT NULL DEFAULT 1,
 			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
 			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 		);`
@@ -238,6 +624,626 @@ func createTables() {
 		log.Fatal("Failed to create doctors table:", err)
 	}
 
+	// Add version column for optimistic concurrency control
+	if dbType == "sqlite" {
+		DB.Exec(`ALTER TABLE doctors ADD COLUMN version INTEGER NOT NULL DEFAULT 1;`)
+	} else {
+		DB.Exec(`ALTER TABLE doctors ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;`)
+	}
+
+	// Create prescription and visit summary tables
+	var documentTables []string
+
+	if dbType == "sqlite" {
+		documentTables = []string{`
+		CREATE TABLE IF NOT EXISTS prescriptions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			code VARCHAR(32) UNIQUE NOT NULL,
+			doctor_id INTEGER NOT NULL,
+			patient_id INTEGER,
+			patient_name VARCHAR(255) NOT NULL,
+			patient_date_of_birth VARCHAR(20),
+			patient_gender VARCHAR(10),
+			patient_phone VARCHAR(20),
+			patient_address TEXT,
+			diagnosis TEXT,
+			notes TEXT,
+			status VARCHAR(20) DEFAULT 'active',
+			next_visit VARCHAR(20),
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (doctor_id) REFERENCES doctors(id),
+			FOREIGN KEY (patient_id) REFERENCES users(id) ON DELETE SET NULL
+		);`, `
+		CREATE TABLE IF NOT EXISTS prescription_items (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			prescription_id INTEGER NOT NULL,
+			drug_name VARCHAR(255) NOT NULL,
+			dosage VARCHAR(100),
+			frequency VARCHAR(100),
+			duration VARCHAR(100),
+			quantity INTEGER DEFAULT 0,
+			unit VARCHAR(50),
+			instructions TEXT,
+			FOREIGN KEY (prescription_id) REFERENCES prescriptions(id) ON DELETE CASCADE
+		);`, `
+		CREATE TABLE IF NOT EXISTS visit_summaries (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			code VARCHAR(32) UNIQUE NOT NULL,
+			doctor_id INTEGER NOT NULL,
+			prescription_id INTEGER,
+			patient_id INTEGER,
+			patient_name VARCHAR(255) NOT NULL,
+			patient_date_of_birth VARCHAR(20),
+			patient_gender VARCHAR(10),
+			patient_phone VARCHAR(20),
+			patient_address TEXT,
+			visit_date DATETIME NOT NULL,
+			chief_complaint TEXT,
+			findings TEXT,
+			diagnosis TEXT,
+			treatment_plan TEXT,
+			follow_up_date VARCHAR(20),
+			notes TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (doctor_id) REFERENCES doctors(id),
+			FOREIGN KEY (prescription_id) REFERENCES prescriptions(id) ON DELETE SET NULL,
+			FOREIGN KEY (patient_id) REFERENCES users(id) ON DELETE SET NULL
+		);`}
+	} else {
+		documentTables = []string{`
+		CREATE TABLE IF NOT EXISTS prescriptions (
+			id SERIAL PRIMARY KEY,
+			code VARCHAR(32) UNIQUE NOT NULL,
+			doctor_id INTEGER NOT NULL REFERENCES doctors(id),
+			patient_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+			patient_name VARCHAR(255) NOT NULL,
+			patient_date_of_birth VARCHAR(20),
+			patient_gender VARCHAR(10),
+			patient_phone VARCHAR(20),
+			patient_address TEXT,
+			diagnosis TEXT,
+			notes TEXT,
+			status VARCHAR(20) DEFAULT 'active',
+			next_visit VARCHAR(20),
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		);`, `
+		CREATE TABLE IF NOT EXISTS prescription_items (
+			id SERIAL PRIMARY KEY,
+			prescription_id INTEGER NOT NULL REFERENCES prescriptions(id) ON DELETE CASCADE,
+			drug_name VARCHAR(255) NOT NULL,
+			dosage VARCHAR(100),
+			frequency VARCHAR(100),
+			duration VARCHAR(100),
+			quantity INTEGER DEFAULT 0,
+			unit VARCHAR(50),
+			instructions TEXT
+		);`, `
+		CREATE TABLE IF NOT EXISTS visit_summaries (
+			id SERIAL PRIMARY KEY,
+			code VARCHAR(32) UNIQUE NOT NULL,
+			doctor_id INTEGER NOT NULL REFERENCES doctors(id),
+			prescription_id INTEGER REFERENCES prescriptions(id) ON DELETE SET NULL,
+			patient_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+			patient_name VARCHAR(255) NOT NULL,
+			patient_date_of_birth VARCHAR(20),
+			patient_gender VARCHAR(10),
+			patient_phone VARCHAR(20),
+			patient_address TEXT,
+			visit_date TIMESTAMP WITH TIME ZONE NOT NULL,
+			chief_complaint TEXT,
+			findings TEXT,
+			diagnosis TEXT,
+			treatment_plan TEXT,
+			follow_up_date VARCHAR(20),
+			notes TEXT,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		);`}
+	}
+
+	for _, table := range documentTables {
+		if _, err = DB.Exec(table); err != nil {
+			log.Fatal("Failed to create prescription tables:", err)
+		}
+	}
+
+	// Create chat tables
+	var chatTables []string
+
+	if dbType == "sqlite" {
+		chatTables = []string{`
+		CREATE TABLE IF NOT EXISTS conversations (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			type VARCHAR(20) DEFAULT 'direct',
+			title VARCHAR(255),
+			created_by INTEGER NOT NULL,
+			last_message_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE CASCADE
+		);`, `
+		CREATE TABLE IF NOT EXISTS conversation_members (
+			conversation_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL,
+			last_read_message_id INTEGER DEFAULT 0,
+			joined_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (conversation_id, user_id),
+			FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);`, `
+		CREATE TABLE IF NOT EXISTS messages (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			conversation_id INTEGER NOT NULL,
+			sender_id INTEGER NOT NULL,
+			body TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE,
+			FOREIGN KEY (sender_id) REFERENCES users(id) ON DELETE CASCADE
+		);`}
+	} else {
+		chatTables = []string{`
+		CREATE TABLE IF NOT EXISTS conversations (
+			id SERIAL PRIMARY KEY,
+			type VARCHAR(20) DEFAULT 'direct',
+			title VARCHAR(255),
+			created_by INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			last_message_at TIMESTAMP WITH TIME ZONE,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		);`, `
+		CREATE TABLE IF NOT EXISTS conversation_members (
+			conversation_id INTEGER NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			last_read_message_id INTEGER DEFAULT 0,
+			joined_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (conversation_id, user_id)
+		);`, `
+		CREATE TABLE IF NOT EXISTS messages (
+			id SERIAL PRIMARY KEY,
+			conversation_id INTEGER NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+			sender_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			body TEXT NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		);`}
+	}
+
+	for _, table := range chatTables {
+		if _, err = DB.Exec(table); err != nil {
+			log.Fatal("Failed to create chat tables:", err)
+		}
+	}
+
+	// Create consultation_sessions table
+	var consultationTable string
+
+	if dbType == "sqlite" {
+		consultationTable = `
+		CREATE TABLE IF NOT EXISTS consultation_sessions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			doctor_id INTEGER NOT NULL,
+			patient_id INTEGER NOT NULL,
+			mode VARCHAR(20) DEFAULT 'video',
+			status VARCHAR(20) DEFAULT 'waiting',
+			conversation_id INTEGER,
+			started_at DATETIME,
+			ended_at DATETIME,
+			duration_seconds INTEGER DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (doctor_id) REFERENCES doctors(id),
+			FOREIGN KEY (patient_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE SET NULL
+		);`
+	} else {
+		consultationTable = `
+		CREATE TABLE IF NOT EXISTS consultation_sessions (
+			id SERIAL PRIMARY KEY,
+			doctor_id INTEGER NOT NULL REFERENCES doctors(id),
+			patient_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			mode VARCHAR(20) DEFAULT 'video',
+			status VARCHAR(20) DEFAULT 'waiting',
+			conversation_id INTEGER REFERENCES conversations(id) ON DELETE SET NULL,
+			started_at TIMESTAMP WITH TIME ZONE,
+			ended_at TIMESTAMP WITH TIME ZONE,
+			duration_seconds INTEGER DEFAULT 0,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		);`
+	}
+
+	_, err = DB.Exec(consultationTable)
+	if err != nil {
+		log.Fatal("Failed to create consultation_sessions table:", err)
+	}
+
+	// Create consultation_requests table (the triage queue)
+	var consultationRequestTable string
+
+	if dbType == "sqlite" {
+		consultationRequestTable = `
+		CREATE TABLE IF NOT EXISTS consultation_requests (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			patient_id INTEGER NOT NULL,
+			specialty VARCHAR(100) NOT NULL,
+			symptoms TEXT NOT NULL,
+			mode VARCHAR(20) DEFAULT 'video',
+			priority VARCHAR(20) DEFAULT 'medium',
+			priority_source VARCHAR(20) DEFAULT 'auto',
+			status VARCHAR(20) DEFAULT 'queued',
+			claimed_by INTEGER,
+			claimed_at DATETIME,
+			completed_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (patient_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY (claimed_by) REFERENCES doctors(id) ON DELETE SET NULL
+		);`
+	} else {
+		consultationRequestTable = `
+		CREATE TABLE IF NOT EXISTS consultation_requests (
+			id SERIAL PRIMARY KEY,
+			patient_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			specialty VARCHAR(100) NOT NULL,
+			symptoms TEXT NOT NULL,
+			mode VARCHAR(20) DEFAULT 'video',
+			priority VARCHAR(20) DEFAULT 'medium',
+			priority_source VARCHAR(20) DEFAULT 'auto',
+			status VARCHAR(20) DEFAULT 'queued',
+			claimed_by INTEGER REFERENCES doctors(id) ON DELETE SET NULL,
+			claimed_at TIMESTAMP WITH TIME ZONE,
+			completed_at TIMESTAMP WITH TIME ZONE,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		);`
+	}
+
+	_, err = DB.Exec(consultationRequestTable)
+	if err != nil {
+		log.Fatal("Failed to create consultation_requests table:", err)
+	}
+
+	// Create attachments table
+	var attachmentTable string
+
+	if dbType == "sqlite" {
+		attachmentTable = `
+		CREATE TABLE IF NOT EXISTS attachments (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			owner_id INTEGER NOT NULL,
+			context VARCHAR(30) DEFAULT 'general',
+			context_id INTEGER,
+			filename VARCHAR(255) NOT NULL,
+			content_type VARCHAR(150) NOT NULL,
+			size INTEGER NOT NULL,
+			sha256 CHAR(64) NOT NULL,
+			storage_key VARCHAR(255) NOT NULL,
+			thumbnail_key VARCHAR(255),
+			width INTEGER DEFAULT 0,
+			height INTEGER DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (owner_id) REFERENCES users(id) ON DELETE CASCADE
+		);`
+	} else {
+		attachmentTable = `
+		CREATE TABLE IF NOT EXISTS attachments (
+			id SERIAL PRIMARY KEY,
+			owner_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			context VARCHAR(30) DEFAULT 'general',
+			context_id INTEGER,
+			filename VARCHAR(255) NOT NULL,
+			content_type VARCHAR(150) NOT NULL,
+			size BIGINT NOT NULL,
+			sha256 CHAR(64) NOT NULL,
+			storage_key VARCHAR(255) NOT NULL,
+			thumbnail_key VARCHAR(255),
+			width INTEGER DEFAULT 0,
+			height INTEGER DEFAULT 0,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		);`
+	}
+
+	_, err = DB.Exec(attachmentTable)
+	if err != nil {
+		log.Fatal("Failed to create attachments table:", err)
+	}
+
+	// Create support ticket tables
+	var supportTables []string
+
+	if dbType == "sqlite" {
+		supportTables = []string{`
+		CREATE TABLE IF NOT EXISTS support_tickets (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			patient_id INTEGER NOT NULL,
+			subject VARCHAR(255) NOT NULL,
+			description TEXT NOT NULL,
+			category VARCHAR(20) DEFAULT 'other',
+			priority VARCHAR(20) DEFAULT 'medium',
+			status VARCHAR(20) DEFAULT 'open',
+			assigned_to INTEGER,
+			first_response_at DATETIME,
+			first_response_due_at DATETIME NOT NULL,
+			resolution_due_at DATETIME NOT NULL,
+			resolved_at DATETIME,
+			closed_at DATETIME,
+			last_activity_at DATETIME NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (patient_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY (assigned_to) REFERENCES users(id) ON DELETE SET NULL
+		);`, `
+		CREATE TABLE IF NOT EXISTS support_ticket_messages (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			ticket_id INTEGER NOT NULL,
+			author_id INTEGER NOT NULL,
+			body TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (ticket_id) REFERENCES support_tickets(id) ON DELETE CASCADE,
+			FOREIGN KEY (author_id) REFERENCES users(id) ON DELETE CASCADE
+		);`}
+	} else {
+		supportTables = []string{`
+		CREATE TABLE IF NOT EXISTS support_tickets (
+			id SERIAL PRIMARY KEY,
+			patient_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			subject VARCHAR(255) NOT NULL,
+			description TEXT NOT NULL,
+			category VARCHAR(20) DEFAULT 'other',
+			priority VARCHAR(20) DEFAULT 'medium',
+			status VARCHAR(20) DEFAULT 'open',
+			assigned_to INTEGER REFERENCES users(id) ON DELETE SET NULL,
+			first_response_at TIMESTAMP WITH TIME ZONE,
+			first_response_due_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			resolution_due_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			resolved_at TIMESTAMP WITH TIME ZONE,
+			closed_at TIMESTAMP WITH TIME ZONE,
+			last_activity_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		);`, `
+		CREATE TABLE IF NOT EXISTS support_ticket_messages (
+			id SERIAL PRIMARY KEY,
+			ticket_id INTEGER NOT NULL REFERENCES support_tickets(id) ON DELETE CASCADE,
+			author_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			body TEXT NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		);`}
+	}
+
+	for _, table := range supportTables {
+		if _, err = DB.Exec(table); err != nil {
+			log.Fatal("Failed to create support ticket tables:", err)
+		}
+	}
+
+	// Create staff schedule tables
+	var scheduleTables []string
+
+	if dbType == "sqlite" {
+		scheduleTables = []string{`
+		CREATE TABLE IF NOT EXISTS schedule_events (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			title VARCHAR(255) NOT NULL,
+			description TEXT DEFAULT '',
+			type VARCHAR(20) DEFAULT 'meeting',
+			location VARCHAR(255) DEFAULT '',
+			start_at DATETIME NOT NULL,
+			end_at DATETIME NOT NULL,
+			rrule VARCHAR(255) DEFAULT '',
+			series_end_at DATETIME,
+			created_by INTEGER NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE CASCADE
+		);`, `
+		CREATE TABLE IF NOT EXISTS schedule_event_attendees (
+			event_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL,
+			PRIMARY KEY (event_id, user_id),
+			FOREIGN KEY (event_id) REFERENCES schedule_events(id) ON DELETE CASCADE,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);`, `
+		CREATE TABLE IF NOT EXISTS shift_rosters (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			title VARCHAR(255) NOT NULL,
+			period_start DATETIME NOT NULL,
+			period_end DATETIME NOT NULL,
+			status VARCHAR(20) DEFAULT 'draft',
+			created_by INTEGER NOT NULL,
+			published_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE CASCADE
+		);`, `
+		CREATE TABLE IF NOT EXISTS shifts (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			roster_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL,
+			start_at DATETIME NOT NULL,
+			end_at DATETIME NOT NULL,
+			label VARCHAR(100) DEFAULT '',
+			FOREIGN KEY (roster_id) REFERENCES shift_rosters(id) ON DELETE CASCADE,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);`, `
+		CREATE TABLE IF NOT EXISTS shift_swap_requests (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			shift_id INTEGER NOT NULL,
+			requester_id INTEGER NOT NULL,
+			target_user_id INTEGER NOT NULL,
+			target_shift_id INTEGER,
+			reason TEXT DEFAULT '',
+			status VARCHAR(20) DEFAULT 'pending',
+			decided_by INTEGER,
+			decided_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (shift_id) REFERENCES shifts(id) ON DELETE CASCADE,
+			FOREIGN KEY (requester_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY (target_user_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY (target_shift_id) REFERENCES shifts(id) ON DELETE CASCADE,
+			FOREIGN KEY (decided_by) REFERENCES users(id) ON DELETE SET NULL
+		);`}
+	} else {
+		scheduleTables = []string{`
+		CREATE TABLE IF NOT EXISTS schedule_events (
+			id SERIAL PRIMARY KEY,
+			title VARCHAR(255) NOT NULL,
+			description TEXT DEFAULT '',
+			type VARCHAR(20) DEFAULT 'meeting',
+			location VARCHAR(255) DEFAULT '',
+			start_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			end_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			rrule VARCHAR(255) DEFAULT '',
+			series_end_at TIMESTAMP WITH TIME ZONE,
+			created_by INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		);`, `
+		CREATE TABLE IF NOT EXISTS schedule_event_attendees (
+			event_id INTEGER NOT NULL REFERENCES schedule_events(id) ON DELETE CASCADE,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			PRIMARY KEY (event_id, user_id)
+		);`, `
+		CREATE TABLE IF NOT EXISTS shift_rosters (
+			id SERIAL PRIMARY KEY,
+			title VARCHAR(255) NOT NULL,
+			period_start TIMESTAMP WITH TIME ZONE NOT NULL,
+			period_end TIMESTAMP WITH TIME ZONE NOT NULL,
+			status VARCHAR(20) DEFAULT 'draft',
+			created_by INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			published_at TIMESTAMP WITH TIME ZONE,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		);`, `
+		CREATE TABLE IF NOT EXISTS shifts (
+			id SERIAL PRIMARY KEY,
+			roster_id INTEGER NOT NULL REFERENCES shift_rosters(id) ON DELETE CASCADE,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			start_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			end_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			label VARCHAR(100) DEFAULT ''
+		);`, `
+		CREATE TABLE IF NOT EXISTS shift_swap_requests (
+			id SERIAL PRIMARY KEY,
+			shift_id INTEGER NOT NULL REFERENCES shifts(id) ON DELETE CASCADE,
+			requester_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			target_user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			target_shift_id INTEGER REFERENCES shifts(id) ON DELETE CASCADE,
+			reason TEXT DEFAULT '',
+			status VARCHAR(20) DEFAULT 'pending',
+			decided_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+			decided_at TIMESTAMP WITH TIME ZONE,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		);`}
+	}
+
+	for _, table := range scheduleTables {
+		if _, err = DB.Exec(table); err != nil {
+			log.Fatal("Failed to create schedule tables:", err)
+		}
+	}
+
+	// Create notification tables
+	var notificationTables []string
+
+	if dbType == "sqlite" {
+		notificationTables = []string{`
+		CREATE TABLE IF NOT EXISTS notifications (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			category VARCHAR(20) NOT NULL,
+			title VARCHAR(255) NOT NULL,
+			body TEXT DEFAULT '',
+			link VARCHAR(255) DEFAULT '',
+			read_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);`, `
+		CREATE TABLE IF NOT EXISTS notification_preferences (
+			user_id INTEGER NOT NULL,
+			category VARCHAR(20) NOT NULL,
+			in_app BOOLEAN NOT NULL DEFAULT 1,
+			email BOOLEAN NOT NULL DEFAULT 0,
+			sms BOOLEAN NOT NULL DEFAULT 0,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (user_id, category),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);`}
+	} else {
+		notificationTables = []string{`
+		CREATE TABLE IF NOT EXISTS notifications (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			category VARCHAR(20) NOT NULL,
+			title VARCHAR(255) NOT NULL,
+			body TEXT DEFAULT '',
+			link VARCHAR(255) DEFAULT '',
+			read_at TIMESTAMP WITH TIME ZONE,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		);`, `
+		CREATE TABLE IF NOT EXISTS notification_preferences (
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			category VARCHAR(20) NOT NULL,
+			in_app BOOLEAN NOT NULL DEFAULT TRUE,
+			email BOOLEAN NOT NULL DEFAULT FALSE,
+			sms BOOLEAN NOT NULL DEFAULT FALSE,
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (user_id, category)
+		);`}
+	}
+
+	for _, table := range notificationTables {
+		if _, err = DB.Exec(table); err != nil {
+			log.Fatal("Failed to create notification tables:", err)
+		}
+	}
+
+	// Create sms_messages table
+	var smsTable string
+
+	if dbType == "sqlite" {
+		smsTable = `
+		CREATE TABLE IF NOT EXISTS sms_messages (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER,
+			phone_number VARCHAR(20) NOT NULL,
+			body TEXT NOT NULL,
+			provider VARCHAR(50) NOT NULL,
+			provider_message_id VARCHAR(100),
+			status VARCHAR(20) NOT NULL DEFAULT 'queued',
+			error TEXT,
+			sent_at DATETIME,
+			delivered_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL
+		);`
+	} else {
+		smsTable = `
+		CREATE TABLE IF NOT EXISTS sms_messages (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+			phone_number VARCHAR(20) NOT NULL,
+			body TEXT NOT NULL,
+			provider VARCHAR(50) NOT NULL,
+			provider_message_id VARCHAR(100),
+			status VARCHAR(20) NOT NULL DEFAULT 'queued',
+			error TEXT,
+			sent_at TIMESTAMP WITH TIME ZONE,
+			delivered_at TIMESTAMP WITH TIME ZONE,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		);`
+	}
+
+	if _, err = DB.Exec(smsTable); err != nil {
+		log.Fatal("Failed to create sms_messages table:", err)
+	}
+
 	// Create indexes for better performance
 	var indexes []string
 
@@ -248,10 +1254,50 @@ func createTables() {
 			"CREATE INDEX IF NOT EXISTS idx_blog_posts_category ON blog_posts(category);",
 			"CREATE INDEX IF NOT EXISTS idx_blog_posts_published ON blog_posts(published_at);",
 			"CREATE INDEX IF NOT EXISTS idx_blog_posts_created ON blog_posts(created_at);",
+			"CREATE INDEX IF NOT EXISTS idx_blog_posts_publish_at ON blog_posts(publish_at);",
+			"CREATE INDEX IF NOT EXISTS idx_blog_posts_unpublish_at ON blog_posts(unpublish_at);",
+			"CREATE UNIQUE INDEX IF NOT EXISTS idx_blog_posts_slug ON blog_posts(slug);",
+			"CREATE INDEX IF NOT EXISTS idx_blog_post_slugs_post ON blog_post_slugs(post_id);",
+			"CREATE INDEX IF NOT EXISTS idx_blog_posts_reviewer ON blog_posts(reviewer_id);",
+			"CREATE INDEX IF NOT EXISTS idx_blog_post_review_comments_post ON blog_post_review_comments(post_id);",
+			"CREATE INDEX IF NOT EXISTS idx_blog_comments_post ON blog_comments(post_id, status);",
+			"CREATE INDEX IF NOT EXISTS idx_blog_comments_status ON blog_comments(status);",
+			"CREATE INDEX IF NOT EXISTS idx_blog_comments_author ON blog_comments(author_id, created_at);",
+			"CREATE INDEX IF NOT EXISTS idx_blog_posts_category_id ON blog_posts(category_id);",
+			"CREATE INDEX IF NOT EXISTS idx_blog_post_tags_tag ON blog_post_tags(tag_id);",
+			"CREATE INDEX IF NOT EXISTS idx_blog_post_views_day ON blog_post_views(day);",
 			"CREATE INDEX IF NOT EXISTS idx_doctors_status ON doctors(status);",
 			"CREATE INDEX IF NOT EXISTS idx_doctors_specialty ON doctors(specialty);",
 			"CREATE INDEX IF NOT EXISTS idx_doctors_email ON doctors(email);",
 			"CREATE INDEX IF NOT EXISTS idx_doctors_created ON doctors(created_at);",
+			"CREATE INDEX IF NOT EXISTS idx_prescriptions_doctor ON prescriptions(doctor_id);",
+			"CREATE INDEX IF NOT EXISTS idx_prescriptions_patient ON prescriptions(patient_id);",
+			"CREATE INDEX IF NOT EXISTS idx_prescription_items_prescription ON prescription_items(prescription_id);",
+			"CREATE INDEX IF NOT EXISTS idx_visit_summaries_doctor ON visit_summaries(doctor_id);",
+			"CREATE INDEX IF NOT EXISTS idx_visit_summaries_patient ON visit_summaries(patient_id);",
+			"CREATE INDEX IF NOT EXISTS idx_conversation_members_user ON conversation_members(user_id);",
+			"CREATE INDEX IF NOT EXISTS idx_messages_conversation ON messages(conversation_id, id);",
+			"CREATE INDEX IF NOT EXISTS idx_consultation_sessions_doctor ON consultation_sessions(doctor_id);",
+			"CREATE INDEX IF NOT EXISTS idx_consultation_sessions_patient ON consultation_sessions(patient_id);",
+			"CREATE INDEX IF NOT EXISTS idx_consultation_requests_queue ON consultation_requests(specialty, status);",
+			"CREATE INDEX IF NOT EXISTS idx_consultation_requests_patient ON consultation_requests(patient_id);",
+			"CREATE INDEX IF NOT EXISTS idx_consultation_requests_claimed ON consultation_requests(claimed_by);",
+			"CREATE INDEX IF NOT EXISTS idx_attachments_owner ON attachments(owner_id);",
+			"CREATE INDEX IF NOT EXISTS idx_attachments_sha256 ON attachments(sha256);",
+			"CREATE INDEX IF NOT EXISTS idx_attachments_context ON attachments(context, context_id);",
+			"CREATE INDEX IF NOT EXISTS idx_support_tickets_patient ON support_tickets(patient_id);",
+			"CREATE INDEX IF NOT EXISTS idx_support_tickets_queue ON support_tickets(status, priority);",
+			"CREATE INDEX IF NOT EXISTS idx_support_tickets_assigned ON support_tickets(assigned_to);",
+			"CREATE INDEX IF NOT EXISTS idx_support_ticket_messages_ticket ON support_ticket_messages(ticket_id);",
+			"CREATE INDEX IF NOT EXISTS idx_schedule_events_range ON schedule_events(start_at, series_end_at);",
+			"CREATE INDEX IF NOT EXISTS idx_schedule_event_attendees_user ON schedule_event_attendees(user_id);",
+			"CREATE INDEX IF NOT EXISTS idx_shifts_roster ON shifts(roster_id);",
+			"CREATE INDEX IF NOT EXISTS idx_shifts_user ON shifts(user_id, start_at);",
+			"CREATE INDEX IF NOT EXISTS idx_shift_swap_requests_shift ON shift_swap_requests(shift_id, status);",
+			"CREATE INDEX IF NOT EXISTS idx_notifications_user ON notifications(user_id, id);",
+			"CREATE INDEX IF NOT EXISTS idx_notifications_unread ON notifications(user_id, read_at);",
+			"CREATE INDEX IF NOT EXISTS idx_sms_messages_phone ON sms_messages(phone_number, created_at);",
+			"CREATE INDEX IF NOT EXISTS idx_sms_messages_provider ON sms_messages(provider, provider_message_id);",
 		}
 	} else {
 		indexes = []string{
@@ -260,10 +1306,50 @@ func createTables() {
 			"CREATE INDEX IF NOT EXISTS idx_blog_posts_category ON blog_posts(category);",
 			"CREATE INDEX IF NOT EXISTS idx_blog_posts_published ON blog_posts(published_at);",
 			"CREATE INDEX IF NOT EXISTS idx_blog_posts_created ON blog_posts(created_at);",
+			"CREATE INDEX IF NOT EXISTS idx_blog_posts_publish_at ON blog_posts(publish_at);",
+			"CREATE INDEX IF NOT EXISTS idx_blog_posts_unpublish_at ON blog_posts(unpublish_at);",
+			"CREATE UNIQUE INDEX IF NOT EXISTS idx_blog_posts_slug ON blog_posts(slug);",
+			"CREATE INDEX IF NOT EXISTS idx_blog_post_slugs_post ON blog_post_slugs(post_id);",
+			"CREATE INDEX IF NOT EXISTS idx_blog_posts_reviewer ON blog_posts(reviewer_id);",
+			"CREATE INDEX IF NOT EXISTS idx_blog_post_review_comments_post ON blog_post_review_comments(post_id);",
+			"CREATE INDEX IF NOT EXISTS idx_blog_comments_post ON blog_comments(post_id, status);",
+			"CREATE INDEX IF NOT EXISTS idx_blog_comments_status ON blog_comments(status);",
+			"CREATE INDEX IF NOT EXISTS idx_blog_comments_author ON blog_comments(author_id, created_at);",
+			"CREATE INDEX IF NOT EXISTS idx_blog_posts_category_id ON blog_posts(category_id);",
+			"CREATE INDEX IF NOT EXISTS idx_blog_post_tags_tag ON blog_post_tags(tag_id);",
+			"CREATE INDEX IF NOT EXISTS idx_blog_post_views_day ON blog_post_views(day);",
 			"CREATE INDEX IF NOT EXISTS idx_doctors_status ON doctors(status);",
 			"CREATE INDEX IF NOT EXISTS idx_doctors_specialty ON doctors(specialty);",
 			"CREATE INDEX IF NOT EXISTS idx_doctors_email ON doctors(email);",
 			"CREATE INDEX IF NOT EXISTS idx_doctors_created ON doctors(created_at);",
+			"CREATE INDEX IF NOT EXISTS idx_prescriptions_doctor ON prescriptions(doctor_id);",
+			"CREATE INDEX IF NOT EXISTS idx_prescriptions_patient ON prescriptions(patient_id);",
+			"CREATE INDEX IF NOT EXISTS idx_prescription_items_prescription ON prescription_items(prescription_id);",
+			"CREATE INDEX IF NOT EXISTS idx_visit_summaries_doctor ON visit_summaries(doctor_id);",
+			"CREATE INDEX IF NOT EXISTS idx_visit_summaries_patient ON visit_summaries(patient_id);",
+			"CREATE INDEX IF NOT EXISTS idx_conversation_members_user ON conversation_members(user_id);",
+			"CREATE INDEX IF NOT EXISTS idx_messages_conversation ON messages(conversation_id, id);",
+			"CREATE INDEX IF NOT EXISTS idx_consultation_sessions_doctor ON consultation_sessions(doctor_id);",
+			"CREATE INDEX IF NOT EXISTS idx_consultation_sessions_patient ON consultation_sessions(patient_id);",
+			"CREATE INDEX IF NOT EXISTS idx_consultation_requests_queue ON consultation_requests(specialty, status);",
+			"CREATE INDEX IF NOT EXISTS idx_consultation_requests_patient ON consultation_requests(patient_id);",
+			"CREATE INDEX IF NOT EXISTS idx_consultation_requests_claimed ON consultation_requests(claimed_by);",
+			"CREATE INDEX IF NOT EXISTS idx_attachments_owner ON attachments(owner_id);",
+			"CREATE INDEX IF NOT EXISTS idx_attachments_sha256 ON attachments(sha256);",
+			"CREATE INDEX IF NOT EXISTS idx_attachments_context ON attachments(context, context_id);",
+			"CREATE INDEX IF NOT EXISTS idx_support_tickets_patient ON support_tickets(patient_id);",
+			"CREATE INDEX IF NOT EXISTS idx_support_tickets_queue ON support_tickets(status, priority);",
+			"CREATE INDEX IF NOT EXISTS idx_support_tickets_assigned ON support_tickets(assigned_to);",
+			"CREATE INDEX IF NOT EXISTS idx_support_ticket_messages_ticket ON support_ticket_messages(ticket_id);",
+			"CREATE INDEX IF NOT EXISTS idx_schedule_events_range ON schedule_events(start_at, series_end_at);",
+			"CREATE INDEX IF NOT EXISTS idx_schedule_event_attendees_user ON schedule_event_attendees(user_id);",
+			"CREATE INDEX IF NOT EXISTS idx_shifts_roster ON shifts(roster_id);",
+			"CREATE INDEX IF NOT EXISTS idx_shifts_user ON shifts(user_id, start_at);",
+			"CREATE INDEX IF NOT EXISTS idx_shift_swap_requests_shift ON shift_swap_requests(shift_id, status);",
+			"CREATE INDEX IF NOT EXISTS idx_notifications_user ON notifications(user_id, id);",
+			"CREATE INDEX IF NOT EXISTS idx_notifications_unread ON notifications(user_id, read_at);",
+			"CREATE INDEX IF NOT EXISTS idx_sms_messages_phone ON sms_messages(phone_number, created_at);",
+			"CREATE INDEX IF NOT EXISTS idx_sms_messages_provider ON sms_messages(provider, provider_message_id);",
 		}
 	}
 
@@ -0,0 +1,36 @@
+package feed
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// URL is a page listed in a sitemap
+type URL struct {
+	Loc     string
+	LastMod time.Time // zero if unknown
+}
+
+type urlset struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// Sitemap renders urls as an XML sitemap. Sitemaps are limited to 50,000
+// URLs; callers with more must split them.
+func Sitemap(urls []URL) ([]byte, error) {
+	doc := urlset{URLs: []sitemapURL{}}
+	for _, u := range urls {
+		entry := sitemapURL{Loc: u.Loc}
+		if !u.LastMod.IsZero() {
+			entry.LastMod = u.LastMod.UTC().Format(time.RFC3339)
+		}
+		doc.URLs = append(doc.URLs, entry)
+	}
+	return marshalXML(doc)
+}
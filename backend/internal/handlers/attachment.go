@@ -0,0 +1,412 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dottrip/fpt-swp/internal/apierror"
+	"github.com/dottrip/fpt-swp/internal/models"
+	"github.com/dottrip/fpt-swp/internal/response"
+	"github.com/dottrip/fpt-swp/internal/storage"
+	"github.com/dottrip/fpt-swp/internal/upload"
+	"github.com/gin-gonic/gin"
+)
+
+// AttachmentResponse is an attachment with download URLs. URLs of private
+// attachments are signed and expire at ExpiresAt.
+type AttachmentResponse struct {
+	*models.Attachment
+	URL          string     `json:"url"`
+	ThumbnailURL string     `json:"thumbnail_url,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+}
+
+// attachmentResponse builds the download URLs of an attachment
+func attachmentResponse(a *models.Attachment) (AttachmentResponse, error) {
+	resp := AttachmentResponse{Attachment: a}
+
+	if upload.IsPublic(a.Context) {
+		resp.URL = upload.PublicURL(a.ID, upload.VariantOriginal)
+		if a.ThumbnailKey != "" {
+			resp.ThumbnailURL = upload.PublicURL(a.ID, upload.VariantThumbnail)
+		}
+		return resp, nil
+	}
+
+	var err error
+	expiresAt := time.Now().Add(upload.URLTTL()).UTC()
+	if resp.URL, err = upload.SignedURL(a.ID, upload.VariantOriginal, expiresAt); err != nil {
+		return resp, err
+	}
+	if a.ThumbnailKey != "" {
+		if resp.ThumbnailURL, err = upload.SignedURL(a.ID, upload.VariantThumbnail, expiresAt); err != nil {
+			return resp, err
+		}
+	}
+	resp.ExpiresAt = &expiresAt
+
+	return resp, nil
+}
+
+// canAttach reports whether user may upload a file to the given context.
+// A medical record's context ID is the patient's user ID.
+func canAttach(user *models.User, uploadContext string, contextID *int) bool {
+	switch uploadContext {
+	case upload.ContextGeneral, upload.ContextAvatar:
+		return true
+	case upload.ContextChat:
+		if contextID == nil {
+			return false
+		}
+		member, err := models.IsConversationMember(*contextID, user.ID)
+		return err == nil && member
+	case upload.ContextBlog:
+		return hasRole(user, "admin", "staff", "doctor")
+	case upload.ContextTicket:
+		return contextID != nil && canAccessTicket(user, *contextID)
+	case upload.ContextMedicalRecord:
+		return contextID != nil && (hasRole(user, "admin", "doctor", "staff") || *contextID == user.ID)
+	default:
+		return false
+	}
+}
+
+// canAccessAttachment applies the owner's access rules: owners and admins can
+// always read a file, others depending on what it is attached to
+func canAccessAttachment(user *models.User, a *models.Attachment) bool {
+	if a.OwnerID == user.ID || hasRole(user, "admin") {
+		return true
+	}
+
+	switch a.Context {
+	case upload.ContextBlog, upload.ContextAvatar:
+		return true
+	case upload.ContextChat:
+		if a.ContextID == nil {
+			return false
+		}
+		member, err := models.IsConversationMember(*a.ContextID, user.ID)
+		return err == nil && member
+	case upload.ContextTicket:
+		return a.ContextID != nil && canAccessTicket(user, *a.ContextID)
+	case upload.ContextMedicalRecord:
+		return hasRole(user, "doctor", "staff") || (a.ContextID != nil && *a.ContextID == user.ID)
+	default:
+		return false
+	}
+}
+
+// storeUpload writes the file and its thumbnail to storage, reusing the
+// objects of an earlier upload with the same content
+func storeUpload(ctx context.Context, file *upload.File, a *models.Attachment) error {
+	a.StorageKey = file.Key()
+
+	if existing, err := models.FindAttachmentByHash(file.SHA256); err == nil {
+		a.StorageKey = existing.StorageKey
+		a.ThumbnailKey = existing.ThumbnailKey
+		a.Width, a.Height = existing.Width, existing.Height
+	}
+
+	exists, err := storage.Default.Exists(ctx, a.StorageKey)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if err := storage.Default.Put(ctx, a.StorageKey, file.Reader(), file.Size, file.ContentType); err != nil {
+			return err
+		}
+	}
+
+	if a.ThumbnailKey != "" || !file.IsImage() {
+		return nil
+	}
+
+	// A missing thumbnail is not fatal; the original is still served
+	thumb, err := upload.MakeThumbnail(file)
+	if err != nil {
+		log.Printf("upload: no thumbnail for %s: %v", file.SHA256, err)
+		return nil
+	}
+	key := thumb.Key(file)
+	if err := storage.Default.Put(ctx, key, bytes.NewReader(thumb.Data), int64(len(thumb.Data)), thumb.ContentType); err != nil {
+		return err
+	}
+	a.ThumbnailKey = key
+	a.Width, a.Height = thumb.Width, thumb.Height
+
+	return nil
+}
+
+// UploadAttachment handles POST /api/attachments (multipart form with a
+// "file" field and optional "context" and "context_id")
+func UploadAttachment(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		apierror.Respond(c, apierror.Unauthorized())
+		return
+	}
+
+	// Leave room for the multipart envelope around the largest allowed file
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, upload.MaxUploadSize()+1<<20)
+
+	uploadContext := c.DefaultPostForm("context", upload.ContextGeneral)
+	policy, ok := upload.PolicyFor(uploadContext)
+	if !ok {
+		apierror.Respond(c, apierror.Field("context", "oneof", strings.Join(upload.Contexts(), " ")))
+		return
+	}
+
+	var contextID *int
+	if value := c.PostForm("context_id"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			apierror.Respond(c, apierror.BadRequest("error.invalid_id"))
+			return
+		}
+		contextID = &id
+	}
+
+	if !canAttach(user, uploadContext, contextID) {
+		apierror.Respond(c, apierror.Forbidden("error.upload_forbidden"))
+		return
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			apierror.Respond(c, apierror.New(http.StatusRequestEntityTooLarge, apierror.CodeFileTooLarge))
+			return
+		}
+		apierror.Respond(c, apierror.Field("file", "required", ""))
+		return
+	}
+	if header.Size > policy.MaxSize {
+		apierror.Respond(c, fileTooLarge(policy))
+		return
+	}
+
+	f, err := header.Open()
+	if err != nil {
+		apierror.Respond(c, apierror.BadRequest("error.file_unreadable"))
+		return
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, policy.MaxSize+1))
+	if err != nil {
+		apierror.Respond(c, apierror.BadRequest("error.file_unreadable"))
+		return
+	}
+
+	file, err := upload.Inspect(data, header.Filename, policy)
+	if err != nil {
+		switch {
+		case errors.Is(err, upload.ErrTooLarge):
+			apierror.Respond(c, fileTooLarge(policy))
+		case errors.Is(err, upload.ErrTypeNotAllowed):
+			apierror.Respond(c, apierror.New(http.StatusUnsupportedMediaType, apierror.CodeUnsupportedMediaType))
+		case errors.Is(err, upload.ErrEmpty):
+			apierror.Respond(c, apierror.Field("file", "required", ""))
+		default:
+			apierror.Respond(c, err)
+		}
+		return
+	}
+
+	attachment := &models.Attachment{
+		OwnerID:     user.ID,
+		Context:     uploadContext,
+		ContextID:   contextID,
+		Filename:    file.Filename,
+		ContentType: file.ContentType,
+		Size:        file.Size,
+		SHA256:      file.SHA256,
+	}
+
+	if err := storeUpload(c.Request.Context(), file, attachment); err != nil {
+		log.Printf("upload: failed to store %s: %v", file.SHA256, err)
+		apierror.Respond(c, apierror.Internal(err))
+		return
+	}
+
+	if err := attachment.Create(); err != nil {
+		apierror.Respond(c, apierror.Internal(err))
+		return
+	}
+
+	resp, err := attachmentResponse(attachment)
+	if err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	response.Message(c, http.StatusCreated, "File uploaded successfully", resp)
+}
+
+// fileTooLarge is the error for a file over the size limit of policy
+func fileTooLarge(policy upload.Policy) *apierror.Error {
+	return apierror.New(http.StatusRequestEntityTooLarge, apierror.CodeFileTooLarge).
+		WithKey("error.file_too_large_max", map[string]interface{}{"MaxMB": policy.MaxSize >> 20})
+}
+
+// loadAttachment resolves the :id parameter for the current user
+func loadAttachment(c *gin.Context) (*models.User, *models.Attachment, bool) {
+	user, ok := currentUser(c)
+	if !ok {
+		apierror.Respond(c, apierror.Unauthorized())
+		return nil, nil, false
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, apierror.BadRequest("error.invalid_id"))
+		return nil, nil, false
+	}
+
+	attachment, err := models.GetAttachmentByID(id)
+	if err != nil || !canAccessAttachment(user, attachment) {
+		apierror.Respond(c, apierror.NotFound("error.attachment_not_found"))
+		return nil, nil, false
+	}
+
+	return user, attachment, true
+}
+
+// GetAttachment handles GET /api/attachments/{id}, returning the metadata
+// with freshly signed download URLs
+func GetAttachment(c *gin.Context) {
+	_, attachment, ok := loadAttachment(c)
+	if !ok {
+		return
+	}
+
+	resp, err := attachmentResponse(attachment)
+	if err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	response.OK(c, http.StatusOK, resp)
+}
+
+// DeleteAttachment handles DELETE /api/attachments/{id}. The stored content is
+// removed once no other attachment shares it.
+func DeleteAttachment(c *gin.Context) {
+	user, attachment, ok := loadAttachment(c)
+	if !ok {
+		return
+	}
+
+	if attachment.OwnerID != user.ID && !hasRole(user, "admin") {
+		apierror.Respond(c, apierror.Forbidden("error.attachment_not_owner"))
+		return
+	}
+
+	orphaned, err := attachment.Delete()
+	if err != nil {
+		apierror.Respond(c, apierror.Internal(err))
+		return
+	}
+
+	if orphaned {
+		ctx := c.Request.Context()
+		for _, key := range []string{attachment.StorageKey, attachment.ThumbnailKey} {
+			if key == "" {
+				continue
+			}
+			if err := storage.Default.Delete(ctx, key); err != nil {
+				log.Printf("upload: failed to delete %s: %v", key, err)
+			}
+		}
+	}
+
+	response.Message(c, http.StatusOK, "Attachment deleted successfully", nil)
+}
+
+// DownloadFile handles GET /api/files/{id}. Private files require a valid
+// signed URL from GetAttachment; blog images and avatars are public.
+func DownloadFile(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, apierror.BadRequest("error.invalid_id"))
+		return
+	}
+
+	variant := c.DefaultQuery("variant", upload.VariantOriginal)
+
+	attachment, err := models.GetAttachmentByID(id)
+	if err == nil && !upload.IsPublic(attachment.Context) &&
+		!upload.VerifySignedURL(id, variant, c.Query("expires"), c.Query("signature")) {
+		err = errors.New("invalid signature")
+	}
+	if err != nil {
+		// Do not reveal whether the file exists to holders of a bad link
+		apierror.Respond(c, apierror.Forbidden("error.invalid_link"))
+		return
+	}
+
+	key, contentType := attachment.StorageKey, attachment.ContentType
+	if variant == upload.VariantThumbnail {
+		if attachment.ThumbnailKey == "" {
+			apierror.Respond(c, apierror.NotFound("error.thumbnail_not_found"))
+			return
+		}
+		key = attachment.ThumbnailKey
+		contentType = "image/jpeg"
+		if strings.HasSuffix(key, ".png") {
+			contentType = "image/png"
+		}
+	} else if variant != upload.VariantOriginal {
+		apierror.Respond(c, apierror.Field("variant", "oneof", upload.VariantOriginal+" "+upload.VariantThumbnail))
+		return
+	}
+
+	etag := `"` + attachment.SHA256 + "-" + variant + `"`
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	body, err := storage.Default.Get(c.Request.Context(), key)
+	if err != nil {
+		log.Printf("upload: failed to read %s: %v", key, err)
+		apierror.Respond(c, apierror.NotFound("error.attachment_not_found"))
+		return
+	}
+	defer body.Close()
+
+	// Only images and PDFs are displayed inline; scripts in other types must
+	// never run on the API origin
+	disposition := "attachment"
+	if strings.HasPrefix(contentType, "image/") || contentType == "application/pdf" {
+		disposition = "inline"
+	}
+
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Filename}))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Security-Policy", "default-src 'none'; sandbox")
+	c.Header("ETag", etag)
+	if upload.IsPublic(attachment.Context) {
+		c.Header("Cache-Control", "public, max-age=86400")
+	} else {
+		c.Header("Cache-Control", "private, no-store")
+	}
+	if variant == upload.VariantOriginal {
+		c.Header("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	}
+
+	c.Status(http.StatusOK)
+	if _, err := io.Copy(c.Writer, body); err != nil {
+		log.Printf("upload: failed to send %s: %v", key, err)
+	}
+}
@@ -2,11 +2,12 @@ package handlers
 
 import (
 	"database/sql"
-	"fmt"
 	"net/http"
 	"strings"
 
+	"github.com/dottrip/fpt-swp/internal/apierror"
 	"github.com/dottrip/fpt-swp/internal/models"
+	"github.com/dottrip/fpt-swp/internal/response"
 	"github.com/dottrip/fpt-swp/pkg/utils"
 	"github.com/gin-gonic/gin"
 )
@@ -19,49 +20,9 @@ type LoginInput struct {
 
 // RegisterInput represents the register request body
 type RegisterInput struct {
-	Username string `json:"username" binding:"required"`
-	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=6"`
-}
-
-// parseValidationError converts validation errors to user-friendly Vietnamese messages
-func parseValidationError(err error) string {
-	errMsg := err.Error()
-
-	// Log the original error for debugging
-	fmt.Printf("DEBUG - Validation error: %s\n", errMsg)
-
-	// Handle specific Gin validation error patterns
-	if strings.Contains(errMsg, "RegisterInput.Password") && strings.Contains(errMsg, "min") {
-		fmt.Printf("DEBUG - Matched password min error\n")
-		return "Mật khẩu phải có ít nhất 6 ký tự"
-	}
-	if strings.Contains(errMsg, "RegisterInput.Email") && strings.Contains(errMsg, "email") {
-		return "Email không đúng định dạng"
-	}
-	if strings.Contains(errMsg, "RegisterInput.Username") && strings.Contains(errMsg, "required") {
-		return "Tên người dùng là bắt buộc"
-	}
-	if strings.Contains(errMsg, "RegisterInput.Email") && strings.Contains(errMsg, "required") {
-		return "Email là bắt buộc"
-	}
-	if strings.Contains(errMsg, "RegisterInput.Password") && strings.Contains(errMsg, "required") {
-		return "Mật khẩu là bắt buộc"
-	}
-
-	// Handle LoginInput validation errors
-	if strings.Contains(errMsg, "LoginInput.Email") && strings.Contains(errMsg, "email") {
-		return "Email không đúng định dạng"
-	}
-	if strings.Contains(errMsg, "LoginInput.Email") && strings.Contains(errMsg, "required") {
-		return "Email là bắt buộc"
-	}
-	if strings.Contains(errMsg, "LoginInput.Password") && strings.Contains(errMsg, "required") {
-		return "Mật khẩu là bắt buộc"
-	}
-
-	fmt.Printf("DEBUG - No pattern matched, returning default\n")
-	return "Dữ liệu nhập vào không hợp lệ"
+	Username string `json:"username" binding:"required,max=255"`
+	Email    string `json:"email" binding:"required,email,max=255"`
+	Password string `json:"password" binding:"required,min=6,max=72"`
 }
 
 // Register handles user registration
@@ -70,9 +31,7 @@ func Register(c *gin.Context) {
 
 	// Bind and validate input
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": parseValidationError(err),
-		})
+		apierror.Respond(c, apierror.FromBinding(err))
 		return
 	}
 
@@ -86,47 +45,31 @@ func Register(c *gin.Context) {
 	// Save user to database
 	if err := user.Create(); err != nil {
 		// Check for common database errors
-		errMsg := err.Error()
+		errMsg := strings.ToLower(err.Error())
 		if strings.Contains(errMsg, "duplicate") || strings.Contains(errMsg, "unique") {
 			if strings.Contains(errMsg, "email") {
-				c.JSON(http.StatusBadRequest, gin.H{
-					"error": "Email này đã được sử dụng",
-				})
+				apierror.Respond(c, apierror.New(http.StatusBadRequest, apierror.CodeEmailTaken))
 				return
 			}
 			if strings.Contains(errMsg, "username") {
-				c.JSON(http.StatusBadRequest, gin.H{
-					"error": "Tên người dùng này đã được sử dụng",
-				})
+				apierror.Respond(c, apierror.New(http.StatusBadRequest, apierror.CodeUsernameTaken))
 				return
 			}
 		}
 
-		if strings.Contains(errMsg, "password must be at least 6 characters") {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": "Mật khẩu phải có ít nhất 6 ký tự",
-			})
-			return
-		}
-
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Không thể tạo tài khoản. Vui lòng thử lại sau.",
-		})
+		apierror.Respond(c, err)
 		return
 	}
 
 	// Generate token
 	token, err := utils.GenerateToken(user.ID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Không thể tạo token. Vui lòng thử lại sau.",
-		})
+		apierror.Respond(c, err)
 		return
 	}
 
 	// Return token
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Đăng ký thành công",
+	response.Message(c, http.StatusOK, localize(c, "auth.register_success"), gin.H{
 		"user": gin.H{
 			"id":       user.ID,
 			"username": user.Username,
@@ -143,9 +86,7 @@ func Login(c *gin.Context) {
 
 	// Bind and validate input
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": parseValidationError(err),
-		})
+		apierror.Respond(c, apierror.FromBinding(err))
 		return
 	}
 
@@ -153,37 +94,28 @@ func Login(c *gin.Context) {
 	user, err := models.GetByEmail(input.Email)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Email hoặc mật khẩu không đúng",
-			})
+			apierror.Respond(c, apierror.New(http.StatusUnauthorized, apierror.CodeInvalidCredentials))
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Không thể xác thực người dùng. Vui lòng thử lại sau.",
-		})
+		apierror.Respond(c, err)
 		return
 	}
 
 	// Verify password
 	if err := user.VerifyPassword(input.Password); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error": "Email hoặc mật khẩu không đúng",
-		})
+		apierror.Respond(c, apierror.New(http.StatusUnauthorized, apierror.CodeInvalidCredentials))
 		return
 	}
 
 	// Generate token
 	token, err := utils.GenerateToken(user.ID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Không thể tạo token. Vui lòng thử lại sau.",
-		})
+		apierror.Respond(c, err)
 		return
 	}
 
 	// Return token
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Đăng nhập thành công",
+	response.Message(c, http.StatusOK, localize(c, "auth.login_success"), gin.H{
 		"user": gin.H{
 			"id":       user.ID,
 			"username": user.Username,
@@ -1,54 +1,50 @@
 package handlers
 
 import (
+	"database/sql"
+	"errors"
 	"net/http"
+	"path"
 	"strconv"
+	"time"
 
+	"github.com/dottrip/fpt-swp/internal/apierror"
 	"github.com/dottrip/fpt-swp/internal/models"
+	"github.com/dottrip/fpt-swp/internal/response"
 	"github.com/gin-gonic/gin"
 )
 
-// BlogResponse represents a standard blog API response
-type BlogResponse struct {
-	Success bool        `json:"success"`
-	Message string      `json:"message,omitempty"`
-	Data    interface{} `json:"data,omitempty"`
-	Error   string      `json:"error,omitempty"`
-}
-
-// CreateBlogPost handles creating a new blog post
+// CreateBlogPost handles creating a new blog post. Creating it published or
+// scheduled needs an admin's ?override_review=true, since it has not been
+// reviewed.
 func CreateBlogPost(c *gin.Context) {
-	var blogPost models.BlogPost
-	if err := c.ShouldBindJSON(&blogPost); err != nil {
-		c.JSON(http.StatusBadRequest, BlogResponse{
-			Success: false,
-			Error:   "Invalid JSON format: " + err.Error(),
-		})
+	var input models.BlogPostInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.FromBinding(err))
 		return
 	}
-
-	// TODO: Get author ID from JWT token/session
-	// For now, we'll use the provided author_id or default to 1
-	if blogPost.AuthorID == 0 {
-		blogPost.AuthorID = 1 // Default author for testing
+	override, err := reviewOverride(c)
+	if err != nil {
+		apierror.Respond(c, err)
+		return
 	}
 
+	// The author is whoever is signed in; comments are on unless turned off
+	blogPost := models.BlogPost{AuthorID: c.GetInt("user_id"), ReviewOverride: override, CommentsEnabled: true}
+	input.Apply(&blogPost)
+
 	if err := blogPost.Create(); err != nil {
-		c.JSON(http.StatusInternalServerError, BlogResponse{
-			Success: false,
-			Error:   err.Error(),
-		})
+		apierror.Respond(c, err)
 		return
 	}
+	setETag(c, blogPost.Version)
 
-	c.JSON(http.StatusCreated, BlogResponse{
-		Success: true,
-		Message: "Blog post created successfully",
-		Data:    blogPost,
-	})
+	response.Message(c, http.StatusCreated, "Blog post created successfully", blogPost)
 }
 
-// GetBlogPosts handles retrieving blog posts with filtering
+// GetBlogPosts handles retrieving blog posts with filtering. It pages with
+// ?limit=&offset=, or with ?cursor= for stable paging while posts are added;
+// cursor pages are ordered by ID and ignore sort_by.
 func GetBlogPosts(c *gin.Context) {
 	// Parse query parameters
 	filter := models.BlogPostFilter{}
@@ -61,6 +57,10 @@ func GetBlogPosts(c *gin.Context) {
 		filter.Category = category
 	}
 
+	if tag := c.Query("tag"); tag != "" {
+		filter.Tag = tag
+	}
+
 	if authorIDStr := c.Query("author_id"); authorIDStr != "" {
 		if authorID, err := strconv.Atoi(authorIDStr); err == nil {
 			filter.AuthorID = authorID
@@ -71,23 +71,9 @@ func GetBlogPosts(c *gin.Context) {
 		filter.Search = search
 	}
 
-	if limitStr := c.Query("limit"); limitStr != "" {
-		if limit, err := strconv.Atoi(limitStr); err == nil && limit > 0 {
-			filter.Limit = limit
-		}
-	} else {
-		filter.Limit = 10 // Default limit
-	}
-
-	if offsetStr := c.Query("offset"); offsetStr != "" {
-		if offset, err := strconv.Atoi(offsetStr); err == nil && offset >= 0 {
-			filter.Offset = offset
-		}
-	}
-
 	if sortBy := c.Query("sort_by"); sortBy != "" {
 		// Validate sort fields
-		validSorts := []string{"title", "created_at", "updated_at", "view_count", "published_at"}
+		validSorts := []string{"title", "created_at", "updated_at", "view_count", "published_at", "relevance"}
 		for _, valid := range validSorts {
 			if sortBy == valid {
 				filter.SortBy = sortBy
@@ -102,19 +88,34 @@ func GetBlogPosts(c *gin.Context) {
 		}
 	}
 
-	posts, err := models.GetBlogPosts(filter)
+	p, err := parsePage(c, 10, filter.SortOrder != "asc")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, BlogResponse{
-			Success: false,
-			Error:   err.Error(),
-		})
+		apierror.Respond(c, err)
 		return
 	}
+	filter.Limit, filter.Offset, filter.Keyset = p.fetchLimit(), p.Offset, p.Keyset
+
+	posts, total, err := listBlogPosts(filter)
+	if err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	n, meta := p.meta(total, len(posts), func(i int) int { return posts[i].ID })
+	response.List(c, posts[:n], meta)
+}
 
-	c.JSON(http.StatusOK, BlogResponse{
-		Success: true,
-		Data:    posts,
-	})
+// listBlogPosts fetches a page of posts and the total matching the filter
+func listBlogPosts(filter models.BlogPostFilter) ([]models.BlogPost, int, error) {
+	posts, err := models.GetBlogPosts(filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	total, err := models.CountBlogPosts(filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	return posts, total, nil
 }
 
 // GetBlogPost handles retrieving a single blog post by ID
@@ -123,88 +124,173 @@ func GetBlogPost(c *gin.Context) {
 
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, BlogResponse{
-			Success: false,
-			Error:   "Invalid blog post ID",
-		})
+		apierror.Respond(c, apierror.BadRequest("error.invalid_id"))
+		return
+	}
+
+	post, err := models.GetBlogPostByID(id)
+	if err != nil {
+		apierror.Respond(c, notFoundOr(err, "error.blog_post_not_found"))
+		return
+	}
+
+	setETag(c, post.Version)
+	labelMedicalReview(c, post)
+	response.OK(c, http.StatusOK, post)
+}
+
+// GetPublishedBlogPost handles retrieving a blog post by ID for the public:
+// drafts, scheduled posts before their time and archived posts are not
+// found
+func GetPublishedBlogPost(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, apierror.BadRequest("error.invalid_id"))
 		return
 	}
 
 	post, err := models.GetBlogPostByID(id)
+	if err == nil && !post.IsVisible(time.Now()) {
+		err = sql.ErrNoRows
+	}
 	if err != nil {
-		c.JSON(http.StatusNotFound, BlogResponse{
-			Success: false,
-			Error:   "Blog post not found",
-		})
+		apierror.Respond(c, notFoundOr(err, "error.blog_post_not_found"))
 		return
 	}
 
-	// Increment view count (optional - only if not the author viewing)
-	if c.Query("increment_view") == "true" {
-		post.IncrementViewCount()
+	countView(c, post)
+
+	setETag(c, post.Version)
+	labelMedicalReview(c, post)
+	response.OK(c, http.StatusOK, post)
+}
+
+// GetBlogPostBySlug handles retrieving a published blog post by slug. A
+// slug the post had before it was renamed answers with a 301 to the
+// current one, so old links keep working.
+func GetBlogPostBySlug(c *gin.Context) {
+	slug := c.Param("slug")
+
+	post, err := models.GetBlogPostBySlug(slug)
+	if errors.Is(err, sql.ErrNoRows) {
+		var id int
+		if id, err = models.GetBlogPostIDByFormerSlug(slug); err == nil {
+			if post, err = models.GetBlogPostByID(id); err == nil && post.IsVisible(time.Now()) {
+				location := path.Join(path.Dir(c.Request.URL.Path), post.Slug)
+				if c.Request.URL.RawQuery != "" {
+					location += "?" + c.Request.URL.RawQuery
+				}
+				c.Redirect(http.StatusMovedPermanently, location)
+				return
+			}
+		}
+	}
+	// Drafts, scheduled and archived posts are not public
+	if err == nil && !post.IsVisible(time.Now()) {
+		err = sql.ErrNoRows
 	}
+	if err != nil {
+		apierror.Respond(c, notFoundOr(err, "error.blog_post_not_found"))
+		return
+	}
+
+	countView(c, post)
 
-	c.JSON(http.StatusOK, BlogResponse{
-		Success: true,
-		Data:    post,
-	})
+	setETag(c, post.Version)
+	labelMedicalReview(c, post)
+	response.OK(c, http.StatusOK, post)
 }
 
-// UpdateBlogPost handles updating an existing blog post
+// UpdateBlogPost handles replacing an existing blog post. The version being
+// replaced must be given in If-Match or the version field.
 func UpdateBlogPost(c *gin.Context) {
 	idStr := c.Param("id")
 
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, BlogResponse{
-			Success: false,
-			Error:   "Invalid blog post ID",
-		})
+		apierror.Respond(c, apierror.BadRequest("error.invalid_id"))
 		return
 	}
 
 	// Get existing post
 	existingPost, err := models.GetBlogPostByID(id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, BlogResponse{
-			Success: false,
-			Error:   "Blog post not found",
-		})
+		apierror.Respond(c, notFoundOr(err, "error.blog_post_not_found"))
 		return
 	}
 
-	// Parse updated data
-	var updatedPost models.BlogPost
-	if err := c.ShouldBindJSON(&updatedPost); err != nil {
-		c.JSON(http.StatusBadRequest, BlogResponse{
-			Success: false,
-			Error:   "Invalid JSON format: " + err.Error(),
-		})
+	// Parse updated data; the author, view count and dates are kept
+	var input models.BlogPostInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.FromBinding(err))
+		return
+	}
+	if err := checkVersion(c, existingPost.Version, input.Version, true); err != nil {
+		apierror.Respond(c, err)
 		return
 	}
-
-	// Set ID and author ID from existing post
-	updatedPost.ID = existingPost.ID
-	updatedPost.AuthorID = existingPost.AuthorID
-	updatedPost.CreatedAt = existingPost.CreatedAt
-	updatedPost.ViewCount = existingPost.ViewCount
 
 	// TODO: Check if user has permission to update this post
 	// (should be author or admin)
 
-	if err := updatedPost.Update(); err != nil {
-		c.JSON(http.StatusInternalServerError, BlogResponse{
-			Success: false,
-			Error:   err.Error(),
-		})
+	updateBlogPost(c, existingPost, input)
+}
+
+// PatchBlogPost handles changing some fields of a blog post with a JSON
+// Merge Patch. If-Match or a version member is optional.
+func PatchBlogPost(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, apierror.BadRequest("error.invalid_id"))
+		return
+	}
+
+	existingPost, err := models.GetBlogPostByID(id)
+	if err != nil {
+		apierror.Respond(c, notFoundOr(err, "error.blog_post_not_found"))
+		return
+	}
+
+	var input models.BlogPostInput
+	if err := bindMergePatch(c, existingPost.Input(), &input); err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	if err := checkVersion(c, existingPost.Version, input.Version, false); err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	updateBlogPost(c, existingPost, input)
+}
+
+// updateBlogPost stores input over post, failing if the post was changed
+// since it was read
+func updateBlogPost(c *gin.Context, post *models.BlogPost, input models.BlogPostInput) {
+	override, err := reviewOverride(c)
+	if err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	if input.ReviewerID != nil {
+		if _, ok := reviewerDoctor(c, *input.ReviewerID); !ok {
+			return
+		}
+	}
+
+	input.Apply(post)
+	post.EditorID = c.GetInt("user_id")
+	post.ReviewOverride = override
+	if err := post.Update(); err != nil {
+		apierror.Respond(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, BlogResponse{
-		Success: true,
-		Message: "Blog post updated successfully",
-		Data:    updatedPost,
-	})
+	setETag(c, post.Version)
+	labelMedicalReview(c, post)
+	response.Message(c, http.StatusOK, "Blog post updated successfully", post)
 }
 
 // DeleteBlogPost handles deleting a blog post
@@ -213,121 +299,99 @@ func DeleteBlogPost(c *gin.Context) {
 
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, BlogResponse{
-			Success: false,
-			Error:   "Invalid blog post ID",
-		})
+		apierror.Respond(c, apierror.BadRequest("error.invalid_id"))
 		return
 	}
 
 	// Get existing post to check permissions
 	existingPost, err := models.GetBlogPostByID(id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, BlogResponse{
-			Success: false,
-			Error:   "Blog post not found",
-		})
+		apierror.Respond(c, notFoundOr(err, "error.blog_post_not_found"))
 		return
 	}
 
 	// TODO: Check if user has permission to delete this post
 	// (should be author or admin)
 
+	// Only delete the version the client has seen, if it says which
+	if err := checkVersion(c, existingPost.Version, 0, false); err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
 	if err := existingPost.Delete(); err != nil {
-		c.JSON(http.StatusInternalServerError, BlogResponse{
-			Success: false,
-			Error:   err.Error(),
-		})
+		apierror.Respond(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, BlogResponse{
-		Success: true,
-		Message: "Blog post deleted successfully",
-	})
+	response.Message(c, http.StatusOK, "Blog post deleted successfully", nil)
 }
 
-// GetBlogStats handles retrieving blog statistics
+// GetBlogStats handles retrieving blog statistics: post counts, and under
+// views the views from ?from= to ?to= per day with the most viewed posts
+// and referring sites
 func GetBlogStats(c *gin.Context) {
+	from, to, ok := blogStatsRange(c)
+	if !ok {
+		return
+	}
+
 	stats, err := models.GetBlogStats()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, BlogResponse{
-			Success: false,
-			Error:   err.Error(),
-		})
+		apierror.Respond(c, err)
 		return
 	}
+	views, err := models.GetBlogViewStats(from, to, topBlogStats)
+	if err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+	stats["views"] = views
 
-	c.JSON(http.StatusOK, BlogResponse{
-		Success: true,
-		Data:    stats,
-	})
-}
-
-// GetBlogCategories handles retrieving available blog categories
-func GetBlogCategories(c *gin.Context) {
-	// These could be stored in database or config
-	categories := []string{
-		"Sức khỏe tổng quát",
-		"Tim mạch",
-		"Tiêu hóa",
-		"Thần kinh",
-		"Nhi khoa",
-		"Phụ khoa",
-		"Da liễu",
-		"Mắt",
-		"Tai mũi họng",
-		"Răng hàm mặt",
-		"Dinh dưỡng",
-		"Tâm lý",
-		"Tin tức y tế",
-		"Khuyến mãi",
-	}
-
-	c.JSON(http.StatusOK, BlogResponse{
-		Success: true,
-		Data:    categories,
-	})
+	response.OK(c, http.StatusOK, stats)
 }
 
-// PublishBlogPost handles publishing a draft blog post
+// PublishBlogPost handles publishing a draft blog post. It must have been
+// approved by a doctor, unless an admin adds ?override_review=true.
 func PublishBlogPost(c *gin.Context) {
 	idStr := c.Param("id")
 
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, BlogResponse{
-			Success: false,
-			Error:   "Invalid blog post ID",
-		})
+		apierror.Respond(c, apierror.BadRequest("error.invalid_id"))
 		return
 	}
 
 	// Get existing post
 	post, err := models.GetBlogPostByID(id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, BlogResponse{
-			Success: false,
-			Error:   "Blog post not found",
-		})
+		apierror.Respond(c, notFoundOr(err, "error.blog_post_not_found"))
+		return
+	}
+
+	if err := checkVersion(c, post.Version, 0, false); err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	override, err := reviewOverride(c)
+	if err != nil {
+		apierror.Respond(c, err)
 		return
 	}
 
-	// Update status to published
-	post.Status = "published"
+	// Publish now, even if it was scheduled for later
+	post.PublishNow()
+	post.EditorID = c.GetInt("user_id")
+	post.ReviewOverride = override
 	if err := post.Update(); err != nil {
-		c.JSON(http.StatusInternalServerError, BlogResponse{
-			Success: false,
-			Error:   err.Error(),
-		})
+		apierror.Respond(c, err)
 		return
 	}
+	setETag(c, post.Version)
+	labelMedicalReview(c, post)
 
-	c.JSON(http.StatusOK, BlogResponse{
-		Success: true,
-		Message: "Blog post published successfully",
-		Data:    post,
-	})
+	response.Message(c, http.StatusOK, "Blog post published successfully", post)
 }
 
 // UnpublishBlogPost handles unpublishing a blog post (back to draft)
@@ -336,89 +400,79 @@ func UnpublishBlogPost(c *gin.Context) {
 
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, BlogResponse{
-			Success: false,
-			Error:   "Invalid blog post ID",
-		})
+		apierror.Respond(c, apierror.BadRequest("error.invalid_id"))
 		return
 	}
 
 	// Get existing post
 	post, err := models.GetBlogPostByID(id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, BlogResponse{
-			Success: false,
-			Error:   "Blog post not found",
-		})
+		apierror.Respond(c, notFoundOr(err, "error.blog_post_not_found"))
+		return
+	}
+
+	if err := checkVersion(c, post.Version, 0, false); err != nil {
+		apierror.Respond(c, err)
 		return
 	}
 
 	// Update status to draft
 	post.Status = "draft"
+	post.EditorID = c.GetInt("user_id")
 	if err := post.Update(); err != nil {
-		c.JSON(http.StatusInternalServerError, BlogResponse{
-			Success: false,
-			Error:   err.Error(),
-		})
+		apierror.Respond(c, err)
 		return
 	}
+	setETag(c, post.Version)
 
-	c.JSON(http.StatusOK, BlogResponse{
-		Success: true,
-		Message: "Blog post unpublished successfully",
-		Data:    post,
-	})
+	response.Message(c, http.StatusOK, "Blog post unpublished successfully", post)
 }
 
-// GetPublishedBlogPosts returns only published blog posts for public consumption
+// GetPublishedBlogPosts returns only published blog posts for public
+// consumption, paged like GetBlogPosts; cursor pages are newest first
 func GetPublishedBlogPosts(c *gin.Context) {
-	// Force status to published for public endpoint
+	// Only posts the public can read now, never scheduled ones early
 	filter := models.BlogPostFilter{
-		Status: "published",
+		Visible: true,
 	}
 
 	if category := c.Query("category"); category != "" {
 		filter.Category = category
 	}
 
-	if search := c.Query("search"); search != "" {
-		filter.Search = search
+	if tag := c.Query("tag"); tag != "" {
+		filter.Tag = tag
 	}
 
-	if limitStr := c.Query("limit"); limitStr != "" {
-		if limit, err := strconv.Atoi(limitStr); err == nil && limit > 0 {
-			filter.Limit = limit
-		}
-	} else {
-		filter.Limit = 10 // Default limit
-	}
-
-	if offsetStr := c.Query("offset"); offsetStr != "" {
-		if offset, err := strconv.Atoi(offsetStr); err == nil && offset >= 0 {
-			filter.Offset = offset
-		}
+	if search := c.Query("search"); search != "" {
+		filter.Search = search
 	}
 
 	// Default sort by published date
 	filter.SortBy = "published_at"
 	filter.SortOrder = "desc"
 
-	posts, err := models.GetBlogPosts(filter)
+	p, err := parsePage(c, 10, true)
+	if err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+	filter.Limit, filter.Offset, filter.Keyset = p.fetchLimit(), p.Offset, p.Keyset
+
+	posts, total, err := listBlogPosts(filter)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, BlogResponse{
-			Success: false,
-			Error:   err.Error(),
-		})
+		apierror.Respond(c, err)
 		return
 	}
+	n, meta := p.meta(total, len(posts), func(i int) int { return posts[i].ID })
+	posts = posts[:n]
 
 	// Remove content field for list view to reduce payload size
 	for i := range posts {
-		posts[i].Content = ""
+		posts[i].ContentMarkdown = ""
+		posts[i].ContentHTML = ""
+		labelMedicalReview(c, &posts[i])
 	}
 
-	c.JSON(http.StatusOK, BlogResponse{
-		Success: true,
-		Data:    posts,
-	})
+	response.List(c, posts, meta)
 }
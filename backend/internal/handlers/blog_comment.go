@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dottrip/fpt-swp/internal/apierror"
+	"github.com/dottrip/fpt-swp/internal/models"
+	"github.com/dottrip/fpt-swp/internal/response"
+	"github.com/dottrip/fpt-swp/internal/spam"
+	"github.com/gin-gonic/gin"
+)
+
+// commentStatuses are the statuses a spam verdict gives a new comment
+var commentStatuses = map[spam.Verdict]string{
+	spam.Ham:        models.CommentApproved,
+	spam.Suspicious: models.CommentPending,
+	spam.Spam:       models.CommentSpam,
+}
+
+// visibleBlogPostParam loads the post named by the :id path parameter,
+// which readers must be able to see
+func visibleBlogPostParam(c *gin.Context) (*models.BlogPost, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, apierror.BadRequest("error.invalid_id"))
+		return nil, false
+	}
+
+	post, err := models.GetBlogPostByID(id)
+	if err == nil && !post.IsVisible(time.Now()) {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		apierror.Respond(c, notFoundOr(err, "error.blog_post_not_found"))
+		return nil, false
+	}
+	return post, true
+}
+
+// blogStaff loads the signed-in user, who must be staff or an admin
+func blogStaff(c *gin.Context) (*models.User, bool) {
+	user, ok := currentUser(c)
+	if !ok || !hasRole(user, "staff", "admin") {
+		apierror.Respond(c, apierror.Forbidden("error.forbidden"))
+		return nil, false
+	}
+	return user, true
+}
+
+// blogCommentParam loads the comment named by the :id path parameter
+func blogCommentParam(c *gin.Context) (*models.BlogComment, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, apierror.BadRequest("error.invalid_id"))
+		return nil, false
+	}
+
+	comment, err := models.GetBlogCommentByID(id)
+	if err != nil {
+		apierror.Respond(c, notFoundOr(err, "error.blog_comment_not_found"))
+		return nil, false
+	}
+	return comment, true
+}
+
+// GetBlogPostComments handles retrieving the approved comments of a
+// published post as threads, oldest first
+func GetBlogPostComments(c *gin.Context) {
+	post, ok := visibleBlogPostParam(c)
+	if !ok {
+		return
+	}
+
+	comments, err := models.GetBlogCommentThreads(post.ID)
+	if err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	response.OK(c, http.StatusOK, comments)
+}
+
+// CreateBlogPostComment handles a signed-in reader commenting on a
+// published post, or replying to a comment with parent_id. The spam
+// classifier decides whether it is published straight away, held for a
+// moderator or marked as spam; the response says only whether it is
+// published.
+func CreateBlogPostComment(c *gin.Context) {
+	post, ok := visibleBlogPostParam(c)
+	if !ok {
+		return
+	}
+
+	var input models.BlogCommentInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.FromBinding(err))
+		return
+	}
+
+	if !post.CommentsEnabled {
+		apierror.Respond(c, models.ErrCommentsDisabled)
+		return
+	}
+	authorID := c.GetInt("user_id")
+	banned, err := models.IsBannedFromComments(authorID)
+	if err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+	if banned {
+		apierror.Respond(c, models.ErrCommentBanned)
+		return
+	}
+
+	result := spam.Classify(c.Request.Context(), spam.Comment{
+		Body:     input.Body,
+		AuthorID: authorID,
+		PostID:   post.ID,
+		CountRecent: func(since time.Time) (int, error) {
+			return models.CountRecentBlogComments(authorID, since)
+		},
+	})
+
+	comment := models.BlogComment{
+		PostID:     post.ID,
+		ParentID:   input.ParentID,
+		AuthorID:   authorID,
+		Body:       input.Body,
+		Status:     commentStatuses[result.Verdict],
+		SpamReason: result.Reason,
+	}
+	if err := comment.Create(); err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+	if saved, err := models.GetBlogCommentByID(comment.ID); err == nil {
+		comment = *saved
+	}
+
+	// Spam is not announced to its author; it looks held like the rest
+	comment.SpamReason = ""
+	if comment.Status != models.CommentApproved {
+		comment.Status = models.CommentPending
+		response.Message(c, http.StatusAccepted, "Comment is awaiting moderation", comment)
+		return
+	}
+	response.Message(c, http.StatusCreated, "Comment posted successfully", comment)
+}
+
+// GetBlogComments handles the moderation queue: comments of every post,
+// oldest first, filtered by ?status= (pending by default, "all" for any)
+// and ?post_id=
+func GetBlogComments(c *gin.Context) {
+	if _, ok := blogStaff(c); !ok {
+		return
+	}
+
+	filter := models.BlogCommentFilter{Status: c.DefaultQuery("status", models.CommentPending)}
+	if filter.Status == "all" {
+		filter.Status = ""
+	}
+	if postID, err := strconv.Atoi(c.Query("post_id")); err == nil {
+		filter.PostID = postID
+	}
+
+	p, err := parsePage(c, 20, false)
+	if err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+	filter.Limit = p.fetchLimit()
+	filter.Offset = p.Offset
+	filter.Keyset = p.Keyset
+
+	comments, err := models.GetBlogComments(filter)
+	if err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+	total, err := models.CountBlogComments(filter)
+	if err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	n, meta := p.meta(total, len(comments), func(i int) int { return comments[i].ID })
+	response.List(c, comments[:n], meta)
+}
+
+// moderateBlogComment moves the comment named by :id to status
+func moderateBlogComment(c *gin.Context, status, message string) {
+	user, ok := blogStaff(c)
+	if !ok {
+		return
+	}
+	comment, ok := blogCommentParam(c)
+	if !ok {
+		return
+	}
+
+	if err := comment.Moderate(status, user.ID); err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	response.Message(c, http.StatusOK, message, comment)
+}
+
+// ApproveBlogComment handles publishing a held comment
+func ApproveBlogComment(c *gin.Context) {
+	moderateBlogComment(c, models.CommentApproved, "Comment approved")
+}
+
+// RejectBlogComment handles turning down a comment, or taking down a
+// published one
+func RejectBlogComment(c *gin.Context) {
+	moderateBlogComment(c, models.CommentRejected, "Comment rejected")
+}
+
+// MarkBlogCommentSpam handles marking a comment as spam
+func MarkBlogCommentSpam(c *gin.Context) {
+	moderateBlogComment(c, models.CommentSpam, "Comment marked as spam")
+}
+
+// BanBlogCommenter handles banning a comment's author from commenting. The
+// comment is marked as spam, and the author's other comments awaiting
+// moderation are rejected.
+func BanBlogCommenter(c *gin.Context) {
+	user, ok := blogStaff(c)
+	if !ok {
+		return
+	}
+	comment, ok := blogCommentParam(c)
+	if !ok {
+		return
+	}
+	var input models.BlogCommentBanInput
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			apierror.Respond(c, apierror.FromBinding(err))
+			return
+		}
+	}
+
+	if err := comment.Moderate(models.CommentSpam, user.ID); err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+	rejected, err := models.BanBlogCommenter(comment.AuthorID, user.ID, input.Reason)
+	if err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	response.Message(c, http.StatusOK, "User banned from commenting", gin.H{
+		"user_id":  comment.AuthorID,
+		"rejected": rejected,
+	})
+}
@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"html"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dottrip/fpt-swp/internal/apierror"
+	"github.com/dottrip/fpt-swp/internal/feed"
+	"github.com/dottrip/fpt-swp/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// feedLength is how many of the latest posts a feed carries
+const feedLength = 20
+
+// siteURL is the address of path on the public website, which feeds and
+// the sitemap link to
+func siteURL(path string) string {
+	baseURL := os.Getenv("FRONTEND_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:5173"
+	}
+	return strings.TrimRight(baseURL, "/") + path
+}
+
+// apiURL is the public address of path on this server
+func apiURL(path string) string {
+	baseURL := os.Getenv("PUBLIC_API_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:8080"
+	}
+	return strings.TrimRight(baseURL, "/") + path
+}
+
+// Pages of the public website
+func blogPostURL(slug string) string     { return siteURL("/blog/" + url.PathEscape(slug)) }
+func blogCategoryURL(slug string) string { return siteURL("/blog?category=" + url.QueryEscape(slug)) }
+func doctorURL(id int) string            { return siteURL("/doctors/" + strconv.Itoa(id)) }
+
+// blogFeed builds the feed of the latest posts the public can read, only
+// those of the category named by the :slug path parameter if there is one.
+// It also returns when the newest change in the feed was made, zero if the
+// feed is empty.
+func blogFeed(c *gin.Context) (feed.Feed, time.Time, bool) {
+	title := os.Getenv("CLINIC_NAME")
+	if title == "" {
+		title = "Phòng khám Medical"
+	}
+	f := feed.Feed{
+		Title:       title + " - Blog",
+		Description: "Bài viết sức khỏe từ " + title,
+		Language:    "vi",
+		Link:        siteURL("/blog"),
+		FeedURL:     apiURL(c.Request.URL.Path),
+		Items:       []feed.Item{},
+	}
+	// An empty feed needs a fixed update time, or its ETag would change on
+	// every request
+	emptyUpdated := time.Unix(0, 0).UTC()
+
+	filter := models.BlogPostFilter{
+		Visible:   true,
+		SortBy:    "published_at",
+		SortOrder: "desc",
+		Limit:     feedLength,
+	}
+	if slug := c.Param("slug"); slug != "" {
+		category, err := models.BlogCategories.GetBySlug(slug)
+		if err != nil {
+			apierror.Respond(c, notFoundOr(err, "error.blog_category_not_found"))
+			return f, time.Time{}, false
+		}
+		filter.Category = category.Slug
+		emptyUpdated = category.CreatedAt
+		f.Title += " - " + category.Name
+		f.Link = blogCategoryURL(category.Slug)
+	}
+
+	posts, err := models.GetBlogPosts(filter)
+	if err != nil {
+		apierror.Respond(c, err)
+		return f, time.Time{}, false
+	}
+
+	var modified time.Time
+	for _, post := range posts {
+		item := feed.Item{
+			ID:          blogPostURL(post.Slug),
+			URL:         blogPostURL(post.Slug),
+			Title:       html.UnescapeString(post.Title),
+			Summary:     post.Excerpt,
+			ContentHTML: post.ContentHTML,
+			Image:       html.UnescapeString(post.Thumbnail),
+			Author:      post.AuthorName,
+			Published:   post.PublicSince(),
+			Updated:     post.LastModified(),
+		}
+		if post.Category != "" {
+			item.Categories = append(item.Categories, post.Category)
+		}
+		for _, tag := range post.TagList {
+			item.Categories = append(item.Categories, tag.Name)
+		}
+		if item.Updated.After(modified) {
+			modified = item.Updated
+		}
+		f.Items = append(f.Items, item)
+	}
+
+	f.Updated = modified
+	if modified.IsZero() {
+		f.Updated = emptyUpdated
+	}
+	return f, modified, true
+}
+
+// serveBlogFeed renders the feed with render and sends it as contentType
+func serveBlogFeed(c *gin.Context, contentType string, render func(feed.Feed) ([]byte, error)) {
+	f, modified, ok := blogFeed(c)
+	if !ok {
+		return
+	}
+	body, err := render(f)
+	if err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+	sendCacheable(c, contentType, body, modified)
+}
+
+// sendCacheable sends body tagged with a hash of itself and, unless zero,
+// the time it was last modified, answering conditional GETs whose copy is
+// still current with 304 Not Modified
+func sendCacheable(c *gin.Context, contentType string, body []byte, modified time.Time) {
+	sum := sha256.Sum256(body)
+	c.Header("ETag", `"`+hex.EncodeToString(sum[:8])+`"`)
+	c.Header("Content-Type", contentType)
+	c.Header("Cache-Control", "public, max-age=300")
+	http.ServeContent(c.Writer, c.Request, "", modified, bytes.NewReader(body))
+}
+
+// GetBlogFeedRSS handles GET /blog/feed.rss and
+// /blog/categories/:slug/feed.rss
+func GetBlogFeedRSS(c *gin.Context) {
+	serveBlogFeed(c, "application/rss+xml; charset=utf-8", feed.RSS)
+}
+
+// GetBlogFeedAtom handles GET /blog/feed.atom and
+// /blog/categories/:slug/feed.atom
+func GetBlogFeedAtom(c *gin.Context) {
+	serveBlogFeed(c, "application/atom+xml; charset=utf-8", feed.Atom)
+}
+
+// GetBlogFeedJSON handles GET /blog/feed.json and
+// /blog/categories/:slug/feed.json
+func GetBlogFeedJSON(c *gin.Context) {
+	serveBlogFeed(c, "application/feed+json; charset=utf-8", feed.JSON)
+}
+
+// GetSitemap handles GET /sitemap.xml, listing the blog, the posts the
+// public can read, the categories that have any and the profiles of
+// doctors still practicing, each with when it last changed
+func GetSitemap(c *gin.Context) {
+	posts, err := models.GetVisibleBlogPostDates()
+	if err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+	categories, err := models.BlogCategories.List()
+	if err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+	doctors, err := models.GetAllDoctors(models.DoctorFilter{})
+	if err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	// A category changes whenever one of its posts does
+	var modified time.Time
+	categoryModified := map[string]time.Time{}
+	var postURLs []feed.URL
+	for i := range posts {
+		lastMod := posts[i].LastModified()
+		postURLs = append(postURLs, feed.URL{Loc: blogPostURL(posts[i].Slug), LastMod: lastMod})
+		if lastMod.After(categoryModified[posts[i].CategorySlug]) {
+			categoryModified[posts[i].CategorySlug] = lastMod
+		}
+		if lastMod.After(modified) {
+			modified = lastMod
+		}
+	}
+
+	urls := []feed.URL{{Loc: siteURL("/blog"), LastMod: modified}}
+	urls = append(urls, postURLs...)
+	for _, category := range categories {
+		if category.PostCount > 0 {
+			urls = append(urls, feed.URL{Loc: blogCategoryURL(category.Slug), LastMod: categoryModified[category.Slug]})
+		}
+	}
+	for _, doctor := range doctors {
+		if doctor.Status == "inactive" {
+			continue
+		}
+		urls = append(urls, feed.URL{Loc: doctorURL(doctor.ID), LastMod: doctor.UpdatedAt})
+		if doctor.UpdatedAt.After(modified) {
+			modified = doctor.UpdatedAt
+		}
+	}
+
+	body, err := feed.Sitemap(urls)
+	if err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+	sendCacheable(c, "application/xml; charset=utf-8", body, modified)
+}
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/dottrip/fpt-swp/internal/apierror"
+	"github.com/dottrip/fpt-swp/internal/models"
+	"github.com/dottrip/fpt-swp/internal/response"
+	"github.com/dottrip/fpt-swp/internal/templates"
+	"github.com/gin-gonic/gin"
+)
+
+// reviewOverride reports whether the request publishes without a medical
+// review, with ?override_review=true; only admins may
+func reviewOverride(c *gin.Context) (bool, error) {
+	if c.Query("override_review") != "true" {
+		return false, nil
+	}
+	user, ok := currentUser(c)
+	if !ok || !hasRole(user, "admin") {
+		return false, apierror.Forbidden("error.forbidden")
+	}
+	return true, nil
+}
+
+// labelMedicalReview fills in the "medically reviewed by" label of the
+// post's approval, in the request's language
+func labelMedicalReview(c *gin.Context, post *models.BlogPost) {
+	if post.MedicalReview == nil {
+		return
+	}
+	post.MedicalReview.Label = templates.Default.Message(requestLocale(c), "blog.medically_reviewed",
+		map[string]string{"Name": post.MedicalReview.ReviewerName})
+}
+
+// reviewerName is the name a doctor's approval is shown with: the name on
+// their doctor profile, or their username without one
+func reviewerName(user *models.User) string {
+	if doctor, err := models.GetDoctorByEmail(user.Email); err == nil {
+		return doctor.Name
+	}
+	return user.Username
+}
+
+// assignedReviewer loads the signed-in user, who must be the doctor asked
+// to review the post
+func assignedReviewer(c *gin.Context, post *models.BlogPost) (*models.User, bool) {
+	user, ok := currentUser(c)
+	if !ok {
+		apierror.Respond(c, apierror.Unauthorized())
+		return nil, false
+	}
+	if post.ReviewerID == nil || *post.ReviewerID != user.ID || !hasRole(user, "doctor") {
+		apierror.Respond(c, apierror.Forbidden("error.blog_not_reviewer"))
+		return nil, false
+	}
+	return user, true
+}
+
+// reviewerDoctor loads the user with ID id, who must be a doctor to review
+// a post
+func reviewerDoctor(c *gin.Context, id int) (*models.User, bool) {
+	reviewer, err := models.GetByID(id)
+	if err != nil || !hasRole(reviewer, "doctor") {
+		apierror.Respond(c, apierror.Validation(apierror.FieldError{Field: "reviewer_id", Code: "doctor"}))
+		return nil, false
+	}
+	return reviewer, true
+}
+
+// bindReview binds the optional body of a review action
+func bindReview(c *gin.Context) (models.BlogReviewInput, bool) {
+	var input models.BlogReviewInput
+	if c.Request.ContentLength == 0 {
+		return input, true
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.FromBinding(err))
+		return input, false
+	}
+	return input, true
+}
+
+// SubmitBlogPostForReview handles asking a doctor to review a post. The
+// post is pending review until they approve it or ask for changes.
+func SubmitBlogPostForReview(c *gin.Context) {
+	post, ok := blogPostParam(c)
+	if !ok {
+		return
+	}
+	input, ok := bindReview(c)
+	if !ok {
+		return
+	}
+	if err := checkVersion(c, post.Version, 0, false); err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	if input.ReviewerID == 0 {
+		apierror.Respond(c, apierror.Validation(apierror.FieldError{Field: "reviewer_id", Code: "required"}))
+		return
+	}
+	reviewer, ok := reviewerDoctor(c, input.ReviewerID)
+	if !ok {
+		return
+	}
+
+	if err := post.SubmitForReview(reviewer.ID, c.GetInt("user_id"), input.Body); err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+	setETag(c, post.Version)
+
+	response.Message(c, http.StatusOK, "Blog post submitted for review", post)
+}
+
+// ApproveBlogPost handles the assigned doctor approving a post pending
+// review. It returns to draft, ready to publish with their name shown.
+func ApproveBlogPost(c *gin.Context) {
+	post, ok := blogPostParam(c)
+	if !ok {
+		return
+	}
+	reviewer, ok := assignedReviewer(c, post)
+	if !ok {
+		return
+	}
+	input, ok := bindReview(c)
+	if !ok {
+		return
+	}
+	if err := checkVersion(c, post.Version, 0, false); err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	if err := post.Approve(reviewer.ID, reviewerName(reviewer), input.Body); err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+	setETag(c, post.Version)
+	labelMedicalReview(c, post)
+
+	response.Message(c, http.StatusOK, "Blog post approved", post)
+}
+
+// RequestBlogPostChanges handles the assigned doctor sending a post pending
+// review back to draft with a comment on what to change
+func RequestBlogPostChanges(c *gin.Context) {
+	post, ok := blogPostParam(c)
+	if !ok {
+		return
+	}
+	reviewer, ok := assignedReviewer(c, post)
+	if !ok {
+		return
+	}
+	input, ok := bindReview(c)
+	if !ok {
+		return
+	}
+	if err := checkVersion(c, post.Version, 0, false); err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	if err := post.RequestChanges(reviewer.ID, input.Body); err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+	setETag(c, post.Version)
+
+	response.Message(c, http.StatusOK, "Changes requested", post)
+}
+
+// GetBlogReviewComments handles listing the review comments of a post,
+// oldest first
+func GetBlogReviewComments(c *gin.Context) {
+	post, ok := blogPostParam(c)
+	if !ok {
+		return
+	}
+
+	comments, err := models.GetBlogReviewComments(post.ID)
+	if err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	response.OK(c, http.StatusOK, comments)
+}
+
+// CreateBlogReviewComment handles commenting on the current version of a
+// post
+func CreateBlogReviewComment(c *gin.Context) {
+	post, ok := blogPostParam(c)
+	if !ok {
+		return
+	}
+	var input models.BlogReviewInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.FromBinding(err))
+		return
+	}
+
+	comment, err := post.AddReviewComment(c.GetInt("user_id"), input.Body)
+	if err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	response.Message(c, http.StatusCreated, "Comment added", comment)
+}
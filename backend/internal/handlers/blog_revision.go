@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/dottrip/fpt-swp/internal/apierror"
+	"github.com/dottrip/fpt-swp/internal/models"
+	"github.com/dottrip/fpt-swp/internal/response"
+	"github.com/gin-gonic/gin"
+)
+
+// blogPostParam loads the post named by the :id path parameter
+func blogPostParam(c *gin.Context) (*models.BlogPost, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, apierror.BadRequest("error.invalid_id"))
+		return nil, false
+	}
+
+	post, err := models.GetBlogPostByID(id)
+	if err != nil {
+		apierror.Respond(c, notFoundOr(err, "error.blog_post_not_found"))
+		return nil, false
+	}
+	return post, true
+}
+
+// blogRevision loads revision version of a post
+func blogRevision(c *gin.Context, postID int, version string) (*models.BlogRevision, bool) {
+	v, err := strconv.Atoi(version)
+	if err != nil {
+		apierror.Respond(c, apierror.BadRequest("error.invalid_id"))
+		return nil, false
+	}
+
+	revision, err := models.GetBlogRevision(postID, v)
+	if err != nil {
+		apierror.Respond(c, notFoundOr(err, "error.blog_revision_not_found"))
+		return nil, false
+	}
+	return revision, true
+}
+
+// GetBlogRevisions handles listing the revisions of a post, newest first
+func GetBlogRevisions(c *gin.Context) {
+	post, ok := blogPostParam(c)
+	if !ok {
+		return
+	}
+
+	revisions, err := models.GetBlogRevisions(post.ID)
+	if err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	response.OK(c, http.StatusOK, revisions)
+}
+
+// GetBlogRevision handles retrieving one revision of a post with its content
+func GetBlogRevision(c *gin.Context) {
+	post, ok := blogPostParam(c)
+	if !ok {
+		return
+	}
+
+	revision, ok := blogRevision(c, post.ID, c.Param("rev"))
+	if !ok {
+		return
+	}
+
+	response.OK(c, http.StatusOK, revision)
+}
+
+// DiffBlogRevisions handles GET .../revisions/diff?from=&to=, a unified diff
+// between two revisions of a post. to defaults to the current version.
+func DiffBlogRevisions(c *gin.Context) {
+	post, ok := blogPostParam(c)
+	if !ok {
+		return
+	}
+
+	if c.Query("from") == "" {
+		apierror.Respond(c, apierror.Field("from", "required", ""))
+		return
+	}
+	from, ok := blogRevision(c, post.ID, c.Query("from"))
+	if !ok {
+		return
+	}
+	to, ok := blogRevision(c, post.ID, c.DefaultQuery("to", strconv.Itoa(post.Version)))
+	if !ok {
+		return
+	}
+
+	diff, err := models.DiffBlogRevisions(from, to)
+	if err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	response.OK(c, http.StatusOK, diff)
+}
+
+// RestoreBlogRevision handles bringing back the title, content and excerpt
+// of an earlier revision. The restore is saved as a new revision, so it can
+// be undone the same way; If-Match is optional.
+func RestoreBlogRevision(c *gin.Context) {
+	post, ok := blogPostParam(c)
+	if !ok {
+		return
+	}
+
+	revision, ok := blogRevision(c, post.ID, c.Param("rev"))
+	if !ok {
+		return
+	}
+
+	if err := checkVersion(c, post.Version, 0, false); err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+	override, err := reviewOverride(c)
+	if err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	revision.Restore(post)
+	post.EditorID = c.GetInt("user_id")
+	post.ReviewOverride = override
+	if err := post.Update(); err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+	setETag(c, post.Version)
+
+	response.Message(c, http.StatusOK, "Blog post restored successfully", post)
+}
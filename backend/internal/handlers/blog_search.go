@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/dottrip/fpt-swp/internal/apierror"
+	"github.com/dottrip/fpt-swp/internal/models"
+	"github.com/dottrip/fpt-swp/internal/response"
+	"github.com/gin-gonic/gin"
+)
+
+// SearchBlogPosts handles GET /blog/search?q=, the posts the public can read
+// that contain the words searched for, best matches first. Results page
+// with ?limit=&offset= only, since they are not ordered by ID.
+func SearchBlogPosts(c *gin.Context) {
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		apierror.Respond(c, apierror.Validation(apierror.FieldError{Field: "q", Code: "required"}))
+		return
+	}
+
+	filter := models.BlogPostFilter{
+		Visible:  true,
+		Search:   query,
+		Category: c.Query("category"),
+		Tag:      c.Query("tag"),
+	}
+
+	p, err := parsePage(c, 10, true)
+	if err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+	p.Keyset = nil
+	filter.Limit, filter.Offset = p.Limit, p.Offset
+
+	results, err := models.SearchBlogPosts(filter)
+	if err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+	total, err := models.CountBlogPosts(filter)
+	if err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+	_, meta := p.meta(total, len(results), func(i int) int { return results[i].ID })
+
+	// Like other lists, results leave out the content
+	for i := range results {
+		results[i].ContentMarkdown = ""
+		results[i].ContentHTML = ""
+		labelMedicalReview(c, &results[i].BlogPost)
+	}
+
+	response.List(c, results, meta)
+}
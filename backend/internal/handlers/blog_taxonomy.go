@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/dottrip/fpt-swp/internal/apierror"
+	"github.com/dottrip/fpt-swp/internal/models"
+	"github.com/dottrip/fpt-swp/internal/response"
+	"github.com/gin-gonic/gin"
+)
+
+// listBlogTerms responds with every term of a taxonomy and its count of
+// published posts
+func listBlogTerms(c *gin.Context, x models.BlogTaxonomy) {
+	terms, err := x.List()
+	if err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	response.OK(c, http.StatusOK, terms)
+}
+
+// blogTermParam loads the term named by the :id path parameter
+func blogTermParam(c *gin.Context, x models.BlogTaxonomy, notFound string) (*models.BlogTerm, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, apierror.BadRequest("error.invalid_id"))
+		return nil, false
+	}
+
+	term, err := x.Get(id)
+	if err != nil {
+		apierror.Respond(c, notFoundOr(err, notFound))
+		return nil, false
+	}
+	return term, true
+}
+
+// createBlogTerm handles adding a term to a taxonomy
+func createBlogTerm(c *gin.Context, x models.BlogTaxonomy, message string) {
+	if _, ok := blogStaff(c); !ok {
+		return
+	}
+
+	var input models.BlogTermInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.FromBinding(err))
+		return
+	}
+
+	term := models.BlogTerm{Name: input.Name, Slug: input.Slug, Description: input.Description}
+	if err := x.Create(&term); err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	response.Message(c, http.StatusCreated, message, term)
+}
+
+// updateBlogTerm handles renaming a term; every post filed under it shows
+// the new name
+func updateBlogTerm(c *gin.Context, x models.BlogTaxonomy, notFound, message string) {
+	if _, ok := blogStaff(c); !ok {
+		return
+	}
+	term, ok := blogTermParam(c, x, notFound)
+	if !ok {
+		return
+	}
+
+	var input models.BlogTermInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.FromBinding(err))
+		return
+	}
+
+	term.Name, term.Description = input.Name, input.Description
+	if input.Slug != "" {
+		term.Slug = input.Slug
+	}
+	if err := x.Update(term); err != nil {
+		apierror.Respond(c, notFoundOr(err, notFound))
+		return
+	}
+
+	response.Message(c, http.StatusOK, message, term)
+}
+
+// deleteBlogTerm handles deleting a term, taking it off every post
+func deleteBlogTerm(c *gin.Context, x models.BlogTaxonomy, notFound, message string) {
+	if _, ok := blogStaff(c); !ok {
+		return
+	}
+	term, ok := blogTermParam(c, x, notFound)
+	if !ok {
+		return
+	}
+
+	if err := x.Delete(term.ID); err != nil {
+		apierror.Respond(c, notFoundOr(err, notFound))
+		return
+	}
+
+	response.Message(c, http.StatusOK, message, nil)
+}
+
+// mergeBlogTerm handles moving every post from one term to another and
+// deleting the first
+func mergeBlogTerm(c *gin.Context, x models.BlogTaxonomy, notFound, message string) {
+	if _, ok := blogStaff(c); !ok {
+		return
+	}
+	term, ok := blogTermParam(c, x, notFound)
+	if !ok {
+		return
+	}
+
+	var input models.BlogTermMergeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.FromBinding(err))
+		return
+	}
+
+	if err := x.Merge(term.ID, input.IntoID); err != nil {
+		apierror.Respond(c, notFoundOr(err, notFound))
+		return
+	}
+	into, err := x.Get(input.IntoID)
+	if err != nil {
+		apierror.Respond(c, notFoundOr(err, notFound))
+		return
+	}
+
+	response.Message(c, http.StatusOK, message, into)
+}
+
+// GetBlogCategories handles listing the blog categories with their counts
+// of published posts, by name
+func GetBlogCategories(c *gin.Context) {
+	listBlogTerms(c, models.BlogCategories)
+}
+
+// CreateBlogCategory handles adding a category
+func CreateBlogCategory(c *gin.Context) {
+	createBlogTerm(c, models.BlogCategories, "Category created successfully")
+}
+
+// UpdateBlogCategory handles renaming a category
+func UpdateBlogCategory(c *gin.Context) {
+	updateBlogTerm(c, models.BlogCategories, "error.blog_category_not_found", "Category updated successfully")
+}
+
+// DeleteBlogCategory handles deleting a category; its posts are left
+// without one
+func DeleteBlogCategory(c *gin.Context) {
+	deleteBlogTerm(c, models.BlogCategories, "error.blog_category_not_found", "Category deleted successfully")
+}
+
+// MergeBlogCategory handles merging a category into another
+func MergeBlogCategory(c *gin.Context) {
+	mergeBlogTerm(c, models.BlogCategories, "error.blog_category_not_found", "Categories merged successfully")
+}
+
+// GetBlogTags handles listing the blog tags with their counts of published
+// posts, by name
+func GetBlogTags(c *gin.Context) {
+	listBlogTerms(c, models.BlogTags)
+}
+
+// CreateBlogTag handles adding a tag
+func CreateBlogTag(c *gin.Context) {
+	createBlogTerm(c, models.BlogTags, "Tag created successfully")
+}
+
+// UpdateBlogTag handles renaming a tag
+func UpdateBlogTag(c *gin.Context) {
+	updateBlogTerm(c, models.BlogTags, "error.blog_tag_not_found", "Tag updated successfully")
+}
+
+// DeleteBlogTag handles deleting a tag, taking it off every post
+func DeleteBlogTag(c *gin.Context) {
+	deleteBlogTerm(c, models.BlogTags, "error.blog_tag_not_found", "Tag deleted successfully")
+}
+
+// MergeBlogTag handles merging a tag into another
+func MergeBlogTag(c *gin.Context) {
+	mergeBlogTerm(c, models.BlogTags, "error.blog_tag_not_found", "Tags merged successfully")
+}
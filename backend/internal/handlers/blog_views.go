@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dottrip/fpt-swp/internal/apierror"
+	"github.com/dottrip/fpt-swp/internal/models"
+	"github.com/dottrip/fpt-swp/internal/pageviews"
+	"github.com/gin-gonic/gin"
+)
+
+// countView counts a view of the post when the client asks with
+// ?increment_view=true. Visitors are told apart by IP alone, so changing
+// the user agent does not make a new visitor; the user agent only picks
+// out bots. Bots, prefetches and a visitor's repeated views within the
+// window do not count; see pageviews.
+func countView(c *gin.Context, post *models.BlogPost) {
+	if c.Query("increment_view") != "true" {
+		return
+	}
+	purpose := c.GetHeader("Sec-Purpose") + c.GetHeader("Purpose")
+	if strings.Contains(strings.ToLower(purpose), "prefetch") {
+		return
+	}
+
+	pageviews.Default.Record(pageviews.View{
+		PostID:    post.ID,
+		Visitor:   pageviews.Fingerprint(c.ClientIP()),
+		Referrer:  c.Request.Referer(),
+		UserAgent: c.Request.UserAgent(),
+		At:        time.Now(),
+	})
+}
+
+const (
+	// topBlogStats is how many posts and referring sites stats list
+	topBlogStats = 10
+
+	// maxBlogStatsDays is the longest range of days stats cover
+	maxBlogStatsDays = 366
+)
+
+// blogStatsRange parses the days ?from= and ?to= (YYYY-MM-DD, both
+// included) of blog stats. They default to the last 30 days, clinic time.
+func blogStatsRange(c *gin.Context) (time.Time, time.Time, bool) {
+	y, m, d := time.Now().In(models.ClinicLocation()).Date()
+	to := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	from := to.AddDate(0, 0, -29)
+
+	if value := c.Query("from"); value != "" {
+		t, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			apierror.Respond(c, apierror.Field("from", "datetime", "2006-01-02"))
+			return time.Time{}, time.Time{}, false
+		}
+		from = t
+	}
+	if value := c.Query("to"); value != "" {
+		t, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			apierror.Respond(c, apierror.Field("to", "datetime", "2006-01-02"))
+			return time.Time{}, time.Time{}, false
+		}
+		to = t
+	}
+
+	if to.Before(from) {
+		apierror.Respond(c, apierror.Field("to", "gtefield", "from"))
+		return time.Time{}, time.Time{}, false
+	}
+	if to.Sub(from) >= maxBlogStatsDays*24*time.Hour {
+		apierror.Respond(c, apierror.Field("to", "max_days", strconv.Itoa(maxBlogStatsDays)))
+		return time.Time{}, time.Time{}, false
+	}
+	return from, to, true
+}
@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/dottrip/fpt-swp/internal/apierror"
+	"github.com/dottrip/fpt-swp/internal/chat"
+	"github.com/dottrip/fpt-swp/internal/models"
+	"github.com/dottrip/fpt-swp/internal/response"
+	"github.com/gin-gonic/gin"
+)
+
+// SendMessageInput represents the request body for sending a message over REST
+type SendMessageInput struct {
+	Body     string `json:"body" binding:"required,max=4000"`
+	ClientID string `json:"client_id" binding:"max=64"`
+}
+
+// MarkReadInput represents the request body for a read receipt
+type MarkReadInput struct {
+	MessageID int `json:"message_id" binding:"required"`
+}
+
+// CreateConversation handles POST /api/conversations
+func CreateConversation(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		apierror.Respond(c, apierror.Unauthorized())
+		return
+	}
+
+	var req models.ConversationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, apierror.FromBinding(err))
+		return
+	}
+
+	if len(req.MemberIDs) == 0 {
+		apierror.Respond(c, apierror.Field("member_ids", "required", ""))
+		return
+	}
+
+	for _, memberID := range req.MemberIDs {
+		if _, err := models.GetByID(memberID); err != nil {
+			apierror.Respond(c, apierror.Field("member_ids", "exists", strconv.Itoa(memberID)))
+			return
+		}
+	}
+
+	conversation := &models.Conversation{
+		Type:      req.Type,
+		Title:     req.Title,
+		CreatedBy: user.ID,
+	}
+
+	if err := conversation.Create(req.MemberIDs); err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	response.Message(c, http.StatusCreated, "Conversation created successfully", conversation)
+}
+
+// GetConversations handles GET /api/conversations
+func GetConversations(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		apierror.Respond(c, apierror.Unauthorized())
+		return
+	}
+
+	conversations, err := models.GetConversationsForUser(user.ID)
+	if err != nil {
+		apierror.Respond(c, apierror.Internal(err))
+		return
+	}
+
+	response.OK(c, http.StatusOK, conversations)
+}
+
+// conversationMember resolves the :id parameter and checks that the caller is a member.
+// Non-members get a 404 so conversation IDs cannot be probed.
+func conversationMember(c *gin.Context) (*models.User, int, bool) {
+	user, ok := currentUser(c)
+	if !ok {
+		apierror.Respond(c, apierror.Unauthorized())
+		return nil, 0, false
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, apierror.BadRequest("error.invalid_id"))
+		return nil, 0, false
+	}
+
+	isMember, err := models.IsConversationMember(id, user.ID)
+	if err != nil || !isMember {
+		apierror.Respond(c, apierror.NotFound("error.conversation_not_found"))
+		return nil, 0, false
+	}
+
+	return user, id, true
+}
+
+// GetConversation handles GET /api/conversations/{id}
+func GetConversation(c *gin.Context) {
+	_, id, ok := conversationMember(c)
+	if !ok {
+		return
+	}
+
+	conversation, err := models.GetConversationByID(id)
+	if err != nil {
+		apierror.Respond(c, apierror.NotFound("error.conversation_not_found"))
+		return
+	}
+
+	response.OK(c, http.StatusOK, conversation)
+}
+
+// GetConversationMessages handles GET /api/conversations/{id}/messages.
+// Pages backwards through history with ?limit= and ?cursor=, the
+// meta.next_cursor of the previous page; ?before_id= is still accepted.
+func GetConversationMessages(c *gin.Context) {
+	_, id, ok := conversationMember(c)
+	if !ok {
+		return
+	}
+
+	limit := 50
+	if limitStr := c.Query("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 100 {
+			limit = l
+		}
+	}
+
+	beforeID := 0
+	if cursor := c.Query("cursor"); cursor != "" {
+		position, err := response.DecodeCursor(cursor)
+		if err != nil {
+			apierror.Respond(c, apierror.BadRequest("error.invalid_cursor"))
+			return
+		}
+		beforeID = position.ID
+	} else if beforeStr := c.Query("before_id"); beforeStr != "" {
+		if b, err := strconv.Atoi(beforeStr); err == nil && b > 0 {
+			beforeID = b
+		}
+	}
+
+	messages, hasMore, err := models.GetMessages(id, beforeID, limit)
+	if err != nil {
+		apierror.Respond(c, apierror.Internal(err))
+		return
+	}
+	total, err := models.CountMessages(id)
+	if err != nil {
+		apierror.Respond(c, apierror.Internal(err))
+		return
+	}
+
+	// Pages run from newest to oldest; each is in chronological order, so
+	// the next one starts before its first message
+	meta := response.Meta{Total: total, Limit: limit, HasMore: hasMore}
+	if hasMore && len(messages) > 0 {
+		meta.NextCursor = response.EncodeCursor(response.Cursor{ID: messages[0].ID, Desc: true})
+	}
+
+	response.List(c, messages, meta)
+}
+
+// SendConversationMessage handles POST /api/conversations/{id}/messages, a
+// REST fallback for clients that cannot keep a WebSocket open
+func SendConversationMessage(c *gin.Context) {
+	user, id, ok := conversationMember(c)
+	if !ok {
+		return
+	}
+
+	var input SendMessageInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.FromBinding(err))
+		return
+	}
+
+	message, err := chat.DefaultHub.SendMessage(user.ID, id, input.Body, input.ClientID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotConversationMember) {
+			apierror.Respond(c, apierror.NotFound("error.conversation_not_found"))
+			return
+		}
+		apierror.Respond(c, err)
+		return
+	}
+
+	response.OK(c, http.StatusCreated, message)
+}
+
+// MarkConversationRead handles POST /api/conversations/{id}/read
+func MarkConversationRead(c *gin.Context) {
+	user, id, ok := conversationMember(c)
+	if !ok {
+		return
+	}
+
+	var input MarkReadInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.FromBinding(err))
+		return
+	}
+
+	if err := chat.DefaultHub.MarkRead(user.ID, id, input.MessageID); err != nil {
+		if errors.Is(err, models.ErrMessageNotInConversation) {
+			apierror.Respond(c, apierror.Field("message_id", "conversation_message", ""))
+			return
+		}
+		apierror.Respond(c, apierror.Internal(err))
+		return
+	}
+
+	response.Message(c, http.StatusOK, "Conversation marked as read", nil)
+}
+
+// ChatWebSocket handles GET /api/ws/chat, upgrading to a WebSocket for
+// real-time messages, typing indicators and read receipts
+func ChatWebSocket(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		apierror.Respond(c, apierror.Unauthorized())
+		return
+	}
+
+	conn, err := chat.Upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// The upgrader has already written an error response
+		log.Printf("chat: websocket upgrade failed: %v", err)
+		return
+	}
+
+	chat.DefaultHub.ServeConn(conn, user.ID)
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dottrip/fpt-swp/internal/apierror"
+	"github.com/dottrip/fpt-swp/internal/mergepatch"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// etag is the entity tag of a resource at version
+func etag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// setETag tags the response with the version of the resource it carries
+func setETag(c *gin.Context, version int) {
+	c.Header("ETag", etag(version))
+}
+
+// checkVersion enforces optimistic concurrency for a write to a resource at
+// version current. The client names the version its change is based on in
+// If-Match, in the body's version member (bodyVersion, 0 if absent), or both.
+// A write naming another version fails with 412; a write that is required
+// to name one and does not fails with 428.
+func checkVersion(c *gin.Context, current, bodyVersion int, required bool) error {
+	named, matched := false, true
+
+	if header := c.GetHeader("If-Match"); header != "" {
+		named = true
+		matched = ifMatch(header, current)
+	}
+	if bodyVersion != 0 {
+		named = true
+		matched = matched && bodyVersion == current
+	}
+
+	if !named && required {
+		return apierror.PreconditionRequired()
+	}
+	if !matched {
+		return apierror.PreconditionFailed()
+	}
+	return nil
+}
+
+// ifMatch reports whether an If-Match header matches version. Weak tags
+// are compared by value, since ETags here only ever name a version.
+func ifMatch(header string, version int) bool {
+	want := etag(version)
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == want {
+			return true
+		}
+	}
+	return false
+}
+
+// bindMergePatch applies the JSON Merge Patch in the request body to
+// current, the resource as its request type, then decodes and validates the
+// result into target like ShouldBindJSON. Only the members the patch sets
+// are validated. Bodies may be sent as application/merge-patch+json or
+// application/json.
+func bindMergePatch(c *gin.Context, current, target interface{}) error {
+	switch c.ContentType() {
+	case mergepatch.ContentType, binding.MIMEJSON:
+	default:
+		return apierror.New(http.StatusUnsupportedMediaType, apierror.CodeUnsupportedMediaType).WithKey("error.merge_patch_type", map[string]interface{}{"ContentType": mergepatch.ContentType})
+	}
+
+	patch, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return apierror.FromBinding(err)
+	}
+	if len(strings.TrimSpace(string(patch))) == 0 {
+		return apierror.FromBinding(io.EOF)
+	}
+
+	document, err := json.Marshal(current)
+	if err != nil {
+		return apierror.Internal(err)
+	}
+	merged, err := mergepatch.Apply(document, patch)
+	if err != nil {
+		return apierror.FromBinding(err)
+	}
+	if err := binding.JSON.BindBody(merged, target); err != nil {
+		if err = patchedErrors(err, patch); err != nil {
+			return apierror.FromBinding(err)
+		}
+	}
+	return nil
+}
+
+// patchedErrors drops the validation errors of members the patch leaves
+// alone, so records stored before a rule was added can still be patched;
+// it returns nil if none are left. Other errors are returned as they are.
+func patchedErrors(err error, patch []byte) error {
+	var verrs validator.ValidationErrors
+	var members map[string]json.RawMessage
+	if !errors.As(err, &verrs) || json.Unmarshal(patch, &members) != nil {
+		return err
+	}
+
+	var kept validator.ValidationErrors
+	for _, fe := range verrs {
+		// The namespace is the struct name, then the member's JSON name
+		_, path, _ := strings.Cut(fe.Namespace(), ".")
+		member, _, _ := strings.Cut(path, ".")
+		member, _, _ = strings.Cut(member, "[")
+		if _, ok := members[member]; ok {
+			kept = append(kept, fe)
+		}
+	}
+	if len(kept) == 0 {
+		return nil
+	}
+	return kept
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dottrip/fpt-swp/internal/apierror"
+	"github.com/dottrip/fpt-swp/internal/mergepatch"
+	"github.com/dottrip/fpt-swp/internal/models"
+	"github.com/dottrip/fpt-swp/internal/validation"
+	"github.com/gin-gonic/gin"
+)
+
+// patchDoctor binds patch over a doctor stored before the license and phone
+// rules existed
+func patchDoctor(t *testing.T, patch string) (models.DoctorRequest, error) {
+	t.Helper()
+	if err := validation.Register(); err != nil {
+		t.Fatal(err)
+	}
+	apierror.UseJSONFieldNames()
+
+	legacy := models.DoctorRequest{
+		Name:          "Nguyễn Văn An",
+		Email:         "an@example.com",
+		Phone:         "12345",
+		Specialty:     "Nội khoa",
+		LicenseNumber: "BS12345",
+		Status:        "active",
+	}
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPatch, "/api/doctors/1", strings.NewReader(patch))
+	c.Request.Header.Set("Content-Type", mergepatch.ContentType)
+
+	var req models.DoctorRequest
+	err := bindMergePatch(c, legacy, &req)
+	return req, err
+}
+
+func TestMergePatchSkipsRulesOfUntouchedMembers(t *testing.T) {
+	req, err := patchDoctor(t, `{"status": "on_leave"}`)
+	if err != nil {
+		t.Fatalf("status-only patch of a legacy doctor: %v", err)
+	}
+	if req.Status != "on_leave" || req.LicenseNumber != "BS12345" {
+		t.Errorf("patched request = %+v, want the new status and the old license", req)
+	}
+}
+
+func TestMergePatchValidatesPatchedMembers(t *testing.T) {
+	_, err := patchDoctor(t, `{"license_number": "BS99999"}`)
+	var e *apierror.Error
+	if !errors.As(err, &e) || len(e.Fields) != 1 || e.Fields[0].Field != "license_number" {
+		t.Fatalf("patching an invalid license = %v, want one license_number field error", err)
+	}
+}
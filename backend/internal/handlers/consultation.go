@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/dottrip/fpt-swp/internal/apierror"
+	"github.com/dottrip/fpt-swp/internal/models"
+	"github.com/dottrip/fpt-swp/internal/response"
+	"github.com/dottrip/fpt-swp/internal/signaling"
+	"github.com/gin-gonic/gin"
+)
+
+// isConsultationParticipant reports whether user is the session's patient or
+// the user account of its assigned doctor
+func isConsultationParticipant(user *models.User, session *models.ConsultationSession) bool {
+	if session.PatientID == user.ID {
+		return true
+	}
+	doctor, err := models.GetDoctorByEmail(user.Email)
+	return err == nil && doctor.ID == session.DoctorID
+}
+
+// CreateConsultationSession handles POST /api/consultations/sessions.
+// Patients book for themselves; staff and admins may book on behalf of a patient.
+func CreateConsultationSession(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		apierror.Respond(c, apierror.Unauthorized())
+		return
+	}
+
+	var req models.ConsultationSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, apierror.FromBinding(err))
+		return
+	}
+
+	patientID := user.ID
+	if hasRole(user, "admin", "staff") && req.PatientID != 0 {
+		patientID = req.PatientID
+	}
+
+	patient, err := models.GetByID(patientID)
+	if err != nil {
+		apierror.Respond(c, apierror.Field("patient_id", "exists", ""))
+		return
+	}
+
+	doctor, err := models.GetDoctorByID(req.DoctorID)
+	if err != nil || doctor.Status != "active" {
+		apierror.Respond(c, apierror.Field("doctor_id", "available", ""))
+		return
+	}
+
+	session := &models.ConsultationSession{
+		DoctorID:  doctor.ID,
+		PatientID: patient.ID,
+		Mode:      req.Mode,
+	}
+
+	// Open a chat conversation alongside the call when the doctor has an account
+	if doctorUser, err := models.GetByEmail(doctor.Email); err == nil {
+		conversation := &models.Conversation{
+			Type:      "consultation",
+			Title:     "Tư vấn với " + doctor.Name,
+			CreatedBy: patient.ID,
+		}
+		if err := conversation.Create([]int{doctorUser.ID}); err != nil {
+			log.Printf("consultation: failed to create conversation: %v", err)
+		} else {
+			session.ConversationID = &conversation.ID
+		}
+	}
+
+	if err := session.Create(); err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	created, err := models.GetConsultationSessionByID(session.ID)
+	if err != nil {
+		created = session
+	}
+
+	response.Message(c, http.StatusCreated, "Consultation session created successfully", created)
+}
+
+// loadConsultationSession resolves the :id parameter. Participants always
+// have access; admins too when allowAdmin is set.
+func loadConsultationSession(c *gin.Context, allowAdmin bool) (*models.User, *models.ConsultationSession, bool) {
+	user, ok := currentUser(c)
+	if !ok {
+		apierror.Respond(c, apierror.Unauthorized())
+		return nil, nil, false
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, apierror.BadRequest("error.invalid_id"))
+		return nil, nil, false
+	}
+
+	session, err := models.GetConsultationSessionByID(id)
+	if err != nil {
+		apierror.Respond(c, apierror.NotFound("error.consultation_not_found"))
+		return nil, nil, false
+	}
+
+	if !isConsultationParticipant(user, session) && !(allowAdmin && hasRole(user, "admin")) {
+		apierror.Respond(c, apierror.Forbidden("error.consultation_not_participant"))
+		return nil, nil, false
+	}
+
+	return user, session, true
+}
+
+// GetConsultationSession handles GET /api/consultations/sessions/{id}
+func GetConsultationSession(c *gin.Context) {
+	_, session, ok := loadConsultationSession(c, true)
+	if !ok {
+		return
+	}
+
+	response.OK(c, http.StatusOK, session)
+}
+
+// EndConsultationSession handles POST /api/consultations/sessions/{id}/end
+func EndConsultationSession(c *gin.Context) {
+	_, session, ok := loadConsultationSession(c, true)
+	if !ok {
+		return
+	}
+
+	completed, err := session.Complete()
+	if err != nil {
+		apierror.Respond(c, apierror.Internal(err))
+		return
+	}
+	if completed {
+		signaling.DefaultHub.PublishState(session)
+	}
+
+	response.Message(c, http.StatusOK, "Consultation session ended", session)
+}
+
+// GetConsultationICEServers handles GET /api/consultations/sessions/{id}/ice-servers,
+// returning STUN/TURN servers with short-lived TURN credentials
+func GetConsultationICEServers(c *gin.Context) {
+	user, _, ok := loadConsultationSession(c, false)
+	if !ok {
+		return
+	}
+
+	response.OK(c, http.StatusOK, signaling.ICEServersFor(user.ID))
+}
+
+// ConsultationSignalWebSocket handles GET /api/ws/consultations/{id}, relaying
+// WebRTC offers, answers and ICE candidates between doctor and patient
+func ConsultationSignalWebSocket(c *gin.Context) {
+	user, session, ok := loadConsultationSession(c, false)
+	if !ok {
+		return
+	}
+
+	if session.Status == "completed" {
+		apierror.Respond(c, apierror.Conflict("error.consultation_ended"))
+		return
+	}
+
+	conn, err := signaling.Upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// The upgrader has already written an error response
+		log.Printf("signaling: websocket upgrade failed: %v", err)
+		return
+	}
+
+	signaling.DefaultHub.ServeConn(conn, session, user.ID)
+}
@@ -0,0 +1,343 @@
+package handlers
+
+import (
+	"errors"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dottrip/fpt-swp/internal/apierror"
+	"github.com/dottrip/fpt-swp/internal/models"
+	"github.com/dottrip/fpt-swp/internal/notify"
+	"github.com/dottrip/fpt-swp/internal/response"
+	"github.com/gin-gonic/gin"
+)
+
+// currentDoctor returns the active doctor profile linked to user, if any
+func currentDoctor(user *models.User) (*models.Doctor, bool) {
+	doctor, err := models.GetDoctorByEmail(user.Email)
+	if err != nil || doctor.Status != "active" {
+		return nil, false
+	}
+	return doctor, true
+}
+
+// CreateConsultationRequest handles POST /api/consultation-requests.
+// Patients queue for themselves; staff and admins may queue a patient and set
+// the priority directly instead of relying on automatic triage.
+func CreateConsultationRequest(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		apierror.Respond(c, apierror.Unauthorized())
+		return
+	}
+
+	var input models.ConsultationRequestInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.FromBinding(err))
+		return
+	}
+
+	request := &models.ConsultationRequest{
+		PatientID: user.ID,
+		Specialty: input.Specialty,
+		Symptoms:  input.Symptoms,
+		Mode:      input.Mode,
+	}
+	if hasRole(user, "admin", "staff") {
+		if input.PatientID != 0 {
+			request.PatientID = input.PatientID
+		}
+		request.Priority = input.Priority
+	}
+
+	if _, err := models.GetByID(request.PatientID); err != nil {
+		apierror.Respond(c, apierror.Field("patient_id", "exists", ""))
+		return
+	}
+
+	specialties, err := models.GetDoctorSpecialties()
+	if err != nil {
+		apierror.Respond(c, apierror.Internal(err))
+		return
+	}
+	known := false
+	for _, specialty := range specialties {
+		if specialty == html.EscapeString(strings.TrimSpace(request.Specialty)) {
+			known = true
+			break
+		}
+	}
+	if !known {
+		apierror.Respond(c, apierror.Field("specialty", "specialty", ""))
+		return
+	}
+
+	if err := request.Create(); err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	created, err := models.GetConsultationRequestByID(request.ID)
+	if err != nil {
+		created = request
+	}
+	created.FillQueuePosition()
+
+	response.Message(c, http.StatusCreated, "Consultation request queued successfully", created)
+}
+
+// GetConsultationRequests handles GET /api/consultation-requests. Staff and
+// admins see every request, doctors the requests they claimed and patients
+// their own.
+func GetConsultationRequests(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		apierror.Respond(c, apierror.Unauthorized())
+		return
+	}
+
+	filter := models.ConsultationRequestFilter{
+		Status: c.Query("status"),
+		Limit:  200,
+	}
+
+	if hasRole(user, "admin", "staff") {
+		filter.Specialty = html.EscapeString(strings.TrimSpace(c.Query("specialty")))
+	} else if doctor, ok := currentDoctor(user); ok {
+		filter.ClaimedBy = doctor.ID
+	} else {
+		filter.PatientID = user.ID
+	}
+
+	requests, err := models.GetConsultationRequests(filter)
+	if err != nil {
+		apierror.Respond(c, apierror.Internal(err))
+		return
+	}
+
+	response.OK(c, http.StatusOK, requests)
+}
+
+// loadConsultationRequest resolves the :id parameter for user. Staff and
+// admins may access any request, patients their own and doctors the requests
+// of their specialty.
+func loadConsultationRequest(c *gin.Context) (*models.User, *models.ConsultationRequest, bool) {
+	user, ok := currentUser(c)
+	if !ok {
+		apierror.Respond(c, apierror.Unauthorized())
+		return nil, nil, false
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, apierror.BadRequest("error.invalid_id"))
+		return nil, nil, false
+	}
+
+	request, err := models.GetConsultationRequestByID(id)
+	if err != nil {
+		apierror.Respond(c, apierror.NotFound("error.consultation_request_not_found"))
+		return nil, nil, false
+	}
+
+	allowed := hasRole(user, "admin", "staff") || request.PatientID == user.ID
+	if !allowed {
+		if doctor, ok := currentDoctor(user); ok {
+			allowed = doctor.Specialty == request.Specialty
+		}
+	}
+	if !allowed {
+		apierror.Respond(c, apierror.Forbidden("error.forbidden"))
+		return nil, nil, false
+	}
+
+	return user, request, true
+}
+
+// GetConsultationRequest handles GET /api/consultation-requests/{id},
+// including the queue position and estimated wait while it is queued
+func GetConsultationRequest(c *gin.Context) {
+	_, request, ok := loadConsultationRequest(c)
+	if !ok {
+		return
+	}
+
+	if err := request.FillQueuePosition(); err != nil {
+		apierror.Respond(c, apierror.Internal(err))
+		return
+	}
+
+	response.OK(c, http.StatusOK, request)
+}
+
+// CancelConsultationRequest handles POST /api/consultation-requests/{id}/cancel
+func CancelConsultationRequest(c *gin.Context) {
+	user, request, ok := loadConsultationRequest(c)
+	if !ok {
+		return
+	}
+
+	if request.PatientID != user.ID && !hasRole(user, "admin", "staff") {
+		apierror.Respond(c, apierror.Forbidden("error.consultation_request_cancel_forbidden"))
+		return
+	}
+
+	cancelled, err := request.Cancel()
+	if err != nil {
+		apierror.Respond(c, apierror.Internal(err))
+		return
+	}
+	if !cancelled {
+		apierror.Respond(c, apierror.Conflict("error.consultation_request_not_queued"))
+		return
+	}
+
+	response.Message(c, http.StatusOK, "Consultation request cancelled", request)
+}
+
+// SetPriorityInput represents the request structure for overriding a priority
+type SetPriorityInput struct {
+	Priority string `json:"priority" binding:"required,oneof=low medium high urgent"`
+}
+
+// SetConsultationRequestPriority handles PUT /api/consultation-requests/{id}/priority
+func SetConsultationRequestPriority(c *gin.Context) {
+	user, request, ok := loadConsultationRequest(c)
+	if !ok {
+		return
+	}
+
+	if !hasRole(user, "admin", "staff") {
+		apierror.Respond(c, apierror.Forbidden("error.staff_only"))
+		return
+	}
+
+	var input SetPriorityInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.FromBinding(err))
+		return
+	}
+
+	updated, err := request.SetPriority(input.Priority)
+	if err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+	if !updated {
+		apierror.Respond(c, apierror.Conflict("error.consultation_request_not_queued"))
+		return
+	}
+	request.FillQueuePosition()
+
+	response.Message(c, http.StatusOK, "Priority updated", request)
+}
+
+// ClaimConsultationRequest handles POST /api/consultation-queue/claim, giving
+// the calling doctor the next request of their specialty
+func ClaimConsultationRequest(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		apierror.Respond(c, apierror.Unauthorized())
+		return
+	}
+
+	doctor, ok := currentDoctor(user)
+	if !ok {
+		apierror.Respond(c, apierror.Forbidden("error.active_doctor_only"))
+		return
+	}
+
+	request, err := models.ClaimNextConsultationRequest(doctor.ID, doctor.Specialty)
+	if errors.Is(err, models.ErrQueueEmpty) {
+		response.Message(c, http.StatusOK, "No consultation requests waiting", nil)
+		return
+	}
+	if err != nil {
+		apierror.Respond(c, apierror.Internal(err))
+		return
+	}
+
+	notify.NotifyAsync(request.PatientID, notify.Event{
+		Category: models.NotifyConsultation,
+		Title:    "A doctor has accepted your consultation request",
+		Body:     "Dr. " + doctor.Name + " will contact you shortly.",
+		Link:     "/dashboard/patient",
+	})
+
+	response.Message(c, http.StatusOK, "Consultation request claimed", request)
+}
+
+// ReleaseConsultationRequest handles POST /api/consultation-requests/{id}/release,
+// putting a claimed request back at its place in the queue
+func ReleaseConsultationRequest(c *gin.Context) {
+	user, request, ok := loadConsultationRequest(c)
+	if !ok {
+		return
+	}
+
+	// Admins may release a request on behalf of whoever holds it
+	doctorID := 0
+	if !hasRole(user, "admin") {
+		doctor, ok := currentDoctor(user)
+		if !ok {
+			apierror.Respond(c, apierror.Forbidden("error.consultation_request_not_claimer"))
+			return
+		}
+		doctorID = doctor.ID
+	}
+
+	released, err := request.Release(doctorID)
+	if err != nil {
+		apierror.Respond(c, apierror.Internal(err))
+		return
+	}
+	if !released {
+		apierror.Respond(c, apierror.Conflict("error.consultation_request_not_claimed"))
+		return
+	}
+	request.FillQueuePosition()
+
+	response.Message(c, http.StatusOK, "Consultation request released", request)
+}
+
+// CompleteConsultationRequest handles POST /api/consultation-requests/{id}/complete
+func CompleteConsultationRequest(c *gin.Context) {
+	user, request, ok := loadConsultationRequest(c)
+	if !ok {
+		return
+	}
+
+	doctor, ok := currentDoctor(user)
+	if !ok {
+		apierror.Respond(c, apierror.Forbidden("error.consultation_request_not_claimer"))
+		return
+	}
+
+	completed, err := request.Complete(doctor.ID)
+	if err != nil {
+		apierror.Respond(c, apierror.Internal(err))
+		return
+	}
+	if !completed {
+		apierror.Respond(c, apierror.Conflict("error.consultation_request_not_claimed"))
+		return
+	}
+
+	response.Message(c, http.StatusOK, "Consultation request completed", request)
+}
+
+// GetConsultationQueueStats handles GET /api/consultation-queue/stats with
+// live queue lengths and wait estimates, optionally for one ?specialty=
+func GetConsultationQueueStats(c *gin.Context) {
+	specialty := html.EscapeString(strings.TrimSpace(c.Query("specialty")))
+
+	stats, err := models.GetQueueStats(specialty)
+	if err != nil {
+		apierror.Respond(c, apierror.Internal(err))
+		return
+	}
+
+	response.OK(c, http.StatusOK, stats)
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"github.com/dottrip/fpt-swp/internal/models"
+	"github.com/dottrip/fpt-swp/internal/templates"
+	"github.com/gin-gonic/gin"
+)
+
+// currentUser loads the authenticated user set by the auth middleware
+func currentUser(c *gin.Context) (*models.User, bool) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		return nil, false
+	}
+
+	id, ok := userID.(int)
+	if !ok {
+		return nil, false
+	}
+
+	user, err := models.GetByID(id)
+	if err != nil {
+		return nil, false
+	}
+
+	return user, true
+}
+
+// hasRole reports whether the user has one of the given roles
+func hasRole(user *models.User, roles ...string) bool {
+	for _, role := range roles {
+		if user.Role == role {
+			return true
+		}
+	}
+	return false
+}
+
+// requestLocale is the locale the client asked for with Accept-Language
+func requestLocale(c *gin.Context) string {
+	return templates.MatchLocale(c.GetHeader("Accept-Language"))
+}
+
+// localize renders a localized message for the request
+func localize(c *gin.Context, key string) string {
+	return templates.Default.Message(requestLocale(c), key, nil)
+}
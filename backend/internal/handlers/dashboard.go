@@ -3,7 +3,9 @@ package handlers
 import (
 	"net/http"
 
+	"github.com/dottrip/fpt-swp/internal/apierror"
 	"github.com/dottrip/fpt-swp/internal/models"
+	"github.com/dottrip/fpt-swp/internal/response"
 	"github.com/gin-gonic/gin"
 )
 
@@ -12,20 +14,19 @@ func Dashboard(c *gin.Context) {
 	// Get user ID from context (set by auth middleware)
 	userID, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "User ID not found in context"})
+		apierror.Respond(c, apierror.Unauthorized())
 		return
 	}
 
 	// Get user by ID
 	user, err := models.GetByID(userID.(int))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		apierror.Respond(c, apierror.Internal(err))
 		return
 	}
 
 	// Return user data
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Welcome to the dashboard",
+	response.Message(c, http.StatusOK, "Welcome to the dashboard", gin.H{
 		"user": gin.H{
 			"id":       user.ID,
 			"username": user.Username,
@@ -4,7 +4,9 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/dottrip/fpt-swp/internal/apierror"
 	"github.com/dottrip/fpt-swp/internal/models"
+	"github.com/dottrip/fpt-swp/internal/response"
 	"github.com/gin-gonic/gin"
 )
 
@@ -12,51 +14,28 @@ import (
 func CreateDoctor(c *gin.Context) {
 	var req models.DoctorRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error":   "Invalid JSON format: " + err.Error(),
-		})
+		apierror.Respond(c, apierror.FromBinding(err))
 		return
 	}
 
 	// Create doctor instance from request
-	doctor := &models.Doctor{
-		Name:              req.Name,
-		Email:             req.Email,
-		Phone:             req.Phone,
-		Specialty:         req.Specialty,
-		Experience:        req.Experience,
-		Education:         req.Education,
-		Bio:               req.Bio,
-		Avatar:            req.Avatar,
-		LicenseNumber:     req.LicenseNumber,
-		Address:           req.Address,
-		DateOfBirth:       req.DateOfBirth,
-		Gender:            req.Gender,
-		Status:            req.Status,
-		Certifications:    req.Certifications,
-		WorkingHours:      req.WorkingHours,
-		ConsultationPrice: req.ConsultationPrice,
-	}
+	doctor := &models.Doctor{}
+	req.Apply(doctor)
 
 	// Create doctor
 	if err := doctor.Create(); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error":   err.Error(),
-		})
+		apierror.Respond(c, err)
 		return
 	}
+	setETag(c, doctor.Version)
 
 	// Return success response
-	c.JSON(http.StatusCreated, gin.H{
-		"success": true,
-		"message": "Doctor created successfully",
-		"data":    doctor,
-	})
+	response.Message(c, http.StatusCreated, "Doctor created successfully", doctor)
 }
 
-// GetDoctors handles GET /api/doctors
+// GetDoctors handles GET /api/doctors. It pages with ?limit=&offset=, or
+// with ?cursor= for stable paging while doctors are added; cursor pages are
+// ordered by ID, newest first unless sort_order=asc, and ignore sort_by.
 func GetDoctors(c *gin.Context) {
 	// Parse query parameters
 	filter := models.DoctorFilter{
@@ -67,37 +46,29 @@ func GetDoctors(c *gin.Context) {
 		SortOrder: c.Query("sort_order"),
 	}
 
-	// Parse limit and offset
-	if limitStr := c.Query("limit"); limitStr != "" {
-		if limit, err := strconv.Atoi(limitStr); err == nil {
-			filter.Limit = limit
-		}
-	} else {
-		filter.Limit = 20 // Default limit
-	}
-
-	if offsetStr := c.Query("offset"); offsetStr != "" {
-		if offset, err := strconv.Atoi(offsetStr); err == nil {
-			filter.Offset = offset
-		}
+	p, err := parsePage(c, 20, filter.SortOrder != "asc")
+	if err != nil {
+		apierror.Respond(c, err)
+		return
 	}
+	filter.Limit, filter.Offset, filter.Keyset = p.fetchLimit(), p.Offset, p.Keyset
 
 	// Get doctors
 	doctors, err := models.GetAllDoctors(filter)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"error":   err.Error(),
-		})
+		apierror.Respond(c, err)
+		return
+	}
+
+	total, err := models.CountDoctors(filter)
+	if err != nil {
+		apierror.Respond(c, err)
 		return
 	}
 
 	// Return success response
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"data":    doctors,
-		"count":   len(doctors),
-	})
+	n, meta := p.meta(total, len(doctors), func(i int) int { return doctors[i].ID })
+	response.List(c, doctors[:n], meta)
 }
 
 // GetDoctor handles GET /api/doctors/{id}
@@ -107,97 +78,96 @@ func GetDoctor(c *gin.Context) {
 
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error":   "Invalid doctor ID",
-		})
+		apierror.Respond(c, apierror.BadRequest("error.invalid_id"))
 		return
 	}
 
 	// Get doctor
 	doctor, err := models.GetDoctorByID(id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"success": false,
-			"error":   "Doctor not found",
-		})
+		apierror.Respond(c, notFoundOr(err, "error.doctor_not_found"))
 		return
 	}
 
 	// Return success response
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"data":    doctor,
-	})
+	setETag(c, doctor.Version)
+	response.OK(c, http.StatusOK, doctor)
 }
 
-// UpdateDoctor handles PUT /api/doctors/{id}
+// UpdateDoctor handles PUT /api/doctors/{id}, replacing every field. The
+// version being replaced must be given in If-Match or the version field.
 func UpdateDoctor(c *gin.Context) {
 	// Get ID from URL
 	idStr := c.Param("id")
 
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error":   "Invalid doctor ID",
-		})
+		apierror.Respond(c, apierror.BadRequest("error.invalid_id"))
 		return
 	}
 
 	// Get existing doctor
 	doctor, err := models.GetDoctorByID(id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"success": false,
-			"error":   "Doctor not found",
-		})
+		apierror.Respond(c, notFoundOr(err, "error.doctor_not_found"))
 		return
 	}
 
 	// Parse request body
 	var req models.DoctorRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error":   "Invalid JSON format: " + err.Error(),
-		})
+		apierror.Respond(c, apierror.FromBinding(err))
+		return
+	}
+
+	if err := checkVersion(c, doctor.Version, req.Version, true); err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	updateDoctor(c, doctor, req)
+}
+
+// PatchDoctor handles PATCH /api/doctors/{id} with a JSON Merge Patch of
+// the fields to change. If-Match or a version member is optional.
+func PatchDoctor(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, apierror.BadRequest("error.invalid_id"))
 		return
 	}
 
-	// Update doctor fields
-	doctor.Name = req.Name
-	doctor.Email = req.Email
-	doctor.Phone = req.Phone
-	doctor.Specialty = req.Specialty
-	doctor.Experience = req.Experience
-	doctor.Education = req.Education
-	doctor.Bio = req.Bio
-	doctor.Avatar = req.Avatar
-	doctor.LicenseNumber = req.LicenseNumber
-	doctor.Address = req.Address
-	doctor.DateOfBirth = req.DateOfBirth
-	doctor.Gender = req.Gender
-	doctor.Status = req.Status
-	doctor.Certifications = req.Certifications
-	doctor.WorkingHours = req.WorkingHours
-	doctor.ConsultationPrice = req.ConsultationPrice
-
-	// Update doctor
+	doctor, err := models.GetDoctorByID(id)
+	if err != nil {
+		apierror.Respond(c, notFoundOr(err, "error.doctor_not_found"))
+		return
+	}
+
+	var req models.DoctorRequest
+	if err := bindMergePatch(c, doctor.Request(), &req); err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	if err := checkVersion(c, doctor.Version, req.Version, false); err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	updateDoctor(c, doctor, req)
+}
+
+// updateDoctor stores req over doctor, failing if the doctor was changed
+// since it was read
+func updateDoctor(c *gin.Context, doctor *models.Doctor, req models.DoctorRequest) {
+	req.Apply(doctor)
 	if err := doctor.Update(); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error":   err.Error(),
-		})
+		apierror.Respond(c, err)
 		return
 	}
 
-	// Return success response
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"message": "Doctor updated successfully",
-		"data":    doctor,
-	})
+	setETag(c, doctor.Version)
+	response.Message(c, http.StatusOK, "Doctor updated successfully", doctor)
 }
 
 // DeleteDoctor handles DELETE /api/doctors/{id}
@@ -207,37 +177,31 @@ func DeleteDoctor(c *gin.Context) {
 
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error":   "Invalid doctor ID",
-		})
+		apierror.Respond(c, apierror.BadRequest("error.invalid_id"))
 		return
 	}
 
 	// Get existing doctor
 	doctor, err := models.GetDoctorByID(id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"success": false,
-			"error":   "Doctor not found",
-		})
+		apierror.Respond(c, notFoundOr(err, "error.doctor_not_found"))
+		return
+	}
+
+	// Only delete the version the client has seen, if it says which
+	if err := checkVersion(c, doctor.Version, 0, false); err != nil {
+		apierror.Respond(c, err)
 		return
 	}
 
 	// Delete doctor
 	if err := doctor.Delete(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"error":   err.Error(),
-		})
+		apierror.Respond(c, err)
 		return
 	}
 
 	// Return success response
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"message": "Doctor deleted successfully",
-	})
+	response.Message(c, http.StatusOK, "Doctor deleted successfully", nil)
 }
 
 // GetDoctorSpecialties handles GET /api/doctors/specialties
@@ -245,16 +209,10 @@ func GetDoctorSpecialties(c *gin.Context) {
 	// Get specialties
 	specialties, err := models.GetDoctorSpecialties()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"error":   err.Error(),
-		})
+		apierror.Respond(c, err)
 		return
 	}
 
 	// Return success response
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"data":    specialties,
-	})
+	response.OK(c, http.StatusOK, specialties)
 }
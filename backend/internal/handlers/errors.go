@@ -0,0 +1,17 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/dottrip/fpt-swp/internal/apierror"
+)
+
+// notFoundOr maps sql.ErrNoRows to a not-found error with the message key
+// and leaves any other error to be reported as internal
+func notFoundOr(err error, key string) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return apierror.NotFound(key)
+	}
+	return err
+}
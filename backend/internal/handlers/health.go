@@ -3,13 +3,11 @@ package handlers
 import (
 	"net/http"
 
+	"github.com/dottrip/fpt-swp/internal/response"
 	"github.com/gin-gonic/gin"
 )
 
 // HealthCheck handles health check requests
 func HealthCheck(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"status": "ok",
-		"message": "Service is running",
-	})
-} 
\ No newline at end of file
+	response.Message(c, http.StatusOK, "Service is running", gin.H{"status": "ok"})
+}
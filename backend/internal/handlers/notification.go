@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dottrip/fpt-swp/internal/apierror"
+	"github.com/dottrip/fpt-swp/internal/models"
+	"github.com/dottrip/fpt-swp/internal/notify"
+	"github.com/dottrip/fpt-swp/internal/response"
+	"github.com/gin-gonic/gin"
+)
+
+// streamKeepAlive is how often an idle notification stream sends a comment,
+// so proxies do not close it
+const streamKeepAlive = 25 * time.Second
+
+// NotificationList is the data of GET /api/notifications
+type NotificationList struct {
+	Notifications    []models.Notification `json:"notifications"`
+	UnreadCount      int                   `json:"unread_count"`
+	UnreadByCategory map[string]int        `json:"unread_by_category"`
+}
+
+// GetNotifications handles GET /api/notifications?category=&unread=true with
+// the unread counts in total and per category
+func GetNotifications(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		apierror.Respond(c, apierror.Unauthorized())
+		return
+	}
+
+	filter := models.NotificationFilter{
+		Category:   c.Query("category"),
+		UnreadOnly: c.Query("unread") == "true",
+		Limit:      20,
+	}
+	if limit, err := strconv.Atoi(c.Query("limit")); err == nil && limit > 0 && limit <= 100 {
+		filter.Limit = limit
+	}
+	if offset, err := strconv.Atoi(c.Query("offset")); err == nil && offset > 0 {
+		filter.Offset = offset
+	}
+
+	notifications, err := models.GetNotifications(user.ID, filter)
+	if err != nil {
+		apierror.Respond(c, apierror.Internal(err))
+		return
+	}
+
+	unread, byCategory, err := models.CountUnreadNotifications(user.ID)
+	if err != nil {
+		apierror.Respond(c, apierror.Internal(err))
+		return
+	}
+
+	response.OK(c, http.StatusOK, NotificationList{
+		Notifications:    notifications,
+		UnreadCount:      unread,
+		UnreadByCategory: byCategory,
+	})
+}
+
+// MarkNotificationRead handles POST /api/notifications/{id}/read
+func MarkNotificationRead(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		apierror.Respond(c, apierror.Unauthorized())
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, apierror.BadRequest("error.invalid_id"))
+		return
+	}
+
+	err = models.MarkNotificationRead(user.ID, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		apierror.Respond(c, apierror.NotFound("error.notification_not_found"))
+		return
+	}
+	if err != nil {
+		apierror.Respond(c, apierror.Internal(err))
+		return
+	}
+
+	notify.DefaultHub.PublishRead(user.ID, id)
+
+	response.Message(c, http.StatusOK, "Notification marked as read", nil)
+}
+
+// MarkAllNotificationsRead handles POST /api/notifications/read-all?category=
+func MarkAllNotificationsRead(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		apierror.Respond(c, apierror.Unauthorized())
+		return
+	}
+
+	marked, err := models.MarkAllNotificationsRead(user.ID, c.Query("category"))
+	if err != nil {
+		apierror.Respond(c, apierror.Internal(err))
+		return
+	}
+
+	if marked > 0 {
+		notify.DefaultHub.PublishRead(user.ID, 0)
+	}
+
+	response.Message(c, http.StatusOK, "Notifications marked as read", gin.H{"marked": marked})
+}
+
+// GetNotificationPreferences handles GET /api/notifications/preferences
+func GetNotificationPreferences(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		apierror.Respond(c, apierror.Unauthorized())
+		return
+	}
+
+	preferences, err := models.GetNotificationPreferences(user.ID)
+	if err != nil {
+		apierror.Respond(c, apierror.Internal(err))
+		return
+	}
+
+	response.OK(c, http.StatusOK, preferences)
+}
+
+// NotificationPreferencesInput represents the request structure for
+// updating preferences; categories left out keep their current setting
+type NotificationPreferencesInput struct {
+	Preferences []models.NotificationPreference `json:"preferences" binding:"required,dive"`
+}
+
+// UpdateNotificationPreferences handles PUT /api/notifications/preferences
+func UpdateNotificationPreferences(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		apierror.Respond(c, apierror.Unauthorized())
+		return
+	}
+
+	var input NotificationPreferencesInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.FromBinding(err))
+		return
+	}
+
+	if err := models.SaveNotificationPreferences(user.ID, input.Preferences); err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	preferences, err := models.GetNotificationPreferences(user.ID)
+	if err != nil {
+		apierror.Respond(c, apierror.Internal(err))
+		return
+	}
+
+	response.Message(c, http.StatusOK, "Notification preferences updated successfully", preferences)
+}
+
+// NotificationStream handles GET /api/notifications/stream, pushing new
+// notifications over Server-Sent Events. EventSource cannot set headers, so
+// the token may be passed as a query parameter. A reconnecting client sends
+// Last-Event-ID and receives the notifications it missed.
+func NotificationStream(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		apierror.Respond(c, apierror.Unauthorized())
+		return
+	}
+
+	events, unsubscribe := notify.DefaultHub.Subscribe(user.ID)
+	defer unsubscribe()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	if lastID, err := strconv.Atoi(c.GetHeader("Last-Event-ID")); err == nil && lastID > 0 {
+		missed, err := models.GetNotifications(user.ID, models.NotificationFilter{AfterID: lastID, Limit: 100})
+		if err == nil {
+			for i := len(missed) - 1; i >= 0; i-- {
+				writeNotificationEvent(c.Writer, &missed[i])
+			}
+		}
+	}
+
+	if unread, byCategory, err := models.CountUnreadNotifications(user.ID); err == nil {
+		c.SSEvent("unread", gin.H{"unread_count": unread, "unread_by_category": byCategory})
+	}
+	c.Writer.Flush()
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			return true
+		case event := <-events:
+			switch event.Type {
+			case notify.StreamNotification:
+				writeNotificationEvent(w, event.Notification)
+			case notify.StreamRead:
+				unread, byCategory, err := models.CountUnreadNotifications(user.ID)
+				if err != nil {
+					return true
+				}
+				c.SSEvent("unread", gin.H{"unread_count": unread, "unread_by_category": byCategory})
+			}
+			return true
+		}
+	})
+}
+
+// writeNotificationEvent writes a notification with its ID as the event ID,
+// which the browser sends back as Last-Event-ID when reconnecting
+func writeNotificationEvent(w io.Writer, n *models.Notification) {
+	if n == nil {
+		return
+	}
+	data, err := json.Marshal(n)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "id: %d\nevent: notification\ndata: %s\n\n", n.ID, data)
+}
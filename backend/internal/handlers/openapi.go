@@ -0,0 +1,452 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/dottrip/fpt-swp/internal/apierror"
+	"github.com/dottrip/fpt-swp/internal/mergepatch"
+	"github.com/dottrip/fpt-swp/internal/models"
+	"github.com/dottrip/fpt-swp/internal/openapi"
+	"github.com/dottrip/fpt-swp/internal/signaling"
+	"github.com/dottrip/fpt-swp/internal/templates"
+	"github.com/gin-gonic/gin"
+)
+
+// apiInfo describes the API in the OpenAPI document
+var apiInfo = openapi.Info{
+	Title:   "FPT SWP Clinic API",
+	Version: "1.0.0",
+	Description: "Every JSON response uses the envelope {success, message, data, meta, error}. " +
+		"Errors carry a stable code, a message in the language of Accept-Language and the request ID.",
+}
+
+// Common query parameters
+var (
+	pageParams = []openapi.Param{
+		{Name: "limit", Type: "integer", Description: "Page size, at most 100"},
+		{Name: "offset", Type: "integer", Description: "Rows to skip; ignored with cursor"},
+		{Name: "cursor", Description: "Pages by cursor instead of offset: empty for the first page, then meta.next_cursor"},
+	}
+	sortParams = []openapi.Param{
+		{Name: "sort_by"},
+		{Name: "sort_order", Enum: []string{"asc", "desc"}},
+	}
+	ifMatchParams = []openapi.Param{
+		{Name: "If-Match", Description: "ETag of the version being changed, as returned by GET; 412 if it is no longer current"},
+	}
+	overrideReviewParams = []openapi.Param{
+		{Name: "override_review", Type: "boolean", Description: "Admins only: publish or schedule, or edit a live post, without a medical review"},
+	}
+	pdfParams = []openapi.Param{
+		{Name: "disposition", Enum: []string{"attachment", "inline"}, Description: "inline to open the PDF for printing"},
+	}
+)
+
+func params(lists ...[]openapi.Param) []openapi.Param {
+	var all []openapi.Param
+	for _, list := range lists {
+		all = append(all, list...)
+	}
+	return all
+}
+
+// authResult is the data of register and login responses
+type authResult struct {
+	User struct {
+		ID       int    `json:"id"`
+		Username string `json:"username"`
+		Email    string `json:"email"`
+		Role     string `json:"role"`
+	} `json:"user"`
+	Token string `json:"token"`
+}
+
+// feedDescription describes every blog feed
+const feedDescription = "The latest published posts with their full content. Supports conditional GET with ETag and Last-Modified."
+
+// apiOperations documents every route registered in cmd/api/main.go. The
+// server warns at startup about routes missing here, and
+// TestOpenAPICoversRoutes in cmd/api fails on them.
+func apiOperations() []openapi.Operation {
+	return []openapi.Operation{
+		// System
+		{Method: "GET", Path: "/api/health", Handler: HealthCheck, Tag: "System", Summary: "Health check",
+			Response: struct {
+				Status string `json:"status"`
+			}{}},
+		{Method: "GET", Path: "/api/openapi.json", Handler: GetOpenAPISpec, Tag: "System", Summary: "This OpenAPI document", Produces: "application/json"},
+		{Method: "GET", Path: "/api/docs", Handler: GetAPIDocs, Tag: "System", Summary: "API reference page", Produces: "text/html"},
+		{Method: "GET", Path: "/sitemap.xml", Handler: GetSitemap, Tag: "System", Summary: "Sitemap of the public website",
+			Description: "The blog, published posts, categories with published posts and doctor profiles, with lastmod. Supports conditional GET with ETag and Last-Modified.",
+			Produces:    "application/xml"},
+		{Method: "GET", Path: "/api/dashboard", Handler: Dashboard, Tag: "System", Summary: "Current user summary", Auth: openapi.Bearer,
+			Response: struct {
+				User struct {
+					ID       int    `json:"id"`
+					Username string `json:"username"`
+					Email    string `json:"email"`
+					Role     string `json:"role"`
+				} `json:"user"`
+			}{}},
+
+		// Auth
+		{Method: "POST", Path: "/api/register", Handler: Register, Tag: "Auth", Summary: "Create an account", Request: RegisterInput{}, Response: authResult{}},
+		{Method: "POST", Path: "/api/login", Handler: Login, Tag: "Auth", Summary: "Sign in", Request: LoginInput{}, Response: authResult{}},
+
+		// Blog
+		{Method: "GET", Path: "/api/blog/posts", Handler: GetPublishedBlogPosts, Tag: "Blog", Summary: "List published posts", List: true,
+			Query:    params([]openapi.Param{{Name: "category", Description: "Category slug or name"}, {Name: "tag", Description: "Tag slug or name"}, {Name: "search"}}, pageParams),
+			Response: []models.BlogPost{}},
+		{Method: "GET", Path: "/api/blog/search", Handler: SearchBlogPosts, Tag: "Blog", Summary: "Search published posts", List: true,
+			Description: "Posts containing every word of q, or words starting with it, in the title or text, with or without accents; best matches first, with title matches ranked higher. title_highlight and snippet mark the words found with <mark>.",
+			Query: []openapi.Param{{Name: "q", Required: true, Description: "Words to search for"}, {Name: "category", Description: "Category slug or name"}, {Name: "tag", Description: "Tag slug or name"},
+				{Name: "limit", Type: "integer", Description: "Page size, at most 100"}, {Name: "offset", Type: "integer", Description: "Rows to skip"}},
+			Response: []models.BlogSearchResult{}},
+		{Method: "GET", Path: "/api/blog/posts/:id", Handler: GetPublishedBlogPost, Tag: "Blog", Summary: "Get a published post",
+			Query:    []openapi.Param{{Name: "increment_view", Type: "boolean"}},
+			Response: models.BlogPost{}},
+		{Method: "GET", Path: "/api/blog/posts/by-slug/:slug", Handler: GetBlogPostBySlug, Tag: "Blog", Summary: "Get a published post by slug",
+			Description: "A slug the post had before it was renamed redirects to the current one with 301 Moved Permanently.",
+			Query:       []openapi.Param{{Name: "increment_view", Type: "boolean"}},
+			Response:    models.BlogPost{}},
+		{Method: "GET", Path: "/api/blog/posts/:id/comments", Handler: GetBlogPostComments, Tag: "Blog", Summary: "List the comments of a published post",
+			Description: "Approved comments as threads, oldest first; replies are nested under the comment they answer.",
+			Response:    []models.BlogComment{}},
+		{Method: "POST", Path: "/api/blog/posts/:id/comments", Handler: CreateBlogPostComment, Tag: "Blog", Summary: "Comment on a published post", Auth: openapi.Bearer, Status: http.StatusCreated,
+			Description: "Any signed-in user; set parent_id to reply to a comment. Comments the spam filter holds are answered with 202 and wait for a moderator. 403 if comments are off for the post or the user is banned from commenting.",
+			Request:     models.BlogCommentInput{}, Response: models.BlogComment{}},
+		{Method: "GET", Path: "/api/blog/categories", Handler: GetBlogCategories, Tag: "Blog", Summary: "List categories",
+			Description: "By name, with the number of published posts in each.", Response: []models.BlogTerm{}},
+		{Method: "GET", Path: "/api/blog/tags", Handler: GetBlogTags, Tag: "Blog", Summary: "List tags",
+			Description: "By name, with the number of published posts with each.", Response: []models.BlogTerm{}},
+		{Method: "GET", Path: "/api/blog/feed.rss", Handler: GetBlogFeedRSS, Tag: "Blog", Summary: "RSS feed of the latest published posts",
+			Description: feedDescription, Produces: "application/rss+xml"},
+		{Method: "GET", Path: "/api/blog/feed.atom", Handler: GetBlogFeedAtom, Tag: "Blog", Summary: "Atom feed of the latest published posts",
+			Description: feedDescription, Produces: "application/atom+xml"},
+		{Method: "GET", Path: "/api/blog/feed.json", Handler: GetBlogFeedJSON, Tag: "Blog", Summary: "JSON Feed of the latest published posts",
+			Description: feedDescription, Produces: "application/feed+json"},
+		{Method: "GET", Path: "/api/blog/categories/:slug/feed.rss", Handler: GetBlogFeedRSS, Tag: "Blog", Summary: "RSS feed of a category",
+			Description: feedDescription, Produces: "application/rss+xml"},
+		{Method: "GET", Path: "/api/blog/categories/:slug/feed.atom", Handler: GetBlogFeedAtom, Tag: "Blog", Summary: "Atom feed of a category",
+			Description: feedDescription, Produces: "application/atom+xml"},
+		{Method: "GET", Path: "/api/blog/categories/:slug/feed.json", Handler: GetBlogFeedJSON, Tag: "Blog", Summary: "JSON Feed of a category",
+			Description: feedDescription, Produces: "application/feed+json"},
+		{Method: "GET", Path: "/api/blog/manage/posts", Handler: GetBlogPosts, Tag: "Blog", Summary: "List posts of any status", Auth: openapi.Bearer, List: true,
+			Query:    params([]openapi.Param{{Name: "status"}, {Name: "category"}, {Name: "tag"}, {Name: "author_id", Type: "integer"}, {Name: "search", Description: "Words to search for; sort_by=relevance puts the best matches first"}}, sortParams, pageParams),
+			Response: []models.BlogPost{}},
+		{Method: "POST", Path: "/api/blog/manage/posts", Handler: CreateBlogPost, Tag: "Blog", Summary: "Create a post", Auth: openapi.Bearer, Status: http.StatusCreated,
+			Description: "Creating a post published or scheduled needs override_review, since it has not been reviewed (409 otherwise).",
+			Query:       overrideReviewParams, Request: models.BlogPostInput{}, Response: models.BlogPost{}},
+		{Method: "GET", Path: "/api/blog/manage/posts/:id", Handler: GetBlogPost, Tag: "Blog", Summary: "Get a post of any status", Auth: openapi.Bearer, Response: models.BlogPost{}},
+		{Method: "PUT", Path: "/api/blog/manage/posts/:id", Handler: UpdateBlogPost, Tag: "Blog", Summary: "Replace a post", Auth: openapi.Bearer,
+			Description: "The version being replaced must be sent in If-Match or the version field (428 otherwise). Changing the title or content of a published or scheduled post takes it off the site, back to pending_review, unless an admin sends override_review.",
+			Query:       overrideReviewParams, Header: ifMatchParams, Request: models.BlogPostInput{}, Response: models.BlogPost{}},
+		{Method: "PATCH", Path: "/api/blog/manage/posts/:id", Handler: PatchBlogPost, Tag: "Blog", Summary: "Change some fields of a post", Auth: openapi.Bearer,
+			Description: "JSON Merge Patch (RFC 7386): send only the fields to change; null clears a field. Changing the title or content of a published or scheduled post takes it off the site, back to pending_review, unless an admin sends override_review.",
+			Query:       overrideReviewParams, Header: ifMatchParams, Request: models.BlogPostInput{}, Consumes: mergepatch.ContentType, Response: models.BlogPost{}},
+		{Method: "DELETE", Path: "/api/blog/manage/posts/:id", Handler: DeleteBlogPost, Tag: "Blog", Summary: "Delete a post", Auth: openapi.Bearer, Header: ifMatchParams},
+		{Method: "POST", Path: "/api/blog/manage/posts/:id/publish", Handler: PublishBlogPost, Tag: "Blog", Summary: "Publish a post", Auth: openapi.Bearer,
+			Description: "The post must have been approved by a doctor since its title or content last changed (409 otherwise), unless an admin sends override_review.",
+			Query:       overrideReviewParams, Header: ifMatchParams, Response: models.BlogPost{}},
+		{Method: "POST", Path: "/api/blog/manage/posts/:id/unpublish", Handler: UnpublishBlogPost, Tag: "Blog", Summary: "Move a post back to draft", Auth: openapi.Bearer, Header: ifMatchParams, Response: models.BlogPost{}},
+		{Method: "GET", Path: "/api/blog/manage/posts/:id/revisions", Handler: GetBlogRevisions, Tag: "Blog", Summary: "List the revisions of a post", Auth: openapi.Bearer,
+			Description: "Newest first, without content. Every save of a post is a revision, numbered by the post's version.",
+			Response:    []models.BlogRevision{}},
+		{Method: "GET", Path: "/api/blog/manage/posts/:id/revisions/diff", Handler: DiffBlogRevisions, Tag: "Blog", Summary: "Compare two revisions of a post", Auth: openapi.Bearer,
+			Description: "Unified diff of the title, status and Markdown content.",
+			Query: []openapi.Param{
+				{Name: "from", Type: "integer", Required: true, Description: "Version to compare from"},
+				{Name: "to", Type: "integer", Description: "Version to compare to; defaults to the current version"},
+			},
+			Response: models.BlogRevisionDiff{}},
+		{Method: "GET", Path: "/api/blog/manage/posts/:id/revisions/:rev", Handler: GetBlogRevision, Tag: "Blog", Summary: "Get a revision of a post", Auth: openapi.Bearer, Response: models.BlogRevision{}},
+		{Method: "POST", Path: "/api/blog/manage/posts/:id/revisions/:rev/restore", Handler: RestoreBlogRevision, Tag: "Blog", Summary: "Restore a revision of a post", Auth: openapi.Bearer,
+			Description: "Brings back the title, content and excerpt of the revision, saved as a new revision. The slug is kept, and so is the status unless the post goes back to pending_review as with PUT.",
+			Query:       overrideReviewParams, Header: ifMatchParams, Response: models.BlogPost{}},
+		{Method: "POST", Path: "/api/blog/manage/posts/:id/review/submit", Handler: SubmitBlogPostForReview, Tag: "Blog", Summary: "Ask a doctor to review a post", Auth: openapi.Bearer,
+			Description: "reviewer_id must be a user with the doctor role. The post is pending_review until they approve it or request changes.",
+			Header:      ifMatchParams, Request: models.BlogReviewInput{}, Response: models.BlogPost{}},
+		{Method: "POST", Path: "/api/blog/manage/posts/:id/review/approve", Handler: ApproveBlogPost, Tag: "Blog", Summary: "Approve a post as its reviewer", Auth: openapi.Bearer,
+			Description: "Only the assigned doctor. The post returns to draft, ready to publish with a \"medically reviewed by\" label.",
+			Header:      ifMatchParams, Request: models.BlogReviewInput{}, Response: models.BlogPost{}},
+		{Method: "POST", Path: "/api/blog/manage/posts/:id/review/request-changes", Handler: RequestBlogPostChanges, Tag: "Blog", Summary: "Send a post back to its author", Auth: openapi.Bearer,
+			Description: "Only the assigned doctor; body is required. The post returns to draft.",
+			Header:      ifMatchParams, Request: models.BlogReviewInput{}, Response: models.BlogPost{}},
+		{Method: "GET", Path: "/api/blog/manage/posts/:id/review/comments", Handler: GetBlogReviewComments, Tag: "Blog", Summary: "List the review comments of a post", Auth: openapi.Bearer,
+			Response: []models.BlogReviewComment{}},
+		{Method: "POST", Path: "/api/blog/manage/posts/:id/review/comments", Handler: CreateBlogReviewComment, Tag: "Blog", Summary: "Comment on a post under review", Auth: openapi.Bearer, Status: http.StatusCreated,
+			Request: models.BlogReviewInput{}, Response: models.BlogReviewComment{}},
+		{Method: "GET", Path: "/api/blog/manage/comments", Handler: GetBlogComments, Tag: "Blog", Summary: "Comment moderation queue", Auth: openapi.Bearer, List: true,
+			Description: "Staff and admins only. Oldest first; status is pending by default, or all.",
+			Query:       params([]openapi.Param{{Name: "status", Enum: []string{"pending", "approved", "rejected", "spam", "all"}}, {Name: "post_id", Type: "integer"}}, pageParams),
+			Response:    []models.BlogComment{}},
+		{Method: "POST", Path: "/api/blog/manage/comments/:id/approve", Handler: ApproveBlogComment, Tag: "Blog", Summary: "Publish a comment", Auth: openapi.Bearer,
+			Description: "Staff and admins only.", Response: models.BlogComment{}},
+		{Method: "POST", Path: "/api/blog/manage/comments/:id/reject", Handler: RejectBlogComment, Tag: "Blog", Summary: "Reject a comment", Auth: openapi.Bearer,
+			Description: "Staff and admins only; also takes down a published comment.", Response: models.BlogComment{}},
+		{Method: "POST", Path: "/api/blog/manage/comments/:id/spam", Handler: MarkBlogCommentSpam, Tag: "Blog", Summary: "Mark a comment as spam", Auth: openapi.Bearer,
+			Description: "Staff and admins only.", Response: models.BlogComment{}},
+		{Method: "POST", Path: "/api/blog/manage/comments/:id/ban", Handler: BanBlogCommenter, Tag: "Blog", Summary: "Ban a comment's author from commenting", Auth: openapi.Bearer,
+			Description: "Staff and admins only. The comment is marked as spam and the author's comments awaiting moderation are rejected.",
+			Request:     models.BlogCommentBanInput{}, Response: map[string]interface{}{}},
+		{Method: "POST", Path: "/api/blog/manage/categories", Handler: CreateBlogCategory, Tag: "Blog", Summary: "Add a category", Auth: openapi.Bearer, Status: http.StatusCreated,
+			Description: "Staff and admins only. Without a slug, one is made from the name.",
+			Request:     models.BlogTermInput{}, Response: models.BlogTerm{}},
+		{Method: "PUT", Path: "/api/blog/manage/categories/:id", Handler: UpdateBlogCategory, Tag: "Blog", Summary: "Rename a category", Auth: openapi.Bearer,
+			Description: "Staff and admins only. The slug is kept unless one is given.",
+			Request:     models.BlogTermInput{}, Response: models.BlogTerm{}},
+		{Method: "DELETE", Path: "/api/blog/manage/categories/:id", Handler: DeleteBlogCategory, Tag: "Blog", Summary: "Delete a category", Auth: openapi.Bearer,
+			Description: "Staff and admins only. Its posts are left without a category."},
+		{Method: "POST", Path: "/api/blog/manage/categories/:id/merge", Handler: MergeBlogCategory, Tag: "Blog", Summary: "Merge a category into another", Auth: openapi.Bearer,
+			Description: "Staff and admins only. Its posts move to into_id and the category is deleted.",
+			Request:     models.BlogTermMergeInput{}, Response: models.BlogTerm{}},
+		{Method: "POST", Path: "/api/blog/manage/tags", Handler: CreateBlogTag, Tag: "Blog", Summary: "Add a tag", Auth: openapi.Bearer, Status: http.StatusCreated,
+			Description: "Staff and admins only. Without a slug, one is made from the name.",
+			Request:     models.BlogTermInput{}, Response: models.BlogTerm{}},
+		{Method: "PUT", Path: "/api/blog/manage/tags/:id", Handler: UpdateBlogTag, Tag: "Blog", Summary: "Rename a tag", Auth: openapi.Bearer,
+			Description: "Staff and admins only. The slug is kept unless one is given.",
+			Request:     models.BlogTermInput{}, Response: models.BlogTerm{}},
+		{Method: "DELETE", Path: "/api/blog/manage/tags/:id", Handler: DeleteBlogTag, Tag: "Blog", Summary: "Delete a tag", Auth: openapi.Bearer,
+			Description: "Staff and admins only. It is taken off every post."},
+		{Method: "POST", Path: "/api/blog/manage/tags/:id/merge", Handler: MergeBlogTag, Tag: "Blog", Summary: "Merge a tag into another", Auth: openapi.Bearer,
+			Description: "Staff and admins only. Its posts get into_id instead and the tag is deleted.",
+			Request:     models.BlogTermMergeInput{}, Response: models.BlogTerm{}},
+		{Method: "GET", Path: "/api/blog/manage/stats", Handler: GetBlogStats, Tag: "Blog", Summary: "Post counts and views", Auth: openapi.Bearer,
+			Description: "Post counts, and under views the views of each day in the range with the most viewed posts and referring sites. Views are counted once per visitor per window, ignoring bots, and appear after the next flush.",
+			Query: []openapi.Param{
+				{Name: "from", Format: "date", Description: "First day, YYYY-MM-DD; default 29 days before to"},
+				{Name: "to", Format: "date", Description: "Last day, included; default today, clinic time; the range covers at most 366 days"},
+			},
+			Response: map[string]interface{}{}},
+
+		// Doctors
+		{Method: "GET", Path: "/api/doctors", Handler: GetDoctors, Tag: "Doctors", Summary: "List doctors", Auth: openapi.Bearer, List: true,
+			Query:    params([]openapi.Param{{Name: "search"}, {Name: "specialty"}, {Name: "status"}}, sortParams, pageParams),
+			Response: []models.Doctor{}},
+		{Method: "POST", Path: "/api/doctors", Handler: CreateDoctor, Tag: "Doctors", Summary: "Add a doctor", Auth: openapi.Bearer, Status: http.StatusCreated,
+			Request: models.DoctorRequest{}, Response: models.Doctor{}},
+		{Method: "GET", Path: "/api/doctors/specialties", Handler: GetDoctorSpecialties, Tag: "Doctors", Summary: "List specialties", Auth: openapi.Bearer, Response: []string{}},
+		{Method: "GET", Path: "/api/doctors/:id", Handler: GetDoctor, Tag: "Doctors", Summary: "Get a doctor", Auth: openapi.Bearer, Response: models.Doctor{}},
+		{Method: "PUT", Path: "/api/doctors/:id", Handler: UpdateDoctor, Tag: "Doctors", Summary: "Replace a doctor", Auth: openapi.Bearer,
+			Description: "The version being replaced must be sent in If-Match or the version field (428 otherwise). Changing the title or content of a published or scheduled post takes it off the site, back to pending_review, unless an admin sends override_review.",
+			Header:      ifMatchParams, Request: models.DoctorRequest{}, Response: models.Doctor{}},
+		{Method: "PATCH", Path: "/api/doctors/:id", Handler: PatchDoctor, Tag: "Doctors", Summary: "Change some fields of a doctor", Auth: openapi.Bearer,
+			Description: "JSON Merge Patch (RFC 7386): send only the fields to change; null clears a field. Changing the title or content of a published or scheduled post takes it off the site, back to pending_review, unless an admin sends override_review.",
+			Header:      ifMatchParams, Request: models.DoctorRequest{}, Consumes: mergepatch.ContentType, Response: models.Doctor{}},
+		{Method: "DELETE", Path: "/api/doctors/:id", Handler: DeleteDoctor, Tag: "Doctors", Summary: "Delete a doctor", Auth: openapi.Bearer, Header: ifMatchParams},
+
+		// Prescriptions and visit summaries
+		{Method: "POST", Path: "/api/prescriptions", Handler: CreatePrescription, Tag: "Prescriptions", Summary: "Issue a prescription", Auth: openapi.Bearer, Status: http.StatusCreated,
+			Request: models.PrescriptionRequest{}, Response: models.Prescription{}},
+		{Method: "GET", Path: "/api/prescriptions/:id", Handler: GetPrescription, Tag: "Prescriptions", Summary: "Get a prescription", Auth: openapi.Bearer, Response: models.Prescription{}},
+		{Method: "GET", Path: "/api/prescriptions/:id/pdf", Handler: GetPrescriptionPDF, Tag: "Prescriptions", Summary: "Prescription PDF", Auth: openapi.Bearer,
+			Query: pdfParams, Produces: "application/pdf"},
+		{Method: "POST", Path: "/api/visit-summaries", Handler: CreateVisitSummary, Tag: "Prescriptions", Summary: "Write a visit summary", Auth: openapi.Bearer, Status: http.StatusCreated,
+			Request: models.VisitSummaryRequest{}, Response: models.VisitSummary{}},
+		{Method: "GET", Path: "/api/visit-summaries/:id", Handler: GetVisitSummary, Tag: "Prescriptions", Summary: "Get a visit summary", Auth: openapi.Bearer, Response: models.VisitSummary{}},
+		{Method: "GET", Path: "/api/visit-summaries/:id/pdf", Handler: GetVisitSummaryPDF, Tag: "Prescriptions", Summary: "Visit summary PDF", Auth: openapi.Bearer,
+			Query: pdfParams, Produces: "application/pdf"},
+		{Method: "GET", Path: "/api/verify/:code", Handler: VerifyDocument, Tag: "Prescriptions", Summary: "Verify a printed document by its QR code",
+			Description: "The document's type, code, issue date, masked patient name and issuing doctor, with valid set to true; 404 if no document has the code.",
+			Response:    map[string]interface{}{}},
+
+		// Chat
+		{Method: "GET", Path: "/api/conversations", Handler: GetConversations, Tag: "Chat", Summary: "List my conversations", Auth: openapi.Bearer, Response: []models.Conversation{}},
+		{Method: "POST", Path: "/api/conversations", Handler: CreateConversation, Tag: "Chat", Summary: "Start a conversation", Auth: openapi.Bearer, Status: http.StatusCreated,
+			Request: models.ConversationRequest{}, Response: models.Conversation{}},
+		{Method: "GET", Path: "/api/conversations/:id", Handler: GetConversation, Tag: "Chat", Summary: "Get a conversation", Auth: openapi.Bearer, Response: models.Conversation{}},
+		{Method: "GET", Path: "/api/conversations/:id/messages", Handler: GetConversationMessages, Tag: "Chat", Summary: "Message history, newest page first", Auth: openapi.Bearer, List: true,
+			Description: "Each page is in chronological order; pass meta.next_cursor as cursor for the older page before it.",
+			Query: []openapi.Param{
+				{Name: "limit", Type: "integer", Description: "Page size, at most 100"},
+				{Name: "cursor", Description: "meta.next_cursor of the previous page; empty or absent for the newest page"},
+				{Name: "before_id", Type: "integer", Description: "Messages before this ID; deprecated, use cursor"},
+			},
+			Response: []models.Message{}},
+		{Method: "POST", Path: "/api/conversations/:id/messages", Handler: SendConversationMessage, Tag: "Chat", Summary: "Send a message", Auth: openapi.Bearer, Status: http.StatusCreated,
+			Request: SendMessageInput{}, Response: models.Message{}},
+		{Method: "POST", Path: "/api/conversations/:id/read", Handler: MarkConversationRead, Tag: "Chat", Summary: "Mark messages read", Auth: openapi.Bearer, Request: MarkReadInput{}},
+		{Method: "GET", Path: "/api/ws/chat", Handler: ChatWebSocket, Tag: "Chat", Summary: "Chat events over WebSocket", Auth: openapi.QueryToken, Status: http.StatusSwitchingProtocols},
+
+		// Consultations
+		{Method: "POST", Path: "/api/consultations/sessions", Handler: CreateConsultationSession, Tag: "Consultations", Summary: "Start a video or voice session", Auth: openapi.Bearer, Status: http.StatusCreated,
+			Request: models.ConsultationSessionRequest{}, Response: models.ConsultationSession{}},
+		{Method: "GET", Path: "/api/consultations/sessions/:id", Handler: GetConsultationSession, Tag: "Consultations", Summary: "Get a session", Auth: openapi.Bearer, Response: models.ConsultationSession{}},
+		{Method: "POST", Path: "/api/consultations/sessions/:id/end", Handler: EndConsultationSession, Tag: "Consultations", Summary: "End a session", Auth: openapi.Bearer, Response: models.ConsultationSession{}},
+		{Method: "GET", Path: "/api/consultations/sessions/:id/ice-servers", Handler: GetConsultationICEServers, Tag: "Consultations", Summary: "STUN and TURN servers", Auth: openapi.Bearer, Response: signaling.ICEConfig{}},
+		{Method: "GET", Path: "/api/ws/consultations/:id", Handler: ConsultationSignalWebSocket, Tag: "Consultations", Summary: "WebRTC signaling over WebSocket", Auth: openapi.QueryToken, Status: http.StatusSwitchingProtocols},
+
+		// Consultation queue
+		{Method: "GET", Path: "/api/consultation-requests", Handler: GetConsultationRequests, Tag: "Consultation queue", Summary: "List requests", Auth: openapi.Bearer,
+			Query:    []openapi.Param{{Name: "status"}, {Name: "specialty"}},
+			Response: []models.ConsultationRequest{}},
+		{Method: "POST", Path: "/api/consultation-requests", Handler: CreateConsultationRequest, Tag: "Consultation queue", Summary: "Request a consultation", Auth: openapi.Bearer, Status: http.StatusCreated,
+			Request: models.ConsultationRequestInput{}, Response: models.ConsultationRequest{}},
+		{Method: "GET", Path: "/api/consultation-requests/:id", Handler: GetConsultationRequest, Tag: "Consultation queue", Summary: "Get a request", Auth: openapi.Bearer, Response: models.ConsultationRequest{}},
+		{Method: "POST", Path: "/api/consultation-requests/:id/cancel", Handler: CancelConsultationRequest, Tag: "Consultation queue", Summary: "Cancel a request", Auth: openapi.Bearer, Response: models.ConsultationRequest{}},
+		{Method: "PUT", Path: "/api/consultation-requests/:id/priority", Handler: SetConsultationRequestPriority, Tag: "Consultation queue", Summary: "Override triage priority", Auth: openapi.Bearer,
+			Request: SetPriorityInput{}, Response: models.ConsultationRequest{}},
+		{Method: "POST", Path: "/api/consultation-requests/:id/release", Handler: ReleaseConsultationRequest, Tag: "Consultation queue", Summary: "Return a claimed request to the queue", Auth: openapi.Bearer, Response: models.ConsultationRequest{}},
+		{Method: "POST", Path: "/api/consultation-requests/:id/complete", Handler: CompleteConsultationRequest, Tag: "Consultation queue", Summary: "Complete a request", Auth: openapi.Bearer, Response: models.ConsultationRequest{}},
+		{Method: "POST", Path: "/api/consultation-queue/claim", Handler: ClaimConsultationRequest, Tag: "Consultation queue", Summary: "Claim the next request; data is null when the queue is empty", Auth: openapi.Bearer, Response: &models.ConsultationRequest{}},
+		{Method: "GET", Path: "/api/consultation-queue/stats", Handler: GetConsultationQueueStats, Tag: "Consultation queue", Summary: "Queue statistics by specialty", Auth: openapi.Bearer,
+			Query:    []openapi.Param{{Name: "specialty"}},
+			Response: []models.QueueStats{}},
+
+		// Attachments
+		{Method: "POST", Path: "/api/attachments", Handler: UploadAttachment, Tag: "Attachments", Summary: "Upload a file", Auth: openapi.Bearer, Status: http.StatusCreated,
+			Form: []openapi.Param{
+				{Name: "file", Type: "file", Required: true},
+				{Name: "context", Description: "What the file is attached to; decides size and type limits"},
+				{Name: "context_id", Type: "integer"},
+			},
+			Response: AttachmentResponse{}},
+		{Method: "GET", Path: "/api/attachments/:id", Handler: GetAttachment, Tag: "Attachments", Summary: "Attachment metadata and signed download URLs", Auth: openapi.Bearer, Response: AttachmentResponse{}},
+		{Method: "DELETE", Path: "/api/attachments/:id", Handler: DeleteAttachment, Tag: "Attachments", Summary: "Delete an attachment", Auth: openapi.Bearer},
+		{Method: "GET", Path: "/api/files/:id", Handler: DownloadFile, Tag: "Attachments", Summary: "Download a file through a signed URL",
+			Query: []openapi.Param{
+				{Name: "variant", Enum: []string{"original", "thumbnail"}},
+				{Name: "expires", Type: "integer"},
+				{Name: "signature"},
+			},
+			Produces: "application/octet-stream"},
+
+		// Support
+		{Method: "GET", Path: "/api/support/tickets", Handler: GetSupportTickets, Tag: "Support", Summary: "List tickets", Auth: openapi.Bearer, List: true,
+			Query: []openapi.Param{
+				{Name: "status"}, {Name: "priority"}, {Name: "category"}, {Name: "assignee"},
+				{Name: "breached", Type: "boolean"}, {Name: "limit", Type: "integer"}, {Name: "offset", Type: "integer"},
+			},
+			Response: []models.SupportTicket{}},
+		{Method: "POST", Path: "/api/support/tickets", Handler: CreateSupportTicket, Tag: "Support", Summary: "Open a ticket", Auth: openapi.Bearer, Status: http.StatusCreated,
+			Request: models.SupportTicketRequest{}, Response: models.SupportTicket{}},
+		{Method: "GET", Path: "/api/support/tickets/:id", Handler: GetSupportTicket, Tag: "Support", Summary: "Get a ticket with its messages", Auth: openapi.Bearer, Response: models.SupportTicket{}},
+		{Method: "POST", Path: "/api/support/tickets/:id/messages", Handler: ReplySupportTicket, Tag: "Support", Summary: "Reply to a ticket", Auth: openapi.Bearer, Status: http.StatusCreated,
+			Request: TicketReplyInput{},
+			Response: struct {
+				Message models.TicketMessage `json:"message"`
+				Ticket  models.SupportTicket `json:"ticket"`
+			}{}},
+		{Method: "PUT", Path: "/api/support/tickets/:id/assign", Handler: AssignSupportTicket, Tag: "Support", Summary: "Assign a ticket", Auth: openapi.Bearer,
+			Request: AssignTicketInput{}, Response: models.SupportTicket{}},
+		{Method: "PUT", Path: "/api/support/tickets/:id/status", Handler: UpdateSupportTicketStatus, Tag: "Support", Summary: "Change ticket status", Auth: openapi.Bearer,
+			Request: TicketStatusInput{}, Response: models.SupportTicket{}},
+		{Method: "PUT", Path: "/api/support/tickets/:id/priority", Handler: UpdateSupportTicketPriority, Tag: "Support", Summary: "Change ticket priority", Auth: openapi.Bearer,
+			Request: SetPriorityInput{}, Response: models.SupportTicket{}},
+
+		// Staff schedule and shifts
+		{Method: "GET", Path: "/api/staff/schedule", Handler: GetStaffSchedule, Tag: "Staff", Summary: "Schedule occurrences in a range", Auth: openapi.Bearer,
+			Query: []openapi.Param{
+				{Name: "from", Format: "date-time"}, {Name: "to", Format: "date-time"},
+				{Name: "user_id", Type: "integer", Description: "Another staff member's schedule, for admins"},
+			},
+			Response: StaffSchedule{}},
+		{Method: "POST", Path: "/api/staff/schedule/events", Handler: CreateScheduleEvent, Tag: "Staff", Summary: "Create an event", Auth: openapi.Bearer, Status: http.StatusCreated,
+			Request: models.ScheduleEventRequest{}, Response: models.ScheduleEvent{}},
+		{Method: "GET", Path: "/api/staff/schedule/events/:id", Handler: GetScheduleEvent, Tag: "Staff", Summary: "Get an event", Auth: openapi.Bearer, Response: models.ScheduleEvent{}},
+		{Method: "PUT", Path: "/api/staff/schedule/events/:id", Handler: UpdateScheduleEvent, Tag: "Staff", Summary: "Update an event", Auth: openapi.Bearer,
+			Request: models.ScheduleEventRequest{}, Response: models.ScheduleEvent{}},
+		{Method: "DELETE", Path: "/api/staff/schedule/events/:id", Handler: DeleteScheduleEvent, Tag: "Staff", Summary: "Delete an event", Auth: openapi.Bearer},
+		{Method: "GET", Path: "/api/staff/rosters", Handler: GetShiftRosters, Tag: "Staff", Summary: "List rosters", Auth: openapi.Bearer, List: true, Response: []models.ShiftRoster{}},
+		{Method: "POST", Path: "/api/staff/rosters", Handler: CreateShiftRoster, Tag: "Staff", Summary: "Create a roster", Auth: openapi.Bearer, Status: http.StatusCreated,
+			Request: models.ShiftRosterRequest{}, Response: models.ShiftRoster{}},
+		{Method: "GET", Path: "/api/staff/rosters/:id", Handler: GetShiftRoster, Tag: "Staff", Summary: "Get a roster with its shifts", Auth: openapi.Bearer, Response: models.ShiftRoster{}},
+		{Method: "POST", Path: "/api/staff/rosters/:id/shifts", Handler: AddRosterShift, Tag: "Staff", Summary: "Add a shift", Auth: openapi.Bearer, Status: http.StatusCreated,
+			Request: models.ShiftInput{}, Response: models.Shift{}},
+		{Method: "DELETE", Path: "/api/staff/rosters/:id/shifts/:shiftId", Handler: DeleteRosterShift, Tag: "Staff", Summary: "Remove a shift", Auth: openapi.Bearer},
+		{Method: "POST", Path: "/api/staff/rosters/:id/publish", Handler: PublishShiftRoster, Tag: "Staff", Summary: "Publish a roster", Auth: openapi.Bearer, Response: models.ShiftRoster{}},
+		{Method: "POST", Path: "/api/staff/shifts/:id/swap-requests", Handler: RequestShiftSwap, Tag: "Staff", Summary: "Ask to swap a shift", Auth: openapi.Bearer, Status: http.StatusCreated,
+			Request: models.ShiftSwapInput{}, Response: models.ShiftSwapRequest{}},
+		{Method: "GET", Path: "/api/staff/swap-requests", Handler: GetShiftSwapRequests, Tag: "Staff", Summary: "List swap requests", Auth: openapi.Bearer, List: true,
+			Query:    []openapi.Param{{Name: "status"}},
+			Response: []models.ShiftSwapRequest{}},
+		{Method: "POST", Path: "/api/staff/swap-requests/:id/approve", Handler: ApproveShiftSwap, Tag: "Staff", Summary: "Approve a swap", Auth: openapi.Bearer, Response: models.ShiftSwapRequest{}},
+		{Method: "POST", Path: "/api/staff/swap-requests/:id/reject", Handler: RejectShiftSwap, Tag: "Staff", Summary: "Reject a swap", Auth: openapi.Bearer, Response: models.ShiftSwapRequest{}},
+		{Method: "POST", Path: "/api/staff/swap-requests/:id/cancel", Handler: CancelShiftSwap, Tag: "Staff", Summary: "Withdraw a swap request", Auth: openapi.Bearer, Response: models.ShiftSwapRequest{}},
+
+		// Notifications
+		{Method: "GET", Path: "/api/notifications", Handler: GetNotifications, Tag: "Notifications", Summary: "List my notifications", Auth: openapi.Bearer,
+			Query: []openapi.Param{
+				{Name: "category"}, {Name: "unread", Type: "boolean"},
+				{Name: "limit", Type: "integer"}, {Name: "offset", Type: "integer"},
+			},
+			Response: NotificationList{}},
+		{Method: "POST", Path: "/api/notifications/:id/read", Handler: MarkNotificationRead, Tag: "Notifications", Summary: "Mark a notification read", Auth: openapi.Bearer},
+		{Method: "POST", Path: "/api/notifications/read-all", Handler: MarkAllNotificationsRead, Tag: "Notifications", Summary: "Mark all notifications read", Auth: openapi.Bearer,
+			Query: []openapi.Param{{Name: "category"}},
+			Response: struct {
+				Marked int64 `json:"marked"`
+			}{}},
+		{Method: "GET", Path: "/api/notifications/preferences", Handler: GetNotificationPreferences, Tag: "Notifications", Summary: "Channel preferences", Auth: openapi.Bearer, Response: []models.NotificationPreference{}},
+		{Method: "PUT", Path: "/api/notifications/preferences", Handler: UpdateNotificationPreferences, Tag: "Notifications", Summary: "Update channel preferences", Auth: openapi.Bearer,
+			Request: NotificationPreferencesInput{}, Response: []models.NotificationPreference{}},
+		{Method: "PUT", Path: "/api/notifications/phone", Handler: UpdateNotificationPhone, Tag: "Notifications", Summary: "Set the number SMS notifications go to", Auth: openapi.Bearer,
+			Request: PhoneInput{},
+			Response: struct {
+				Phone string `json:"phone"`
+			}{}},
+		{Method: "GET", Path: "/api/notifications/stream", Handler: NotificationStream, Tag: "Notifications", Summary: "Server-sent notification events", Auth: openapi.QueryToken, Produces: "text/event-stream"},
+
+		// SMS
+		{Method: "GET", Path: "/api/sms/messages", Handler: GetSMSMessages, Tag: "SMS", Summary: "SMS log, for admins", Auth: openapi.Bearer,
+			Query: []openapi.Param{
+				{Name: "phone"}, {Name: "status"},
+				{Name: "limit", Type: "integer"}, {Name: "offset", Type: "integer"},
+			},
+			Response: []models.SMSMessage{}},
+		{Method: "GET", Path: "/api/sms/status-callback", Handler: SMSStatusCallback, Tag: "SMS", Summary: "Delivery report from the SMS gateway",
+			Query: []openapi.Param{{Name: "token", Description: "SMS_CALLBACK_SECRET"}}},
+		{Method: "POST", Path: "/api/sms/status-callback", Handler: SMSStatusCallback, Tag: "SMS", Summary: "Delivery report from the SMS gateway (JSON or form body)",
+			Query: []openapi.Param{{Name: "token", Description: "SMS_CALLBACK_SECRET"}}},
+
+		// Templates
+		{Method: "GET", Path: "/api/admin/templates", Handler: GetTemplates, Tag: "Templates", Summary: "Message and email templates, for admins", Auth: openapi.Bearer,
+			Query: []openapi.Param{{Name: "locale", Enum: templates.Locales}},
+			Response: struct {
+				Locales  []string          `json:"locales"`
+				Emails   []string          `json:"emails"`
+				Messages map[string]string `json:"messages"`
+				Problems []string          `json:"problems"`
+			}{}},
+		{Method: "GET", Path: "/api/admin/templates/email/:name", Handler: PreviewEmailTemplate, Tag: "Templates", Summary: "Preview an email with fixture data", Auth: openapi.Bearer,
+			Query:    []openapi.Param{{Name: "locale", Enum: templates.Locales}, {Name: "format", Enum: []string{"json", "html", "text"}}},
+			Response: templates.Email{}},
+		{Method: "POST", Path: "/api/admin/templates/email/:name", Handler: PreviewEmailTemplate, Tag: "Templates", Summary: "Preview an email with posted data", Auth: openapi.Bearer,
+			Query:    []openapi.Param{{Name: "locale", Enum: templates.Locales}, {Name: "format", Enum: []string{"json", "html", "text"}}},
+			Request:  map[string]interface{}{},
+			Response: templates.Email{}},
+	}
+}
+
+var (
+	openAPIOnce     sync.Once
+	openAPIDocument []byte
+	openAPIError    error
+)
+
+// OpenAPIDocument returns the generated OpenAPI document
+func OpenAPIDocument() (*openapi.Document, error) {
+	return openapi.Build(apiInfo, apiOperations())
+}
+
+// GetOpenAPISpec handles GET /api/openapi.json
+func GetOpenAPISpec(c *gin.Context) {
+	openAPIOnce.Do(func() {
+		var doc *openapi.Document
+		if doc, openAPIError = OpenAPIDocument(); openAPIError == nil {
+			openAPIDocument, openAPIError = json.Marshal(doc)
+		}
+	})
+	if openAPIError != nil {
+		apierror.Respond(c, apierror.Internal(openAPIError))
+		return
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", openAPIDocument)
+}
+
+// GetAPIDocs handles GET /api/docs, the API reference page
+func GetAPIDocs(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", openapi.DocsPage)
+}
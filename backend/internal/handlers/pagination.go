@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"strconv"
+
+	"github.com/dottrip/fpt-swp/internal/apierror"
+	"github.com/dottrip/fpt-swp/internal/models"
+	"github.com/dottrip/fpt-swp/internal/response"
+	"github.com/gin-gonic/gin"
+)
+
+// maxPageLimit caps the limit a client may ask for
+const maxPageLimit = 100
+
+// page is the paging a list request asked for
+type page struct {
+	Limit  int
+	Offset int
+	Keyset *models.Keyset // set for cursor paging
+}
+
+// parsePage reads ?limit= and either ?offset= or ?cursor= from the query.
+// The presence of cursor, empty for the first page, selects cursor paging;
+// desc is the direction of a new cursor list. Cursor lists are ordered by ID
+// so that rows inserted while a client pages never shift later pages.
+func parsePage(c *gin.Context, defaultLimit int, desc bool) (page, error) {
+	p := page{Limit: defaultLimit}
+
+	if limit, err := strconv.Atoi(c.Query("limit")); err == nil && limit > 0 {
+		p.Limit = limit
+	}
+	if p.Limit > maxPageLimit {
+		p.Limit = maxPageLimit
+	}
+
+	cursor, ok := c.GetQuery("cursor")
+	if !ok {
+		if offset, err := strconv.Atoi(c.Query("offset")); err == nil && offset > 0 {
+			p.Offset = offset
+		}
+		return p, nil
+	}
+
+	p.Keyset = &models.Keyset{Desc: desc}
+	if cursor != "" {
+		position, err := response.DecodeCursor(cursor)
+		if err != nil {
+			return p, apierror.BadRequest("error.invalid_cursor")
+		}
+		p.Keyset.AfterID, p.Keyset.Desc = position.ID, position.Desc
+	}
+	return p, nil
+}
+
+// fetchLimit is the number of rows to query. Cursor pages fetch one extra
+// row to learn whether another page follows.
+func (p page) fetchLimit() int {
+	if p.Keyset != nil {
+		return p.Limit + 1
+	}
+	return p.Limit
+}
+
+// meta describes a page of fetched rows, fetched with fetchLimit, out of
+// total. It returns how many of the rows belong to the page; id returns the
+// ID of row i.
+func (p page) meta(total, fetched int, id func(i int) int) (int, response.Meta) {
+	meta := response.Meta{Total: total, Limit: p.Limit}
+
+	if p.Keyset == nil {
+		offset := p.Offset
+		meta.Offset = &offset
+		meta.HasMore = offset+fetched < total
+		return fetched, meta
+	}
+
+	if fetched > p.Limit {
+		fetched = p.Limit
+		meta.HasMore = true
+		meta.NextCursor = response.EncodeCursor(response.Cursor{ID: id(fetched - 1), Desc: p.Keyset.Desc})
+	}
+	return fetched, meta
+}
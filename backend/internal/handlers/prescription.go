@@ -0,0 +1,372 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dottrip/fpt-swp/internal/apierror"
+	"github.com/dottrip/fpt-swp/internal/models"
+	"github.com/dottrip/fpt-swp/internal/pdf"
+	"github.com/dottrip/fpt-swp/internal/response"
+	"github.com/gin-gonic/gin"
+)
+
+// verificationURL builds the public link encoded in a document's QR code
+func verificationURL(code string) string {
+	baseURL := os.Getenv("PUBLIC_API_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:8080"
+	}
+	return strings.TrimRight(baseURL, "/") + "/api/verify/" + code
+}
+
+// canViewPatientDocument reports whether the user may read a document the
+// doctor with ID doctorID issued to patientID: staff, the patient, the
+// issuing doctor, or a doctor who has had a consultation with the patient
+func canViewPatientDocument(user *models.User, doctorID int, patientID *int) bool {
+	if hasRole(user, "admin", "staff") {
+		return true
+	}
+	if patientID != nil && *patientID == user.ID {
+		return true
+	}
+	if !hasRole(user, "doctor") {
+		return false
+	}
+	doctor, ok := currentDoctor(user)
+	if !ok {
+		return false
+	}
+	if doctor.ID == doctorID {
+		return true
+	}
+	if patientID == nil {
+		return false
+	}
+	treated, err := models.HasConsulted(doctor.ID, *patientID)
+	return err == nil && treated
+}
+
+// checkIssuingDoctor writes an error unless the user may issue a document
+// in the name of the doctor with ID doctorID: admins for any doctor, doctors
+// only for themselves
+func checkIssuingDoctor(c *gin.Context, user *models.User, doctorID int) bool {
+	if _, err := models.GetDoctorByID(doctorID); err != nil {
+		apierror.Respond(c, apierror.Field("doctor_id", "exists", ""))
+		return false
+	}
+	if hasRole(user, "admin") {
+		return true
+	}
+	doctor, ok := currentDoctor(user)
+	if !ok {
+		apierror.Respond(c, apierror.Forbidden("error.active_doctor_only"))
+		return false
+	}
+	if doctor.ID != doctorID {
+		apierror.Respond(c, apierror.Forbidden("error.document_other_doctor"))
+		return false
+	}
+	return true
+}
+
+// sendPDF writes a rendered PDF, inline for printing or as a download
+func sendPDF(c *gin.Context, filename string, body []byte) {
+	disposition := "attachment"
+	if c.Query("disposition") == "inline" {
+		disposition = "inline"
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("%s; filename=%q", disposition, filename))
+	c.Data(http.StatusOK, "application/pdf", body)
+}
+
+// CreatePrescription handles POST /api/prescriptions
+func CreatePrescription(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		apierror.Respond(c, apierror.Unauthorized())
+		return
+	}
+	if !hasRole(user, "admin", "doctor") {
+		apierror.Respond(c, apierror.Forbidden("error.prescription_doctor_only"))
+		return
+	}
+
+	var req models.PrescriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, apierror.FromBinding(err))
+		return
+	}
+
+	if !checkIssuingDoctor(c, user, req.DoctorID) {
+		return
+	}
+
+	prescription := &models.Prescription{
+		DoctorID:    req.DoctorID,
+		PatientInfo: req.PatientInfo,
+		Diagnosis:   req.Diagnosis,
+		Notes:       req.Notes,
+		Status:      req.Status,
+		NextVisit:   req.NextVisit,
+		Items:       make([]models.PrescriptionItem, len(req.Items)),
+	}
+	for i, item := range req.Items {
+		prescription.Items[i] = item.Item()
+	}
+
+	if err := prescription.Create(); err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	response.Message(c, http.StatusCreated, "Prescription created successfully", prescription)
+}
+
+// loadPrescription resolves the :id parameter and checks the caller may see it
+func loadPrescription(c *gin.Context) (*models.Prescription, bool) {
+	user, ok := currentUser(c)
+	if !ok {
+		apierror.Respond(c, apierror.Unauthorized())
+		return nil, false
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, apierror.BadRequest("error.invalid_id"))
+		return nil, false
+	}
+
+	prescription, err := models.GetPrescriptionByID(id)
+	if err != nil || !canViewPatientDocument(user, prescription.DoctorID, prescription.PatientID) {
+		apierror.Respond(c, apierror.NotFound("error.prescription_not_found"))
+		return nil, false
+	}
+
+	return prescription, true
+}
+
+// GetPrescription handles GET /api/prescriptions/{id}
+func GetPrescription(c *gin.Context) {
+	prescription, ok := loadPrescription(c)
+	if !ok {
+		return
+	}
+
+	response.OK(c, http.StatusOK, prescription)
+}
+
+// GetPrescriptionPDF handles GET /api/prescriptions/{id}/pdf
+func GetPrescriptionPDF(c *gin.Context) {
+	prescription, ok := loadPrescription(c)
+	if !ok {
+		return
+	}
+
+	doctor, err := models.GetDoctorByID(prescription.DoctorID)
+	if err != nil {
+		apierror.Respond(c, apierror.Internal(err))
+		return
+	}
+
+	var buf bytes.Buffer
+	err = pdf.WritePrescription(&buf, pdf.ClinicFromEnv(), doctor, prescription, verificationURL(prescription.Code))
+	if err != nil {
+		apierror.Respond(c, apierror.Internal(err))
+		return
+	}
+
+	sendPDF(c, fmt.Sprintf("don-thuoc-%s.pdf", prescription.Code), buf.Bytes())
+}
+
+// CreateVisitSummary handles POST /api/visit-summaries
+func CreateVisitSummary(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		apierror.Respond(c, apierror.Unauthorized())
+		return
+	}
+	if !hasRole(user, "admin", "doctor") {
+		apierror.Respond(c, apierror.Forbidden("error.visit_summary_doctor_only"))
+		return
+	}
+
+	var req models.VisitSummaryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, apierror.FromBinding(err))
+		return
+	}
+
+	if !checkIssuingDoctor(c, user, req.DoctorID) {
+		return
+	}
+
+	if req.PrescriptionID != nil {
+		if _, err := models.GetPrescriptionByID(*req.PrescriptionID); err != nil {
+			apierror.Respond(c, apierror.Field("prescription_id", "exists", ""))
+			return
+		}
+	}
+
+	summary := &models.VisitSummary{
+		DoctorID:       req.DoctorID,
+		PrescriptionID: req.PrescriptionID,
+		PatientInfo:    req.PatientInfo,
+		ChiefComplaint: req.ChiefComplaint,
+		Findings:       req.Findings,
+		Diagnosis:      req.Diagnosis,
+		TreatmentPlan:  req.TreatmentPlan,
+		FollowUpDate:   req.FollowUpDate,
+		Notes:          req.Notes,
+	}
+	if req.VisitDate != nil {
+		summary.VisitDate = *req.VisitDate
+	}
+
+	if err := summary.Create(); err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	response.Message(c, http.StatusCreated, "Visit summary created successfully", summary)
+}
+
+// loadVisitSummary resolves the :id parameter and checks the caller may see it
+func loadVisitSummary(c *gin.Context) (*models.VisitSummary, bool) {
+	user, ok := currentUser(c)
+	if !ok {
+		apierror.Respond(c, apierror.Unauthorized())
+		return nil, false
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, apierror.BadRequest("error.invalid_id"))
+		return nil, false
+	}
+
+	summary, err := models.GetVisitSummaryByID(id)
+	if err != nil || !canViewPatientDocument(user, summary.DoctorID, summary.PatientID) {
+		apierror.Respond(c, apierror.NotFound("error.visit_summary_not_found"))
+		return nil, false
+	}
+
+	return summary, true
+}
+
+// GetVisitSummary handles GET /api/visit-summaries/{id}
+func GetVisitSummary(c *gin.Context) {
+	summary, ok := loadVisitSummary(c)
+	if !ok {
+		return
+	}
+
+	response.OK(c, http.StatusOK, summary)
+}
+
+// GetVisitSummaryPDF handles GET /api/visit-summaries/{id}/pdf
+func GetVisitSummaryPDF(c *gin.Context) {
+	summary, ok := loadVisitSummary(c)
+	if !ok {
+		return
+	}
+
+	doctor, err := models.GetDoctorByID(summary.DoctorID)
+	if err != nil {
+		apierror.Respond(c, apierror.Internal(err))
+		return
+	}
+
+	var items []models.PrescriptionItem
+	if summary.PrescriptionID != nil {
+		items, err = models.GetPrescriptionItems(*summary.PrescriptionID)
+		if err != nil {
+			apierror.Respond(c, apierror.Internal(err))
+			return
+		}
+	}
+
+	var buf bytes.Buffer
+	err = pdf.WriteVisitSummary(&buf, pdf.ClinicFromEnv(), doctor, summary, items, verificationURL(summary.Code))
+	if err != nil {
+		apierror.Respond(c, apierror.Internal(err))
+		return
+	}
+
+	sendPDF(c, fmt.Sprintf("tom-tat-kham-%s.pdf", summary.Code), buf.Bytes())
+}
+
+// maskName keeps only the given name in full, e.g. "Nguyễn Văn An" -> "N. V. An"
+func maskName(name string) string {
+	parts := strings.Fields(html.UnescapeString(name))
+	for i := 0; i < len(parts)-1; i++ {
+		parts[i] = string([]rune(parts[i])[:1]) + "."
+	}
+	return strings.Join(parts, " ")
+}
+
+// VerifyDocument handles GET /api/verify/{code}, the public target of the
+// QR code printed on prescriptions and visit summaries. It confirms that the
+// document was issued by the clinic without exposing the full patient record.
+func VerifyDocument(c *gin.Context) {
+	code := c.Param("code")
+
+	var (
+		docType  string
+		doctorID int
+		issuedAt time.Time
+		patient  string
+		details  gin.H
+	)
+
+	if prescription, err := models.GetPrescriptionByCode(code); err == nil {
+		drugs := make([]gin.H, 0, len(prescription.Items))
+		for _, item := range prescription.Items {
+			drugs = append(drugs, gin.H{
+				"drug_name": html.UnescapeString(item.DrugName),
+				"quantity":  item.Quantity,
+				"unit":      html.UnescapeString(item.Unit),
+			})
+		}
+		docType = "prescription"
+		doctorID = prescription.DoctorID
+		issuedAt = prescription.CreatedAt
+		patient = prescription.PatientName
+		details = gin.H{"status": prescription.Status, "items": drugs}
+	} else if summary, err := models.GetVisitSummaryByCode(code); err == nil {
+		docType = "visit_summary"
+		doctorID = summary.DoctorID
+		issuedAt = summary.VisitDate
+		patient = summary.PatientName
+		details = gin.H{}
+	} else {
+		apierror.Respond(c, apierror.NotFound("error.document_not_found"))
+		return
+	}
+
+	doctor, err := models.GetDoctorByID(doctorID)
+	if err != nil {
+		apierror.Respond(c, apierror.NotFound("error.doctor_not_found"))
+		return
+	}
+
+	details["type"] = docType
+	details["code"] = strings.ToUpper(code)
+	details["issued_at"] = issuedAt
+	details["patient_name"] = maskName(patient)
+	details["doctor"] = gin.H{
+		"name":           html.UnescapeString(doctor.Name),
+		"specialty":      html.UnescapeString(doctor.Specialty),
+		"license_number": html.UnescapeString(doctor.LicenseNumber),
+	}
+
+	details["valid"] = true
+
+	response.OK(c, http.StatusOK, details)
+}
@@ -0,0 +1,306 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dottrip/fpt-swp/internal/apierror"
+	"github.com/dottrip/fpt-swp/internal/models"
+	"github.com/dottrip/fpt-swp/internal/notify"
+	"github.com/dottrip/fpt-swp/internal/response"
+	"github.com/gin-gonic/gin"
+)
+
+// maxScheduleRange bounds a schedule query
+const maxScheduleRange = 62 * 24 * time.Hour
+
+// scheduleRoles are the roles that have a staff schedule
+var scheduleRoles = []string{"admin", "staff", "doctor"}
+
+// scheduleUser returns the current user if they have a staff schedule
+func scheduleUser(c *gin.Context) (*models.User, bool) {
+	user, ok := currentUser(c)
+	if !ok {
+		apierror.Respond(c, apierror.Unauthorized())
+		return nil, false
+	}
+
+	if !hasRole(user, scheduleRoles...) {
+		apierror.Respond(c, apierror.Forbidden("error.schedule_staff_only"))
+		return nil, false
+	}
+
+	return user, true
+}
+
+// parseScheduleTime accepts RFC 3339 timestamps or YYYY-MM-DD dates, which
+// mean midnight clinic time
+func parseScheduleTime(value string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, false, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, models.ClinicLocation())
+	return t, true, err
+}
+
+// scheduleRange reads ?from= and ?to=. A date-only "to" includes that day.
+// The default is the current week, Monday to Sunday.
+func scheduleRange(c *gin.Context) (time.Time, time.Time, bool) {
+	now := time.Now().In(models.ClinicLocation())
+	y, m, d := now.Date()
+	monday := time.Date(y, m, d-(int(now.Weekday())+6)%7, 0, 0, 0, 0, models.ClinicLocation())
+	from, to := monday, monday.AddDate(0, 0, 7)
+
+	if value := c.Query("from"); value != "" {
+		t, _, err := parseScheduleTime(value)
+		if err != nil {
+			apierror.Respond(c, apierror.Field("from", "date_or_time", ""))
+			return time.Time{}, time.Time{}, false
+		}
+		from, to = t, t.AddDate(0, 0, 7)
+	}
+
+	if value := c.Query("to"); value != "" {
+		t, dateOnly, err := parseScheduleTime(value)
+		if err != nil {
+			apierror.Respond(c, apierror.Field("to", "date_or_time", ""))
+			return time.Time{}, time.Time{}, false
+		}
+		if dateOnly {
+			t = t.AddDate(0, 0, 1)
+		}
+		to = t
+	}
+
+	if !to.After(from) {
+		apierror.Respond(c, apierror.Field("to", "gtfield", "from"))
+		return time.Time{}, time.Time{}, false
+	}
+	if to.Sub(from) > maxScheduleRange {
+		apierror.Respond(c, apierror.Field("to", "max_days", strconv.Itoa(int(maxScheduleRange.Hours()/24))))
+		return time.Time{}, time.Time{}, false
+	}
+
+	return from, to, true
+}
+
+// StaffSchedule is the data of GET /api/staff/schedule: the occurrences of
+// a user's schedule in a range, in order
+type StaffSchedule struct {
+	From        time.Time                   `json:"from"`
+	To          time.Time                   `json:"to"`
+	UserID      int                         `json:"user_id"`
+	Occurrences []models.ScheduleOccurrence `json:"occurrences"`
+}
+
+// GetStaffSchedule handles GET /api/staff/schedule?from=&to=. It returns the
+// event occurrences and published shifts of the current user; admins can
+// pass ?user_id= to see someone else's schedule.
+func GetStaffSchedule(c *gin.Context) {
+	user, ok := scheduleUser(c)
+	if !ok {
+		return
+	}
+
+	from, to, ok := scheduleRange(c)
+	if !ok {
+		return
+	}
+
+	userID := user.ID
+	if value := c.Query("user_id"); value != "" && hasRole(user, "admin") {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			apierror.Respond(c, apierror.BadRequest("error.invalid_id"))
+			return
+		}
+		userID = id
+	}
+
+	occurrences, err := models.GetScheduleOccurrences(userID, from, to)
+	if err != nil {
+		apierror.Respond(c, apierror.Internal(err))
+		return
+	}
+
+	shifts, err := models.GetPublishedShifts(userID, from, to)
+	if err != nil {
+		apierror.Respond(c, apierror.Internal(err))
+		return
+	}
+	for i := range shifts {
+		occurrences = append(occurrences, shifts[i].Occurrence())
+	}
+	models.SortOccurrences(occurrences)
+
+	response.OK(c, http.StatusOK, StaffSchedule{
+		From:        from.UTC(),
+		To:          to.UTC(),
+		UserID:      userID,
+		Occurrences: occurrences,
+	})
+}
+
+// validateAttendees checks that every attendee has a staff schedule
+func validateAttendees(ids []int) error {
+	for _, id := range ids {
+		attendee, err := models.GetByID(id)
+		if err != nil || !hasRole(attendee, scheduleRoles...) {
+			return &models.ValidationError{Field: "attendee_ids", Code: "staff", Param: strconv.Itoa(id)}
+		}
+	}
+	return nil
+}
+
+// saveScheduleEvent validates the request, checks attendee conflicts and
+// saves the event. It writes the error response and returns false on failure.
+func saveScheduleEvent(c *gin.Context, event *models.ScheduleEvent, input models.ScheduleEventRequest, save func([]int) error) bool {
+	event.Title = input.Title
+	event.Description = input.Description
+	event.Type = input.Type
+	event.Location = input.Location
+	event.StartAt = input.StartAt
+	event.EndAt = input.EndAt
+	event.RRule = input.RRule
+
+	if err := validateAttendees(input.AttendeeIDs); err != nil {
+		apierror.Respond(c, err)
+		return false
+	}
+	if err := event.Validate(); err != nil {
+		apierror.Respond(c, err)
+		return false
+	}
+
+	if !input.AllowConflicts {
+		attendees := append([]int{event.CreatedBy}, input.AttendeeIDs...)
+		conflicts, err := models.FindScheduleConflicts(event, attendees)
+		if err != nil {
+			apierror.Respond(c, apierror.Internal(err))
+			return false
+		}
+		if len(conflicts) > 0 {
+			response.Fail(c, http.StatusConflict, response.Error{
+				Code:      apierror.CodeConflict,
+				Message:   "Event conflicts with existing events; set allow_conflicts to save anyway",
+				Details:   conflicts,
+				RequestID: c.GetString("request_id"),
+			})
+			return false
+		}
+	}
+
+	if err := save(input.AttendeeIDs); err != nil {
+		apierror.Respond(c, err)
+		return false
+	}
+	return true
+}
+
+// CreateScheduleEvent handles POST /api/staff/schedule/events. A 409 lists
+// the conflicting events of the attendees unless allow_conflicts is set.
+func CreateScheduleEvent(c *gin.Context) {
+	user, ok := scheduleUser(c)
+	if !ok {
+		return
+	}
+
+	var input models.ScheduleEventRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.FromBinding(err))
+		return
+	}
+
+	event := &models.ScheduleEvent{CreatedBy: user.ID}
+	if !saveScheduleEvent(c, event, input, event.Create) {
+		return
+	}
+
+	for _, attendee := range event.Attendees {
+		if attendee.UserID != user.ID {
+			notify.NotifyAsync(attendee.UserID, notify.Event{
+				Category: models.NotifySchedule,
+				Title:    "You have been invited to " + event.Title,
+				Body:     user.Username + " added you to an event on " + event.StartAt.In(models.ClinicLocation()).Format("02/01/2006 15:04"),
+				Link:     "/dashboard/staff/schedule",
+			})
+		}
+	}
+
+	response.Message(c, http.StatusCreated, "Event created successfully", event)
+}
+
+// loadScheduleEvent resolves the :id parameter. Attendees and admins can
+// see an event; only its creator and admins can change it.
+func loadScheduleEvent(c *gin.Context, write bool) (*models.User, *models.ScheduleEvent, bool) {
+	user, ok := scheduleUser(c)
+	if !ok {
+		return nil, nil, false
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, apierror.BadRequest("error.invalid_id"))
+		return nil, nil, false
+	}
+
+	event, err := models.GetScheduleEventByID(id)
+	if err != nil || (!event.HasAttendee(user.ID) && !hasRole(user, "admin")) {
+		apierror.Respond(c, apierror.NotFound("error.event_not_found"))
+		return nil, nil, false
+	}
+
+	if write && event.CreatedBy != user.ID && !hasRole(user, "admin") {
+		apierror.Respond(c, apierror.Forbidden("error.event_not_organizer"))
+		return nil, nil, false
+	}
+
+	return user, event, true
+}
+
+// GetScheduleEvent handles GET /api/staff/schedule/events/{id}
+func GetScheduleEvent(c *gin.Context) {
+	_, event, ok := loadScheduleEvent(c, false)
+	if !ok {
+		return
+	}
+
+	response.OK(c, http.StatusOK, event)
+}
+
+// UpdateScheduleEvent handles PUT /api/staff/schedule/events/{id}. Changes
+// apply to every occurrence of a recurring event.
+func UpdateScheduleEvent(c *gin.Context) {
+	_, event, ok := loadScheduleEvent(c, true)
+	if !ok {
+		return
+	}
+
+	var input models.ScheduleEventRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.FromBinding(err))
+		return
+	}
+
+	if !saveScheduleEvent(c, event, input, event.Update) {
+		return
+	}
+
+	response.Message(c, http.StatusOK, "Event updated successfully", event)
+}
+
+// DeleteScheduleEvent handles DELETE /api/staff/schedule/events/{id}
+func DeleteScheduleEvent(c *gin.Context) {
+	_, event, ok := loadScheduleEvent(c, true)
+	if !ok {
+		return
+	}
+
+	if err := event.Delete(); err != nil {
+		apierror.Respond(c, apierror.Internal(err))
+		return
+	}
+
+	response.Message(c, http.StatusOK, "Event deleted successfully", nil)
+}
@@ -0,0 +1,369 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/dottrip/fpt-swp/internal/apierror"
+	"github.com/dottrip/fpt-swp/internal/models"
+	"github.com/dottrip/fpt-swp/internal/notify"
+	"github.com/dottrip/fpt-swp/internal/response"
+	"github.com/gin-gonic/gin"
+)
+
+// requireAdmin writes a 403 with the message key unless the user is an admin
+func requireAdmin(c *gin.Context, user *models.User, key string) bool {
+	if hasRole(user, "admin") {
+		return true
+	}
+	apierror.Respond(c, apierror.Forbidden(key))
+	return false
+}
+
+// CreateShiftRoster handles POST /api/staff/rosters. The roster starts as a
+// draft that only admins see.
+func CreateShiftRoster(c *gin.Context) {
+	user, ok := scheduleUser(c)
+	if !ok || !requireAdmin(c, user, "error.roster_admin_only") {
+		return
+	}
+
+	var req models.ShiftRosterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, apierror.FromBinding(err))
+		return
+	}
+
+	userIDs := make([]int, 0, len(req.Shifts))
+	for _, s := range req.Shifts {
+		userIDs = append(userIDs, s.UserID)
+	}
+	if err := validateAttendees(userIDs); err != nil {
+		apierror.Respond(c, apierror.Field("shifts", "staff", ""))
+		return
+	}
+
+	roster := &models.ShiftRoster{
+		Title:       req.Title,
+		PeriodStart: req.PeriodStart,
+		PeriodEnd:   req.PeriodEnd,
+		CreatedBy:   user.ID,
+	}
+	if err := roster.Create(req.Shifts); err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	shifts, err := models.GetRosterShifts(roster.ID)
+	if err == nil {
+		roster.Shifts = shifts
+	}
+
+	response.Message(c, http.StatusCreated, "Roster created successfully", roster)
+}
+
+// GetShiftRosters handles GET /api/staff/rosters. Staff see published
+// rosters; admins also see drafts.
+func GetShiftRosters(c *gin.Context) {
+	user, ok := scheduleUser(c)
+	if !ok {
+		return
+	}
+
+	rosters, err := models.GetShiftRosters(hasRole(user, "admin"))
+	if err != nil {
+		apierror.Respond(c, apierror.Internal(err))
+		return
+	}
+
+	response.List(c, rosters, response.Meta{Total: len(rosters)})
+}
+
+// loadShiftRoster resolves the :id parameter; drafts are only visible to admins
+func loadShiftRoster(c *gin.Context) (*models.User, *models.ShiftRoster, bool) {
+	user, ok := scheduleUser(c)
+	if !ok {
+		return nil, nil, false
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, apierror.BadRequest("error.invalid_id"))
+		return nil, nil, false
+	}
+
+	roster, err := models.GetShiftRosterByID(id)
+	if err != nil || (roster.Status != models.RosterPublished && !hasRole(user, "admin")) {
+		apierror.Respond(c, apierror.NotFound("error.roster_not_found"))
+		return nil, nil, false
+	}
+
+	return user, roster, true
+}
+
+// GetShiftRoster handles GET /api/staff/rosters/{id} with its shifts
+func GetShiftRoster(c *gin.Context) {
+	_, roster, ok := loadShiftRoster(c)
+	if !ok {
+		return
+	}
+
+	shifts, err := models.GetRosterShifts(roster.ID)
+	if err != nil {
+		apierror.Respond(c, apierror.Internal(err))
+		return
+	}
+	roster.Shifts = shifts
+
+	response.OK(c, http.StatusOK, roster)
+}
+
+// AddRosterShift handles POST /api/staff/rosters/{id}/shifts on a draft roster
+func AddRosterShift(c *gin.Context) {
+	user, roster, ok := loadShiftRoster(c)
+	if !ok || !requireAdmin(c, user, "error.roster_admin_only") {
+		return
+	}
+
+	var input models.ShiftInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.FromBinding(err))
+		return
+	}
+
+	if err := validateAttendees([]int{input.UserID}); err != nil {
+		apierror.Respond(c, apierror.Field("shifts", "staff", ""))
+		return
+	}
+
+	shift, err := roster.AddShift(input)
+	if err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	response.Message(c, http.StatusCreated, "Shift added successfully", shift)
+}
+
+// DeleteRosterShift handles DELETE /api/staff/rosters/{id}/shifts/{shiftId}
+// on a draft roster
+func DeleteRosterShift(c *gin.Context) {
+	user, roster, ok := loadShiftRoster(c)
+	if !ok || !requireAdmin(c, user, "error.roster_admin_only") {
+		return
+	}
+
+	shiftID, err := strconv.Atoi(c.Param("shiftId"))
+	if err != nil {
+		apierror.Respond(c, apierror.BadRequest("error.invalid_id"))
+		return
+	}
+
+	if err := roster.DeleteShift(shiftID); err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	response.Message(c, http.StatusOK, "Shift deleted successfully", nil)
+}
+
+// PublishShiftRoster handles POST /api/staff/rosters/{id}/publish
+func PublishShiftRoster(c *gin.Context) {
+	user, roster, ok := loadShiftRoster(c)
+	if !ok || !requireAdmin(c, user, "error.roster_admin_only") {
+		return
+	}
+
+	if err := roster.Publish(); err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	shifts, err := models.GetRosterShifts(roster.ID)
+	if err == nil {
+		notified := make(map[int]bool)
+		for _, s := range shifts {
+			if notified[s.UserID] {
+				continue
+			}
+			notified[s.UserID] = true
+			notify.NotifyAsync(s.UserID, notify.Event{
+				Category: models.NotifySchedule,
+				Title:    "Shift roster published",
+				Body:     "Your shifts for " + roster.Title + " are now available.",
+				Link:     "/dashboard/staff/schedule",
+			})
+		}
+	}
+
+	response.Message(c, http.StatusOK, "Roster published successfully", roster)
+}
+
+// RequestShiftSwap handles POST /api/staff/shifts/{id}/swap-requests. The
+// holder of a published shift asks to hand it to a colleague, optionally in
+// exchange for one of theirs.
+func RequestShiftSwap(c *gin.Context) {
+	user, ok := scheduleUser(c)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, apierror.BadRequest("error.invalid_id"))
+		return
+	}
+
+	shift, err := models.GetShiftByID(id)
+	if err != nil || shift.RosterStatus != models.RosterPublished {
+		apierror.Respond(c, apierror.NotFound("error.shift_not_found"))
+		return
+	}
+
+	var input models.ShiftSwapInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.FromBinding(err))
+		return
+	}
+
+	if err := validateAttendees([]int{input.TargetUserID}); err != nil {
+		apierror.Respond(c, apierror.Field("target_user_id", "staff", ""))
+		return
+	}
+
+	swap, err := shift.CreateSwapRequest(user.ID, input)
+	if err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	notify.NotifyAsync(swap.TargetUserID, notify.Event{
+		Category: models.NotifySchedule,
+		Title:    "Shift swap request",
+		Body:     user.Username + " asked to swap a shift with you.",
+		Link:     "/dashboard/staff/schedule",
+	})
+
+	response.Message(c, http.StatusCreated, "Swap request submitted for approval", swap)
+}
+
+// GetShiftSwapRequests handles GET /api/staff/swap-requests?status=. Admins
+// see every request; staff see requests they made or that involve them.
+func GetShiftSwapRequests(c *gin.Context) {
+	user, ok := scheduleUser(c)
+	if !ok {
+		return
+	}
+
+	filter := models.ShiftSwapFilter{Status: c.Query("status")}
+	if !hasRole(user, "admin") {
+		filter.UserID = user.ID
+	}
+
+	requests, err := models.GetShiftSwapRequests(filter)
+	if err != nil {
+		apierror.Respond(c, apierror.Internal(err))
+		return
+	}
+
+	response.List(c, requests, response.Meta{Total: len(requests)})
+}
+
+// loadShiftSwap resolves the :id parameter. Admins can access every request,
+// staff only those involving them.
+func loadShiftSwap(c *gin.Context) (*models.User, *models.ShiftSwapRequest, bool) {
+	user, ok := scheduleUser(c)
+	if !ok {
+		return nil, nil, false
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, apierror.BadRequest("error.invalid_id"))
+		return nil, nil, false
+	}
+
+	swap, err := models.GetShiftSwapRequestByID(id)
+	if err != nil || (swap.RequesterID != user.ID && swap.TargetUserID != user.ID && !hasRole(user, "admin")) {
+		apierror.Respond(c, apierror.NotFound("error.swap_not_found"))
+		return nil, nil, false
+	}
+
+	return user, swap, true
+}
+
+// ApproveShiftSwap handles POST /api/staff/swap-requests/{id}/approve
+func ApproveShiftSwap(c *gin.Context) {
+	user, swap, ok := loadShiftSwap(c)
+	if !ok || !requireAdmin(c, user, "error.swap_approve_admin_only") {
+		return
+	}
+
+	if err := swap.Approve(user.ID); err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	notifySwapDecision(swap, "approved")
+
+	response.Message(c, http.StatusOK, "Shift swap approved", swap)
+}
+
+// RejectShiftSwap handles POST /api/staff/swap-requests/{id}/reject. Admins
+// and the colleague asked to take the shift can reject a request.
+func RejectShiftSwap(c *gin.Context) {
+	user, swap, ok := loadShiftSwap(c)
+	if !ok {
+		return
+	}
+
+	if swap.TargetUserID != user.ID && !requireAdmin(c, user, "error.swap_reject_forbidden") {
+		return
+	}
+
+	if err := swap.Decide(models.SwapRejected, user.ID); err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	notifySwapDecision(swap, "rejected")
+
+	response.Message(c, http.StatusOK, "Shift swap rejected", swap)
+}
+
+// CancelShiftSwap handles POST /api/staff/swap-requests/{id}/cancel by the requester
+func CancelShiftSwap(c *gin.Context) {
+	user, swap, ok := loadShiftSwap(c)
+	if !ok {
+		return
+	}
+
+	if swap.RequesterID != user.ID {
+		apierror.Respond(c, apierror.Forbidden("error.swap_not_requester"))
+		return
+	}
+
+	if err := swap.Decide(models.SwapCancelled, user.ID); err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	response.Message(c, http.StatusOK, "Swap request cancelled", swap)
+}
+
+// notifySwapDecision tells the requester, and on approval also the colleague
+// taking the shift, how a swap request was decided
+func notifySwapDecision(swap *models.ShiftSwapRequest, decision string) {
+	event := notify.Event{
+		Category: models.NotifySchedule,
+		Title:    "Shift swap " + decision,
+		Body:     "Your swap request with " + swap.TargetUserName + " was " + decision + ".",
+		Link:     "/dashboard/staff/schedule",
+	}
+	notify.NotifyAsync(swap.RequesterID, event)
+
+	if decision == "approved" {
+		event.Body = "You now cover the shift swapped with " + swap.RequesterName + "."
+		notify.NotifyAsync(swap.TargetUserID, event)
+	}
+}
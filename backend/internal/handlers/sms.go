@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dottrip/fpt-swp/internal/apierror"
+	"github.com/dottrip/fpt-swp/internal/models"
+	"github.com/dottrip/fpt-swp/internal/response"
+	"github.com/dottrip/fpt-swp/internal/sms"
+	"github.com/gin-gonic/gin"
+)
+
+// PhoneInput represents the request to set the phone number SMS go to
+type PhoneInput struct {
+	Phone string `json:"phone" binding:"max=32"`
+}
+
+// UpdateNotificationPhone handles PUT /api/notifications/phone. An empty
+// phone removes the number.
+func UpdateNotificationPhone(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		apierror.Respond(c, apierror.Unauthorized())
+		return
+	}
+
+	var input PhoneInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.FromBinding(err))
+		return
+	}
+
+	var phone string
+	if strings.TrimSpace(input.Phone) != "" {
+		normalized, err := sms.NormalizePhone(input.Phone)
+		if err != nil {
+			apierror.Respond(c, apierror.Field("phone", "vnphone", ""))
+			return
+		}
+		phone = normalized
+	}
+
+	if err := models.SetUserPhone(user.ID, phone); err != nil {
+		apierror.Respond(c, apierror.Internal(err))
+		return
+	}
+
+	response.Message(c, http.StatusOK, "Phone number updated successfully", gin.H{"phone": phone})
+}
+
+// GetSMSMessages handles GET /api/sms/messages?phone=&status= for admins
+func GetSMSMessages(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		apierror.Respond(c, apierror.Unauthorized())
+		return
+	}
+	if !requireAdmin(c, user, "error.sms_log_admin_only") {
+		return
+	}
+
+	filter := models.SMSMessageFilter{
+		Status: c.Query("status"),
+		Limit:  50,
+	}
+	if phone := c.Query("phone"); phone != "" {
+		normalized, err := sms.NormalizePhone(phone)
+		if err != nil {
+			apierror.Respond(c, apierror.Field("phone", "vnphone", ""))
+			return
+		}
+		filter.PhoneNumber = normalized
+	}
+	if limit, err := strconv.Atoi(c.Query("limit")); err == nil && limit > 0 && limit <= 200 {
+		filter.Limit = limit
+	}
+	if offset, err := strconv.Atoi(c.Query("offset")); err == nil && offset > 0 {
+		filter.Offset = offset
+	}
+
+	messages, err := models.GetSMSMessages(filter)
+	if err != nil {
+		apierror.Respond(c, apierror.Internal(err))
+		return
+	}
+
+	response.OK(c, http.StatusOK, messages)
+}
+
+// callbackFields reads a delivery report sent as JSON, a form or a query
+// string into flat string values
+func callbackFields(c *gin.Context) (map[string]string, error) {
+	fields := map[string]string{}
+
+	if strings.HasPrefix(c.ContentType(), "application/json") {
+		var body map[string]interface{}
+		if err := json.NewDecoder(c.Request.Body).Decode(&body); err != nil {
+			return nil, err
+		}
+		for key, value := range body {
+			switch v := value.(type) {
+			case string:
+				fields[key] = v
+			case float64:
+				fields[key] = strconv.FormatFloat(v, 'f', -1, 64)
+			}
+		}
+	} else if err := c.Request.ParseForm(); err != nil {
+		return nil, err
+	} else {
+		for key := range c.Request.Form {
+			fields[key] = c.Request.Form.Get(key)
+		}
+	}
+
+	for key, value := range c.Request.URL.Query() {
+		if _, ok := fields[key]; !ok && key != "token" {
+			fields[key] = value[0]
+		}
+	}
+	return fields, nil
+}
+
+// firstField returns the first non-empty value among keys
+func firstField(fields map[string]string, keys ...string) string {
+	for _, key := range keys {
+		if value := strings.TrimSpace(fields[key]); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// SMSStatusCallback handles delivery reports posted by the SMS gateway to
+// /api/sms/status-callback?token=. Callbacks are refused until
+// SMS_CALLBACK_SECRET is set.
+func SMSStatusCallback(c *gin.Context) {
+	secret := sms.CallbackSecret()
+	if secret == "" || subtle.ConstantTimeCompare([]byte(c.Query("token")), []byte(secret)) != 1 {
+		apierror.Respond(c, apierror.Unauthorized().WithKey("error.invalid_token", nil))
+		return
+	}
+
+	fields, err := callbackFields(c)
+	if err != nil {
+		apierror.Respond(c, apierror.BadRequest("error.malformed_body"))
+		return
+	}
+
+	status, ok := sms.ParseDeliveryStatus(firstField(fields, "status", "state", "dlr_status"))
+	if !ok {
+		apierror.Respond(c, apierror.Field("status", "invalid", ""))
+		return
+	}
+
+	reference := firstField(fields, "reference", "ref", "client_ref")
+	providerID := firstField(fields, "message_id", "msg_id", "sms_id", "id")
+	if reference == "" && providerID == "" {
+		apierror.Respond(c, apierror.Field("reference", "required", ""))
+		return
+	}
+
+	message, err := sms.FindMessage(reference, providerID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			apierror.Respond(c, apierror.NotFound("error.sms_not_found"))
+			return
+		}
+		apierror.Respond(c, apierror.Internal(err))
+		return
+	}
+
+	reason := firstField(fields, "error", "error_message", "description", "reason")
+	if err := message.UpdateDeliveryStatus(status, reason); err != nil {
+		log.Printf("sms: failed to record delivery report for message %d: %v", message.ID, err)
+		apierror.Respond(c, apierror.Internal(err))
+		return
+	}
+
+	response.Message(c, http.StatusOK, fmt.Sprintf("Message %d is %s", message.ID, message.Status), nil)
+}
@@ -0,0 +1,315 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/dottrip/fpt-swp/internal/apierror"
+	"github.com/dottrip/fpt-swp/internal/models"
+	"github.com/dottrip/fpt-swp/internal/notify"
+	"github.com/dottrip/fpt-swp/internal/response"
+	"github.com/gin-gonic/gin"
+)
+
+// CreateSupportTicket handles POST /api/support/tickets
+func CreateSupportTicket(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		apierror.Respond(c, apierror.Unauthorized())
+		return
+	}
+
+	var req models.SupportTicketRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, apierror.FromBinding(err))
+		return
+	}
+
+	ticket := &models.SupportTicket{
+		PatientID:   user.ID,
+		Subject:     req.Subject,
+		Description: req.Description,
+		Category:    req.Category,
+		Priority:    req.Priority,
+	}
+
+	if err := ticket.Create(); err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	created, err := models.GetSupportTicketByID(ticket.ID)
+	if err != nil {
+		created = ticket
+	}
+
+	response.Message(c, http.StatusCreated, "Support ticket created successfully", created)
+}
+
+// GetSupportTickets handles GET /api/support/tickets. Staff get the queue,
+// filtered by ?status=, ?priority=, ?category=, ?assignee= (a user ID, "me"
+// or "unassigned") and ?breached=true; patients get their own tickets.
+func GetSupportTickets(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		apierror.Respond(c, apierror.Unauthorized())
+		return
+	}
+
+	filter := models.SupportTicketFilter{
+		Status:   c.Query("status"),
+		Priority: c.Query("priority"),
+		Category: c.Query("category"),
+		Breached: c.Query("breached") == "true",
+		Limit:    20,
+	}
+
+	if limit, err := strconv.Atoi(c.Query("limit")); err == nil && limit > 0 && limit <= 100 {
+		filter.Limit = limit
+	}
+	if offset, err := strconv.Atoi(c.Query("offset")); err == nil && offset > 0 {
+		filter.Offset = offset
+	}
+
+	if hasRole(user, "admin", "staff") {
+		switch assignee := c.Query("assignee"); assignee {
+		case "":
+		case "me":
+			filter.AssignedTo = user.ID
+		case "unassigned":
+			filter.Unassigned = true
+		default:
+			id, err := strconv.Atoi(assignee)
+			if err != nil {
+				apierror.Respond(c, apierror.Field("assignee", "invalid", ""))
+				return
+			}
+			filter.AssignedTo = id
+		}
+	} else {
+		filter.PatientID = user.ID
+	}
+
+	tickets, err := models.GetSupportTickets(filter)
+	if err != nil {
+		apierror.Respond(c, apierror.Internal(err))
+		return
+	}
+
+	response.List(c, tickets, response.Meta{Total: len(tickets)})
+}
+
+// canAccessTicket reports whether user may see the ticket: staff see every
+// ticket, patients only their own
+func canAccessTicket(user *models.User, ticketID int) bool {
+	if hasRole(user, "admin", "staff") {
+		return true
+	}
+	ticket, err := models.GetSupportTicketByID(ticketID)
+	return err == nil && ticket.PatientID == user.ID
+}
+
+// loadSupportTicket resolves the :id parameter. Staff can access every
+// ticket, patients only their own.
+func loadSupportTicket(c *gin.Context) (*models.User, *models.SupportTicket, bool) {
+	user, ok := currentUser(c)
+	if !ok {
+		apierror.Respond(c, apierror.Unauthorized())
+		return nil, nil, false
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, apierror.BadRequest("error.invalid_id"))
+		return nil, nil, false
+	}
+
+	ticket, err := models.GetSupportTicketByID(id)
+	if err != nil || (ticket.PatientID != user.ID && !hasRole(user, "admin", "staff")) {
+		apierror.Respond(c, apierror.NotFound("error.ticket_not_found"))
+		return nil, nil, false
+	}
+
+	return user, ticket, true
+}
+
+// GetSupportTicket handles GET /api/support/tickets/{id} with its message thread
+func GetSupportTicket(c *gin.Context) {
+	_, ticket, ok := loadSupportTicket(c)
+	if !ok {
+		return
+	}
+
+	messages, err := models.GetTicketMessages(ticket.ID)
+	if err != nil {
+		apierror.Respond(c, apierror.Internal(err))
+		return
+	}
+	ticket.Messages = messages
+
+	response.OK(c, http.StatusOK, ticket)
+}
+
+// TicketReplyInput represents the request structure for replying to a ticket
+type TicketReplyInput struct {
+	Message string `json:"message" binding:"required"`
+}
+
+// ReplySupportTicket handles POST /api/support/tickets/{id}/messages
+func ReplySupportTicket(c *gin.Context) {
+	user, ticket, ok := loadSupportTicket(c)
+	if !ok {
+		return
+	}
+
+	var input TicketReplyInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.FromBinding(err))
+		return
+	}
+
+	message, err := ticket.Reply(user, input.Message)
+	if errors.Is(err, models.ErrTicketClosed) {
+		apierror.Respond(c, apierror.Conflict("error.ticket_closed"))
+		return
+	}
+	if err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	notifyTicketReply(user, ticket)
+
+	response.Message(c, http.StatusCreated, "Reply sent successfully", gin.H{
+		"message": message,
+		"ticket":  ticket,
+	})
+}
+
+// AssignTicketInput represents the request structure for assigning a ticket
+type AssignTicketInput struct {
+	AssigneeID int `json:"assignee_id" binding:"required"`
+}
+
+// AssignSupportTicket handles PUT /api/support/tickets/{id}/assign
+func AssignSupportTicket(c *gin.Context) {
+	user, ticket, ok := loadSupportTicket(c)
+	if !ok {
+		return
+	}
+
+	if !hasRole(user, "admin", "staff") {
+		apierror.Respond(c, apierror.Forbidden("error.ticket_assign_staff_only"))
+		return
+	}
+
+	var input AssignTicketInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.FromBinding(err))
+		return
+	}
+
+	assignee, err := models.GetByID(input.AssigneeID)
+	if err != nil || !hasRole(assignee, "admin", "staff") {
+		apierror.Respond(c, apierror.Field("assignee_id", "staff", ""))
+		return
+	}
+
+	if err := ticket.Assign(assignee.ID); err != nil {
+		apierror.Respond(c, apierror.Internal(err))
+		return
+	}
+
+	if assignee.ID != user.ID {
+		notify.NotifyAsync(assignee.ID, notify.Event{
+			Category: models.NotifySupport,
+			Title:    "Support ticket assigned to you",
+			Body:     ticket.Subject,
+			Link:     "/dashboard/staff/support",
+		})
+	}
+
+	response.Message(c, http.StatusOK, "Ticket assigned successfully", ticket)
+}
+
+// TicketStatusInput represents the request structure for changing a ticket's status
+type TicketStatusInput struct {
+	Status string `json:"status" binding:"required,oneof=open in_progress resolved closed"`
+}
+
+// UpdateSupportTicketStatus handles PUT /api/support/tickets/{id}/status.
+// Patients may only close their own tickets.
+func UpdateSupportTicketStatus(c *gin.Context) {
+	user, ticket, ok := loadSupportTicket(c)
+	if !ok {
+		return
+	}
+
+	var input TicketStatusInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.FromBinding(err))
+		return
+	}
+
+	if !hasRole(user, "admin", "staff") && input.Status != models.TicketClosed {
+		apierror.Respond(c, apierror.Forbidden("error.ticket_not_owner"))
+		return
+	}
+
+	if err := ticket.SetStatus(input.Status); err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	response.Message(c, http.StatusOK, "Ticket status updated successfully", ticket)
+}
+
+// UpdateSupportTicketPriority handles PUT /api/support/tickets/{id}/priority
+func UpdateSupportTicketPriority(c *gin.Context) {
+	user, ticket, ok := loadSupportTicket(c)
+	if !ok {
+		return
+	}
+
+	if !hasRole(user, "admin", "staff") {
+		apierror.Respond(c, apierror.Forbidden("error.ticket_priority_staff_only"))
+		return
+	}
+
+	var input SetPriorityInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.FromBinding(err))
+		return
+	}
+
+	if err := ticket.SetPriority(input.Priority); err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	response.Message(c, http.StatusOK, "Ticket priority updated successfully", ticket)
+}
+
+// notifyTicketReply tells the other side of a ticket about a new reply: the
+// patient when staff answer, the assignee when the patient does
+func notifyTicketReply(author *models.User, ticket *models.SupportTicket) {
+	if hasRole(author, "admin", "staff") {
+		notify.NotifyAsync(ticket.PatientID, notify.Event{
+			Category: models.NotifySupport,
+			Title:    "New reply to your support ticket",
+			Body:     ticket.Subject,
+			Link:     "/dashboard/patient",
+		})
+		return
+	}
+
+	if ticket.AssignedTo != nil {
+		notify.NotifyAsync(*ticket.AssignedTo, notify.Event{
+			Category: models.NotifySupport,
+			Title:    "Patient replied to a support ticket",
+			Body:     ticket.Subject,
+			Link:     "/dashboard/staff/support",
+		})
+	}
+}
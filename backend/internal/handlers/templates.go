@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/dottrip/fpt-swp/internal/apierror"
+	"github.com/dottrip/fpt-swp/internal/response"
+	"github.com/dottrip/fpt-swp/internal/templates"
+	"github.com/gin-gonic/gin"
+)
+
+// previewSet loads the templates afresh so admins see edits to the override
+// directory without a restart
+func previewSet(c *gin.Context) (*templates.Set, bool) {
+	user, ok := currentUser(c)
+	if !ok {
+		apierror.Respond(c, apierror.Unauthorized())
+		return nil, false
+	}
+	if !requireAdmin(c, user, "error.template_preview_admin_only") {
+		return nil, false
+	}
+
+	set, err := templates.Load(os.Getenv("TEMPLATES_DIR"))
+	if err != nil {
+		apierror.Respond(c, apierror.Internal(err))
+		return nil, false
+	}
+	return set, true
+}
+
+// GetTemplates handles GET /api/admin/templates?locale=. It lists the emails
+// and every message rendered with its sample data, and reports templates
+// that are missing or broken.
+func GetTemplates(c *gin.Context) {
+	set, ok := previewSet(c)
+	if !ok {
+		return
+	}
+
+	locale := c.DefaultQuery("locale", templates.DefaultLocale)
+	if !templates.IsLocale(locale) {
+		apierror.Respond(c, apierror.Field("locale", "oneof", strings.Join(templates.Locales, " ")))
+		return
+	}
+
+	messages := gin.H{}
+	for _, key := range set.Messages() {
+		rendered, err := set.Render(locale, key, set.Fixture(key))
+		if err != nil {
+			rendered = "error: " + err.Error()
+		}
+		messages[key] = rendered
+	}
+
+	var problems []string
+	if err := set.Check(); err != nil {
+		problems = strings.Split(err.Error(), "\n")
+	}
+
+	response.OK(c, http.StatusOK, gin.H{
+		"locales":  templates.Locales,
+		"emails":   set.Emails(),
+		"messages": messages,
+		"problems": problems,
+	})
+}
+
+// PreviewEmailTemplate handles GET and POST /api/admin/templates/email/:name
+// ?locale=&format=html|text. It renders with the sample data, or with the
+// JSON object POSTed as the body. Without a format it returns the subject,
+// text and HTML as JSON.
+func PreviewEmailTemplate(c *gin.Context) {
+	set, ok := previewSet(c)
+	if !ok {
+		return
+	}
+
+	name := "email/" + c.Param("name")
+	locale := c.DefaultQuery("locale", templates.DefaultLocale)
+	if !templates.IsLocale(locale) {
+		apierror.Respond(c, apierror.Field("locale", "oneof", strings.Join(templates.Locales, " ")))
+		return
+	}
+
+	data := set.Fixture(name)
+	if c.Request.Method == http.MethodPost {
+		var body map[string]interface{}
+		if err := json.NewDecoder(c.Request.Body).Decode(&body); err != nil {
+			apierror.Respond(c, apierror.FromBinding(err))
+			return
+		}
+		data = body
+	}
+
+	email, err := set.RenderEmail(locale, name, data)
+	if err != nil {
+		if strings.Contains(err.Error(), "unknown email") {
+			apierror.Respond(c, apierror.NotFound("error.template_not_found"))
+			return
+		}
+		// The error names the template line at fault, which is what an
+		// admin previewing a template needs to see
+		apierror.Respond(c, apierror.New(http.StatusUnprocessableEntity, apierror.CodeValidation).
+			WithKey("error.template_render_failed", map[string]interface{}{"Error": err.Error()}))
+		return
+	}
+
+	switch c.Query("format") {
+	case "html":
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(email.HTML))
+	case "text":
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte("Subject: "+email.Subject+"\n\n"+email.Text))
+	default:
+		response.OK(c, http.StatusOK, email)
+	}
+}
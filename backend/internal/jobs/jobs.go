@@ -0,0 +1,22 @@
+// Package jobs runs periodic background maintenance tasks
+package jobs
+
+import (
+	"log"
+	"time"
+)
+
+// Every runs fn every interval until the process exits. Errors are logged and
+// the job keeps running; fn must be safe to run on several replicas at once.
+func Every(name string, interval time.Duration, fn func() error) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := fn(); err != nil {
+				log.Printf("jobs: %s failed: %v", name, err)
+			}
+		}
+	}()
+}
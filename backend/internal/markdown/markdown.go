@@ -0,0 +1,76 @@
+// Package markdown renders blog posts written in Markdown (CommonMark with
+// GitHub-style tables) to HTML that is safe to put in a page as is. Raw HTML
+// in the source is dropped, and the output passes through an allowlist
+// sanitizer, so staff can format posts but not inject scripts or styles.
+package markdown
+
+import (
+	"bytes"
+	"html"
+	"regexp"
+
+	"github.com/dottrip/fpt-swp/internal/textutil"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+var (
+	converter = goldmark.New(
+		goldmark.WithExtensions(
+			extension.NewTable(extension.WithTableCellAlignMethod(extension.TableCellAlignAttribute)),
+			extension.Strikethrough,
+		),
+	)
+
+	// policy allows the elements Markdown produces and nothing else
+	policy = newPolicy()
+
+	// text keeps only the text of an HTML fragment
+	text = bluemonday.StrictPolicy()
+)
+
+// newPolicy builds the allowlist of elements and attributes rendered posts
+// may contain. Links and images must be http(s), mailto or relative URLs,
+// and links to other sites open in a new tab without access to the opener.
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.NewPolicy()
+
+	p.AllowElements(
+		"p", "br", "hr", "h1", "h2", "h3", "h4", "h5", "h6",
+		"blockquote", "pre", "code", "em", "strong", "del",
+		"ul", "ol", "li", "table", "thead", "tbody", "tr", "th", "td",
+	)
+	p.AllowAttrs("start").Matching(bluemonday.Integer).OnElements("ol")
+	p.AllowAttrs("align").Matching(regexp.MustCompile(`^(?:left|center|right)$`)).OnElements("th", "td")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+#-]+$`)).OnElements("code")
+
+	p.AllowAttrs("href", "title").OnElements("a")
+	p.AllowAttrs("src", "alt", "title").OnElements("img")
+	p.AllowURLSchemes("http", "https", "mailto")
+	p.AllowRelativeURLs(true)
+	p.RequireParseableURLs(true)
+	p.AddTargetBlankToFullyQualifiedLinks(true)
+
+	return p
+}
+
+// Render converts Markdown source to sanitized HTML
+func Render(source string) (string, error) {
+	var buf bytes.Buffer
+	if err := converter.Convert([]byte(source), &buf); err != nil {
+		return "", err
+	}
+	return policy.Sanitize(buf.String()), nil
+}
+
+// Excerpt returns the text of rendered HTML, without markup, shortened to
+// at most limit characters
+func Excerpt(rendered string, limit int) string {
+	return textutil.Truncate(PlainText(rendered), limit)
+}
+
+// PlainText returns the text of rendered HTML without markup
+func PlainText(rendered string) string {
+	return html.UnescapeString(text.Sanitize(rendered))
+}
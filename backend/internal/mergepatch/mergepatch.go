@@ -0,0 +1,59 @@
+// Package mergepatch applies JSON Merge Patch documents (RFC 7386): members
+// of the patch replace those of the target, objects are merged recursively
+// and null removes a member.
+package mergepatch
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// ContentType is the media type of merge patch documents
+const ContentType = "application/merge-patch+json"
+
+// Apply returns doc with patch applied. Both must be JSON documents.
+func Apply(doc, patch []byte) ([]byte, error) {
+	target, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := decode(patch)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(merge(target, changes))
+}
+
+// decode parses a document, keeping numbers as written so that large
+// integers survive the round trip
+func decode(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// merge is the MergePatch function of RFC 7386, section 2
+func merge(target, patch interface{}) interface{} {
+	changes, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	object, ok := target.(map[string]interface{})
+	if !ok {
+		object = map[string]interface{}{}
+	}
+	for name, value := range changes {
+		if value == nil {
+			delete(object, name)
+			continue
+		}
+		object[name] = merge(object[name], value)
+	}
+	return object
+}
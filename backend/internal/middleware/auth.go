@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/dottrip/fpt-swp/internal/apierror"
 	"github.com/gin-gonic/gin"
 	"github.com/dottrip/fpt-swp/pkg/utils"
 )
@@ -14,7 +15,7 @@ func JWTAuthMiddleware() gin.HandlerFunc {
 		// Get the Authorization header
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "authorization header is required"})
+			apierror.Respond(c, apierror.New(http.StatusUnauthorized, apierror.CodeUnauthorized).WithKey("error.missing_token", nil))
 			c.Abort()
 			return
 		}
@@ -22,7 +23,7 @@ func JWTAuthMiddleware() gin.HandlerFunc {
 		// Check if the header has the Bearer prefix
 		parts := strings.Split(authHeader, " ")
 		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid authorization format"})
+			apierror.Respond(c, apierror.New(http.StatusUnauthorized, apierror.CodeUnauthorized).WithKey("error.invalid_auth_format", nil))
 			c.Abort()
 			return
 		}
@@ -33,7 +34,7 @@ func JWTAuthMiddleware() gin.HandlerFunc {
 		// Validate the token
 		userID, err := utils.ExtractTokenID(tokenString)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
+			apierror.Respond(c, apierror.New(http.StatusUnauthorized, apierror.CodeUnauthorized).WithKey("error.invalid_token", nil))
 			c.Abort()
 			return
 		}
@@ -42,4 +43,33 @@ func JWTAuthMiddleware() gin.HandlerFunc {
 		c.Set("user_id", userID)
 		c.Next()
 	}
-} 
\ No newline at end of file
+} 
+// WebSocketAuthMiddleware authenticates WebSocket upgrade requests. Browsers
+// cannot set headers on WebSocket handshakes, so the token may also be passed
+// in the "token" query parameter.
+func WebSocketAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString := c.Query("token")
+		if authHeader := c.GetHeader("Authorization"); authHeader != "" {
+			tokenString = strings.TrimPrefix(authHeader, "Bearer ")
+		}
+
+		if tokenString == "" {
+			apierror.Respond(c, apierror.New(http.StatusUnauthorized, apierror.CodeUnauthorized).WithKey("error.missing_token", nil))
+			c.Abort()
+			return
+		}
+
+		// Validate the token
+		userID, err := utils.ExtractTokenID(tokenString)
+		if err != nil {
+			apierror.Respond(c, apierror.New(http.StatusUnauthorized, apierror.CodeUnauthorized).WithKey("error.invalid_token", nil))
+			c.Abort()
+			return
+		}
+
+		// Set the user ID in the context
+		c.Set("user_id", userID)
+		c.Next()
+	}
+}
@@ -0,0 +1,110 @@
+package models
+
+import (
+	"time"
+
+	"github.com/dottrip/fpt-swp/internal/database"
+)
+
+// Attachment is an uploaded file. The content lives in file storage under
+// StorageKey, which is shared by every attachment with the same hash.
+type Attachment struct {
+	ID           int       `json:"id"`
+	OwnerID      int       `json:"owner_id"`
+	Context      string    `json:"context"`              // general, chat, ticket, medical_record, blog, avatar
+	ContextID    *int      `json:"context_id,omitempty"` // conversation, ticket, or patient user ID of a medical record
+	Filename     string    `json:"filename"`
+	ContentType  string    `json:"content_type"`
+	Size         int64     `json:"size"`
+	SHA256       string    `json:"sha256"`
+	StorageKey   string    `json:"-"`
+	ThumbnailKey string    `json:"-"`
+	Width        int       `json:"width,omitempty"`
+	Height       int       `json:"height,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Create creates a new attachment record
+func (a *Attachment) Create() error {
+	dbType := getEnv("DB_TYPE", "postgres")
+
+	if dbType == "sqlite" {
+		query := `
+			INSERT INTO attachments (owner_id, context, context_id, filename, content_type, size, sha256,
+				storage_key, thumbnail_key, width, height, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		`
+
+		result, err := database.DB.Exec(query, a.OwnerID, a.Context, a.ContextID, a.Filename, a.ContentType,
+			a.Size, a.SHA256, a.StorageKey, a.ThumbnailKey, a.Width, a.Height)
+		if err != nil {
+			return err
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		a.ID = int(id)
+
+		return database.DB.QueryRow(`SELECT created_at FROM attachments WHERE id = ?`, a.ID).Scan(&a.CreatedAt)
+	}
+
+	query := `
+		INSERT INTO attachments (owner_id, context, context_id, filename, content_type, size, sha256,
+			storage_key, thumbnail_key, width, height)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING id, created_at
+	`
+
+	return database.DB.QueryRow(query, a.OwnerID, a.Context, a.ContextID, a.Filename, a.ContentType,
+		a.Size, a.SHA256, a.StorageKey, a.ThumbnailKey, a.Width, a.Height,
+	).Scan(&a.ID, &a.CreatedAt)
+}
+
+// GetAttachmentByID retrieves an attachment by ID
+func GetAttachmentByID(id int) (*Attachment, error) {
+	a := &Attachment{}
+
+	query := `
+		SELECT id, owner_id, context, context_id, filename, content_type, size, sha256,
+			storage_key, COALESCE(thumbnail_key, ''), width, height, created_at
+		FROM attachments WHERE id = ` + getPlaceholder(1)
+
+	err := database.DB.QueryRow(query, id).Scan(
+		&a.ID, &a.OwnerID, &a.Context, &a.ContextID, &a.Filename, &a.ContentType, &a.Size, &a.SHA256,
+		&a.StorageKey, &a.ThumbnailKey, &a.Width, &a.Height, &a.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// FindAttachmentByHash returns an existing attachment with the same content,
+// so its stored object and thumbnail can be reused
+func FindAttachmentByHash(sha256 string) (*Attachment, error) {
+	var id int
+	query := "SELECT id FROM attachments WHERE sha256 = " + getPlaceholder(1) + " ORDER BY id LIMIT 1"
+	if err := database.DB.QueryRow(query, sha256).Scan(&id); err != nil {
+		return nil, err
+	}
+	return GetAttachmentByID(id)
+}
+
+// Delete removes the attachment record. It reports whether the stored content
+// is no longer referenced by any attachment and can be deleted.
+func (a *Attachment) Delete() (orphaned bool, err error) {
+	if _, err := database.DB.Exec("DELETE FROM attachments WHERE id = "+getPlaceholder(1), a.ID); err != nil {
+		return false, err
+	}
+
+	var remaining int
+	query := "SELECT COUNT(*) FROM attachments WHERE storage_key = " + getPlaceholder(1)
+	if err := database.DB.QueryRow(query, a.StorageKey).Scan(&remaining); err != nil {
+		return false, err
+	}
+
+	return remaining == 0, nil
+}
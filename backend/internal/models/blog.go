@@ -2,7 +2,6 @@ package models
 
 import (
 	"database/sql"
-	"errors"
 	"fmt"
 	"html"
 	"os"
@@ -10,36 +9,130 @@ import (
 	"time"
 
 	"github.com/dottrip/fpt-swp/internal/database"
+	"github.com/dottrip/fpt-swp/internal/markdown"
+	"github.com/dottrip/fpt-swp/internal/textutil"
 )
 
 // BlogPost represents a blog post in the system
 type BlogPost struct {
-	ID          int        `json:"id"`
-	Title       string     `json:"title"`
-	Content     string     `json:"content"`
-	Excerpt     string     `json:"excerpt"`
-	Thumbnail   string     `json:"thumbnail"`
-	AuthorID    int        `json:"author_id"`
-	AuthorName  string     `json:"author_name"`
-	Status      string     `json:"status"` // draft, published, archived
-	Category    string     `json:"category"`
-	Tags        string     `json:"tags"` // comma-separated
-	ViewCount   int        `json:"view_count"`
-	CreatedAt   time.Time  `json:"created_at"`
-	UpdatedAt   time.Time  `json:"updated_at"`
-	PublishedAt *time.Time `json:"published_at,omitempty"`
+	ID              int        `json:"id"`
+	Title           string     `json:"title"`
+	Slug            string     `json:"slug"`             // unique; former slugs redirect to it
+	ContentMarkdown string     `json:"content_markdown"` // source as written by staff
+	ContentHTML     string     `json:"content_html"`     // rendered from ContentMarkdown and sanitized on save
+	Excerpt         string     `json:"excerpt"`
+	Thumbnail       string     `json:"thumbnail"`
+	AuthorID        int        `json:"author_id"`
+	AuthorName      string     `json:"author_name"`
+	Status          string     `json:"status"` // draft, pending_review, scheduled, published, archived
+	Category        string     `json:"category"`
+	Tags            string     `json:"tags"` // comma-separated
+	ViewCount       int        `json:"view_count"`
+	Version         int        `json:"version"` // incremented by every update
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	PublishedAt     *time.Time `json:"published_at,omitempty"`
+	PublishAt       *time.Time `json:"publish_at,omitempty"`   // when a scheduled post is published
+	UnpublishAt     *time.Time `json:"unpublish_at,omitempty"` // when a published post is archived
+
+	// Category and Tags are the names of the post's category and tags; new
+	// ones are created when the post is saved
+	CategoryID   *int          `json:"category_id"`
+	CategorySlug string        `json:"category_slug,omitempty"`
+	TagList      []BlogTermRef `json:"tag_list"` // by name
+
+	CommentsEnabled bool `json:"comments_enabled"` // readers may comment
+	CommentCount    int  `json:"comment_count"`    // approved comments
+
+	ReviewerID    *int               `json:"reviewer_id,omitempty"`    // doctor asked to review the post
+	MedicalReview *BlogMedicalReview `json:"medical_review,omitempty"` // approval of the current content
+
+	EditorID       int                `json:"-"` // user saving the post, recorded in its revision; defaults to the author
+	ReviewOverride bool               `json:"-"` // an admin publishes the post without a medical review
+	reviewNote     *BlogReviewComment // saved with the next Update, for review actions
+}
+
+// excerptLength is the length, in characters, of generated excerpts
+const excerptLength = 200
+
+// BlogPostInput represents the request structure for creating/updating a
+// blog post. The author, view count and timestamps are set by the server.
+type BlogPostInput struct {
+	Title           string     `json:"title" binding:"required,max=255"`
+	Slug            string     `json:"slug" binding:"omitempty,max=100,slug"` // generated from the title on create if empty
+	ContentMarkdown string     `json:"content_markdown" binding:"required"`   // CommonMark with tables
+	Excerpt         string     `json:"excerpt"`
+	Thumbnail       string     `json:"thumbnail" binding:"max=500"`
+	Status          string     `json:"status" binding:"omitempty,oneof=draft pending_review scheduled published archived"`
+	Category        string     `json:"category" binding:"max=100"`
+	Tags            string     `json:"tags"`
+	PublishAt       *time.Time `json:"publish_at"`        // required when scheduled
+	UnpublishAt     *time.Time `json:"unpublish_at"`      // optional expiry
+	CommentsEnabled *bool      `json:"comments_enabled"`  // kept as it is if left out
+	ReviewerID      *int       `json:"reviewer_id"`       // doctor to review a live post the edit sends back to review; kept if left out
+	Version         int        `json:"version,omitempty"` // version the change is based on, if not given in If-Match
+}
+
+// Apply copies the input onto the post
+func (in BlogPostInput) Apply(b *BlogPost) {
+	b.Title = in.Title
+	if in.Slug != "" {
+		b.Slug = in.Slug
+	}
+	b.ContentMarkdown = in.ContentMarkdown
+	b.Excerpt = in.Excerpt
+	b.Thumbnail = in.Thumbnail
+	b.Status = in.Status
+	b.Category = in.Category
+	b.Tags = in.Tags
+	b.PublishAt = in.PublishAt
+	b.UnpublishAt = in.UnpublishAt
+	if in.CommentsEnabled != nil {
+		b.CommentsEnabled = *in.CommentsEnabled
+	}
+	if in.ReviewerID != nil {
+		b.ReviewerID = in.ReviewerID
+	}
+}
+
+// Input returns the post as the input that would store it unchanged, undoing
+// the escaping BeforeSave applies. A generated excerpt is left out so that
+// it follows changes to the content.
+func (b *BlogPost) Input() BlogPostInput {
+	excerpt := b.Excerpt
+	if excerpt == markdown.Excerpt(b.ContentHTML, excerptLength) {
+		excerpt = ""
+	}
+
+	return BlogPostInput{
+		Title:           html.UnescapeString(b.Title),
+		Slug:            b.Slug,
+		ContentMarkdown: b.ContentMarkdown,
+		Excerpt:         excerpt,
+		Thumbnail:       html.UnescapeString(b.Thumbnail),
+		Status:          b.Status,
+		Category:        b.Category,
+		Tags:            b.Tags,
+		PublishAt:       b.PublishAt,
+		UnpublishAt:     b.UnpublishAt,
+		CommentsEnabled: &b.CommentsEnabled,
+		Version:         b.Version,
+	}
 }
 
 // BlogPostFilter represents filter options for blog posts
 type BlogPostFilter struct {
 	Status    string
+	Visible   bool // only posts the public can read now; see IsVisible
 	Category  string
+	Tag       string // slug or name, like Category
 	AuthorID  int
-	Search    string
+	Search    string // words, matched in full text; see SearchBlogPosts
 	Limit     int
 	Offset    int
-	SortBy    string // title, created_at, updated_at, view_count
-	SortOrder string // asc, desc
+	SortBy    string  // title, created_at, updated_at, view_count, relevance
+	SortOrder string  // asc, desc
+	Keyset    *Keyset // pages by ID instead of Offset when set
 }
 
 // getEnvBlog gets an environment variable or returns a default value
@@ -64,58 +157,114 @@ func getPlaceholderBlog(index int) string {
 func (b *BlogPost) BeforeSave() error {
 	// Sanitize input
 	b.Title = html.EscapeString(strings.TrimSpace(b.Title))
-	b.Category = html.EscapeString(strings.TrimSpace(b.Category))
-	b.Tags = html.EscapeString(strings.TrimSpace(b.Tags))
+	b.Category = strings.TrimSpace(b.Category)
+	b.Tags = strings.TrimSpace(b.Tags)
 	b.Thumbnail = html.EscapeString(strings.TrimSpace(b.Thumbnail))
 
-	// Generate excerpt if not provided
-	if b.Excerpt == "" && len(b.Content) > 200 {
-		b.Excerpt = b.Content[:200] + "..."
+	// Render the Markdown; only the sanitized HTML is served as markup
+	rendered, err := markdown.Render(b.ContentMarkdown)
+	if err != nil {
+		return err
+	}
+	b.ContentHTML = rendered
+
+	// Generate a plain-text excerpt if not provided
+	if strings.TrimSpace(b.Excerpt) == "" {
+		b.Excerpt = markdown.Excerpt(b.ContentHTML, excerptLength)
+	}
+
+	// Store times in UTC so that SQLite compares them correctly, and stamp
+	// the first publication
+	now := time.Now().UTC().Truncate(time.Second)
+	b.PublishAt = utcSecond(b.PublishAt)
+	b.UnpublishAt = utcSecond(b.UnpublishAt)
+	b.scheduleStatus(now)
+	if b.Status == "published" && b.PublishedAt == nil {
+		b.PublishedAt = &now
 	}
 
 	return nil
 }
 
+// utcSecond returns t in UTC, to the second
+func utcSecond(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC().Truncate(time.Second)
+	return &u
+}
+
 // Validate validates the blog post data
 func (b *BlogPost) Validate() error {
 	if b.Title == "" {
-		return errors.New("title is required")
+		return requiredError("title", "title is required")
+	}
+	if b.Slug != "" && !textutil.IsSlug(b.Slug) {
+		return &ValidationError{Field: "slug", Code: "slug", Message: "slug may only contain lowercase letters, digits and single hyphens"}
 	}
-	if b.Content == "" {
-		return errors.New("content is required")
+	if strings.TrimSpace(b.ContentMarkdown) == "" {
+		return requiredError("content_markdown", "content is required")
 	}
 	if b.AuthorID == 0 {
-		return errors.New("author ID is required")
+		return requiredError("author_id", "author ID is required")
 	}
 	if b.Status == "" {
 		b.Status = "draft"
 	}
-	if b.Status != "draft" && b.Status != "published" && b.Status != "archived" {
-		return errors.New("status must be draft, published, or archived")
+	switch b.Status {
+	case "draft", "pending_review", "scheduled", "published", "archived":
+	default:
+		return oneOfError("status", "draft pending_review scheduled published archived", "status must be draft, pending_review, scheduled, published, or archived")
+	}
+	if b.Status == "pending_review" && b.ReviewerID == nil {
+		return requiredError("reviewer_id", "a reviewer is required to review a post")
+	}
+	if b.Status == "scheduled" && b.PublishAt == nil {
+		return requiredError("publish_at", "publish_at is required to schedule a post")
+	}
+	if b.PublishAt != nil && b.UnpublishAt != nil && !b.UnpublishAt.After(*b.PublishAt) {
+		return afterError("unpublish_at", "publish_at", "unpublish_at must be after publish_at")
 	}
 	return nil
 }
 
-// Create creates a new blog post in the database
+// Create creates a new blog post in the database, recorded as its first
+// revision. Without a slug it gets one generated from the title.
 func (b *BlogPost) Create() error {
 	if err := b.Validate(); err != nil {
+		return validationError(err)
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := b.assignSlug(tx); err != nil {
 		return err
 	}
 	if err := b.BeforeSave(); err != nil {
 		return err
 	}
+	if err := b.checkReview(nil); err != nil {
+		return err
+	}
 
 	dbType := getEnvBlog("DB_TYPE", "postgres")
 
 	if dbType == "sqlite" {
 		query := `
-			INSERT INTO blog_posts (title, content, excerpt, thumbnail, author_id, status, category, tags, created_at, updated_at)
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+			INSERT INTO blog_posts (title, slug, content_markdown, content_html, excerpt, thumbnail, author_id, status,
+				publish_at, unpublish_at, published_at, comments_enabled, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
 		`
 
-		result, err := database.DB.Exec(query, b.Title, b.Content, b.Excerpt, b.Thumbnail, b.AuthorID, b.Status, b.Category, b.Tags)
+		result, err := tx.Exec(query, b.Title, b.Slug, b.ContentMarkdown, b.ContentHTML, b.Excerpt, b.Thumbnail, b.AuthorID, b.Status,
+			b.PublishAt, b.UnpublishAt, b.PublishedAt, b.CommentsEnabled)
 		if err != nil {
-			return err
+			return slugError(err)
 		}
 
 		id, err := result.LastInsertId()
@@ -125,45 +274,75 @@ func (b *BlogPost) Create() error {
 		b.ID = int(id)
 
 		// Get the created timestamps
-		selectQuery := `SELECT created_at, updated_at FROM blog_posts WHERE id = ?`
-		err = database.DB.QueryRow(selectQuery, b.ID).Scan(&b.CreatedAt, &b.UpdatedAt)
+		selectQuery := `SELECT version, created_at, updated_at FROM blog_posts WHERE id = ?`
+		err = tx.QueryRow(selectQuery, b.ID).Scan(&b.Version, &b.CreatedAt, &b.UpdatedAt)
 		if err != nil {
 			return err
 		}
 	} else {
 		query := `
-			INSERT INTO blog_posts (title, content, excerpt, thumbnail, author_id, status, category, tags)
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-			RETURNING id, created_at, updated_at
+			INSERT INTO blog_posts (title, slug, content_markdown, content_html, excerpt, thumbnail, author_id, status,
+				publish_at, unpublish_at, published_at, comments_enabled)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+			RETURNING id, version, created_at, updated_at
 		`
 
-		err := database.DB.QueryRow(
-			query, b.Title, b.Content, b.Excerpt, b.Thumbnail, b.AuthorID, b.Status, b.Category, b.Tags,
-		).Scan(&b.ID, &b.CreatedAt, &b.UpdatedAt)
+		err := tx.QueryRow(
+			query, b.Title, b.Slug, b.ContentMarkdown, b.ContentHTML, b.Excerpt, b.Thumbnail, b.AuthorID, b.Status,
+			b.PublishAt, b.UnpublishAt, b.PublishedAt, b.CommentsEnabled,
+		).Scan(&b.ID, &b.Version, &b.CreatedAt, &b.UpdatedAt)
 
 		if err != nil {
-			return err
+			return slugError(err)
 		}
 	}
 
-	// Set published_at if status is published
-	if b.Status == "published" {
-		now := time.Now()
-		b.PublishedAt = &now
-		b.UpdatePublishedAt()
+	if err := b.saveTerms(tx); err != nil {
+		return err
+	}
+	if err := indexBlogPost(tx, b); err != nil {
+		return err
+	}
+	if err := saveRevision(tx, b); err != nil {
+		return err
 	}
 
-	return nil
+	return tx.Commit()
 }
 
-// Update updates an existing blog post
+// Update updates an existing blog post if it is still at b.Version,
+// returning ErrVersionConflict otherwise, increments the version and records
+// it as a revision. When the slug changes the old one is kept to redirect
+// from.
 func (b *BlogPost) Update() error {
 	if err := b.Validate(); err != nil {
+		return validationError(err)
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var oldSlug sql.NullString
+	var review reviewColumns
+	old := &BlogPost{}
+	err = tx.QueryRow("SELECT slug, title, content_markdown, status, reviewer_id, reviewed_by, reviewed_by_name, reviewed_at FROM blog_posts WHERE id = "+getPlaceholderBlog(1), b.ID).
+		Scan(&oldSlug, &old.Title, &old.ContentMarkdown, &old.Status, &old.ReviewerID, &review.by, &review.name, &review.at)
+	if err != nil {
+		return err
+	}
+	old.MedicalReview = review.review()
+	if err := b.assignSlug(tx); err != nil {
 		return err
 	}
 	if err := b.BeforeSave(); err != nil {
 		return err
 	}
+	if err := b.checkReview(old); err != nil {
+		return err
+	}
 
 	dbType := getEnvBlog("DB_TYPE", "postgres")
 
@@ -171,195 +350,239 @@ func (b *BlogPost) Update() error {
 	if dbType == "sqlite" {
 		query = `
 			UPDATE blog_posts 
-			SET title = ?, content = ?, excerpt = ?, thumbnail = ?, status = ?, category = ?, tags = ?, updated_at = CURRENT_TIMESTAMP
-			WHERE id = ?
+			SET title = ?, slug = ?, content_markdown = ?, content_html = ?, excerpt = ?, thumbnail = ?, status = ?,
+				publish_at = ?, unpublish_at = ?, published_at = ?, comments_enabled = ?, reviewer_id = ?, reviewed_by = ?, reviewed_by_name = ?, reviewed_at = ?,
+				version = version + 1, updated_at = CURRENT_TIMESTAMP
+			WHERE id = ? AND version = ?
 		`
-		_, err := database.DB.Exec(query, b.Title, b.Content, b.Excerpt, b.Thumbnail, b.Status, b.Category, b.Tags, b.ID)
+		args := append([]interface{}{b.Title, b.Slug, b.ContentMarkdown, b.ContentHTML, b.Excerpt, b.Thumbnail, b.Status,
+			b.PublishAt, b.UnpublishAt, b.PublishedAt, b.CommentsEnabled}, b.reviewValues()...)
+		result, err := tx.Exec(query, append(args, b.ID, b.Version)...)
+		if err != nil {
+			return slugError(err)
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrVersionConflict
+		}
+		err = tx.QueryRow("SELECT version, updated_at FROM blog_posts WHERE id = ?", b.ID).Scan(&b.Version, &b.UpdatedAt)
 		if err != nil {
 			return err
 		}
 	} else {
 		query = `
 			UPDATE blog_posts 
-			SET title = $1, content = $2, excerpt = $3, thumbnail = $4, status = $5, category = $6, tags = $7, updated_at = CURRENT_TIMESTAMP
-			WHERE id = $8
-			RETURNING updated_at
+			SET title = $1, slug = $2, content_markdown = $3, content_html = $4, excerpt = $5, thumbnail = $6, status = $7,
+				publish_at = $8, unpublish_at = $9, published_at = $10, comments_enabled = $11,
+				reviewer_id = $12, reviewed_by = $13, reviewed_by_name = $14, reviewed_at = $15,
+				version = version + 1, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $16 AND version = $17
+			RETURNING version, updated_at
 		`
-		err := database.DB.QueryRow(query, b.Title, b.Content, b.Excerpt, b.Thumbnail, b.Status, b.Category, b.Tags, b.ID).Scan(&b.UpdatedAt)
+		args := append([]interface{}{b.Title, b.Slug, b.ContentMarkdown, b.ContentHTML, b.Excerpt, b.Thumbnail, b.Status,
+			b.PublishAt, b.UnpublishAt, b.PublishedAt, b.CommentsEnabled}, b.reviewValues()...)
+		err := tx.QueryRow(query, append(args, b.ID, b.Version)...).Scan(&b.Version, &b.UpdatedAt)
+		if err == sql.ErrNoRows {
+			return ErrVersionConflict
+		}
 		if err != nil {
-			return err
+			return slugError(err)
 		}
 	}
 
-	// Set published_at if status changed to published
-	if b.Status == "published" && b.PublishedAt == nil {
-		now := time.Now()
-		b.PublishedAt = &now
-		b.UpdatePublishedAt()
+	if oldSlug.String != b.Slug {
+		if err := moveSlug(tx, b.ID, oldSlug.String, b.Slug); err != nil {
+			return err
+		}
 	}
 
-	return nil
-}
-
-// UpdatePublishedAt updates the published_at timestamp
-func (b *BlogPost) UpdatePublishedAt() error {
-	dbType := getEnvBlog("DB_TYPE", "postgres")
-
-	var query string
-	if dbType == "sqlite" {
-		query = "UPDATE blog_posts SET published_at = CURRENT_TIMESTAMP WHERE id = ?"
-		_, err := database.DB.Exec(query, b.ID)
+	if err := b.saveTerms(tx); err != nil {
 		return err
-	} else {
-		query = "UPDATE blog_posts SET published_at = CURRENT_TIMESTAMP WHERE id = $1"
-		_, err := database.DB.Exec(query, b.ID)
+	}
+	if err := indexBlogPost(tx, b); err != nil {
 		return err
 	}
+	if err := saveRevision(tx, b); err != nil {
+		return err
+	}
+	if b.reviewNote != nil {
+		if err := saveReviewComment(tx, b, b.reviewNote); err != nil {
+			return err
+		}
+		b.reviewNote = nil
+	}
+
+	return tx.Commit()
 }
 
-// Delete deletes a blog post
+// Delete deletes a blog post with its revisions, freeing its current and
+// former slugs
 func (b *BlogPost) Delete() error {
-	dbType := getEnvBlog("DB_TYPE", "postgres")
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-	var query string
-	if dbType == "sqlite" {
-		query = "DELETE FROM blog_posts WHERE id = ?"
-		_, err := database.DB.Exec(query, b.ID)
+	// SQLite does not enforce the cascade unless foreign keys are turned on
+	if _, err := tx.Exec("DELETE FROM blog_post_slugs WHERE post_id = "+getPlaceholderBlog(1), b.ID); err != nil {
 		return err
-	} else {
-		query = "DELETE FROM blog_posts WHERE id = $1"
-		_, err := database.DB.Exec(query, b.ID)
+	}
+	if _, err := tx.Exec("DELETE FROM blog_post_revisions WHERE post_id = "+getPlaceholderBlog(1), b.ID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM blog_post_review_comments WHERE post_id = "+getPlaceholderBlog(1), b.ID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM blog_comments WHERE post_id = "+getPlaceholderBlog(1), b.ID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM blog_post_tags WHERE post_id = "+getPlaceholderBlog(1), b.ID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM blog_post_views WHERE post_id = "+getPlaceholderBlog(1), b.ID); err != nil {
+		return err
+	}
+	if err := unindexBlogPost(tx, b.ID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM blog_posts WHERE id = "+getPlaceholderBlog(1), b.ID); err != nil {
 		return err
 	}
+	return tx.Commit()
 }
 
 // GetBlogPostByID retrieves a blog post by ID
 func GetBlogPostByID(id int) (*BlogPost, error) {
-	post := &BlogPost{}
-	dbType := getEnvBlog("DB_TYPE", "postgres")
+	return getBlogPost("bp.id", id)
+}
 
-	var query string
-	if dbType == "sqlite" {
-		query = `
-			SELECT bp.id, bp.title, bp.content, bp.excerpt, bp.thumbnail, bp.author_id, u.username as author_name,
-				   bp.status, bp.category, bp.tags, bp.view_count, bp.created_at, bp.updated_at, bp.published_at
-			FROM blog_posts bp
-			LEFT JOIN users u ON bp.author_id = u.id
-			WHERE bp.id = ?
-		`
-	} else {
-		query = `
-			SELECT bp.id, bp.title, bp.content, bp.excerpt, bp.thumbnail, bp.author_id, u.username as author_name,
-				   bp.status, bp.category, bp.tags, bp.view_count, bp.created_at, bp.updated_at, bp.published_at
-			FROM blog_posts bp
-			LEFT JOIN users u ON bp.author_id = u.id
-			WHERE bp.id = $1
-		`
-	}
+// GetBlogPostBySlug retrieves a blog post by its current slug
+func GetBlogPostBySlug(slug string) (*BlogPost, error) {
+	return getBlogPost("bp.slug", slug)
+}
+
+// getBlogPost retrieves the blog post whose column equals value
+func getBlogPost(column string, value interface{}) (*BlogPost, error) {
+	post := &BlogPost{}
 
-	err := database.DB.QueryRow(query, id).Scan(
-		&post.ID, &post.Title, &post.Content, &post.Excerpt, &post.Thumbnail, &post.AuthorID, &post.AuthorName,
-		&post.Status, &post.Category, &post.Tags, &post.ViewCount, &post.CreatedAt, &post.UpdatedAt, &post.PublishedAt,
+	query := `
+		SELECT bp.id, bp.title, COALESCE(bp.slug, ''), bp.content_markdown, bp.content_html, bp.excerpt, bp.thumbnail, bp.author_id, u.username as author_name,
+			   bp.status, bp.category_id, COALESCE(cat.name, ''), COALESCE(cat.slug, ''), bp.view_count, bp.version, bp.created_at, bp.updated_at, bp.published_at,
+			   bp.publish_at, bp.unpublish_at, bp.reviewer_id, bp.reviewed_by, bp.reviewed_by_name, bp.reviewed_at,
+			   bp.comments_enabled, (SELECT COUNT(*) FROM blog_comments c WHERE c.post_id = bp.id AND c.status = 'approved')
+		FROM blog_posts bp
+		LEFT JOIN users u ON bp.author_id = u.id
+		LEFT JOIN blog_categories cat ON bp.category_id = cat.id
+		WHERE ` + column + ` = ` + getPlaceholderBlog(1)
+
+	var review reviewColumns
+	err := database.DB.QueryRow(query, value).Scan(
+		&post.ID, &post.Title, &post.Slug, &post.ContentMarkdown, &post.ContentHTML, &post.Excerpt, &post.Thumbnail, &post.AuthorID, &post.AuthorName,
+		&post.Status, &post.CategoryID, &post.Category, &post.CategorySlug, &post.ViewCount, &post.Version, &post.CreatedAt, &post.UpdatedAt, &post.PublishedAt,
+		&post.PublishAt, &post.UnpublishAt, &post.ReviewerID, &review.by, &review.name, &review.at,
+		&post.CommentsEnabled, &post.CommentCount,
 	)
 
 	if err != nil {
 		return nil, err
 	}
+	post.MedicalReview = review.review()
 
+	if err := loadBlogPostTerms([]*BlogPost{post}); err != nil {
+		return nil, err
+	}
 	return post, nil
 }
 
-// GetBlogPosts retrieves blog posts with filtering
-func GetBlogPosts(filter BlogPostFilter) ([]BlogPost, error) {
-	var posts []BlogPost
-	dbType := getEnvBlog("DB_TYPE", "postgres")
+// blogPostFilterClause builds the WHERE conditions shared by GetBlogPosts
+// and CountBlogPosts
+func blogPostFilterClause(filter BlogPostFilter) (string, []interface{}) {
+	where := " WHERE 1=1"
+	args := []interface{}{}
 
-	// Build query with filters
-	baseQuery := `
-		SELECT bp.id, bp.title, bp.content, bp.excerpt, bp.thumbnail, bp.author_id, u.username as author_name,
-			   bp.status, bp.category, bp.tags, bp.view_count, bp.created_at, bp.updated_at, bp.published_at
-		FROM blog_posts bp
-		LEFT JOIN users u ON bp.author_id = u.id
-		WHERE 1=1
-	`
-
-	var args []interface{}
-	argIndex := 1
-
-	// Add filters
 	if filter.Status != "" {
-		if dbType == "sqlite" {
-			baseQuery += " AND bp.status = ?"
-		} else {
-			baseQuery += fmt.Sprintf(" AND bp.status = $%d", argIndex)
-		}
 		args = append(args, filter.Status)
-		argIndex++
+		where += " AND bp.status = " + getPlaceholder(len(args))
+	}
+
+	if filter.Visible {
+		now := time.Now().UTC().Truncate(time.Second)
+		args = append(args, now, now)
+		where += visibleClause(getPlaceholder(len(args)-1), getPlaceholder(len(args)))
 	}
 
 	if filter.Category != "" {
-		if dbType == "sqlite" {
-			baseQuery += " AND bp.category = ?"
-		} else {
-			baseQuery += fmt.Sprintf(" AND bp.category = $%d", argIndex)
-		}
-		args = append(args, filter.Category)
-		argIndex++
+		args = append(args, textutil.Slugify(filter.Category))
+		where += " AND bp.category_id IN (SELECT id FROM blog_categories WHERE slug = " + getPlaceholder(len(args)) + ")"
+	}
+
+	if filter.Tag != "" {
+		args = append(args, textutil.Slugify(filter.Tag))
+		where += " AND bp.id IN (SELECT pt.post_id FROM blog_post_tags pt JOIN blog_tags t ON t.id = pt.tag_id WHERE t.slug = " +
+			getPlaceholder(len(args)) + ")"
 	}
 
 	if filter.AuthorID != 0 {
-		if dbType == "sqlite" {
-			baseQuery += " AND bp.author_id = ?"
-		} else {
-			baseQuery += fmt.Sprintf(" AND bp.author_id = $%d", argIndex)
-		}
 		args = append(args, filter.AuthorID)
-		argIndex++
+		where += " AND bp.author_id = " + getPlaceholder(len(args))
 	}
 
 	if filter.Search != "" {
-		if dbType == "sqlite" {
-			baseQuery += " AND (bp.title LIKE ? OR bp.content LIKE ?)"
-		} else {
-			baseQuery += fmt.Sprintf(" AND (bp.title ILIKE $%d OR bp.content ILIKE $%d)", argIndex, argIndex+1)
-		}
-		searchTerm := "%" + filter.Search + "%"
-		args = append(args, searchTerm, searchTerm)
-		argIndex += 2
+		where += searchClause(filter.Search, &args)
 	}
 
-	// Add sorting
-	if filter.SortBy != "" {
+	return where, args
+}
+
+// visibleClause restricts bp to posts the public can read now, given the
+// placeholders of the current time
+func visibleClause(now1, now2 string) string {
+	return " AND bp.status = 'published' AND (bp.publish_at IS NULL OR bp.publish_at <= " + now1 +
+		") AND (bp.unpublish_at IS NULL OR bp.unpublish_at > " + now2 + ")"
+}
+
+// GetBlogPosts retrieves a page of blog posts matching the filter
+func GetBlogPosts(filter BlogPostFilter) ([]BlogPost, error) {
+	posts := []BlogPost{}
+
+	where, args := blogPostFilterClause(filter)
+	query := `
+		SELECT bp.id, bp.title, COALESCE(bp.slug, ''), bp.content_markdown, bp.content_html, bp.excerpt, bp.thumbnail, bp.author_id, u.username as author_name,
+			   bp.status, bp.category_id, COALESCE(cat.name, ''), COALESCE(cat.slug, ''), bp.view_count, bp.version, bp.created_at, bp.updated_at, bp.published_at,
+			   bp.publish_at, bp.unpublish_at, bp.reviewer_id, bp.reviewed_by, bp.reviewed_by_name, bp.reviewed_at,
+			   bp.comments_enabled, (SELECT COUNT(*) FROM blog_comments c WHERE c.post_id = bp.id AND c.status = 'approved')
+		FROM blog_posts bp
+		LEFT JOIN users u ON bp.author_id = u.id
+		LEFT JOIN blog_categories cat ON bp.category_id = cat.id` + where
+
+	// Add sorting; keyset pages are ordered by ID
+	if filter.Keyset != nil {
+		query += filter.Keyset.clause("bp.id", &args)
+	} else if filter.SortBy == "relevance" {
+		query += relevanceOrder(filter.Search, &args)
+	} else if filter.SortBy != "" {
 		sortOrder := "DESC"
 		if filter.SortOrder == "asc" {
 			sortOrder = "ASC"
 		}
-		baseQuery += fmt.Sprintf(" ORDER BY bp.%s %s", filter.SortBy, sortOrder)
+		query += fmt.Sprintf(" ORDER BY bp.%s %s, bp.id %s", filter.SortBy, sortOrder, sortOrder)
 	} else {
-		baseQuery += " ORDER BY bp.created_at DESC"
+		query += " ORDER BY bp.created_at DESC, bp.id DESC"
 	}
 
 	// Add pagination
 	if filter.Limit > 0 {
-		if dbType == "sqlite" {
-			baseQuery += " LIMIT ?"
-		} else {
-			baseQuery += fmt.Sprintf(" LIMIT $%d", argIndex)
-		}
 		args = append(args, filter.Limit)
-		argIndex++
-
-		if filter.Offset > 0 {
-			if dbType == "sqlite" {
-				baseQuery += " OFFSET ?"
-			} else {
-				baseQuery += fmt.Sprintf(" OFFSET $%d", argIndex)
-			}
+		query += " LIMIT " + getPlaceholder(len(args))
+		if filter.Offset > 0 && filter.Keyset == nil {
 			args = append(args, filter.Offset)
+			query += " OFFSET " + getPlaceholder(len(args))
 		}
 	}
 
-	rows, err := database.DB.Query(baseQuery, args...)
+	rows, err := database.DB.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -367,33 +590,75 @@ func GetBlogPosts(filter BlogPostFilter) ([]BlogPost, error) {
 
 	for rows.Next() {
 		var post BlogPost
+		var review reviewColumns
 		err := rows.Scan(
-			&post.ID, &post.Title, &post.Content, &post.Excerpt, &post.Thumbnail, &post.AuthorID, &post.AuthorName,
-			&post.Status, &post.Category, &post.Tags, &post.ViewCount, &post.CreatedAt, &post.UpdatedAt, &post.PublishedAt,
+			&post.ID, &post.Title, &post.Slug, &post.ContentMarkdown, &post.ContentHTML, &post.Excerpt, &post.Thumbnail, &post.AuthorID, &post.AuthorName,
+			&post.Status, &post.CategoryID, &post.Category, &post.CategorySlug, &post.ViewCount, &post.Version, &post.CreatedAt, &post.UpdatedAt, &post.PublishedAt,
+			&post.PublishAt, &post.UnpublishAt, &post.ReviewerID, &review.by, &review.name, &review.at,
+			&post.CommentsEnabled, &post.CommentCount,
 		)
 		if err != nil {
 			return nil, err
 		}
+		post.MedicalReview = review.review()
 		posts = append(posts, post)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-	return posts, nil
+	page := make([]*BlogPost, len(posts))
+	for i := range posts {
+		page[i] = &posts[i]
+	}
+	return posts, loadBlogPostTerms(page)
 }
 
-// IncrementViewCount increments the view count for a blog post
-func (b *BlogPost) IncrementViewCount() error {
-	dbType := getEnvBlog("DB_TYPE", "postgres")
+// CountBlogPosts counts all blog posts matching the filter, ignoring paging
+func CountBlogPosts(filter BlogPostFilter) (int, error) {
+	where, args := blogPostFilterClause(filter)
+	var count int
+	err := database.DB.QueryRow("SELECT COUNT(*) FROM blog_posts bp"+where, args...).Scan(&count)
+	return count, err
+}
 
-	var query string
-	if dbType == "sqlite" {
-		query = "UPDATE blog_posts SET view_count = view_count + 1 WHERE id = ?"
-		_, err := database.DB.Exec(query, b.ID)
-		return err
-	} else {
-		query = "UPDATE blog_posts SET view_count = view_count + 1 WHERE id = $1"
-		_, err := database.DB.Exec(query, b.ID)
-		return err
+// BackfillBlogPostHTML renders the HTML of posts that have none, e.g. posts
+// written before content was rendered, giving them an excerpt if they lack
+// one, and returns how many it changed
+func BackfillBlogPostHTML() (int, error) {
+	rows, err := database.DB.Query("SELECT id, content_markdown, COALESCE(excerpt, '') FROM blog_posts WHERE content_html = '' ORDER BY id")
+	if err != nil {
+		return 0, err
+	}
+
+	var posts []BlogPost
+	for rows.Next() {
+		var post BlogPost
+		if err := rows.Scan(&post.ID, &post.ContentMarkdown, &post.Excerpt); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		posts = append(posts, post)
 	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	query := "UPDATE blog_posts SET content_html = " + getPlaceholderBlog(1) + ", excerpt = " + getPlaceholderBlog(2) + " WHERE id = " + getPlaceholderBlog(3)
+	for i, post := range posts {
+		rendered, err := markdown.Render(post.ContentMarkdown)
+		if err != nil {
+			return i, err
+		}
+		if strings.TrimSpace(post.Excerpt) == "" {
+			post.Excerpt = markdown.Excerpt(rendered, excerptLength)
+		}
+		if _, err := database.DB.Exec(query, rendered, post.Excerpt, post.ID); err != nil {
+			return i, err
+		}
+	}
+	return len(posts), nil
 }
 
 // GetBlogStats returns blog statistics
@@ -431,6 +696,22 @@ func GetBlogStats() (map[string]interface{}, error) {
 	}
 	stats["draft_posts"] = draftPosts
 
+	// Scheduled posts
+	var scheduledPosts int
+	err = database.DB.QueryRow(query, "scheduled").Scan(&scheduledPosts)
+	if err != nil {
+		return nil, err
+	}
+	stats["scheduled_posts"] = scheduledPosts
+
+	// Posts waiting for a doctor's review
+	var pendingReviewPosts int
+	err = database.DB.QueryRow(query, "pending_review").Scan(&pendingReviewPosts)
+	if err != nil {
+		return nil, err
+	}
+	stats["pending_review_posts"] = pendingReviewPosts
+
 	// Total views
 	var totalViews sql.NullInt64
 	query = "SELECT SUM(view_count) FROM blog_posts"
@@ -0,0 +1,318 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/dottrip/fpt-swp/internal/database"
+)
+
+// Comment statuses. New comments are pending, approved or spam as the spam
+// classifier decides; moderators move them between all four.
+const (
+	CommentPending  = "pending"
+	CommentApproved = "approved"
+	CommentRejected = "rejected"
+	CommentSpam     = "spam"
+)
+
+// ErrCommentsDisabled is returned when commenting on a post that has
+// comments turned off
+var ErrCommentsDisabled = errors.New("comments are disabled for this post")
+
+// ErrCommentBanned is returned when a user banned from commenting comments
+var ErrCommentBanned = errors.New("you are not allowed to comment")
+
+// BlogComment is a reader's comment on a published post, or a reply to one
+type BlogComment struct {
+	ID          int           `json:"id"`
+	PostID      int           `json:"post_id"`
+	PostTitle   string        `json:"post_title,omitempty"` // in the moderation queue
+	ParentID    *int          `json:"parent_id"`            // comment replied to; nil at the top level
+	AuthorID    int           `json:"author_id"`
+	AuthorName  string        `json:"author_name"`
+	Body        string        `json:"body"`
+	Status      string        `json:"status"`                // pending, approved, rejected, spam
+	SpamReason  string        `json:"spam_reason,omitempty"` // why the classifier held it; for moderators
+	ModeratedBy *int          `json:"moderated_by,omitempty"`
+	ModeratedAt *time.Time    `json:"moderated_at,omitempty"`
+	CreatedAt   time.Time     `json:"created_at"`
+	Replies     []BlogComment `json:"replies,omitempty"` // approved replies, oldest first
+}
+
+// BlogCommentInput represents the request structure for posting a comment
+type BlogCommentInput struct {
+	Body     string `json:"body" binding:"required,max=2000"`
+	ParentID *int   `json:"parent_id"` // comment to reply to, on the same post
+}
+
+// BlogCommentBanInput is the optional body of banning a commenter
+type BlogCommentBanInput struct {
+	Reason string `json:"reason" binding:"max=500"`
+}
+
+// BlogCommentFilter selects comments for the moderation queue
+type BlogCommentFilter struct {
+	Status   string
+	PostID   int
+	AuthorID int
+	Limit    int
+	Offset   int
+	Keyset   *Keyset // pages by ID instead of Offset when set
+}
+
+// Validate validates the comment data
+func (c *BlogComment) Validate() error {
+	if strings.TrimSpace(c.Body) == "" {
+		return requiredError("body", "comment is required")
+	}
+	if c.PostID == 0 {
+		return requiredError("post_id", "post ID is required")
+	}
+	if c.AuthorID == 0 {
+		return requiredError("author_id", "author ID is required")
+	}
+	switch c.Status {
+	case CommentPending, CommentApproved, CommentRejected, CommentSpam:
+	default:
+		return oneOfError("status", "pending approved rejected spam", "status must be pending, approved, rejected, or spam")
+	}
+	return nil
+}
+
+// Create stores a new comment. A reply must be to an approved comment on
+// the same post.
+func (c *BlogComment) Create() error {
+	c.Body = html.EscapeString(strings.TrimSpace(c.Body))
+	if err := c.Validate(); err != nil {
+		return validationError(err)
+	}
+
+	if c.ParentID != nil {
+		parent, err := GetBlogCommentByID(*c.ParentID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		if parent == nil || parent.PostID != c.PostID || parent.Status != CommentApproved {
+			return &ValidationError{Field: "parent_id", Code: "reply", Message: "can only reply to a published comment on the same post"}
+		}
+	}
+
+	c.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	query := "INSERT INTO blog_comments (post_id, parent_id, author_id, body, status, spam_reason, created_at) VALUES (" +
+		getPlaceholderBlog(1) + ", " + getPlaceholderBlog(2) + ", " + getPlaceholderBlog(3) + ", " + getPlaceholderBlog(4) + ", " +
+		getPlaceholderBlog(5) + ", " + getPlaceholderBlog(6) + ", " + getPlaceholderBlog(7) + ")"
+	args := []interface{}{c.PostID, c.ParentID, c.AuthorID, c.Body, c.Status, c.SpamReason, c.CreatedAt}
+
+	if getEnvBlog("DB_TYPE", "postgres") == "sqlite" {
+		result, err := database.DB.Exec(query, args...)
+		if err != nil {
+			return err
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		c.ID = int(id)
+		return nil
+	}
+	return database.DB.QueryRow(query+" RETURNING id", args...).Scan(&c.ID)
+}
+
+// Moderate sets the comment's status on behalf of moderator
+func (c *BlogComment) Moderate(status string, moderatorID int) error {
+	c.Status = status
+	if err := c.Validate(); err != nil {
+		return validationError(err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	query := "UPDATE blog_comments SET status = " + getPlaceholderBlog(1) + ", moderated_by = " + getPlaceholderBlog(2) +
+		", moderated_at = " + getPlaceholderBlog(3) + " WHERE id = " + getPlaceholderBlog(4)
+	if _, err := database.DB.Exec(query, status, moderatorID, now, c.ID); err != nil {
+		return err
+	}
+	c.ModeratedBy = &moderatorID
+	c.ModeratedAt = &now
+	return nil
+}
+
+// blogCommentColumns are the columns scanned by scanBlogComment
+const blogCommentColumns = `c.id, c.post_id, COALESCE(bp.title, ''), c.parent_id, c.author_id, COALESCE(u.username, ''), c.body, c.status,
+	c.spam_reason, c.moderated_by, c.moderated_at, c.created_at
+	FROM blog_comments c
+	LEFT JOIN blog_posts bp ON c.post_id = bp.id
+	LEFT JOIN users u ON c.author_id = u.id`
+
+// scanBlogComment scans a row selected with blogCommentColumns
+func scanBlogComment(row interface{ Scan(...interface{}) error }) (BlogComment, error) {
+	var c BlogComment
+	err := row.Scan(&c.ID, &c.PostID, &c.PostTitle, &c.ParentID, &c.AuthorID, &c.AuthorName, &c.Body, &c.Status,
+		&c.SpamReason, &c.ModeratedBy, &c.ModeratedAt, &c.CreatedAt)
+	return c, err
+}
+
+// GetBlogCommentByID retrieves a comment by ID
+func GetBlogCommentByID(id int) (*BlogComment, error) {
+	c, err := scanBlogComment(database.DB.QueryRow("SELECT "+blogCommentColumns+" WHERE c.id = "+getPlaceholderBlog(1), id))
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// GetBlogCommentThreads returns the approved comments of a post as threads,
+// oldest first. Replies to comments that are not approved are left out with
+// them.
+func GetBlogCommentThreads(postID int) ([]BlogComment, error) {
+	query := "SELECT " + blogCommentColumns + " WHERE c.post_id = " + getPlaceholderBlog(1) +
+		" AND c.status = '" + CommentApproved + "' ORDER BY c.created_at, c.id"
+
+	rows, err := database.DB.Query(query, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []BlogComment
+	for rows.Next() {
+		c, err := scanBlogComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		c.PostTitle = ""
+		comments = append(comments, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return commentThreads(comments, nil), nil
+}
+
+// commentThreads nests comments under parent, recursively
+func commentThreads(comments []BlogComment, parent *int) []BlogComment {
+	threads := []BlogComment{}
+	for _, c := range comments {
+		if (parent == nil && c.ParentID == nil) || (parent != nil && c.ParentID != nil && *c.ParentID == *parent) {
+			id := c.ID
+			c.Replies = commentThreads(comments, &id)
+			threads = append(threads, c)
+		}
+	}
+	return threads
+}
+
+// blogCommentFilterClause builds the WHERE conditions shared by
+// GetBlogComments and CountBlogComments
+func blogCommentFilterClause(filter BlogCommentFilter) (string, []interface{}) {
+	where := " WHERE 1=1"
+	args := []interface{}{}
+
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		where += " AND c.status = " + getPlaceholder(len(args))
+	}
+	if filter.PostID != 0 {
+		args = append(args, filter.PostID)
+		where += " AND c.post_id = " + getPlaceholder(len(args))
+	}
+	if filter.AuthorID != 0 {
+		args = append(args, filter.AuthorID)
+		where += " AND c.author_id = " + getPlaceholder(len(args))
+	}
+	return where, args
+}
+
+// GetBlogComments retrieves a page of comments matching the filter, oldest
+// first, for moderation
+func GetBlogComments(filter BlogCommentFilter) ([]BlogComment, error) {
+	where, args := blogCommentFilterClause(filter)
+	query := "SELECT " + blogCommentColumns + where
+
+	if filter.Keyset != nil {
+		query += filter.Keyset.clause("c.id", &args)
+	} else {
+		query += " ORDER BY c.id"
+	}
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += " LIMIT " + getPlaceholder(len(args))
+		if filter.Offset > 0 && filter.Keyset == nil {
+			args = append(args, filter.Offset)
+			query += " OFFSET " + getPlaceholder(len(args))
+		}
+	}
+
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []BlogComment{}
+	for rows.Next() {
+		c, err := scanBlogComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, c)
+	}
+	return comments, rows.Err()
+}
+
+// CountBlogComments counts all comments matching the filter, ignoring paging
+func CountBlogComments(filter BlogCommentFilter) (int, error) {
+	where, args := blogCommentFilterClause(filter)
+	var count int
+	err := database.DB.QueryRow("SELECT COUNT(*) FROM blog_comments c"+where, args...).Scan(&count)
+	return count, err
+}
+
+// CountRecentBlogComments counts the comments a user posted since a time,
+// for the spam classifier's rate limit
+func CountRecentBlogComments(authorID int, since time.Time) (int, error) {
+	query := "SELECT COUNT(*) FROM blog_comments WHERE author_id = " + getPlaceholderBlog(1) + " AND created_at >= " + getPlaceholderBlog(2)
+	var count int
+	err := database.DB.QueryRow(query, authorID, since.UTC().Truncate(time.Second)).Scan(&count)
+	return count, err
+}
+
+// IsBannedFromComments reports whether a user may no longer comment
+func IsBannedFromComments(userID int) (bool, error) {
+	var count int
+	err := database.DB.QueryRow("SELECT COUNT(*) FROM blog_comment_bans WHERE user_id = "+getPlaceholderBlog(1), userID).Scan(&count)
+	return count > 0, err
+}
+
+// BanBlogCommenter stops a user from commenting and rejects their comments
+// still waiting for moderation, returning how many it rejected. Banning a
+// user twice keeps the first ban.
+func BanBlogCommenter(userID, moderatorID int, reason string) (int64, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	query := "INSERT INTO blog_comment_bans (user_id, banned_by, reason, created_at) VALUES (" + getPlaceholderBlog(1) + ", " +
+		getPlaceholderBlog(2) + ", " + getPlaceholderBlog(3) + ", " + getPlaceholderBlog(4) + ") ON CONFLICT (user_id) DO NOTHING"
+	if _, err := tx.Exec(query, userID, moderatorID, strings.TrimSpace(reason), now); err != nil {
+		return 0, err
+	}
+
+	query = "UPDATE blog_comments SET status = '" + CommentRejected + "', moderated_by = " + getPlaceholderBlog(1) +
+		", moderated_at = " + getPlaceholderBlog(2) + " WHERE author_id = " + getPlaceholderBlog(3) + " AND status = '" + CommentPending + "'"
+	result, err := tx.Exec(query, moderatorID, now, userID)
+	if err != nil {
+		return 0, err
+	}
+	rejected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return rejected, tx.Commit()
+}
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"time"
+
+	"github.com/dottrip/fpt-swp/internal/database"
+)
+
+// PublicSince is when the post went public: when it was published, or when
+// it was scheduled to appear if that is later
+func (b *BlogPost) PublicSince() time.Time {
+	var since time.Time
+	if b.PublishedAt != nil {
+		since = *b.PublishedAt
+	}
+	if b.PublishAt != nil && b.PublishAt.After(since) {
+		since = *b.PublishAt
+	}
+	if since.IsZero() {
+		since = b.CreatedAt
+	}
+	return since
+}
+
+// LastModified is when the post last changed as the public sees it
+func (b *BlogPost) LastModified() time.Time {
+	if since := b.PublicSince(); since.After(b.UpdatedAt) {
+		return since
+	}
+	return b.UpdatedAt
+}
+
+// GetVisibleBlogPostDates lists every post the public can read now, newest
+// first, with only its ID, slug, category slug and dates, for sitemaps
+func GetVisibleBlogPostDates() ([]BlogPost, error) {
+	now := time.Now().UTC().Truncate(time.Second)
+	query := `
+		SELECT bp.id, COALESCE(bp.slug, ''), COALESCE(cat.slug, ''), bp.created_at, bp.updated_at, bp.published_at, bp.publish_at
+		FROM blog_posts bp
+		LEFT JOIN blog_categories cat ON bp.category_id = cat.id
+		WHERE 1=1` + visibleClause(getPlaceholderBlog(1), getPlaceholderBlog(2)) + `
+		ORDER BY bp.created_at DESC, bp.id DESC`
+
+	rows, err := database.DB.Query(query, now, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []BlogPost{}
+	for rows.Next() {
+		var post BlogPost
+		if err := rows.Scan(&post.ID, &post.Slug, &post.CategorySlug, &post.CreatedAt, &post.UpdatedAt, &post.PublishedAt, &post.PublishAt); err != nil {
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+	return posts, rows.Err()
+}
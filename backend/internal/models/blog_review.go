@@ -0,0 +1,243 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/dottrip/fpt-swp/internal/database"
+)
+
+// ErrReviewRequired is returned when a post is published or scheduled
+// before a doctor has approved its current content, without an admin
+// override
+var ErrReviewRequired = errors.New("the post must be medically reviewed before it is published")
+
+// ErrReviewState is returned by review actions the post's status does not
+// allow, e.g. approving a post that is not pending review
+var ErrReviewState = errors.New("the post's status does not allow this review action")
+
+// Review actions recorded with review comments
+const (
+	ReviewComment        = "comment"
+	ReviewSubmit         = "submit"
+	ReviewApprove        = "approve"
+	ReviewRequestChanges = "request_changes"
+)
+
+// BlogMedicalReview says which doctor approved the current content of a
+// post. Editing the title or content withdraws it.
+type BlogMedicalReview struct {
+	ReviewerID   *int      `json:"reviewer_id"` // nil once the account is deleted
+	ReviewerName string    `json:"reviewer_name"`
+	ReviewedAt   time.Time `json:"reviewed_at"`
+	Label        string    `json:"label,omitempty"` // e.g. "Medically reviewed by Dr. X", set by handlers
+}
+
+// BlogReviewComment is a comment on a post under review, or the note left
+// with a review action
+type BlogReviewComment struct {
+	ID         int       `json:"id"`
+	PostID     int       `json:"post_id"`
+	Version    int       `json:"version"` // version of the post the comment is about
+	AuthorID   *int      `json:"author_id"`
+	AuthorName string    `json:"author_name"`
+	Action     string    `json:"action"` // comment, submit, approve, request_changes
+	Body       string    `json:"body"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// BlogReviewInput is the request body of review actions
+type BlogReviewInput struct {
+	ReviewerID int    `json:"reviewer_id"` // doctor to review the post; submit only
+	Body       string `json:"body" binding:"max=5000"`
+}
+
+// reviewColumns holds the approval columns of a post as scanned
+type reviewColumns struct {
+	by   sql.NullInt64
+	name sql.NullString
+	at   *time.Time
+}
+
+// review returns the approval, or nil if the post has none
+func (r reviewColumns) review() *BlogMedicalReview {
+	if r.at == nil {
+		return nil
+	}
+	review := &BlogMedicalReview{ReviewerName: r.name.String, ReviewedAt: *r.at}
+	if r.by.Valid {
+		id := int(r.by.Int64)
+		review.ReviewerID = &id
+	}
+	return review
+}
+
+// reviewValues returns the reviewer and approval columns to store
+func (b *BlogPost) reviewValues() []interface{} {
+	if b.MedicalReview == nil {
+		return []interface{}{b.ReviewerID, nil, nil, nil}
+	}
+	return []interface{}{b.ReviewerID, b.MedicalReview.ReviewerID, b.MedicalReview.ReviewerName, b.MedicalReview.ReviewedAt}
+}
+
+// checkReview withdraws the approval of a post whose title or content
+// changed, and refuses to publish or schedule a post that was neither
+// published nor scheduled unless it is approved or an admin overrides. A
+// published or scheduled post whose title or content changed goes back to
+// pending review, off the site, unless an admin overrides. It goes to the
+// doctor who last reviewed it, and needs a reviewer if it has none.
+func (b *BlogPost) checkReview(old *BlogPost) error {
+	edited := old != nil && (old.Title != b.Title || old.ContentMarkdown != b.ContentMarkdown)
+	if edited {
+		b.MedicalReview = nil
+	}
+
+	live := func(status string) bool { return status == "published" || status == "scheduled" }
+	if !live(b.Status) || b.MedicalReview != nil || b.ReviewOverride {
+		return nil
+	}
+	if old != nil && live(old.Status) {
+		if edited {
+			b.Status = "pending_review"
+			if b.ReviewerID == nil {
+				b.ReviewerID = old.lastReviewer()
+			}
+			if b.ReviewerID == nil {
+				return requiredError("reviewer_id", "a reviewer is required to review the edited post")
+			}
+		}
+		return nil
+	}
+	return ErrReviewRequired
+}
+
+// lastReviewer returns the doctor asked to review the post, or else the one
+// who approved it, or nil if there is neither
+func (b *BlogPost) lastReviewer() *int {
+	if b.ReviewerID != nil {
+		return b.ReviewerID
+	}
+	if b.MedicalReview != nil {
+		return b.MedicalReview.ReviewerID
+	}
+	return nil
+}
+
+// SubmitForReview asks the doctor with user ID reviewerID to review the
+// post; it is pending review until they approve it or ask for changes.
+// Published and scheduled posts cannot be submitted.
+func (b *BlogPost) SubmitForReview(reviewerID, authorID int, body string) error {
+	if b.Status == "published" || b.Status == "scheduled" {
+		return ErrReviewState
+	}
+	b.Status = "pending_review"
+	b.ReviewerID = &reviewerID
+	b.MedicalReview = nil
+	b.EditorID = authorID
+	b.reviewNote = &BlogReviewComment{Action: ReviewSubmit, AuthorID: &authorID, Body: strings.TrimSpace(body)}
+	return b.Update()
+}
+
+// Approve records that the assigned reviewer approved the post as it is,
+// returning it to draft ready to publish
+func (b *BlogPost) Approve(reviewerID int, reviewerName, body string) error {
+	if b.Status != "pending_review" {
+		return ErrReviewState
+	}
+	b.Status = "draft"
+	b.MedicalReview = &BlogMedicalReview{ReviewerID: &reviewerID, ReviewerName: reviewerName, ReviewedAt: time.Now().UTC().Truncate(time.Second)}
+	b.EditorID = reviewerID
+	b.reviewNote = &BlogReviewComment{Action: ReviewApprove, AuthorID: &reviewerID, Body: strings.TrimSpace(body)}
+	return b.Update()
+}
+
+// RequestChanges returns a post pending review to draft with the
+// reviewer's comment on what to change
+func (b *BlogPost) RequestChanges(reviewerID int, body string) error {
+	if b.Status != "pending_review" {
+		return ErrReviewState
+	}
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return requiredError("body", "a comment is required when requesting changes")
+	}
+	b.Status = "draft"
+	b.MedicalReview = nil
+	b.EditorID = reviewerID
+	b.reviewNote = &BlogReviewComment{Action: ReviewRequestChanges, AuthorID: &reviewerID, Body: body}
+	return b.Update()
+}
+
+// AddReviewComment adds a comment on the post's current version
+func (b *BlogPost) AddReviewComment(authorID int, body string) (*BlogReviewComment, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return nil, requiredError("body", "comment is required")
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	comment := &BlogReviewComment{Action: ReviewComment, AuthorID: &authorID, Body: body}
+	if err := saveReviewComment(tx, b, comment); err != nil {
+		return nil, err
+	}
+	return comment, tx.Commit()
+}
+
+// saveReviewComment stores comment on the post's current version
+func saveReviewComment(tx *sql.Tx, b *BlogPost, comment *BlogReviewComment) error {
+	comment.PostID = b.ID
+	comment.Version = b.Version
+	comment.CreatedAt = time.Now().UTC().Truncate(time.Second)
+
+	columns := "post_id, version, author_id, action, body, created_at"
+	values := []interface{}{comment.PostID, comment.Version, comment.AuthorID, comment.Action, comment.Body, comment.CreatedAt}
+	placeholders := getPlaceholderBlog(1) + ", " + getPlaceholderBlog(2) + ", " + getPlaceholderBlog(3) + ", " +
+		getPlaceholderBlog(4) + ", " + getPlaceholderBlog(5) + ", " + getPlaceholderBlog(6)
+
+	if getEnvBlog("DB_TYPE", "postgres") == "sqlite" {
+		result, err := tx.Exec("INSERT INTO blog_post_review_comments ("+columns+") VALUES ("+placeholders+")", values...)
+		if err != nil {
+			return err
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		comment.ID = int(id)
+		return nil
+	}
+	return tx.QueryRow("INSERT INTO blog_post_review_comments ("+columns+") VALUES ("+placeholders+") RETURNING id", values...).Scan(&comment.ID)
+}
+
+// GetBlogReviewComments lists the review comments of a post, oldest first
+func GetBlogReviewComments(postID int) ([]BlogReviewComment, error) {
+	query := `
+		SELECT c.id, c.post_id, c.version, c.author_id, COALESCE(u.username, ''), c.action, c.body, c.created_at
+		FROM blog_post_review_comments c
+		LEFT JOIN users u ON c.author_id = u.id
+		WHERE c.post_id = ` + getPlaceholderBlog(1) + `
+		ORDER BY c.created_at, c.id`
+
+	rows, err := database.DB.Query(query, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []BlogReviewComment{}
+	for rows.Next() {
+		var c BlogReviewComment
+		if err := rows.Scan(&c.ID, &c.PostID, &c.Version, &c.AuthorID, &c.AuthorName, &c.Action, &c.Body, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		comments = append(comments, c)
+	}
+	return comments, rows.Err()
+}
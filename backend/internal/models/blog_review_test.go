@@ -0,0 +1,153 @@
+package models
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/dottrip/fpt-swp/internal/database"
+)
+
+// useTestDB points the database at a fresh SQLite file, whose default admin
+// is user 1. InitDB makes a ./data directory, so the test runs in a
+// temporary one.
+func useTestDB(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	t.Setenv("DB_TYPE", "sqlite")
+	t.Setenv("DB_PATH", dir+"/test.db")
+	database.InitDB()
+	t.Cleanup(func() { database.DB.Close() })
+}
+
+// createDoctor adds a doctor's account and returns its user ID
+func createDoctor(t *testing.T) int {
+	t.Helper()
+	result, err := database.DB.Exec("INSERT INTO users (username, email, password, role) VALUES ('doctor', 'doctor@example.com', 'x', 'doctor')")
+	if err != nil {
+		t.Fatalf("insert doctor: %v", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return int(id)
+}
+
+func TestEditingPublishedPostNeedsReviewAgain(t *testing.T) {
+	useTestDB(t)
+	doctorID := createDoctor(t)
+
+	post := &BlogPost{AuthorID: 1, Title: "Hand washing", ContentMarkdown: "Wash for 20 seconds."}
+	if err := post.Create(); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := post.SubmitForReview(doctorID, 1, ""); err != nil {
+		t.Fatalf("SubmitForReview: %v", err)
+	}
+	if err := post.Approve(doctorID, "Dr. Lan", ""); err != nil {
+		t.Fatalf("Approve: %v", err)
+	}
+	post.Status = "published"
+	post.EditorID = 1
+	if err := post.Update(); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if !post.IsVisible(time.Now()) {
+		t.Fatal("the published post is not visible")
+	}
+
+	// An edit with the status unchanged, as PUT and PATCH make, by someone
+	// who does not say who should review it
+	post.ContentMarkdown = "Wash for 2 seconds."
+	post.ReviewerID = nil
+	if err := post.Update(); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	stored, err := GetBlogPostByID(post.ID)
+	if err != nil {
+		t.Fatalf("GetBlogPostByID: %v", err)
+	}
+	if stored.Status != "pending_review" {
+		t.Errorf("status = %q after editing the content, want pending_review", stored.Status)
+	}
+	if stored.ReviewerID == nil || *stored.ReviewerID != doctorID {
+		t.Errorf("reviewer = %v after editing the content, want the doctor who approved it (%d)", stored.ReviewerID, doctorID)
+	}
+	if stored.IsVisible(time.Now()) {
+		t.Error("the edited post is still publicly visible")
+	}
+	visible, err := GetBlogPosts(BlogPostFilter{Visible: true, Limit: 10})
+	if err != nil {
+		t.Fatalf("GetBlogPosts: %v", err)
+	}
+	for _, p := range visible {
+		if p.ID == post.ID {
+			t.Error("the edited post is still listed publicly")
+		}
+	}
+
+	// The doctor can approve the edit
+	if err := stored.Approve(doctorID, "Dr. Lan", ""); err != nil {
+		t.Fatalf("Approve after the edit: %v", err)
+	}
+	if stored.MedicalReview == nil || stored.Status != "draft" {
+		t.Errorf("after approval status = %q, review = %v; want an approved draft", stored.Status, stored.MedicalReview)
+	}
+}
+
+func TestEditingUnreviewedPublishedPostNeedsReviewer(t *testing.T) {
+	useTestDB(t)
+	doctorID := createDoctor(t)
+
+	post := &BlogPost{AuthorID: 1, Title: "Hand washing", ContentMarkdown: "Wash for 20 seconds.", Status: "published", ReviewOverride: true}
+	if err := post.Create(); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	post.ContentMarkdown = "Wash for 2 seconds."
+	post.EditorID = 1
+	post.ReviewOverride = false
+	err := post.Update()
+	var ve *ValidationError
+	if !errors.As(err, &ve) || ve.Field != "reviewer_id" {
+		t.Fatalf("Update without a reviewer = %v, want a reviewer_id validation error", err)
+	}
+
+	post.ReviewerID = &doctorID
+	if err := post.Update(); err != nil {
+		t.Fatalf("Update with a reviewer: %v", err)
+	}
+	if post.Status != "pending_review" {
+		t.Errorf("status = %q, want pending_review", post.Status)
+	}
+}
+
+func TestEditingPublishedPostWithOverride(t *testing.T) {
+	useTestDB(t)
+
+	post := &BlogPost{AuthorID: 1, Title: "Hand washing", ContentMarkdown: "Wash for 20 seconds.", Status: "published", ReviewOverride: true}
+	if err := post.Create(); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	post.ContentMarkdown = "Wash for 30 seconds."
+	post.EditorID = 1
+	if err := post.Update(); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if post.Status != "published" {
+		t.Errorf("status = %q after an admin edit, want published", post.Status)
+	}
+}
@@ -0,0 +1,169 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/dottrip/fpt-swp/internal/database"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// BlogRevision is a saved version of a blog post. One is stored each time a
+// post is created or updated, numbered by the version the post had then.
+type BlogRevision struct {
+	ID              int       `json:"id"`
+	PostID          int       `json:"post_id"`
+	Version         int       `json:"version"`
+	Title           string    `json:"title"`
+	ContentMarkdown string    `json:"content_markdown,omitempty"` // left out of revision lists
+	Excerpt         string    `json:"excerpt,omitempty"`
+	Status          string    `json:"status"`
+	EditorID        *int      `json:"editor_id"` // who saved it; nil once the account is deleted
+	EditorName      string    `json:"editor_name"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// BlogRevisionDiff is a unified diff between two revisions of a post
+type BlogRevisionDiff struct {
+	From int    `json:"from"`
+	To   int    `json:"to"`
+	Diff string `json:"diff"` // empty if the revisions are the same
+}
+
+// BlogRevisionPolicy says which revisions PruneBlogRevisions deletes. The
+// latest revision of a post and every published one are always kept.
+type BlogRevisionPolicy struct {
+	Keep   int           // revisions kept per post, newest first; 0 keeps all
+	MaxAge time.Duration // older revisions are deleted; 0 keeps them
+}
+
+// saveRevision records the post as just saved at b.Version
+func saveRevision(tx *sql.Tx, b *BlogPost) error {
+	editorID := b.EditorID
+	if editorID == 0 {
+		editorID = b.AuthorID
+	}
+
+	query := "INSERT INTO blog_post_revisions (post_id, version, title, content_markdown, excerpt, status, editor_id, created_at) VALUES (" +
+		getPlaceholderBlog(1) + ", " + getPlaceholderBlog(2) + ", " + getPlaceholderBlog(3) + ", " + getPlaceholderBlog(4) + ", " +
+		getPlaceholderBlog(5) + ", " + getPlaceholderBlog(6) + ", " + getPlaceholderBlog(7) + ", " + getPlaceholderBlog(8) + ")"
+
+	_, err := tx.Exec(query, b.ID, b.Version, b.Title, b.ContentMarkdown, b.Excerpt, b.Status, editorID, time.Now().UTC().Truncate(time.Second))
+	return err
+}
+
+// GetBlogRevisions lists the revisions of a post, newest first, without
+// their content
+func GetBlogRevisions(postID int) ([]BlogRevision, error) {
+	query := `
+		SELECT r.id, r.post_id, r.version, r.title, r.status, r.editor_id, COALESCE(u.username, ''), r.created_at
+		FROM blog_post_revisions r
+		LEFT JOIN users u ON r.editor_id = u.id
+		WHERE r.post_id = ` + getPlaceholderBlog(1) + `
+		ORDER BY r.version DESC`
+
+	rows, err := database.DB.Query(query, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []BlogRevision{}
+	for rows.Next() {
+		var r BlogRevision
+		if err := rows.Scan(&r.ID, &r.PostID, &r.Version, &r.Title, &r.Status, &r.EditorID, &r.EditorName, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, r)
+	}
+	return revisions, rows.Err()
+}
+
+// GetBlogRevision retrieves the revision of a post at version
+func GetBlogRevision(postID, version int) (*BlogRevision, error) {
+	query := `
+		SELECT r.id, r.post_id, r.version, r.title, r.content_markdown, COALESCE(r.excerpt, ''), r.status,
+			   r.editor_id, COALESCE(u.username, ''), r.created_at
+		FROM blog_post_revisions r
+		LEFT JOIN users u ON r.editor_id = u.id
+		WHERE r.post_id = ` + getPlaceholderBlog(1) + ` AND r.version = ` + getPlaceholderBlog(2)
+
+	r := &BlogRevision{}
+	err := database.DB.QueryRow(query, postID, version).Scan(
+		&r.ID, &r.PostID, &r.Version, &r.Title, &r.ContentMarkdown, &r.Excerpt, &r.Status,
+		&r.EditorID, &r.EditorName, &r.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Restore copies the title, content and excerpt of the revision onto the
+// post. The post's status, slug and other fields are left alone; saving it
+// then records a new revision.
+func (r *BlogRevision) Restore(b *BlogPost) {
+	b.Title = html.UnescapeString(r.Title)
+	b.ContentMarkdown = r.ContentMarkdown
+	b.Excerpt = r.Excerpt
+}
+
+// DiffBlogRevisions returns a unified diff from one revision to another,
+// covering the title, status and Markdown content
+func DiffBlogRevisions(from, to *BlogRevision) (*BlogRevisionDiff, error) {
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(from.document()),
+		B:        difflib.SplitLines(to.document()),
+		FromFile: fmt.Sprintf("version %d", from.Version),
+		ToFile:   fmt.Sprintf("version %d", to.Version),
+		FromDate: from.CreatedAt.Format(time.RFC3339),
+		ToDate:   to.CreatedAt.Format(time.RFC3339),
+		Context:  3,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &BlogRevisionDiff{From: from.Version, To: to.Version, Diff: diff}, nil
+}
+
+// document is the text of the revision that diffs compare
+func (r *BlogRevision) document() string {
+	// SplitLines ends every line with a newline, the last one included
+	return strings.TrimRight("Title: "+html.UnescapeString(r.Title)+"\nStatus: "+r.Status+"\n\n"+r.ContentMarkdown, "\n")
+}
+
+// PruneBlogRevisions deletes the revisions the policy no longer keeps and
+// returns how many it deleted
+func PruneBlogRevisions(policy BlogRevisionPolicy) (int64, error) {
+	var conditions []string
+	var args []interface{}
+	if policy.Keep > 0 {
+		args = append(args, policy.Keep)
+		conditions = append(conditions, "r.n > "+getPlaceholderBlog(len(args)))
+	}
+	if policy.MaxAge > 0 {
+		args = append(args, time.Now().UTC().Add(-policy.MaxAge))
+		conditions = append(conditions, "r.created_at < "+getPlaceholderBlog(len(args)))
+	}
+	if len(conditions) == 0 {
+		return 0, nil
+	}
+
+	query := `
+		DELETE FROM blog_post_revisions WHERE id IN (
+			SELECT id FROM (
+				SELECT id, status, created_at, ROW_NUMBER() OVER (PARTITION BY post_id ORDER BY version DESC) AS n
+				FROM blog_post_revisions
+			) r
+			WHERE r.n > 1 AND r.status <> 'published' AND (` + strings.Join(conditions, " OR ") + `)
+		)`
+
+	result, err := database.DB.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
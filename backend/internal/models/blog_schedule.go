@@ -0,0 +1,107 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dottrip/fpt-swp/internal/database"
+)
+
+// IsVisible reports whether the public can read the post at now: it is
+// published, its publish_at has come and its unpublish_at has not
+func (b *BlogPost) IsVisible(now time.Time) bool {
+	if b.Status != "published" {
+		return false
+	}
+	if b.PublishAt != nil && b.PublishAt.After(now) {
+		return false
+	}
+	return b.UnpublishAt == nil || b.UnpublishAt.After(now)
+}
+
+// PublishNow publishes the post straight away, dropping a publish_at still
+// to come
+func (b *BlogPost) PublishNow() {
+	b.Status = "published"
+	if b.PublishAt != nil && b.PublishAt.After(time.Now()) {
+		b.PublishAt = nil
+	}
+}
+
+// scheduleStatus moves a post saved as published with a publish_at still to
+// come to scheduled, so it is published by RunBlogSchedule rather than
+// stamped as published now
+func (b *BlogPost) scheduleStatus(now time.Time) {
+	if b.Status == "published" && b.PublishAt != nil && b.PublishAt.After(now) {
+		b.Status = "scheduled"
+	}
+}
+
+// RunBlogSchedule publishes the scheduled posts whose publish_at has come
+// and archives the published posts whose unpublish_at has, and returns how
+// many it changed. Each change is an Update of the version that was read,
+// so when several servers run the schedule at once only one of them changes
+// a post and records its revision; the others skip it. A post that cannot
+// be changed does not hold up the rest: the errors are returned together
+// once every post has been tried. Published posts keep their publish_at as
+// the time they were published, however late the schedule runs.
+func RunBlogSchedule(now time.Time) (int, error) {
+	now = now.UTC().Truncate(time.Second)
+
+	query := `
+		SELECT id FROM blog_posts
+		WHERE (status = 'scheduled' AND publish_at <= ` + getPlaceholderBlog(1) + `)
+		   OR (status = 'published' AND unpublish_at <= ` + getPlaceholderBlog(2) + `)
+		ORDER BY id`
+
+	rows, err := database.DB.Query(query, now, now)
+	if err != nil {
+		return 0, err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	var errs []error
+	for _, id := range ids {
+		post, err := GetBlogPostByID(id)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("post %d: %w", id, err))
+			continue
+		}
+
+		switch {
+		case post.Status == "scheduled" && post.PublishAt != nil && !post.PublishAt.After(now):
+			publishedAt := *post.PublishAt
+			post.Status = "published"
+			post.PublishedAt = &publishedAt
+		case post.Status == "published" && post.UnpublishAt != nil && !post.UnpublishAt.After(now):
+			post.Status = "archived"
+			post.UnpublishAt = nil
+		default:
+			continue // changed since it was selected
+		}
+
+		if err := post.Update(); err != nil {
+			if errors.Is(err, ErrVersionConflict) {
+				continue // another server got there first
+			}
+			errs = append(errs, fmt.Errorf("post %d: %w", id, err))
+			continue
+		}
+		changed++
+	}
+	return changed, errors.Join(errs...)
+}
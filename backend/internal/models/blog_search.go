@@ -0,0 +1,325 @@
+package models
+
+import (
+	"database/sql"
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/dottrip/fpt-swp/internal/database"
+	"github.com/dottrip/fpt-swp/internal/markdown"
+	"github.com/dottrip/fpt-swp/internal/textutil"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	// maxSearchTerms caps the words of a query that are searched for
+	maxSearchTerms = 10
+
+	// snippetLength is about how many characters of text a search result
+	// shows around the words found
+	snippetLength = 200
+)
+
+// BlogSearchResult is a post found by a search, with the words searched for
+// marked in its title and in a snippet of its text. Both are HTML with
+// nothing but <mark> elements.
+type BlogSearchResult struct {
+	BlogPost
+	TitleHighlight string `json:"title_highlight"`
+	Snippet        string `json:"snippet"`
+}
+
+// SearchBlogPosts retrieves a page of the posts matching filter.Search, best
+// matches first. Posts match when they contain every word of the query, or
+// words starting with it, in their title or text, with or without accents;
+// words in the title count for more.
+func SearchBlogPosts(filter BlogPostFilter) ([]BlogSearchResult, error) {
+	filter.SortBy = "relevance"
+	filter.Keyset = nil
+
+	posts, err := GetBlogPosts(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	terms := searchTerms(filter.Search)
+	results := make([]BlogSearchResult, len(posts))
+	for i, post := range posts {
+		results[i] = BlogSearchResult{
+			BlogPost:       post,
+			TitleHighlight: highlight(html.UnescapeString(post.Title), terms, 0),
+			Snippet:        highlight(markdown.PlainText(post.ContentHTML), terms, snippetLength),
+		}
+	}
+	return results, nil
+}
+
+// searchTerms splits a query into the folded words searched for
+func searchTerms(query string) []string {
+	terms := strings.FieldsFunc(textutil.Fold(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(terms) > maxSearchTerms {
+		terms = terms[:maxSearchTerms]
+	}
+	return terms
+}
+
+// ftsQuery is the FTS5 query for posts with every term as a word prefix
+func ftsQuery(terms []string) string {
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + term + `"*`
+	}
+	return strings.Join(quoted, " ")
+}
+
+// tsQuery is the tsquery for posts with every term as a word prefix
+func tsQuery(terms []string) string {
+	return strings.Join(terms, ":* & ") + ":*"
+}
+
+// likeEscaper escapes the characters LIKE treats specially, with a
+// backslash as the ESCAPE character
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// escapeLike returns s as a LIKE pattern matching s literally
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+// searchClause returns the condition for posts matching query, appending
+// its arguments to args. Without a full-text index it falls back to
+// matching the query as typed with LIKE, % and _ included.
+func searchClause(query string, args *[]interface{}) string {
+	if !database.FullTextSearch {
+		like := "LIKE"
+		if getEnvBlog("DB_TYPE", "postgres") != "sqlite" {
+			like = "ILIKE"
+		}
+		searchTerm := "%" + escapeLike(query) + "%"
+		*args = append(*args, searchTerm, searchTerm)
+		return " AND (bp.title " + like + " " + getPlaceholder(len(*args)-1) + ` ESCAPE '\'` +
+			" OR bp.content_markdown " + like + " " + getPlaceholder(len(*args)) + ` ESCAPE '\')`
+	}
+
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		// Nothing but punctuation; no post has such a word
+		return " AND 1=0"
+	}
+	if getEnvBlog("DB_TYPE", "postgres") == "sqlite" {
+		*args = append(*args, ftsQuery(terms))
+		return " AND bp.id IN (SELECT rowid FROM blog_posts_fts WHERE blog_posts_fts MATCH " + getPlaceholder(len(*args)) + ")"
+	}
+	*args = append(*args, tsQuery(terms))
+	return " AND bp.search_vector @@ to_tsquery('blog_search', " + getPlaceholder(len(*args)) + ")"
+}
+
+// relevanceOrder returns the ORDER BY clause putting the posts that best
+// match query first, appending its arguments to args. A word in the title
+// weighs ten times one in the text.
+func relevanceOrder(query string, args *[]interface{}) string {
+	const newest = "bp.created_at DESC, bp.id DESC"
+
+	terms := searchTerms(query)
+	switch {
+	case len(terms) == 0:
+		return " ORDER BY " + newest
+	case !database.FullTextSearch:
+		*args = append(*args, "%"+query+"%")
+		return " ORDER BY CASE WHEN bp.title LIKE " + getPlaceholder(len(*args)) + " THEN 0 ELSE 1 END, " + newest
+	case getEnvBlog("DB_TYPE", "postgres") == "sqlite":
+		// bm25 is lower for better matches
+		*args = append(*args, ftsQuery(terms))
+		return " ORDER BY (SELECT bm25(blog_posts_fts, 10.0, 1.0) FROM blog_posts_fts WHERE blog_posts_fts MATCH " +
+			getPlaceholder(len(*args)) + " AND rowid = bp.id), " + newest
+	default:
+		// The title is weighted A (1.0) and the text D (0.1)
+		*args = append(*args, tsQuery(terms))
+		return " ORDER BY ts_rank(bp.search_vector, to_tsquery('blog_search', " + getPlaceholder(len(*args)) + ")) DESC, " + newest
+	}
+}
+
+// indexBlogPost stores the title and text of the post for searching
+func indexBlogPost(tx *sql.Tx, b *BlogPost) error {
+	if !database.FullTextSearch {
+		return nil
+	}
+
+	title := html.UnescapeString(b.Title)
+	body := markdown.PlainText(b.ContentHTML)
+
+	if getEnvBlog("DB_TYPE", "postgres") != "sqlite" {
+		query := `
+			UPDATE blog_posts
+			SET search_vector = setweight(to_tsvector('blog_search', $1), 'A') || setweight(to_tsvector('blog_search', $2), 'D')
+			WHERE id = $3`
+		_, err := tx.Exec(query, title, body, b.ID)
+		return err
+	}
+
+	// FTS5 only folds the accents it knows of, so the text is stored folded
+	// the same way queries are
+	if err := unindexBlogPost(tx, b.ID); err != nil {
+		return err
+	}
+	_, err := tx.Exec("INSERT INTO blog_posts_fts (rowid, title, body) VALUES (?, ?, ?)", b.ID, textutil.Fold(title), textutil.Fold(body))
+	return err
+}
+
+// unindexBlogPost removes post id from the SQLite search index, which is
+// not deleted with the post
+func unindexBlogPost(tx *sql.Tx, id int) error {
+	if !database.FullTextSearch || getEnvBlog("DB_TYPE", "postgres") != "sqlite" {
+		return nil
+	}
+	_, err := tx.Exec("DELETE FROM blog_posts_fts WHERE rowid = ?", id)
+	return err
+}
+
+// BackfillBlogSearchIndex indexes the posts that are not yet searchable,
+// e.g. posts written before search existed, and returns how many it
+// indexed
+func BackfillBlogSearchIndex() (int, error) {
+	if !database.FullTextSearch {
+		return 0, nil
+	}
+
+	query := "SELECT id, title, content_html FROM blog_posts WHERE search_vector IS NULL ORDER BY id"
+	if getEnvBlog("DB_TYPE", "postgres") == "sqlite" {
+		query = "SELECT id, title, content_html FROM blog_posts WHERE id NOT IN (SELECT rowid FROM blog_posts_fts) ORDER BY id"
+	}
+
+	rows, err := database.DB.Query(query)
+	if err != nil {
+		return 0, err
+	}
+
+	var posts []BlogPost
+	for rows.Next() {
+		var post BlogPost
+		if err := rows.Scan(&post.ID, &post.Title, &post.ContentHTML); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		posts = append(posts, post)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(posts) == 0 {
+		return 0, nil
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	for i := range posts {
+		if err := indexBlogPost(tx, &posts[i]); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(posts), nil
+}
+
+// highlight returns text, HTML-escaped, with the words starting with one of
+// terms wrapped in <mark>. With a limit it returns only about that many
+// characters, starting a little before the first word marked, or the start
+// of the text if none is.
+func highlight(text string, terms []string, limit int) string {
+	text = norm.NFC.String(strings.Join(strings.Fields(text), " "))
+
+	// Find the words of the text and whether each is marked
+	type word struct {
+		start, end int
+		marked     bool
+	}
+	var words []word
+	first := -1
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			i += size
+			continue
+		}
+
+		w := word{start: i}
+		for i < len(text) {
+			r, size := utf8.DecodeRuneInString(text[i:])
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.Is(unicode.Mn, r) {
+				break
+			}
+			i += size
+		}
+		w.end = i
+
+		folded := textutil.Fold(text[w.start:w.end])
+		for _, term := range terms {
+			if strings.HasPrefix(folded, term) {
+				w.marked = true
+				break
+			}
+		}
+		if w.marked && first < 0 {
+			first = len(words)
+		}
+		words = append(words, w)
+	}
+
+	// Pick the words shown: a few before the first one marked, then as many
+	// as fit
+	from, to := 0, len(words)
+	if limit > 0 {
+		if first > 0 {
+			from = first
+			for from > 0 && utf8.RuneCountInString(text[words[from-1].start:words[first].start]) <= limit/4 {
+				from--
+			}
+		}
+		to = from
+		for to < len(words) && (to == from || utf8.RuneCountInString(text[words[from].start:words[to].end]) <= limit) {
+			to++
+		}
+	}
+	if from >= to {
+		return html.EscapeString(text)
+	}
+
+	start, end := 0, len(text)
+	if from > 0 {
+		start = words[from].start
+	}
+	if to < len(words) {
+		end = words[to-1].end
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	at := start
+	for _, w := range words[from:to] {
+		b.WriteString(html.EscapeString(text[at:w.start]))
+		if w.marked {
+			b.WriteString("<mark>" + html.EscapeString(text[w.start:w.end]) + "</mark>")
+		} else {
+			b.WriteString(html.EscapeString(text[w.start:w.end]))
+		}
+		at = w.end
+	}
+	b.WriteString(html.EscapeString(text[at:end]))
+	if end < len(text) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/dottrip/fpt-swp/internal/database"
+)
+
+func TestSearchFallbackMatchesWildcardsLiterally(t *testing.T) {
+	useTestDB(t)
+	fullText := database.FullTextSearch
+	database.FullTextSearch = false
+	t.Cleanup(func() { database.FullTextSearch = fullText })
+
+	for _, title := range []string{"Vaccines are 100% safe", "100 ways to sleep", "snake_case for doctors", "snakescase"} {
+		post := &BlogPost{AuthorID: 1, Title: title, ContentMarkdown: "Text.", Status: "published", ReviewOverride: true}
+		if err := post.Create(); err != nil {
+			t.Fatalf("Create %q: %v", title, err)
+		}
+	}
+
+	for query, want := range map[string]string{"100%": "Vaccines are 100% safe", "snake_case": "snake_case for doctors"} {
+		posts, err := GetBlogPosts(BlogPostFilter{Visible: true, Search: query, Limit: 10})
+		if err != nil {
+			t.Fatalf("GetBlogPosts(%q): %v", query, err)
+		}
+		if len(posts) != 1 || posts[0].Title != want {
+			var titles []string
+			for _, p := range posts {
+				titles = append(titles, p.Title)
+			}
+			t.Errorf("search %q found %q, want only %q", query, titles, want)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package models
+
+import (
+	"database/sql"
+	"html"
+	"strconv"
+
+	"github.com/dottrip/fpt-swp/internal/database"
+	"github.com/dottrip/fpt-swp/internal/textutil"
+)
+
+// defaultSlug is used for titles that have no letters or digits to make a
+// slug from
+const defaultSlug = "bai-viet"
+
+// assignSlug makes sure the post has a slug no other post uses, now or
+// formerly. A slug set by staff must be free; without one, a slug is made
+// from the title, numbered "-2", "-3", ... if another post already has it.
+func (b *BlogPost) assignSlug(tx *sql.Tx) error {
+	if b.Slug != "" {
+		taken, err := slugTaken(tx, b.Slug, b.ID)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return uniqueError("slug", "slug is already in use")
+		}
+		return nil
+	}
+
+	slug, err := freeSlug(tx, html.UnescapeString(b.Title), b.ID)
+	if err != nil {
+		return err
+	}
+	b.Slug = slug
+	return nil
+}
+
+// freeSlug returns the first slug made from title that post id can take
+func freeSlug(tx *sql.Tx, title string, id int) (string, error) {
+	base := textutil.Slugify(title)
+	if base == "" {
+		base = defaultSlug
+	}
+
+	slug := base
+	for n := 2; ; n++ {
+		taken, err := slugTaken(tx, slug, id)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return slug, nil
+		}
+		slug = base + "-" + strconv.Itoa(n)
+	}
+}
+
+// slugTaken reports whether a post other than id has slug, or had it and
+// still redirects from it
+func slugTaken(tx *sql.Tx, slug string, id int) (bool, error) {
+	query := "SELECT (SELECT COUNT(*) FROM blog_posts WHERE slug = " + getPlaceholderBlog(1) + " AND id <> " + getPlaceholderBlog(2) +
+		") + (SELECT COUNT(*) FROM blog_post_slugs WHERE slug = " + getPlaceholderBlog(3) + " AND post_id <> " + getPlaceholderBlog(4) + ")"
+
+	var count int
+	if err := tx.QueryRow(query, slug, id, slug, id).Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// moveSlug records that post id changed its slug from old to current: old
+// redirects from now on, and current no longer does if the post had it
+// before
+func moveSlug(tx *sql.Tx, id int, old, current string) error {
+	if _, err := tx.Exec("DELETE FROM blog_post_slugs WHERE slug = "+getPlaceholderBlog(1), current); err != nil {
+		return err
+	}
+	if old == "" {
+		return nil
+	}
+	_, err := tx.Exec("INSERT INTO blog_post_slugs (slug, post_id) VALUES ("+getPlaceholderBlog(1)+", "+getPlaceholderBlog(2)+")", old, id)
+	return err
+}
+
+// slugError reports a write that lost a race for a slug like assignSlug
+// does, and leaves other errors as they are
+func slugError(err error) error {
+	if isUniqueViolation(err) {
+		return uniqueError("slug", "slug is already in use")
+	}
+	return err
+}
+
+// GetBlogPostIDByFormerSlug returns the ID of the post that used to have
+// slug, or sql.ErrNoRows if none did
+func GetBlogPostIDByFormerSlug(slug string) (int, error) {
+	var id int
+	err := database.DB.QueryRow("SELECT post_id FROM blog_post_slugs WHERE slug = "+getPlaceholderBlog(1), slug).Scan(&id)
+	return id, err
+}
+
+// BackfillBlogPostSlugs gives every post without a slug one made from its
+// title, e.g. posts written before slugs existed, and returns how many it
+// changed. The version is left alone since the content did not change.
+func BackfillBlogPostSlugs() (int, error) {
+	rows, err := database.DB.Query("SELECT id, title FROM blog_posts WHERE slug IS NULL OR slug = '' ORDER BY id")
+	if err != nil {
+		return 0, err
+	}
+
+	var posts []BlogPost
+	for rows.Next() {
+		var post BlogPost
+		if err := rows.Scan(&post.ID, &post.Title); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		posts = append(posts, post)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for i, post := range posts {
+		if err := backfillSlug(&post); err != nil {
+			return i, err
+		}
+	}
+	return len(posts), nil
+}
+
+// backfillSlug stores a slug made from the post's title
+func backfillSlug(post *BlogPost) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := post.assignSlug(tx); err != nil {
+		return err
+	}
+	query := "UPDATE blog_posts SET slug = " + getPlaceholderBlog(1) + " WHERE id = " + getPlaceholderBlog(2)
+	if _, err := tx.Exec(query, post.Slug, post.ID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,591 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"html"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dottrip/fpt-swp/internal/database"
+	"github.com/dottrip/fpt-swp/internal/textutil"
+)
+
+// maxTermName is the longest category or tag name, in characters
+const maxTermName = 100
+
+// BlogTerm is a category or tag posts are filed under. Terms are found by
+// slug, so names that make the same slug are the same term.
+type BlogTerm struct {
+	ID          int       `json:"id"`
+	Name        string    `json:"name"`
+	Slug        string    `json:"slug"`
+	Description string    `json:"description"`
+	PostCount   int       `json:"post_count"` // published posts readers can see now
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// BlogTermRef is the category or a tag of a post
+type BlogTermRef struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+}
+
+// BlogTermInput represents the request structure for creating or renaming a
+// category or tag
+type BlogTermInput struct {
+	Name        string `json:"name" binding:"required,max=100"`
+	Slug        string `json:"slug" binding:"omitempty,max=100,slug"` // generated from the name on create if empty, kept on rename
+	Description string `json:"description" binding:"max=500"`
+}
+
+// BlogTermMergeInput names the term another is merged into
+type BlogTermMergeInput struct {
+	IntoID int `json:"into_id" binding:"required"`
+}
+
+// BlogTaxonomy is a kind of term: categories, of which a post has at most
+// one, or tags, of which it has any number
+type BlogTaxonomy struct {
+	table string
+	// posts selects the IDs of posts filed under the term given as the
+	// placeholder, as "bp"
+	posts string
+}
+
+// Blog taxonomies
+var (
+	BlogCategories = BlogTaxonomy{
+		table: "blog_categories",
+		posts: "SELECT bp.id FROM blog_posts bp WHERE bp.category_id = ",
+	}
+	BlogTags = BlogTaxonomy{
+		table: "blog_tags",
+		posts: "SELECT bp.id FROM blog_posts bp JOIN blog_post_tags pt ON pt.post_id = bp.id WHERE pt.tag_id = ",
+	}
+)
+
+// defaultBlogCategories are the categories staff picked from before they
+// were kept in the database
+var defaultBlogCategories = []string{
+	"Sức khỏe tổng quát", "Tim mạch", "Tiêu hóa", "Thần kinh", "Nhi khoa", "Phụ khoa", "Da liễu",
+	"Mắt", "Tai mũi họng", "Răng hàm mặt", "Dinh dưỡng", "Tâm lý", "Tin tức y tế", "Khuyến mãi",
+}
+
+// Validate validates the term data
+func (t *BlogTerm) Validate() error {
+	if strings.TrimSpace(t.Name) == "" {
+		return requiredError("name", "name is required")
+	}
+	if len([]rune(t.Name)) > maxTermName {
+		return &ValidationError{Field: "name", Code: "max", Param: strconv.Itoa(maxTermName), Message: "name is too long"}
+	}
+	if t.Slug == "" {
+		return &ValidationError{Field: "name", Code: "invalid", Message: "name must contain letters or digits"}
+	}
+	if !textutil.IsSlug(t.Slug) {
+		return &ValidationError{Field: "slug", Code: "slug", Message: "slug may only contain lowercase letters, digits and single hyphens"}
+	}
+	return nil
+}
+
+// List returns every term with its published post count, by name
+func (x BlogTaxonomy) List() ([]BlogTerm, error) {
+	now := time.Now().UTC().Truncate(time.Second)
+	rows, err := database.DB.Query(x.selectTerms("")+" ORDER BY t.name, t.id", now, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	terms := []BlogTerm{}
+	for rows.Next() {
+		t, err := scanBlogTerm(rows)
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, t)
+	}
+	return terms, rows.Err()
+}
+
+// Get retrieves a term by ID
+func (x BlogTaxonomy) Get(id int) (*BlogTerm, error) {
+	now := time.Now().UTC().Truncate(time.Second)
+	t, err := scanBlogTerm(database.DB.QueryRow(x.selectTerms(" WHERE t.id = "+getPlaceholderBlog(3)), now, now, id))
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// GetBySlug retrieves a term by slug
+func (x BlogTaxonomy) GetBySlug(slug string) (*BlogTerm, error) {
+	now := time.Now().UTC().Truncate(time.Second)
+	t, err := scanBlogTerm(database.DB.QueryRow(x.selectTerms(" WHERE t.slug = "+getPlaceholderBlog(3)), now, now, slug))
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// selectTerms selects terms with their counts of visible posts. The count
+// takes the current time twice as the first two arguments, so placeholders
+// in where start at the third.
+func (x BlogTaxonomy) selectTerms(where string) string {
+	return "SELECT t.id, t.name, t.slug, t.description, (SELECT COUNT(*) FROM blog_posts bp WHERE bp.id IN (" + x.posts + "t.id)" +
+		visibleClause(getPlaceholderBlog(1), getPlaceholderBlog(2)) + "), t.created_at, t.updated_at FROM " + x.table + " t" + where
+}
+
+// scanBlogTerm scans a row selected with selectTerms
+func scanBlogTerm(row interface{ Scan(...interface{}) error }) (BlogTerm, error) {
+	var t BlogTerm
+	err := row.Scan(&t.ID, &t.Name, &t.Slug, &t.Description, &t.PostCount, &t.CreatedAt, &t.UpdatedAt)
+	return t, err
+}
+
+// Create stores a new term, with a slug made from its name if it has none
+func (x BlogTaxonomy) Create(t *BlogTerm) error {
+	t.Name = strings.TrimSpace(t.Name)
+	if t.Slug == "" {
+		t.Slug = textutil.Slugify(t.Name)
+	}
+	if err := t.Validate(); err != nil {
+		return validationError(err)
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := x.insert(tx, t); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// insert stores a new term inside tx
+func (x BlogTaxonomy) insert(tx *sql.Tx, t *BlogTerm) error {
+	now := time.Now().UTC().Truncate(time.Second)
+	t.CreatedAt, t.UpdatedAt = now, now
+	t.Description = strings.TrimSpace(t.Description)
+
+	query := "INSERT INTO " + x.table + " (name, slug, description, created_at, updated_at) VALUES (" +
+		getPlaceholderBlog(1) + ", " + getPlaceholderBlog(2) + ", " + getPlaceholderBlog(3) + ", " + getPlaceholderBlog(4) + ", " + getPlaceholderBlog(5) + ")"
+	args := []interface{}{t.Name, t.Slug, t.Description, now, now}
+
+	if getEnvBlog("DB_TYPE", "postgres") == "sqlite" {
+		result, err := tx.Exec(query, args...)
+		if err != nil {
+			return termSlugError(err)
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		t.ID = int(id)
+	} else if err := tx.QueryRow(query+" RETURNING id", args...).Scan(&t.ID); err != nil {
+		return termSlugError(err)
+	}
+	return nil
+}
+
+// Update renames a term. Posts show the new name straight away; their slug
+// links to the term change only if the slug does.
+func (x BlogTaxonomy) Update(t *BlogTerm) error {
+	t.Name = strings.TrimSpace(t.Name)
+	t.Description = strings.TrimSpace(t.Description)
+	if err := t.Validate(); err != nil {
+		return validationError(err)
+	}
+
+	t.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+	query := "UPDATE " + x.table + " SET name = " + getPlaceholderBlog(1) + ", slug = " + getPlaceholderBlog(2) +
+		", description = " + getPlaceholderBlog(3) + ", updated_at = " + getPlaceholderBlog(4) + " WHERE id = " + getPlaceholderBlog(5)
+	result, err := database.DB.Exec(query, t.Name, t.Slug, t.Description, t.UpdatedAt, t.ID)
+	if err != nil {
+		return termSlugError(err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Delete deletes a term. Posts in a deleted category are left without one.
+func (x BlogTaxonomy) Delete(id int) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// SQLite does not enforce the foreign keys unless they are turned on
+	if err := x.unlink(tx, id); err != nil {
+		return err
+	}
+	result, err := tx.Exec("DELETE FROM "+x.table+" WHERE id = "+getPlaceholderBlog(1), id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
+}
+
+// Merge files every post under term from under term into instead, then
+// deletes from. Merging a term into itself is an error.
+func (x BlogTaxonomy) Merge(from, into int) error {
+	if from == into {
+		return &ValidationError{Field: "into_id", Code: "invalid", Message: "a term cannot be merged into itself"}
+	}
+	if _, err := x.Get(into); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return &ValidationError{Field: "into_id", Code: "invalid", Message: "the term to merge into does not exist"}
+		}
+		return err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if x == BlogCategories {
+		query := "UPDATE blog_posts SET category_id = " + getPlaceholderBlog(1) + " WHERE category_id = " + getPlaceholderBlog(2)
+		if _, err := tx.Exec(query, into, from); err != nil {
+			return err
+		}
+	} else {
+		// Posts with both tags keep one link
+		query := "INSERT INTO blog_post_tags (post_id, tag_id) SELECT post_id, " + getPlaceholderBlog(1) +
+			" FROM blog_post_tags WHERE tag_id = " + getPlaceholderBlog(2) +
+			" AND post_id NOT IN (SELECT post_id FROM blog_post_tags WHERE tag_id = " + getPlaceholderBlog(3) + ")"
+		if _, err := tx.Exec(query, into, from, into); err != nil {
+			return err
+		}
+	}
+
+	if err := x.unlink(tx, from); err != nil {
+		return err
+	}
+	result, err := tx.Exec("DELETE FROM "+x.table+" WHERE id = "+getPlaceholderBlog(1), from)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
+}
+
+// unlink removes term id from every post
+func (x BlogTaxonomy) unlink(tx *sql.Tx, id int) error {
+	query := "DELETE FROM blog_post_tags WHERE tag_id = " + getPlaceholderBlog(1)
+	if x == BlogCategories {
+		query = "UPDATE blog_posts SET category_id = NULL WHERE category_id = " + getPlaceholderBlog(1)
+	}
+	_, err := tx.Exec(query, id)
+	return err
+}
+
+// termSlugError reports a slug another term of the kind has
+func termSlugError(err error) error {
+	if isUniqueViolation(err) {
+		return uniqueError("slug", "slug is already in use")
+	}
+	return err
+}
+
+// findOrCreate returns the term named name, found by slug, and creates it
+// if there is none. name is as entered, not escaped.
+func (x BlogTaxonomy) findOrCreate(tx *sql.Tx, name string) (BlogTermRef, error) {
+	name = strings.TrimSpace(name)
+	ref := BlogTermRef{Slug: textutil.Slugify(name)}
+
+	err := tx.QueryRow("SELECT id, name FROM "+x.table+" WHERE slug = "+getPlaceholderBlog(1), ref.Slug).Scan(&ref.ID, &ref.Name)
+	if err == nil || !errors.Is(err, sql.ErrNoRows) {
+		return ref, err
+	}
+
+	t := &BlogTerm{Name: name, Slug: ref.Slug}
+	if err := t.Validate(); err != nil {
+		return ref, err
+	}
+	if err := x.insert(tx, t); err != nil {
+		return ref, err
+	}
+	return BlogTermRef{ID: t.ID, Name: t.Name, Slug: t.Slug}, nil
+}
+
+// splitTags splits a comma-separated list of tag names, dropping empty ones
+func splitTags(tags string) []string {
+	var names []string
+	for _, name := range strings.Split(tags, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// saveTerms files the post under the category and tags named by
+// b.Category and b.Tags, creating the ones that do not exist yet, and sets
+// them to the names stored
+func (b *BlogPost) saveTerms(tx *sql.Tx) error {
+	b.CategoryID, b.CategorySlug = nil, ""
+	if strings.TrimSpace(b.Category) != "" {
+		category, err := BlogCategories.findOrCreate(tx, b.Category)
+		if err != nil {
+			return termError("category", err)
+		}
+		b.CategoryID, b.Category, b.CategorySlug = &category.ID, category.Name, category.Slug
+	}
+	query := "UPDATE blog_posts SET category_id = " + getPlaceholderBlog(1) + " WHERE id = " + getPlaceholderBlog(2)
+	if _, err := tx.Exec(query, b.CategoryID, b.ID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM blog_post_tags WHERE post_id = "+getPlaceholderBlog(1), b.ID); err != nil {
+		return err
+	}
+	b.TagList = []BlogTermRef{}
+	linked := map[int]bool{}
+	for _, name := range splitTags(b.Tags) {
+		tag, err := BlogTags.findOrCreate(tx, name)
+		if err != nil {
+			return termError("tags", err)
+		}
+		if linked[tag.ID] {
+			continue
+		}
+		linked[tag.ID] = true
+		query := "INSERT INTO blog_post_tags (post_id, tag_id) VALUES (" + getPlaceholderBlog(1) + ", " + getPlaceholderBlog(2) + ")"
+		if _, err := tx.Exec(query, b.ID, tag.ID); err != nil {
+			return err
+		}
+		b.TagList = append(b.TagList, tag)
+	}
+	sort.Slice(b.TagList, func(i, j int) bool { return b.TagList[i].Name < b.TagList[j].Name })
+	b.Tags = joinTags(b.TagList)
+	return nil
+}
+
+// joinTags lists the names of tags the way BlogPost.Tags has them
+func joinTags(tags []BlogTermRef) string {
+	names := make([]string, len(tags))
+	for i, tag := range tags {
+		names[i] = tag.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// termError reports a bad category or tag name against the post's field
+func termError(field string, err error) error {
+	var ve *ValidationError
+	if errors.As(err, &ve) {
+		return &ValidationError{Field: field, Code: ve.Code, Param: ve.Param, Message: ve.Message}
+	}
+	return err
+}
+
+// loadBlogPostTerms fills in the category slug and tags of the posts
+func loadBlogPostTerms(posts []*BlogPost) error {
+	if len(posts) == 0 {
+		return nil
+	}
+
+	byID := map[int]*BlogPost{}
+	placeholders := make([]string, len(posts))
+	args := make([]interface{}, len(posts))
+	for i, post := range posts {
+		byID[post.ID] = post
+		post.TagList = []BlogTermRef{}
+		placeholders[i] = getPlaceholderBlog(i + 1)
+		args[i] = post.ID
+	}
+
+	query := "SELECT pt.post_id, t.id, t.name, t.slug FROM blog_post_tags pt JOIN blog_tags t ON t.id = pt.tag_id WHERE pt.post_id IN (" +
+		strings.Join(placeholders, ", ") + ") ORDER BY t.name, t.id"
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var postID int
+		var tag BlogTermRef
+		if err := rows.Scan(&postID, &tag.ID, &tag.Name, &tag.Slug); err != nil {
+			return err
+		}
+		byID[postID].TagList = append(byID[postID].TagList, tag)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, post := range posts {
+		post.Tags = joinTags(post.TagList)
+	}
+	return nil
+}
+
+// BackfillBlogTaxonomy moves the free-text category and comma-separated
+// tags of posts written before categories and tags had tables into them,
+// and returns how many posts it changed. The first time, it also creates
+// the categories staff used to pick from, and it unescapes term names that
+// were stored HTML-escaped.
+func BackfillBlogTaxonomy() (int, error) {
+	var count int
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM blog_categories").Scan(&count); err != nil {
+		return 0, err
+	}
+	if count == 0 {
+		if err := seedBlogCategories(); err != nil {
+			return 0, err
+		}
+	}
+
+	for _, x := range []BlogTaxonomy{BlogCategories, BlogTags} {
+		if err := x.unescapeNames(); err != nil {
+			return 0, err
+		}
+	}
+
+	rows, err := database.DB.Query("SELECT id, COALESCE(category, ''), COALESCE(tags, '') FROM blog_posts WHERE category <> '' OR tags <> '' ORDER BY id")
+	if err != nil {
+		return 0, err
+	}
+
+	var posts []BlogPost
+	for rows.Next() {
+		var post BlogPost
+		if err := rows.Scan(&post.ID, &post.Category, &post.Tags); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		posts = append(posts, post)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for i, post := range posts {
+		if err := backfillTerms(&post); err != nil {
+			return i, err
+		}
+	}
+	return len(posts), nil
+}
+
+// unescapeNames undoes the HTML escaping terms used to be stored with
+func (x BlogTaxonomy) unescapeNames() error {
+	rows, err := database.DB.Query("SELECT id, name FROM " + x.table + " WHERE name LIKE '%&%;%'")
+	if err != nil {
+		return err
+	}
+
+	names := map[int]string{}
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			rows.Close()
+			return err
+		}
+		if unescaped := html.UnescapeString(name); unescaped != name {
+			names[id] = unescaped
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, name := range names {
+		query := "UPDATE " + x.table + " SET name = " + getPlaceholderBlog(1) + " WHERE id = " + getPlaceholderBlog(2)
+		if _, err := database.DB.Exec(query, name, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// seedBlogCategories creates the default categories
+func seedBlogCategories() error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, name := range defaultBlogCategories {
+		if _, err := BlogCategories.findOrCreate(tx, name); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// backfillTerms links a post to its former category and tags, keeping any
+// it is linked to already, and clears the old columns, which hold the
+// names HTML-escaped. The version is left alone since the content did not
+// change.
+func backfillTerms(post *BlogPost) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var categoryID sql.NullInt64
+	if err := tx.QueryRow("SELECT category_id FROM blog_posts WHERE id = "+getPlaceholderBlog(1), post.ID).Scan(&categoryID); err != nil {
+		return err
+	}
+	if name := html.UnescapeString(post.Category); !categoryID.Valid && strings.TrimSpace(name) != "" && textutil.Slugify(name) != "" {
+		category, err := BlogCategories.findOrCreate(tx, strings.TrimSpace(truncateRunes(name, maxTermName)))
+		if err != nil {
+			return err
+		}
+		query := "UPDATE blog_posts SET category_id = " + getPlaceholderBlog(1) + " WHERE id = " + getPlaceholderBlog(2)
+		if _, err := tx.Exec(query, category.ID, post.ID); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range splitTags(html.UnescapeString(post.Tags)) {
+		if textutil.Slugify(name) == "" {
+			continue
+		}
+		tag, err := BlogTags.findOrCreate(tx, strings.TrimSpace(truncateRunes(name, maxTermName)))
+		if err != nil {
+			return err
+		}
+		query := "INSERT INTO blog_post_tags (post_id, tag_id) SELECT " + getPlaceholderBlog(1) + ", " + getPlaceholderBlog(2) +
+			" WHERE NOT EXISTS (SELECT 1 FROM blog_post_tags WHERE post_id = " + getPlaceholderBlog(3) + " AND tag_id = " + getPlaceholderBlog(4) + ")"
+		if _, err := tx.Exec(query, post.ID, tag.ID, post.ID, tag.ID); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec("UPDATE blog_posts SET category = '', tags = '' WHERE id = "+getPlaceholderBlog(1), post.ID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,182 @@
+package models
+
+import (
+	"time"
+
+	"github.com/dottrip/fpt-swp/internal/database"
+)
+
+// dayLayout is how days of blog_post_views are written
+const dayLayout = "2006-01-02"
+
+// BlogPostViewCount is a number of views of a post on a day, clinic time,
+// from one referring site
+type BlogPostViewCount struct {
+	PostID   int
+	Day      string // YYYY-MM-DD
+	Referrer string // host name; empty for direct visits
+	Views    int
+}
+
+// BlogViewStats are the views of blog posts over a range of days
+type BlogViewStats struct {
+	From      string              `json:"from"` // first day, YYYY-MM-DD
+	To        string              `json:"to"`   // last day, included
+	Total     int                 `json:"total"`
+	Daily     []BlogViewDay       `json:"daily"`     // every day of the range, oldest first
+	TopPosts  []BlogPostViews     `json:"top_posts"` // most viewed first
+	Referrers []BlogReferrerViews `json:"referrers"` // most views first
+}
+
+// BlogViewDay is the number of views of all posts on a day
+type BlogViewDay struct {
+	Date  string `json:"date"`
+	Views int    `json:"views"`
+}
+
+// BlogPostViews is the number of views of a post over a range of days
+type BlogPostViews struct {
+	PostID int    `json:"post_id"`
+	Title  string `json:"title"`
+	Slug   string `json:"slug"`
+	Views  int    `json:"views"`
+}
+
+// BlogReferrerViews is the number of views that came from a site
+type BlogReferrerViews struct {
+	Referrer string `json:"referrer"` // empty for direct visits
+	Views    int    `json:"views"`
+}
+
+// AddBlogPostViews adds counted views to the total of each post and to its
+// daily counts. Views of posts deleted since they were counted are dropped.
+func AddBlogPostViews(counts []BlogPostViewCount) error {
+	if len(counts) == 0 {
+		return nil
+	}
+
+	totals := map[int]int{}
+	for _, count := range counts {
+		totals[count.PostID] += count.Views
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Posts deleted since their views were counted update no row
+	exists := map[int]bool{}
+	query := "UPDATE blog_posts SET view_count = view_count + " + getPlaceholderBlog(1) + " WHERE id = " + getPlaceholderBlog(2)
+	for postID, views := range totals {
+		result, err := tx.Exec(query, views, postID)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n > 0 {
+			exists[postID] = true
+		}
+	}
+
+	query = `
+		INSERT INTO blog_post_views (post_id, day, referrer, views)
+		VALUES (` + getPlaceholderBlog(1) + `, ` + getPlaceholderBlog(2) + `, ` + getPlaceholderBlog(3) + `, ` + getPlaceholderBlog(4) + `)
+		ON CONFLICT (post_id, day, referrer) DO UPDATE SET views = blog_post_views.views + excluded.views`
+	for _, count := range counts {
+		if !exists[count.PostID] {
+			continue
+		}
+		if _, err := tx.Exec(query, count.PostID, count.Day, count.Referrer, count.Views); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetBlogViewStats returns the views of blog posts from one day to another,
+// both included, with the limit most viewed posts and referring sites
+func GetBlogViewStats(from, to time.Time, limit int) (*BlogViewStats, error) {
+	stats := &BlogViewStats{
+		From:      from.Format(dayLayout),
+		To:        to.Format(dayLayout),
+		Daily:     []BlogViewDay{},
+		TopPosts:  []BlogPostViews{},
+		Referrers: []BlogReferrerViews{},
+	}
+	rangeClause := " WHERE v.day >= " + getPlaceholderBlog(1) + " AND v.day <= " + getPlaceholderBlog(2)
+
+	// Views per day, zero on days without any
+	rows, err := database.DB.Query("SELECT v.day, SUM(v.views) FROM blog_post_views v"+rangeClause+" GROUP BY v.day", stats.From, stats.To)
+	if err != nil {
+		return nil, err
+	}
+	daily := map[string]int{}
+	for rows.Next() {
+		var day time.Time
+		var views int
+		if err := rows.Scan(&day, &views); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		daily[day.Format(dayLayout)] = views
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		date := day.Format(dayLayout)
+		stats.Daily = append(stats.Daily, BlogViewDay{Date: date, Views: daily[date]})
+		stats.Total += daily[date]
+	}
+
+	// Most viewed posts
+	query := `
+		SELECT bp.id, bp.title, COALESCE(bp.slug, ''), SUM(v.views) AS total
+		FROM blog_post_views v
+		JOIN blog_posts bp ON bp.id = v.post_id` + rangeClause + `
+		GROUP BY bp.id, bp.title, bp.slug
+		ORDER BY total DESC, bp.id
+		LIMIT ` + getPlaceholderBlog(3)
+	rows, err = database.DB.Query(query, stats.From, stats.To, limit)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var post BlogPostViews
+		if err := rows.Scan(&post.PostID, &post.Title, &post.Slug, &post.Views); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		stats.TopPosts = append(stats.TopPosts, post)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Sites the views came from
+	query = `
+		SELECT v.referrer, SUM(v.views) AS total
+		FROM blog_post_views v` + rangeClause + `
+		GROUP BY v.referrer
+		ORDER BY total DESC, v.referrer
+		LIMIT ` + getPlaceholderBlog(3)
+	rows, err = database.DB.Query(query, stats.From, stats.To, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var referrer BlogReferrerViews
+		if err := rows.Scan(&referrer.Referrer, &referrer.Views); err != nil {
+			return nil, err
+		}
+		stats.Referrers = append(stats.Referrers, referrer)
+	}
+	return stats, rows.Err()
+}
@@ -0,0 +1,487 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dottrip/fpt-swp/internal/database"
+)
+
+// MaxMessageLength is the maximum length of a chat message in characters
+const MaxMessageLength = 4000
+
+// Conversation represents a chat conversation between users
+type Conversation struct {
+	ID            int                  `json:"id"`
+	Type          string               `json:"type"` // direct, consultation, support
+	Title         string               `json:"title"`
+	CreatedBy     int                  `json:"created_by"`
+	LastMessageAt *time.Time           `json:"last_message_at,omitempty"`
+	CreatedAt     time.Time            `json:"created_at"`
+	UpdatedAt     time.Time            `json:"updated_at"`
+	Members       []ConversationMember `json:"members,omitempty"`
+	UnreadCount   int                  `json:"unread_count"`
+}
+
+// ConversationMember represents a user taking part in a conversation
+type ConversationMember struct {
+	UserID            int       `json:"user_id"`
+	Username          string    `json:"username"`
+	Role              string    `json:"role"`
+	LastReadMessageID int       `json:"last_read_message_id"`
+	JoinedAt          time.Time `json:"joined_at"`
+}
+
+// Message represents a chat message
+type Message struct {
+	ID             int       `json:"id"`
+	ConversationID int       `json:"conversation_id"`
+	SenderID       int       `json:"sender_id"`
+	SenderName     string    `json:"sender_name"`
+	Body           string    `json:"body"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// ConversationRequest represents the request structure for creating a conversation
+type ConversationRequest struct {
+	Type      string `json:"type" binding:"omitempty,oneof=direct consultation support"`
+	Title     string `json:"title" binding:"max=255"`
+	MemberIDs []int  `json:"member_ids" binding:"dive,gt=0"`
+}
+
+// ErrNotConversationMember is returned when a user acts on a conversation they are not part of
+var ErrNotConversationMember = errors.New("user is not a member of this conversation")
+
+// ErrMessageNotInConversation is returned when a read marker names a message
+// of another conversation
+var ErrMessageNotInConversation = errors.New("message does not belong to this conversation")
+
+// Validate validates the conversation data
+func (c *Conversation) Validate() error {
+	if c.CreatedBy == 0 {
+		return requiredError("created_by", "creator ID is required")
+	}
+	if c.Type == "" {
+		c.Type = "direct"
+	}
+	if c.Type != "direct" && c.Type != "consultation" && c.Type != "support" {
+		return oneOfError("type", "direct consultation support", "type must be direct, consultation, or support")
+	}
+	return nil
+}
+
+// Create creates a new conversation and adds the creator and memberIDs as members
+func (c *Conversation) Create(memberIDs []int) error {
+	if err := c.Validate(); err != nil {
+		return validationError(err)
+	}
+	c.Title = strings.TrimSpace(c.Title)
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	dbType := getEnv("DB_TYPE", "postgres")
+
+	if dbType == "sqlite" {
+		query := `
+			INSERT INTO conversations (type, title, created_by, created_at, updated_at)
+			VALUES (?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		`
+
+		result, err := tx.Exec(query, c.Type, c.Title, c.CreatedBy)
+		if err != nil {
+			return err
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		c.ID = int(id)
+
+		selectQuery := `SELECT created_at, updated_at FROM conversations WHERE id = ?`
+		if err := tx.QueryRow(selectQuery, c.ID).Scan(&c.CreatedAt, &c.UpdatedAt); err != nil {
+			return err
+		}
+	} else {
+		query := `
+			INSERT INTO conversations (type, title, created_by)
+			VALUES ($1, $2, $3)
+			RETURNING id, created_at, updated_at
+		`
+
+		if err := tx.QueryRow(query, c.Type, c.Title, c.CreatedBy).Scan(&c.ID, &c.CreatedAt, &c.UpdatedAt); err != nil {
+			return err
+		}
+	}
+
+	memberQuery := "INSERT INTO conversation_members (conversation_id, user_id) VALUES (" +
+		getPlaceholder(1) + ", " + getPlaceholder(2) + ")"
+
+	seen := map[int]bool{}
+	for _, userID := range append([]int{c.CreatedBy}, memberIDs...) {
+		if seen[userID] {
+			continue
+		}
+		seen[userID] = true
+
+		if _, err := tx.Exec(memberQuery, c.ID, userID); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	members, err := GetConversationMembers(c.ID)
+	if err != nil {
+		return err
+	}
+	c.Members = members
+
+	return nil
+}
+
+// GetConversationByID retrieves a conversation and its members
+func GetConversationByID(id int) (*Conversation, error) {
+	c := &Conversation{}
+
+	query := `
+		SELECT id, type, title, created_by, last_message_at, created_at, updated_at
+		FROM conversations
+		WHERE id = ` + getPlaceholder(1)
+
+	err := database.DB.QueryRow(query, id).Scan(
+		&c.ID, &c.Type, &c.Title, &c.CreatedBy, &c.LastMessageAt, &c.CreatedAt, &c.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Members, err = GetConversationMembers(c.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// GetConversationsForUser lists the conversations a user belongs to, most recently active first
+func GetConversationsForUser(userID int) ([]Conversation, error) {
+	conversations := []Conversation{}
+
+	query := `
+		SELECT c.id, c.type, c.title, c.created_by, c.last_message_at, c.created_at, c.updated_at,
+			(SELECT COUNT(*) FROM messages m
+			 WHERE m.conversation_id = c.id AND m.id > cm.last_read_message_id AND m.sender_id != cm.user_id) AS unread_count
+		FROM conversations c
+		JOIN conversation_members cm ON cm.conversation_id = c.id
+		WHERE cm.user_id = ` + getPlaceholder(1) + `
+		ORDER BY COALESCE(c.last_message_at, c.created_at) DESC
+	`
+
+	rows, err := database.DB.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c Conversation
+		err := rows.Scan(
+			&c.ID, &c.Type, &c.Title, &c.CreatedBy, &c.LastMessageAt, &c.CreatedAt, &c.UpdatedAt, &c.UnreadCount,
+		)
+		if err != nil {
+			return nil, err
+		}
+		conversations = append(conversations, c)
+	}
+
+	return conversations, rows.Err()
+}
+
+// GetConversationMembers retrieves the members of a conversation
+func GetConversationMembers(conversationID int) ([]ConversationMember, error) {
+	members := []ConversationMember{}
+
+	query := `
+		SELECT cm.user_id, u.username, u.role, cm.last_read_message_id, cm.joined_at
+		FROM conversation_members cm
+		JOIN users u ON u.id = cm.user_id
+		WHERE cm.conversation_id = ` + getPlaceholder(1) + `
+		ORDER BY cm.joined_at, cm.user_id
+	`
+
+	rows, err := database.DB.Query(query, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m ConversationMember
+		if err := rows.Scan(&m.UserID, &m.Username, &m.Role, &m.LastReadMessageID, &m.JoinedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+
+	return members, rows.Err()
+}
+
+// GetConversationMemberIDs returns the user IDs of a conversation's members
+func GetConversationMemberIDs(conversationID int) ([]int, error) {
+	var ids []int
+
+	query := "SELECT user_id FROM conversation_members WHERE conversation_id = " + getPlaceholder(1)
+
+	rows, err := database.DB.Query(query, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// IsConversationMember reports whether a user belongs to a conversation
+func IsConversationMember(conversationID, userID int) (bool, error) {
+	var count int
+
+	query := "SELECT COUNT(*) FROM conversation_members WHERE conversation_id = " +
+		getPlaceholder(1) + " AND user_id = " + getPlaceholder(2)
+
+	if err := database.DB.QueryRow(query, conversationID, userID).Scan(&count); err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// Validate validates the message data
+func (m *Message) Validate() error {
+	m.Body = strings.TrimSpace(m.Body)
+	if m.ConversationID == 0 {
+		return requiredError("conversation_id", "conversation ID is required")
+	}
+	if m.SenderID == 0 {
+		return requiredError("sender_id", "sender ID is required")
+	}
+	if m.Body == "" {
+		return requiredError("body", "message body is required")
+	}
+	if utf8.RuneCountInString(m.Body) > MaxMessageLength {
+		return maxError("body", MaxMessageLength, "message is too long")
+	}
+	return nil
+}
+
+// Create stores a new message after checking the sender's membership
+func (m *Message) Create() error {
+	if err := m.Validate(); err != nil {
+		return validationError(err)
+	}
+
+	isMember, err := IsConversationMember(m.ConversationID, m.SenderID)
+	if err != nil {
+		return err
+	}
+	if !isMember {
+		return ErrNotConversationMember
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	dbType := getEnv("DB_TYPE", "postgres")
+
+	if dbType == "sqlite" {
+		query := `
+			INSERT INTO messages (conversation_id, sender_id, body, created_at)
+			VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+		`
+
+		result, err := tx.Exec(query, m.ConversationID, m.SenderID, m.Body)
+		if err != nil {
+			return err
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		m.ID = int(id)
+
+		if err := tx.QueryRow(`SELECT created_at FROM messages WHERE id = ?`, m.ID).Scan(&m.CreatedAt); err != nil {
+			return err
+		}
+
+		updateQuery := `UPDATE conversations SET last_message_at = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+		if _, err := tx.Exec(updateQuery, m.CreatedAt, m.ConversationID); err != nil {
+			return err
+		}
+	} else {
+		query := `
+			INSERT INTO messages (conversation_id, sender_id, body)
+			VALUES ($1, $2, $3)
+			RETURNING id, created_at
+		`
+
+		if err := tx.QueryRow(query, m.ConversationID, m.SenderID, m.Body).Scan(&m.ID, &m.CreatedAt); err != nil {
+			return err
+		}
+
+		updateQuery := `UPDATE conversations SET last_message_at = $1, updated_at = NOW() WHERE id = $2`
+		if _, err := tx.Exec(updateQuery, m.CreatedAt, m.ConversationID); err != nil {
+			return err
+		}
+	}
+
+	// The sender has obviously read their own message
+	readQuery := "UPDATE conversation_members SET last_read_message_id = " + getPlaceholder(1) +
+		" WHERE conversation_id = " + getPlaceholder(2) + " AND user_id = " + getPlaceholder(3)
+	if _, err := tx.Exec(readQuery, m.ID, m.ConversationID, m.SenderID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if sender, err := GetByID(m.SenderID); err == nil {
+		m.SenderName = sender.Username
+	}
+
+	return nil
+}
+
+// GetMessageByID retrieves a single message
+func GetMessageByID(id int) (*Message, error) {
+	m := &Message{}
+
+	query := `
+		SELECT m.id, m.conversation_id, m.sender_id, COALESCE(u.username, ''), m.body, m.created_at
+		FROM messages m
+		LEFT JOIN users u ON u.id = m.sender_id
+		WHERE m.id = ` + getPlaceholder(1)
+
+	err := database.DB.QueryRow(query, id).Scan(
+		&m.ID, &m.ConversationID, &m.SenderID, &m.SenderName, &m.Body, &m.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// GetMessages returns up to limit messages older than beforeID (or the newest
+// messages when beforeID is 0), ordered oldest first. hasMore reports whether
+// older messages remain.
+func GetMessages(conversationID, beforeID, limit int) (messages []Message, hasMore bool, err error) {
+	messages = []Message{}
+
+	query := `
+		SELECT m.id, m.conversation_id, m.sender_id, COALESCE(u.username, ''), m.body, m.created_at
+		FROM messages m
+		LEFT JOIN users u ON u.id = m.sender_id
+		WHERE m.conversation_id = ` + getPlaceholder(1)
+	args := []interface{}{conversationID}
+
+	if beforeID > 0 {
+		query += " AND m.id < " + getPlaceholder(2)
+		args = append(args, beforeID)
+	}
+
+	// Fetch one extra row to find out whether there is another page
+	query += " ORDER BY m.id DESC LIMIT " + getPlaceholder(len(args)+1)
+	args = append(args, limit+1)
+
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m Message
+		if err := rows.Scan(&m.ID, &m.ConversationID, &m.SenderID, &m.SenderName, &m.Body, &m.CreatedAt); err != nil {
+			return nil, false, err
+		}
+		messages = append(messages, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+
+	if len(messages) > limit {
+		hasMore = true
+		messages = messages[:limit]
+	}
+
+	// Reverse into chronological order
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+
+	return messages, hasMore, nil
+}
+
+// CountMessages returns the number of messages in a conversation
+func CountMessages(conversationID int) (int, error) {
+	var count int
+	err := database.DB.QueryRow("SELECT COUNT(*) FROM messages WHERE conversation_id = "+getPlaceholder(1), conversationID).Scan(&count)
+	return count, err
+}
+
+// MarkConversationRead records that a user has read up to messageID, which
+// must belong to the conversation. The read marker only ever moves forward.
+func MarkConversationRead(conversationID, userID, messageID int) error {
+	var exists int
+	err := database.DB.QueryRow("SELECT COUNT(*) FROM messages WHERE id = "+getPlaceholder(1)+" AND conversation_id = "+getPlaceholder(2),
+		messageID, conversationID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists == 0 {
+		return ErrMessageNotInConversation
+	}
+
+	query := "UPDATE conversation_members SET last_read_message_id = " + getPlaceholder(1) +
+		" WHERE conversation_id = " + getPlaceholder(2) + " AND user_id = " + getPlaceholder(3) +
+		" AND last_read_message_id < " + getPlaceholder(4)
+
+	result, err := database.DB.Exec(query, messageID, conversationID, userID, messageID)
+	if err != nil {
+		return err
+	}
+
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		isMember, err := IsConversationMember(conversationID, userID)
+		if err != nil {
+			return err
+		}
+		if !isMember {
+			return ErrNotConversationMember
+		}
+	}
+
+	return nil
+}
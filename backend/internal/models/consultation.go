@@ -0,0 +1,194 @@
+package models
+
+import (
+	"time"
+
+	"github.com/dottrip/fpt-swp/internal/database"
+)
+
+// ConsultationSession represents a chat, video or phone consultation between
+// a doctor and a patient
+type ConsultationSession struct {
+	ID              int        `json:"id"`
+	DoctorID        int        `json:"doctor_id"`
+	DoctorName      string     `json:"doctor_name"`
+	PatientID       int        `json:"patient_id"`
+	PatientName     string     `json:"patient_name"`
+	Mode            string     `json:"mode"`   // chat, video, phone
+	Status          string     `json:"status"` // waiting, in_progress, completed
+	ConversationID  *int       `json:"conversation_id,omitempty"`
+	StartedAt       *time.Time `json:"started_at,omitempty"`
+	EndedAt         *time.Time `json:"ended_at,omitempty"`
+	DurationSeconds int        `json:"duration_seconds"`
+	BillableMinutes int        `json:"billable_minutes"` // duration rounded up to whole minutes
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// ConsultationSessionRequest represents the request structure for creating a consultation session
+type ConsultationSessionRequest struct {
+	DoctorID  int    `json:"doctor_id" binding:"required"`
+	PatientID int    `json:"patient_id"`
+	Mode      string `json:"mode" binding:"omitempty,oneof=chat video phone"`
+}
+
+// Validate validates the consultation session data
+func (s *ConsultationSession) Validate() error {
+	if s.DoctorID == 0 {
+		return requiredError("doctor_id", "doctor ID is required")
+	}
+	if s.PatientID == 0 {
+		return requiredError("patient_id", "patient ID is required")
+	}
+	if s.Mode == "" {
+		s.Mode = "video"
+	}
+	if s.Mode != "chat" && s.Mode != "video" && s.Mode != "phone" {
+		return oneOfError("mode", "chat video phone", "mode must be chat, video, or phone")
+	}
+	return nil
+}
+
+// Create creates a new consultation session in the waiting state
+func (s *ConsultationSession) Create() error {
+	if err := s.Validate(); err != nil {
+		return validationError(err)
+	}
+	s.Status = "waiting"
+
+	dbType := getEnv("DB_TYPE", "postgres")
+
+	if dbType == "sqlite" {
+		query := `
+			INSERT INTO consultation_sessions (doctor_id, patient_id, mode, status, conversation_id, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		`
+
+		result, err := database.DB.Exec(query, s.DoctorID, s.PatientID, s.Mode, s.Status, s.ConversationID)
+		if err != nil {
+			return err
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		s.ID = int(id)
+
+		selectQuery := `SELECT created_at, updated_at FROM consultation_sessions WHERE id = ?`
+		return database.DB.QueryRow(selectQuery, s.ID).Scan(&s.CreatedAt, &s.UpdatedAt)
+	}
+
+	query := `
+		INSERT INTO consultation_sessions (doctor_id, patient_id, mode, status, conversation_id)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, updated_at
+	`
+
+	return database.DB.QueryRow(
+		query, s.DoctorID, s.PatientID, s.Mode, s.Status, s.ConversationID,
+	).Scan(&s.ID, &s.CreatedAt, &s.UpdatedAt)
+}
+
+// GetConsultationSessionByID retrieves a consultation session by ID
+func GetConsultationSessionByID(id int) (*ConsultationSession, error) {
+	s := &ConsultationSession{}
+
+	query := `
+		SELECT cs.id, cs.doctor_id, d.name, cs.patient_id, u.username, cs.mode, cs.status,
+			cs.conversation_id, cs.started_at, cs.ended_at, cs.duration_seconds, cs.created_at, cs.updated_at
+		FROM consultation_sessions cs
+		JOIN doctors d ON d.id = cs.doctor_id
+		JOIN users u ON u.id = cs.patient_id
+		WHERE cs.id = ` + getPlaceholder(1)
+
+	err := database.DB.QueryRow(query, id).Scan(
+		&s.ID, &s.DoctorID, &s.DoctorName, &s.PatientID, &s.PatientName, &s.Mode, &s.Status,
+		&s.ConversationID, &s.StartedAt, &s.EndedAt, &s.DurationSeconds, &s.CreatedAt, &s.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	s.BillableMinutes = (s.DurationSeconds + 59) / 60
+
+	return s, nil
+}
+
+// HasConsulted reports whether the doctor has had a consultation session
+// with the patient
+func HasConsulted(doctorID, patientID int) (bool, error) {
+	var exists bool
+	err := database.DB.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM consultation_sessions WHERE doctor_id = "+getPlaceholder(1)+" AND patient_id = "+getPlaceholder(2)+")",
+		doctorID, patientID,
+	).Scan(&exists)
+	return exists, err
+}
+
+// Start moves a waiting session to in_progress and records the call start.
+// It reports false if the session had already been started or completed, so
+// concurrent callers on different replicas start the clock exactly once.
+func (s *ConsultationSession) Start() (bool, error) {
+	now := time.Now().UTC()
+
+	query := "UPDATE consultation_sessions SET status = 'in_progress', started_at = " + getPlaceholder(1) +
+		", updated_at = " + getPlaceholder(2) + " WHERE id = " + getPlaceholder(3) + " AND status = 'waiting'"
+
+	result, err := database.DB.Exec(query, now, now, s.ID)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, s.reload()
+}
+
+// Complete ends the session and records the call duration used for billing.
+// It reports false if the session was already completed.
+func (s *ConsultationSession) Complete() (bool, error) {
+	if err := s.reload(); err != nil {
+		return false, err
+	}
+	if s.Status == "completed" {
+		return false, nil
+	}
+
+	now := time.Now().UTC()
+	duration := 0
+	if s.StartedAt != nil {
+		duration = int(now.Sub(*s.StartedAt).Seconds())
+		if duration < 0 {
+			duration = 0
+		}
+	}
+
+	query := "UPDATE consultation_sessions SET status = 'completed', ended_at = " + getPlaceholder(1) +
+		", duration_seconds = " + getPlaceholder(2) + ", updated_at = " + getPlaceholder(3) +
+		" WHERE id = " + getPlaceholder(4) + " AND status = " + getPlaceholder(5)
+
+	result, err := database.DB.Exec(query, now, duration, now, s.ID, s.Status)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, s.reload()
+}
+
+// reload refreshes the session from the database
+func (s *ConsultationSession) reload() error {
+	fresh, err := GetConsultationSessionByID(s.ID)
+	if err != nil {
+		return err
+	}
+	*s = *fresh
+	return nil
+}
@@ -0,0 +1,560 @@
+package models
+
+import (
+	"errors"
+	"html"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dottrip/fpt-swp/internal/database"
+)
+
+// Consultation request statuses
+const (
+	RequestQueued    = "queued"
+	RequestClaimed   = "claimed"
+	RequestCompleted = "completed"
+	RequestCancelled = "cancelled"
+)
+
+// DefaultHandleMinutes is the assumed time a doctor spends on a request
+// until enough requests of a specialty have been completed to measure it
+const DefaultHandleMinutes = 15
+
+// ErrQueueEmpty is returned when there is no request left to claim
+var ErrQueueEmpty = errors.New("no consultation requests waiting")
+
+// ConsultationRequest is a patient's request for a consultation, waiting in
+// the queue of a specialty until a doctor claims it
+type ConsultationRequest struct {
+	ID             int        `json:"id"`
+	PatientID      int        `json:"patient_id"`
+	PatientName    string     `json:"patient_name"`
+	Specialty      string     `json:"specialty"`
+	Symptoms       string     `json:"symptoms"`
+	Mode           string     `json:"mode"`            // chat, video, phone
+	Priority       string     `json:"priority"`        // low, medium, high, urgent
+	PrioritySource string     `json:"priority_source"` // auto, staff
+	Status         string     `json:"status"`          // queued, claimed, completed, cancelled
+	ClaimedBy      *int       `json:"claimed_by,omitempty"`
+	ClaimedAt      *time.Time `json:"claimed_at,omitempty"`
+	CompletedAt    *time.Time `json:"completed_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+
+	// Queue position and wait estimate, only set while the request is queued
+	Position             int  `json:"position,omitempty"`
+	EstimatedWaitMinutes *int `json:"estimated_wait_minutes,omitempty"`
+}
+
+// ConsultationRequestInput represents the request structure for joining the queue
+type ConsultationRequestInput struct {
+	PatientID int    `json:"patient_id"`
+	Specialty string `json:"specialty" binding:"required,max=255"`
+	Symptoms  string `json:"symptoms" binding:"required,max=2000"`
+	Mode      string `json:"mode" binding:"omitempty,oneof=chat video phone"`
+	Priority  string `json:"priority" binding:"omitempty,oneof=low medium high urgent"`
+}
+
+// ConsultationRequestFilter represents filters for listing consultation requests
+type ConsultationRequestFilter struct {
+	PatientID int
+	ClaimedBy int
+	Specialty string
+	Status    string
+	Limit     int // 0 means no limit
+}
+
+// QueueStats describes the live queue of one specialty
+type QueueStats struct {
+	Specialty            string         `json:"specialty"`
+	Length               int            `json:"length"`
+	ByPriority           map[string]int `json:"by_priority"`
+	ActiveDoctors        int            `json:"active_doctors"`
+	AverageHandleMinutes float64        `json:"average_handle_minutes"`
+	// EstimatedWaitMinutes is the expected wait for a new request of each
+	// priority; it is omitted when no doctor of the specialty is active
+	EstimatedWaitMinutes map[string]int `json:"estimated_wait_minutes,omitempty"`
+}
+
+// BeforeSave is a hook that gets called before saving the request
+func (r *ConsultationRequest) BeforeSave() error {
+	r.Specialty = html.EscapeString(strings.TrimSpace(r.Specialty))
+	r.Symptoms = html.EscapeString(strings.TrimSpace(r.Symptoms))
+	return nil
+}
+
+// Validate validates the consultation request data
+func (r *ConsultationRequest) Validate() error {
+	if r.PatientID == 0 {
+		return requiredError("patient_id", "patient ID is required")
+	}
+	if strings.TrimSpace(r.Specialty) == "" {
+		return requiredError("specialty", "specialty is required")
+	}
+	if strings.TrimSpace(r.Symptoms) == "" {
+		return requiredError("symptoms", "symptoms are required")
+	}
+	if len([]rune(r.Symptoms)) > 2000 {
+		return maxError("symptoms", 2000, "symptoms must be at most 2000 characters")
+	}
+	if r.Mode == "" {
+		r.Mode = "video"
+	}
+	if r.Mode != "chat" && r.Mode != "video" && r.Mode != "phone" {
+		return oneOfError("mode", "chat video phone", "mode must be chat, video, or phone")
+	}
+	if r.Priority != "" && !IsValidPriority(r.Priority) {
+		return oneOfError("priority", "low medium high urgent", "priority must be low, medium, high, or urgent")
+	}
+	return nil
+}
+
+// Create adds the request to the queue. Unless a priority was set by staff,
+// it is assigned by the triage rules.
+func (r *ConsultationRequest) Create() error {
+	if err := r.Validate(); err != nil {
+		return validationError(err)
+	}
+
+	if r.Priority == "" {
+		r.Priority = TriagePriority(r.Symptoms)
+		r.PrioritySource = "auto"
+	} else {
+		r.PrioritySource = "staff"
+	}
+	r.Status = RequestQueued
+
+	if err := r.BeforeSave(); err != nil {
+		return err
+	}
+
+	dbType := getEnv("DB_TYPE", "postgres")
+
+	if dbType == "sqlite" {
+		query := `
+			INSERT INTO consultation_requests (patient_id, specialty, symptoms, mode, priority, priority_source, status, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		`
+
+		result, err := database.DB.Exec(query, r.PatientID, r.Specialty, r.Symptoms, r.Mode, r.Priority, r.PrioritySource, r.Status)
+		if err != nil {
+			return err
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		r.ID = int(id)
+
+		selectQuery := `SELECT created_at, updated_at FROM consultation_requests WHERE id = ?`
+		return database.DB.QueryRow(selectQuery, r.ID).Scan(&r.CreatedAt, &r.UpdatedAt)
+	}
+
+	query := `
+		INSERT INTO consultation_requests (patient_id, specialty, symptoms, mode, priority, priority_source, status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at, updated_at
+	`
+
+	return database.DB.QueryRow(
+		query, r.PatientID, r.Specialty, r.Symptoms, r.Mode, r.Priority, r.PrioritySource, r.Status,
+	).Scan(&r.ID, &r.CreatedAt, &r.UpdatedAt)
+}
+
+const consultationRequestColumns = `
+	cr.id, cr.patient_id, COALESCE(u.username, ''), cr.specialty, cr.symptoms, cr.mode,
+	cr.priority, cr.priority_source, cr.status, cr.claimed_by, cr.claimed_at, cr.completed_at,
+	cr.created_at, cr.updated_at`
+
+// scanConsultationRequest scans a row selected with consultationRequestColumns
+func scanConsultationRequest(row interface{ Scan(...interface{}) error }) (*ConsultationRequest, error) {
+	r := &ConsultationRequest{}
+	err := row.Scan(
+		&r.ID, &r.PatientID, &r.PatientName, &r.Specialty, &r.Symptoms, &r.Mode,
+		&r.Priority, &r.PrioritySource, &r.Status, &r.ClaimedBy, &r.ClaimedAt, &r.CompletedAt,
+		&r.CreatedAt, &r.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetConsultationRequestByID retrieves a consultation request by ID
+func GetConsultationRequestByID(id int) (*ConsultationRequest, error) {
+	query := `SELECT ` + consultationRequestColumns + `
+		FROM consultation_requests cr
+		LEFT JOIN users u ON u.id = cr.patient_id
+		WHERE cr.id = ` + getPlaceholder(1)
+
+	return scanConsultationRequest(database.DB.QueryRow(query, id))
+}
+
+// GetConsultationRequests lists consultation requests, newest first
+func GetConsultationRequests(filter ConsultationRequestFilter) ([]ConsultationRequest, error) {
+	requests := []ConsultationRequest{}
+
+	query := `SELECT ` + consultationRequestColumns + `
+		FROM consultation_requests cr
+		LEFT JOIN users u ON u.id = cr.patient_id
+		WHERE 1=1`
+	args := []interface{}{}
+
+	if filter.PatientID != 0 {
+		args = append(args, filter.PatientID)
+		query += " AND cr.patient_id = " + getPlaceholder(len(args))
+	}
+	if filter.ClaimedBy != 0 {
+		args = append(args, filter.ClaimedBy)
+		query += " AND cr.claimed_by = " + getPlaceholder(len(args))
+	}
+	if filter.Specialty != "" {
+		args = append(args, filter.Specialty)
+		query += " AND cr.specialty = " + getPlaceholder(len(args))
+	}
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		query += " AND cr.status = " + getPlaceholder(len(args))
+	}
+	query += " ORDER BY cr.created_at DESC, cr.id DESC"
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += " LIMIT " + getPlaceholder(len(args))
+	}
+
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		r, err := scanConsultationRequest(rows)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, *r)
+	}
+
+	return requests, rows.Err()
+}
+
+// queueAging is how long a request waits before it is served as if it had
+// the next priority up, so low priority requests are not starved
+func queueAging() time.Duration {
+	minutes, err := strconv.Atoi(getEnv("QUEUE_AGING_MINUTES", "20"))
+	if err != nil || minutes <= 0 {
+		minutes = 20
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// effectiveRank is the priority rank a request is served with. Waiting raises
+// the rank up to high; only requests triaged as urgent are served as urgent.
+func effectiveRank(r *ConsultationRequest, now time.Time, aging time.Duration) int {
+	rank := priorityRank[r.Priority]
+	if rank >= priorityRank[PriorityHigh] {
+		return rank
+	}
+
+	rank += int(now.Sub(r.CreatedAt) / aging)
+	if rank > priorityRank[PriorityHigh] {
+		rank = priorityRank[PriorityHigh]
+	}
+	return rank
+}
+
+// queuedRequests returns the queued requests of a specialty in the order
+// doctors will be served them: by effective priority, then oldest first
+func queuedRequests(specialty string) ([]ConsultationRequest, error) {
+	queue, err := GetConsultationRequests(ConsultationRequestFilter{Specialty: specialty, Status: RequestQueued})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	aging := queueAging()
+
+	sort.SliceStable(queue, func(i, j int) bool {
+		ri, rj := effectiveRank(&queue[i], now, aging), effectiveRank(&queue[j], now, aging)
+		if ri != rj {
+			return ri > rj
+		}
+		if !queue[i].CreatedAt.Equal(queue[j].CreatedAt) {
+			return queue[i].CreatedAt.Before(queue[j].CreatedAt)
+		}
+		return queue[i].ID < queue[j].ID
+	})
+
+	return queue, nil
+}
+
+// ClaimNextConsultationRequest assigns the next request in the specialty's
+// queue to doctorID. Each claim is a conditional update on a queued request,
+// so two doctors racing for the same patient cannot both get it; the loser
+// moves on to the next request.
+func ClaimNextConsultationRequest(doctorID int, specialty string) (*ConsultationRequest, error) {
+	queue, err := queuedRequests(specialty)
+	if err != nil {
+		return nil, err
+	}
+
+	query := "UPDATE consultation_requests SET status = '" + RequestClaimed + "', claimed_by = " + getPlaceholder(1) +
+		", claimed_at = " + getPlaceholder(2) + ", updated_at = " + getPlaceholder(3) +
+		" WHERE id = " + getPlaceholder(4) + " AND status = '" + RequestQueued + "'"
+
+	for _, candidate := range queue {
+		now := time.Now().UTC()
+		result, err := database.DB.Exec(query, doctorID, now, now, candidate.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		if affected > 0 {
+			return GetConsultationRequestByID(candidate.ID)
+		}
+	}
+
+	return nil, ErrQueueEmpty
+}
+
+// Release returns a claimed request to the queue, keeping its original place.
+// A doctorID of 0 releases the request whoever holds it. It reports false if
+// the request was not claimed by that doctor.
+func (r *ConsultationRequest) Release(doctorID int) (bool, error) {
+	query := "UPDATE consultation_requests SET status = '" + RequestQueued + "', claimed_by = NULL, claimed_at = NULL, updated_at = " +
+		getPlaceholder(1) + " WHERE id = " + getPlaceholder(2) + " AND status = '" + RequestClaimed + "'"
+	args := []interface{}{time.Now().UTC(), r.ID}
+
+	if doctorID != 0 {
+		query += " AND claimed_by = " + getPlaceholder(3)
+		args = append(args, doctorID)
+	}
+
+	return r.transition(query, args...)
+}
+
+// Complete marks a claimed request as handled. It reports false if the
+// request was not claimed by doctorID.
+func (r *ConsultationRequest) Complete(doctorID int) (bool, error) {
+	now := time.Now().UTC()
+
+	query := "UPDATE consultation_requests SET status = '" + RequestCompleted + "', completed_at = " + getPlaceholder(1) +
+		", updated_at = " + getPlaceholder(2) + " WHERE id = " + getPlaceholder(3) +
+		" AND status = '" + RequestClaimed + "' AND claimed_by = " + getPlaceholder(4)
+
+	return r.transition(query, now, now, r.ID, doctorID)
+}
+
+// Cancel withdraws a request that has not been claimed yet. It reports false
+// if a doctor already claimed it.
+func (r *ConsultationRequest) Cancel() (bool, error) {
+	query := "UPDATE consultation_requests SET status = '" + RequestCancelled + "', updated_at = " + getPlaceholder(1) +
+		" WHERE id = " + getPlaceholder(2) + " AND status = '" + RequestQueued + "'"
+
+	return r.transition(query, time.Now().UTC(), r.ID)
+}
+
+// SetPriority overrides the triaged priority of a queued request
+func (r *ConsultationRequest) SetPriority(priority string) (bool, error) {
+	if !IsValidPriority(priority) {
+		return false, oneOfError("priority", "low medium high urgent", "priority must be low, medium, high, or urgent")
+	}
+
+	query := "UPDATE consultation_requests SET priority = " + getPlaceholder(1) + ", priority_source = 'staff', updated_at = " +
+		getPlaceholder(2) + " WHERE id = " + getPlaceholder(3) + " AND status = '" + RequestQueued + "'"
+
+	return r.transition(query, priority, time.Now().UTC(), r.ID)
+}
+
+// transition runs a conditional status update and reloads the request
+func (r *ConsultationRequest) transition(query string, args ...interface{}) (bool, error) {
+	result, err := database.DB.Exec(query, args...)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	fresh, err := GetConsultationRequestByID(r.ID)
+	if err != nil {
+		return false, err
+	}
+	*r = *fresh
+
+	return affected > 0, nil
+}
+
+// waitMinutes estimates the wait behind ahead requests served by doctors in parallel
+func waitMinutes(ahead, doctors int, handleMinutes float64) int {
+	rounds := (ahead + doctors - 1) / doctors
+	return int(float64(rounds)*handleMinutes + 0.5)
+}
+
+// FillQueuePosition sets the position and estimated wait of a queued request
+func (r *ConsultationRequest) FillQueuePosition() error {
+	if r.Status != RequestQueued {
+		return nil
+	}
+
+	queue, err := queuedRequests(r.Specialty)
+	if err != nil {
+		return err
+	}
+
+	stats, err := GetQueueStats(r.Specialty)
+	if err != nil {
+		return err
+	}
+
+	for i, queued := range queue {
+		if queued.ID == r.ID {
+			r.Position = i + 1
+			break
+		}
+	}
+
+	if len(stats) > 0 && stats[0].ActiveDoctors > 0 && r.Position > 0 {
+		wait := waitMinutes(r.Position-1, stats[0].ActiveDoctors, stats[0].AverageHandleMinutes)
+		r.EstimatedWaitMinutes = &wait
+	}
+
+	return nil
+}
+
+// GetQueueStats returns the live queue of each specialty, or only of
+// specialty if it is not empty. Waits are estimated from how long doctors of
+// the specialty took on their recent requests and how many are active.
+func GetQueueStats(specialty string) ([]QueueStats, error) {
+	statsBySpecialty := map[string]*QueueStats{}
+	get := func(name string) *QueueStats {
+		s, ok := statsBySpecialty[name]
+		if !ok {
+			s = &QueueStats{Specialty: name, ByPriority: map[string]int{}, AverageHandleMinutes: DefaultHandleMinutes}
+			for p := range priorityRank {
+				s.ByPriority[p] = 0
+			}
+			statsBySpecialty[name] = s
+		}
+		return s
+	}
+
+	filter := ""
+	args := []interface{}{}
+	if specialty != "" {
+		filter = " AND specialty = " + getPlaceholder(1)
+		args = append(args, specialty)
+		get(specialty)
+	}
+
+	// Queue lengths by priority
+	rows, err := database.DB.Query(
+		"SELECT specialty, priority, COUNT(*) FROM consultation_requests WHERE status = '"+RequestQueued+"'"+filter+
+			" GROUP BY specialty, priority", args...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var name, priority string
+		var count int
+		if err := rows.Scan(&name, &priority, &count); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		s := get(name)
+		s.ByPriority[priority] += count
+		s.Length += count
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Doctors able to take requests
+	rows, err = database.DB.Query(
+		"SELECT specialty, COUNT(*) FROM doctors WHERE status = 'active'"+filter+" GROUP BY specialty", args...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var name string
+		var count int
+		if err := rows.Scan(&name, &count); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		get(name).ActiveDoctors = count
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Average handling time over the last 50 completed requests per specialty
+	rows, err = database.DB.Query(
+		"SELECT specialty, claimed_at, completed_at FROM consultation_requests WHERE status = '"+RequestCompleted+"'"+
+			" AND claimed_at IS NOT NULL AND completed_at IS NOT NULL"+filter+" ORDER BY completed_at DESC LIMIT 1000", args...)
+	if err != nil {
+		return nil, err
+	}
+	totals := map[string]time.Duration{}
+	counts := map[string]int{}
+	for rows.Next() {
+		var name string
+		var claimedAt, completedAt time.Time
+		if err := rows.Scan(&name, &claimedAt, &completedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if counts[name] >= 50 {
+			continue
+		}
+		totals[name] += completedAt.Sub(claimedAt)
+		counts[name]++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for name, count := range counts {
+		if s, ok := statsBySpecialty[name]; ok && count > 0 {
+			minutes := totals[name].Minutes() / float64(count)
+			if minutes < 1 {
+				minutes = 1
+			}
+			s.AverageHandleMinutes = float64(int(minutes*10+0.5)) / 10
+		}
+	}
+
+	stats := make([]QueueStats, 0, len(statsBySpecialty))
+	for _, s := range statsBySpecialty {
+		if s.ActiveDoctors > 0 {
+			// A new request waits behind everything of equal or higher priority
+			s.EstimatedWaitMinutes = map[string]int{}
+			for p, rank := range priorityRank {
+				ahead := 0
+				for q, count := range s.ByPriority {
+					if priorityRank[q] >= rank {
+						ahead += count
+					}
+				}
+				s.EstimatedWaitMinutes[p] = waitMinutes(ahead, s.ActiveDoctors, s.AverageHandleMinutes)
+			}
+		}
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Specialty < stats[j].Specialty })
+
+	return stats, nil
+}
@@ -1,7 +1,7 @@
 package models
 
 import (
-	"errors"
+	"database/sql"
 	"fmt"
 	"html"
 	"strings"
@@ -31,39 +31,86 @@ type Doctor struct {
 	ConsultationPrice int       `json:"consultation_price"`
 	PatientCount      int       `json:"patient_count"`
 	AppointmentCount  int       `json:"appointment_count"`
+	Version           int       `json:"version"` // incremented by every update
 	CreatedAt         time.Time `json:"created_at"`
 	UpdatedAt         time.Time `json:"updated_at"`
 }
 
 // DoctorRequest represents the request structure for creating/updating a doctor
 type DoctorRequest struct {
-	Name              string `json:"name"`
-	Email             string `json:"email"`
-	Phone             string `json:"phone"`
-	Specialty         string `json:"specialty"`
+	Name              string `json:"name" binding:"required,max=255"`
+	Email             string `json:"email" binding:"required,email,max=255"`
+	Phone             string `json:"phone" binding:"required,vnphone"`
+	Specialty         string `json:"specialty" binding:"required,max=255"`
 	Experience        string `json:"experience"`
 	Education         string `json:"education"`
 	Bio               string `json:"bio"`
 	Avatar            string `json:"avatar"`
-	LicenseNumber     string `json:"license_number"`
+	LicenseNumber     string `json:"license_number" binding:"required,vnlicense"`
 	Address           string `json:"address"`
-	DateOfBirth       string `json:"date_of_birth"`
-	Gender            string `json:"gender"`
-	Status            string `json:"status"`
+	DateOfBirth       string `json:"date_of_birth" binding:"omitempty,datetime=2006-01-02"`
+	Gender            string `json:"gender" binding:"omitempty,oneof=Nam Nữ Khác"`
+	Status            string `json:"status" binding:"omitempty,oneof=active on_leave inactive"`
 	Certifications    string `json:"certifications"`
 	WorkingHours      string `json:"working_hours"`
-	ConsultationPrice int    `json:"consultation_price"`
+	ConsultationPrice int    `json:"consultation_price" binding:"gte=0"`
+	Version           int    `json:"version,omitempty"` // version the change is based on, if not given in If-Match
 }
 
 // DoctorFilter represents filters for searching doctors
 type DoctorFilter struct {
-	Search    string `json:"search"`
-	Specialty string `json:"specialty"`
-	Status    string `json:"status"`
-	Limit     int    `json:"limit"`
-	Offset    int    `json:"offset"`
-	SortBy    string `json:"sort_by"`
-	SortOrder string `json:"sort_order"`
+	Search    string  `json:"search"`
+	Specialty string  `json:"specialty"`
+	Status    string  `json:"status"`
+	Limit     int     `json:"limit"`
+	Offset    int     `json:"offset"`
+	SortBy    string  `json:"sort_by"`
+	SortOrder string  `json:"sort_order"`
+	Keyset    *Keyset `json:"-"` // pages by ID instead of Offset when set
+}
+
+// Apply copies the request onto the doctor
+func (r DoctorRequest) Apply(d *Doctor) {
+	d.Name = r.Name
+	d.Email = r.Email
+	d.Phone = r.Phone
+	d.Specialty = r.Specialty
+	d.Experience = r.Experience
+	d.Education = r.Education
+	d.Bio = r.Bio
+	d.Avatar = r.Avatar
+	d.LicenseNumber = r.LicenseNumber
+	d.Address = r.Address
+	d.DateOfBirth = r.DateOfBirth
+	d.Gender = r.Gender
+	d.Status = r.Status
+	d.Certifications = r.Certifications
+	d.WorkingHours = r.WorkingHours
+	d.ConsultationPrice = r.ConsultationPrice
+}
+
+// Request returns the doctor as the request that would store it unchanged,
+// undoing the escaping BeforeSave applies
+func (d *Doctor) Request() DoctorRequest {
+	return DoctorRequest{
+		Name:              html.UnescapeString(d.Name),
+		Email:             html.UnescapeString(d.Email),
+		Phone:             html.UnescapeString(d.Phone),
+		Specialty:         html.UnescapeString(d.Specialty),
+		Experience:        d.Experience,
+		Education:         d.Education,
+		Bio:               d.Bio,
+		Avatar:            d.Avatar,
+		LicenseNumber:     html.UnescapeString(d.LicenseNumber),
+		Address:           d.Address,
+		DateOfBirth:       d.DateOfBirth,
+		Gender:            d.Gender,
+		Status:            d.Status,
+		Certifications:    d.Certifications,
+		WorkingHours:      d.WorkingHours,
+		ConsultationPrice: d.ConsultationPrice,
+		Version:           d.Version,
+	}
 }
 
 // BeforeSave is a hook that gets called before saving the doctor
@@ -86,22 +133,25 @@ func (d *Doctor) BeforeSave() error {
 // Validate validates the doctor data
 func (d *Doctor) Validate() error {
 	if d.Name == "" {
-		return errors.New("name is required")
+		return requiredError("name", "name is required")
 	}
 	if d.Email == "" {
-		return errors.New("email is required")
+		return requiredError("email", "email is required")
 	}
 	if d.Phone == "" {
-		return errors.New("phone is required")
+		return requiredError("phone", "phone is required")
 	}
 	if d.Specialty == "" {
-		return errors.New("specialty is required")
+		return requiredError("specialty", "specialty is required")
 	}
 	if d.LicenseNumber == "" {
-		return errors.New("license number is required")
+		return requiredError("license_number", "license number is required")
 	}
 
 	// Validate status
+	if d.Status == "" {
+		d.Status = "active"
+	}
 	validStatuses := []string{"active", "on_leave", "inactive"}
 	isValidStatus := false
 	for _, status := range validStatuses {
@@ -111,7 +161,7 @@ func (d *Doctor) Validate() error {
 		}
 	}
 	if !isValidStatus {
-		return errors.New("status must be one of: active, on_leave, inactive")
+		return oneOfError("status", "active on_leave inactive", "status must be one of: active, on_leave, inactive")
 	}
 
 	return nil
@@ -120,7 +170,7 @@ func (d *Doctor) Validate() error {
 // Create creates a new doctor in the database
 func (d *Doctor) Create() error {
 	if err := d.Validate(); err != nil {
-		return err
+		return validationError(err)
 	}
 	if err := d.BeforeSave(); err != nil {
 		return err
@@ -154,8 +204,8 @@ func (d *Doctor) Create() error {
 		d.ID = int(id)
 
 		// Get the created timestamps
-		selectQuery := `SELECT created_at, updated_at FROM doctors WHERE id = ?`
-		err = database.DB.QueryRow(selectQuery, d.ID).Scan(&d.CreatedAt, &d.UpdatedAt)
+		selectQuery := `SELECT version, created_at, updated_at FROM doctors WHERE id = ?`
+		err = database.DB.QueryRow(selectQuery, d.ID).Scan(&d.Version, &d.CreatedAt, &d.UpdatedAt)
 		if err != nil {
 			return err
 		}
@@ -166,7 +216,7 @@ func (d *Doctor) Create() error {
 				license_number, address, date_of_birth, gender, status, certifications,
 				working_hours, consultation_price
 			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
-			RETURNING id, created_at, updated_at
+			RETURNING id, version, created_at, updated_at
 		`
 
 		err := database.DB.QueryRow(
@@ -174,7 +224,7 @@ func (d *Doctor) Create() error {
 			d.Name, d.Email, d.Phone, d.Specialty, d.Experience, d.Education,
 			d.Bio, d.Avatar, d.LicenseNumber, d.Address, d.DateOfBirth,
 			d.Gender, d.Status, d.Certifications, d.WorkingHours, d.ConsultationPrice,
-		).Scan(&d.ID, &d.CreatedAt, &d.UpdatedAt)
+		).Scan(&d.ID, &d.Version, &d.CreatedAt, &d.UpdatedAt)
 
 		if err != nil {
 			return err
@@ -184,52 +234,47 @@ func (d *Doctor) Create() error {
 	return nil
 }
 
-// GetAll retrieves doctors with filtering
-func GetAllDoctors(filter DoctorFilter) ([]Doctor, error) {
-	var doctors []Doctor
-	dbType := getEnv("DB_TYPE", "postgres")
-
-	// Build query
-	query := "SELECT id, name, email, phone, specialty, experience, education, bio, avatar, license_number, address, date_of_birth, gender, status, certifications, working_hours, consultation_price, patient_count, appointment_count, created_at, updated_at FROM doctors WHERE 1=1"
+// doctorFilterClause builds the WHERE conditions shared by GetAllDoctors and
+// CountDoctors
+func doctorFilterClause(filter DoctorFilter) (string, []interface{}) {
+	where := " WHERE 1=1"
 	args := []interface{}{}
-	argIndex := 1
 
-	// Add filters
 	if filter.Search != "" {
-		if dbType == "sqlite" {
-			query += " AND (name LIKE ? OR specialty LIKE ? OR email LIKE ?)"
-			searchTerm := "%" + filter.Search + "%"
-			args = append(args, searchTerm, searchTerm, searchTerm)
-		} else {
-			query += fmt.Sprintf(" AND (name ILIKE $%d OR specialty ILIKE $%d OR email ILIKE $%d)", argIndex, argIndex+1, argIndex+2)
-			searchTerm := "%" + filter.Search + "%"
-			args = append(args, searchTerm, searchTerm, searchTerm)
-			argIndex += 3
+		like := "LIKE"
+		if getEnv("DB_TYPE", "postgres") != "sqlite" {
+			like = "ILIKE"
 		}
+		searchTerm := "%" + filter.Search + "%"
+		args = append(args, searchTerm, searchTerm, searchTerm)
+		where += fmt.Sprintf(" AND (name %s %s OR specialty %s %s OR email %s %s)",
+			like, getPlaceholder(len(args)-2), like, getPlaceholder(len(args)-1), like, getPlaceholder(len(args)))
 	}
 
 	if filter.Specialty != "" {
-		if dbType == "sqlite" {
-			query += " AND specialty = ?"
-		} else {
-			query += fmt.Sprintf(" AND specialty = $%d", argIndex)
-			argIndex++
-		}
 		args = append(args, filter.Specialty)
+		where += " AND specialty = " + getPlaceholder(len(args))
 	}
 
 	if filter.Status != "" {
-		if dbType == "sqlite" {
-			query += " AND status = ?"
-		} else {
-			query += fmt.Sprintf(" AND status = $%d", argIndex)
-			argIndex++
-		}
 		args = append(args, filter.Status)
+		where += " AND status = " + getPlaceholder(len(args))
 	}
 
-	// Add ordering
-	if filter.SortBy != "" {
+	return where, args
+}
+
+// GetAllDoctors retrieves a page of doctors matching the filter
+func GetAllDoctors(filter DoctorFilter) ([]Doctor, error) {
+	doctors := []Doctor{}
+
+	where, args := doctorFilterClause(filter)
+	query := "SELECT id, name, email, phone, specialty, experience, education, bio, avatar, license_number, address, date_of_birth, gender, status, certifications, working_hours, consultation_price, patient_count, appointment_count, version, created_at, updated_at FROM doctors" + where
+
+	// Add ordering; keyset pages are ordered by ID
+	if filter.Keyset != nil {
+		query += filter.Keyset.clause("id", &args)
+	} else if filter.SortBy != "" {
 		validSortFields := []string{"name", "specialty", "created_at", "patient_count", "appointment_count"}
 		for _, field := range validSortFields {
 			if filter.SortBy == field {
@@ -237,32 +282,21 @@ func GetAllDoctors(filter DoctorFilter) ([]Doctor, error) {
 				if filter.SortOrder == "desc" {
 					sortOrder = "DESC"
 				}
-				query += fmt.Sprintf(" ORDER BY %s %s", field, sortOrder)
+				query += fmt.Sprintf(" ORDER BY %s %s, id %s", field, sortOrder, sortOrder)
 				break
 			}
 		}
 	} else {
-		query += " ORDER BY created_at DESC"
+		query += " ORDER BY created_at DESC, id DESC"
 	}
 
 	// Add pagination
 	if filter.Limit > 0 {
-		if dbType == "sqlite" {
-			query += " LIMIT ?"
-			if filter.Offset > 0 {
-				query += " OFFSET ?"
-				args = append(args, filter.Limit, filter.Offset)
-			} else {
-				args = append(args, filter.Limit)
-			}
-		} else {
-			query += fmt.Sprintf(" LIMIT $%d", argIndex)
-			args = append(args, filter.Limit)
-			argIndex++
-			if filter.Offset > 0 {
-				query += fmt.Sprintf(" OFFSET $%d", argIndex)
-				args = append(args, filter.Offset)
-			}
+		args = append(args, filter.Limit)
+		query += " LIMIT " + getPlaceholder(len(args))
+		if filter.Offset > 0 && filter.Keyset == nil {
+			args = append(args, filter.Offset)
+			query += " OFFSET " + getPlaceholder(len(args))
 		}
 	}
 
@@ -280,7 +314,7 @@ func GetAllDoctors(filter DoctorFilter) ([]Doctor, error) {
 			&doctor.LicenseNumber, &doctor.Address, &doctor.DateOfBirth, &doctor.Gender,
 			&doctor.Status, &doctor.Certifications, &doctor.WorkingHours,
 			&doctor.ConsultationPrice, &doctor.PatientCount, &doctor.AppointmentCount,
-			&doctor.CreatedAt, &doctor.UpdatedAt,
+			&doctor.Version, &doctor.CreatedAt, &doctor.UpdatedAt,
 		)
 		if err != nil {
 			return nil, err
@@ -288,7 +322,15 @@ func GetAllDoctors(filter DoctorFilter) ([]Doctor, error) {
 		doctors = append(doctors, doctor)
 	}
 
-	return doctors, nil
+	return doctors, rows.Err()
+}
+
+// CountDoctors counts all doctors matching the filter, ignoring paging
+func CountDoctors(filter DoctorFilter) (int, error) {
+	where, args := doctorFilterClause(filter)
+	var count int
+	err := database.DB.QueryRow("SELECT COUNT(*) FROM doctors"+where, args...).Scan(&count)
+	return count, err
 }
 
 // GetByID retrieves a doctor by ID
@@ -302,7 +344,7 @@ func GetDoctorByID(id int) (*Doctor, error) {
 			SELECT id, name, email, phone, specialty, experience, education, bio, avatar,
 			license_number, address, date_of_birth, gender, status, certifications,
 			working_hours, consultation_price, patient_count, appointment_count,
-			created_at, updated_at
+			version, created_at, updated_at
 			FROM doctors WHERE id = ?
 		`
 	} else {
@@ -310,7 +352,7 @@ func GetDoctorByID(id int) (*Doctor, error) {
 			SELECT id, name, email, phone, specialty, experience, education, bio, avatar,
 			license_number, address, date_of_birth, gender, status, certifications,
 			working_hours, consultation_price, patient_count, appointment_count,
-			created_at, updated_at
+			version, created_at, updated_at
 			FROM doctors WHERE id = $1
 		`
 	}
@@ -321,7 +363,7 @@ func GetDoctorByID(id int) (*Doctor, error) {
 		&doctor.LicenseNumber, &doctor.Address, &doctor.DateOfBirth, &doctor.Gender,
 		&doctor.Status, &doctor.Certifications, &doctor.WorkingHours,
 		&doctor.ConsultationPrice, &doctor.PatientCount, &doctor.AppointmentCount,
-		&doctor.CreatedAt, &doctor.UpdatedAt,
+		&doctor.Version, &doctor.CreatedAt, &doctor.UpdatedAt,
 	)
 
 	if err != nil {
@@ -331,10 +373,11 @@ func GetDoctorByID(id int) (*Doctor, error) {
 	return doctor, nil
 }
 
-// Update updates a doctor in the database
+// Update updates a doctor in the database if it is still at d.Version,
+// returning ErrVersionConflict otherwise, and increments the version
 func (d *Doctor) Update() error {
 	if err := d.Validate(); err != nil {
-		return err
+		return validationError(err)
 	}
 	if err := d.BeforeSave(); err != nil {
 		return err
@@ -348,23 +391,29 @@ func (d *Doctor) Update() error {
 				name = ?, email = ?, phone = ?, specialty = ?, experience = ?,
 				education = ?, bio = ?, avatar = ?, license_number = ?, address = ?,
 				date_of_birth = ?, gender = ?, status = ?, certifications = ?,
-				working_hours = ?, consultation_price = ?, updated_at = CURRENT_TIMESTAMP
-			WHERE id = ?
+				working_hours = ?, consultation_price = ?, version = version + 1,
+				updated_at = CURRENT_TIMESTAMP
+			WHERE id = ? AND version = ?
 		`
 
-		_, err := database.DB.Exec(query,
+		result, err := database.DB.Exec(query,
 			d.Name, d.Email, d.Phone, d.Specialty, d.Experience, d.Education,
 			d.Bio, d.Avatar, d.LicenseNumber, d.Address, d.DateOfBirth,
 			d.Gender, d.Status, d.Certifications, d.WorkingHours,
-			d.ConsultationPrice, d.ID,
+			d.ConsultationPrice, d.ID, d.Version,
 		)
 		if err != nil {
 			return err
 		}
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrVersionConflict
+		}
 
 		// Get the updated timestamp
-		selectQuery := `SELECT updated_at FROM doctors WHERE id = ?`
-		err = database.DB.QueryRow(selectQuery, d.ID).Scan(&d.UpdatedAt)
+		selectQuery := `SELECT version, updated_at FROM doctors WHERE id = ?`
+		err = database.DB.QueryRow(selectQuery, d.ID).Scan(&d.Version, &d.UpdatedAt)
 		return err
 	} else {
 		query := `
@@ -372,17 +421,21 @@ func (d *Doctor) Update() error {
 				name = $1, email = $2, phone = $3, specialty = $4, experience = $5,
 				education = $6, bio = $7, avatar = $8, license_number = $9, address = $10,
 				date_of_birth = $11, gender = $12, status = $13, certifications = $14,
-				working_hours = $15, consultation_price = $16, updated_at = NOW()
-			WHERE id = $17
-			RETURNING updated_at
+				working_hours = $15, consultation_price = $16, version = version + 1,
+				updated_at = NOW()
+			WHERE id = $17 AND version = $18
+			RETURNING version, updated_at
 		`
 
 		err := database.DB.QueryRow(query,
 			d.Name, d.Email, d.Phone, d.Specialty, d.Experience, d.Education,
 			d.Bio, d.Avatar, d.LicenseNumber, d.Address, d.DateOfBirth,
 			d.Gender, d.Status, d.Certifications, d.WorkingHours,
-			d.ConsultationPrice, d.ID,
-		).Scan(&d.UpdatedAt)
+			d.ConsultationPrice, d.ID, d.Version,
+		).Scan(&d.Version, &d.UpdatedAt)
+		if err == sql.ErrNoRows {
+			return ErrVersionConflict
+		}
 
 		return err
 	}
@@ -431,3 +484,31 @@ func GetDoctorSpecialties() ([]string, error) {
 
 	return specialties, nil
 }
+
+// GetDoctorByEmail retrieves a doctor by email. Doctor profiles are linked to
+// user accounts through their email address.
+func GetDoctorByEmail(email string) (*Doctor, error) {
+	doctor := &Doctor{}
+
+	query := `
+		SELECT id, name, email, phone, specialty, experience, education, bio, avatar,
+		license_number, address, date_of_birth, gender, status, certifications,
+		working_hours, consultation_price, patient_count, appointment_count,
+		version, created_at, updated_at
+		FROM doctors WHERE email = ` + getPlaceholder(1)
+
+	err := database.DB.QueryRow(query, email).Scan(
+		&doctor.ID, &doctor.Name, &doctor.Email, &doctor.Phone, &doctor.Specialty,
+		&doctor.Experience, &doctor.Education, &doctor.Bio, &doctor.Avatar,
+		&doctor.LicenseNumber, &doctor.Address, &doctor.DateOfBirth, &doctor.Gender,
+		&doctor.Status, &doctor.Certifications, &doctor.WorkingHours,
+		&doctor.ConsultationPrice, &doctor.PatientCount, &doctor.AppointmentCount,
+		&doctor.Version, &doctor.CreatedAt, &doctor.UpdatedAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return doctor, nil
+}
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ErrVersionConflict is returned by Update when the record's version is no
+// longer the one it was read at, i.e. someone else changed it in between
+var ErrVersionConflict = errors.New("the record was changed by someone else")
+
+// ValidationError is returned by Create and Update when the data breaks a
+// model rule. Unlike database errors its message is safe to show to clients.
+type ValidationError struct {
+	Field   string // JSON name of the offending field, if there is one
+	Code    string // rule that failed, e.g. "required" or "oneof"
+	Param   string // rule parameter, e.g. the allowed values
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+// requiredError reports a missing field
+func requiredError(field, message string) error {
+	return &ValidationError{Field: field, Code: "required", Message: message}
+}
+
+// oneOfError reports a field outside its allowed values, given
+// space-separated like validator's oneof
+func oneOfError(field, values, message string) error {
+	return &ValidationError{Field: field, Code: "oneof", Param: values, Message: message}
+}
+
+// afterError reports a time field that must come after another
+func afterError(field, other, message string) error {
+	return &ValidationError{Field: field, Code: "gtfield", Param: other, Message: message}
+}
+
+// maxError reports a field longer or larger than max, like validator's max
+func maxError(field string, max int, message string) error {
+	return &ValidationError{Field: field, Code: "max", Param: strconv.Itoa(max), Message: message}
+}
+
+// uniqueError reports a value another record already has
+func uniqueError(field, message string) error {
+	return &ValidationError{Field: field, Code: "unique", Message: message}
+}
+
+// isUniqueViolation reports whether err is a unique constraint failure from
+// SQLite or PostgreSQL
+func isUniqueViolation(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "UNIQUE constraint failed") || strings.Contains(msg, "duplicate key value")
+}
+
+// validationError marks an error returned by Validate as a ValidationError,
+// keeping structured ones as they are
+func validationError(err error) error {
+	var ve *ValidationError
+	if errors.As(err, &ve) {
+		return err
+	}
+	return &ValidationError{Code: "invalid", Message: err.Error()}
+}
+
+// invalidError reports data that breaks a rule not tied to a single field;
+// code names the rule, e.g. "shift_started"
+func invalidError(code, message string) error {
+	return &ValidationError{Code: code, Message: message}
+}
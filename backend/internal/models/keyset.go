@@ -0,0 +1,25 @@
+package models
+
+// Keyset pages a list by ID instead of by offset: each page holds the rows
+// after the last ID of the previous one. Unlike offsets, rows inserted
+// between requests do not shift the pages, so nothing is skipped or repeated.
+type Keyset struct {
+	AfterID int  // last ID of the previous page; 0 for the first page
+	Desc    bool // newest first
+}
+
+// clause appends the keyset condition and ordering for column to a query
+// that already has a WHERE clause
+func (k *Keyset) clause(column string, args *[]interface{}) string {
+	op, order := ">", "ASC"
+	if k.Desc {
+		op, order = "<", "DESC"
+	}
+
+	sql := ""
+	if k.AfterID > 0 {
+		*args = append(*args, k.AfterID)
+		sql = " AND " + column + " " + op + " " + getPlaceholder(len(*args))
+	}
+	return sql + " ORDER BY " + column + " " + order
+}
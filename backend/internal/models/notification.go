@@ -0,0 +1,313 @@
+package models
+
+import (
+	"database/sql"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/dottrip/fpt-swp/internal/database"
+)
+
+// Notification categories
+const (
+	NotifyAppointment  = "appointment"
+	NotifyConsultation = "consultation"
+	NotifyMessage      = "message"
+	NotifySupport      = "support"
+	NotifySchedule     = "schedule"
+	NotifySystem       = "system"
+	NotifyMarketing    = "marketing"
+)
+
+// NotificationCategories lists the categories users can set preferences for
+var NotificationCategories = []string{
+	NotifyAppointment, NotifyConsultation, NotifyMessage, NotifySupport, NotifySchedule, NotifySystem, NotifyMarketing,
+}
+
+// Notification is an in-app notification for a user
+type Notification struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"user_id"`
+	Category  string     `json:"category"`
+	Title     string     `json:"title"`
+	Body      string     `json:"body"`
+	Link      string     `json:"link,omitempty"`
+	ReadAt    *time.Time `json:"read_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// NotificationFilter represents filters for listing a user's notifications
+type NotificationFilter struct {
+	Category   string
+	UnreadOnly bool
+	AfterID    int
+	Limit      int
+	Offset     int
+}
+
+// NotificationPreference holds the delivery channels a user wants for a category
+type NotificationPreference struct {
+	Category string `json:"category" binding:"required"`
+	InApp    bool   `json:"in_app"`
+	Email    bool   `json:"email"`
+	SMS      bool   `json:"sms"`
+}
+
+// defaultPreferences apply until a user changes a category. SMS is opt-in.
+var defaultPreferences = map[string]NotificationPreference{
+	NotifyAppointment:  {InApp: true, Email: true},
+	NotifyConsultation: {InApp: true, Email: true},
+	NotifyMessage:      {InApp: true},
+	NotifySupport:      {InApp: true, Email: true},
+	NotifySchedule:     {InApp: true, Email: true},
+	NotifySystem:       {InApp: true, Email: true},
+	NotifyMarketing:    {},
+}
+
+// IsValidNotificationCategory reports whether category is a known category
+func IsValidNotificationCategory(category string) bool {
+	_, ok := defaultPreferences[category]
+	return ok
+}
+
+// Create stores the notification
+func (n *Notification) Create() error {
+	if n.UserID == 0 {
+		return requiredError("user_id", "user ID is required")
+	}
+	if !IsValidNotificationCategory(n.Category) {
+		return oneOfError("category", strings.Join(NotificationCategories, " "), "invalid notification category")
+	}
+	// Titles often quote fields that were escaped when saved; unescape first
+	// so they are not escaped twice
+	n.Title = html.EscapeString(html.UnescapeString(strings.TrimSpace(n.Title)))
+	n.Body = html.EscapeString(html.UnescapeString(strings.TrimSpace(n.Body)))
+	if n.Title == "" {
+		return requiredError("title", "title is required")
+	}
+
+	n.CreatedAt = time.Now().UTC().Truncate(time.Second)
+
+	if getEnv("DB_TYPE", "postgres") == "sqlite" {
+		result, err := database.DB.Exec("INSERT INTO notifications (user_id, category, title, body, link, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+			n.UserID, n.Category, n.Title, n.Body, n.Link, n.CreatedAt)
+		if err != nil {
+			return err
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		n.ID = int(id)
+		return nil
+	}
+
+	return database.DB.QueryRow("INSERT INTO notifications (user_id, category, title, body, link, created_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id",
+		n.UserID, n.Category, n.Title, n.Body, n.Link, n.CreatedAt).Scan(&n.ID)
+}
+
+const notificationColumns = `id, user_id, category, title, body, link, read_at, created_at FROM notifications`
+
+func scanNotification(row interface{ Scan(...interface{}) error }) (*Notification, error) {
+	n := &Notification{}
+	var link sql.NullString
+	if err := row.Scan(&n.ID, &n.UserID, &n.Category, &n.Title, &n.Body, &link, &n.ReadAt, &n.CreatedAt); err != nil {
+		return nil, err
+	}
+	n.Link = link.String
+	return n, nil
+}
+
+// GetNotificationByID retrieves a notification
+func GetNotificationByID(id int) (*Notification, error) {
+	return scanNotification(database.DB.QueryRow("SELECT "+notificationColumns+" WHERE id = "+getPlaceholder(1), id))
+}
+
+// GetNotifications lists a user's notifications, newest first
+func GetNotifications(userID int, filter NotificationFilter) ([]Notification, error) {
+	notifications := []Notification{}
+
+	query := "SELECT " + notificationColumns + " WHERE user_id = " + getPlaceholder(1)
+	args := []interface{}{userID}
+
+	if filter.Category != "" {
+		args = append(args, filter.Category)
+		query += " AND category = " + getPlaceholder(len(args))
+	}
+	if filter.UnreadOnly {
+		query += " AND read_at IS NULL"
+	}
+	if filter.AfterID > 0 {
+		args = append(args, filter.AfterID)
+		query += " AND id > " + getPlaceholder(len(args))
+	}
+
+	query += " ORDER BY id DESC"
+
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += " LIMIT " + getPlaceholder(len(args))
+		if filter.Offset > 0 {
+			args = append(args, filter.Offset)
+			query += " OFFSET " + getPlaceholder(len(args))
+		}
+	}
+
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		n, err := scanNotification(rows)
+		if err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, *n)
+	}
+
+	return notifications, rows.Err()
+}
+
+// CountUnreadNotifications returns the number of unread notifications of a
+// user, in total and per category
+func CountUnreadNotifications(userID int) (int, map[string]int, error) {
+	byCategory := make(map[string]int)
+
+	rows, err := database.DB.Query("SELECT category, COUNT(*) FROM notifications WHERE user_id = "+getPlaceholder(1)+
+		" AND read_at IS NULL GROUP BY category", userID)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer rows.Close()
+
+	total := 0
+	for rows.Next() {
+		var category string
+		var count int
+		if err := rows.Scan(&category, &count); err != nil {
+			return 0, nil, err
+		}
+		byCategory[category] = count
+		total += count
+	}
+
+	return total, byCategory, rows.Err()
+}
+
+// MarkNotificationRead marks one notification of a user as read. It returns
+// sql.ErrNoRows if the notification does not belong to the user.
+func MarkNotificationRead(userID, id int) error {
+	result, err := database.DB.Exec("UPDATE notifications SET read_at = COALESCE(read_at, "+getPlaceholder(1)+
+		") WHERE id = "+getPlaceholder(2)+" AND user_id = "+getPlaceholder(3), time.Now().UTC().Truncate(time.Second), id, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// MarkAllNotificationsRead marks every unread notification of a user as
+// read, optionally only in one category. It returns the number marked.
+func MarkAllNotificationsRead(userID int, category string) (int64, error) {
+	query := "UPDATE notifications SET read_at = " + getPlaceholder(1) + " WHERE user_id = " + getPlaceholder(2) + " AND read_at IS NULL"
+	args := []interface{}{time.Now().UTC().Truncate(time.Second), userID}
+
+	if category != "" {
+		args = append(args, category)
+		query += " AND category = " + getPlaceholder(len(args))
+	}
+
+	result, err := database.DB.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// GetNotificationPreferences returns a user's preferences for every
+// category, with defaults for categories the user never changed
+func GetNotificationPreferences(userID int) ([]NotificationPreference, error) {
+	stored := make(map[string]NotificationPreference)
+
+	rows, err := database.DB.Query("SELECT category, in_app, email, sms FROM notification_preferences WHERE user_id = "+getPlaceholder(1), userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p NotificationPreference
+		if err := rows.Scan(&p.Category, &p.InApp, &p.Email, &p.SMS); err != nil {
+			return nil, err
+		}
+		stored[p.Category] = p
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	preferences := make([]NotificationPreference, 0, len(NotificationCategories))
+	for _, category := range NotificationCategories {
+		p, ok := stored[category]
+		if !ok {
+			p = defaultPreferences[category]
+			p.Category = category
+		}
+		preferences = append(preferences, p)
+	}
+	return preferences, nil
+}
+
+// GetNotificationPreference returns a user's preference for one category
+func GetNotificationPreference(userID int, category string) (NotificationPreference, error) {
+	preferences, err := GetNotificationPreferences(userID)
+	if err != nil {
+		return NotificationPreference{}, err
+	}
+	for _, p := range preferences {
+		if p.Category == category {
+			return p, nil
+		}
+	}
+	return NotificationPreference{}, oneOfError("category", strings.Join(NotificationCategories, " "), "invalid notification category")
+}
+
+// SaveNotificationPreferences stores the given category preferences of a
+// user. System notifications always stay in-app.
+func SaveNotificationPreferences(userID int, preferences []NotificationPreference) error {
+	for i := range preferences {
+		if !IsValidNotificationCategory(preferences[i].Category) {
+			return oneOfError("category", strings.Join(NotificationCategories, " "), "category must be one of: "+strings.Join(NotificationCategories, ", "))
+		}
+		if preferences[i].Category == NotifySystem {
+			preferences[i].InApp = true
+		}
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := "INSERT INTO notification_preferences (user_id, category, in_app, email, sms, updated_at) VALUES (" +
+		getPlaceholder(1) + ", " + getPlaceholder(2) + ", " + getPlaceholder(3) + ", " + getPlaceholder(4) + ", " +
+		getPlaceholder(5) + ", " + getPlaceholder(6) + ") ON CONFLICT (user_id, category) DO UPDATE SET " +
+		"in_app = excluded.in_app, email = excluded.email, sms = excluded.sms, updated_at = excluded.updated_at"
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, p := range preferences {
+		if _, err := tx.Exec(query, userID, p.Category, p.InApp, p.Email, p.SMS, now); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
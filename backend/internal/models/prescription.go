@@ -0,0 +1,358 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/dottrip/fpt-swp/internal/database"
+)
+
+// PatientInfo holds the patient details printed on clinical documents.
+// It is stored as a snapshot so that documents stay valid even if the
+// patient later edits their profile.
+type PatientInfo struct {
+	PatientID          *int   `json:"patient_id,omitempty"`
+	PatientName        string `json:"patient_name" binding:"required,max=255"`
+	PatientDateOfBirth string `json:"patient_date_of_birth" binding:"omitempty,datetime=2006-01-02"`
+	PatientGender      string `json:"patient_gender" binding:"omitempty,oneof=Nam Nữ Khác"`
+	PatientPhone       string `json:"patient_phone" binding:"omitempty,vnphone"`
+	PatientAddress     string `json:"patient_address"`
+}
+
+// PrescriptionItem represents a single drug line on a prescription
+type PrescriptionItem struct {
+	ID             int    `json:"id"`
+	PrescriptionID int    `json:"prescription_id"`
+	DrugName       string `json:"drug_name"`
+	Dosage         string `json:"dosage"`
+	Frequency      string `json:"frequency"`
+	Duration       string `json:"duration"`
+	Quantity       int    `json:"quantity"`
+	Unit           string `json:"unit"`
+	Instructions   string `json:"instructions"`
+}
+
+// Prescription represents a prescription issued by a doctor
+type Prescription struct {
+	ID       int    `json:"id"`
+	Code     string `json:"code"` // public verification code
+	DoctorID int    `json:"doctor_id"`
+	PatientInfo
+	Diagnosis string             `json:"diagnosis"`
+	Notes     string             `json:"notes"`
+	Status    string             `json:"status"` // draft, active, completed, cancelled
+	NextVisit string             `json:"next_visit"`
+	Items     []PrescriptionItem `json:"items"`
+	CreatedAt time.Time          `json:"created_at"`
+	UpdatedAt time.Time          `json:"updated_at"`
+}
+
+// PrescriptionRequest represents the request structure for creating a prescription
+type PrescriptionRequest struct {
+	DoctorID int `json:"doctor_id" binding:"required"`
+	PatientInfo
+	Diagnosis string                  `json:"diagnosis"`
+	Notes     string                  `json:"notes"`
+	Status    string                  `json:"status" binding:"omitempty,oneof=draft active completed cancelled"`
+	NextVisit string                  `json:"next_visit"`
+	Items     []PrescriptionItemInput `json:"items" binding:"required,min=1,dive"`
+}
+
+// PrescriptionItemInput is a drug line in a PrescriptionRequest
+type PrescriptionItemInput struct {
+	DrugName     string `json:"drug_name" binding:"required,max=255"`
+	Dosage       string `json:"dosage"`
+	Frequency    string `json:"frequency"`
+	Duration     string `json:"duration"`
+	Quantity     int    `json:"quantity" binding:"gte=0"`
+	Unit         string `json:"unit"`
+	Instructions string `json:"instructions"`
+}
+
+// Item converts the input to a prescription item
+func (in PrescriptionItemInput) Item() PrescriptionItem {
+	return PrescriptionItem{
+		DrugName:     in.DrugName,
+		Dosage:       in.Dosage,
+		Frequency:    in.Frequency,
+		Duration:     in.Duration,
+		Quantity:     in.Quantity,
+		Unit:         in.Unit,
+		Instructions: in.Instructions,
+	}
+}
+
+// generateVerificationCode returns a random code used in public verification links
+func generateVerificationCode() (string, error) {
+	buf := make([]byte, 10)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return strings.ToUpper(hex.EncodeToString(buf)), nil
+}
+
+// sanitize trims and escapes the patient fields
+func (p *PatientInfo) sanitize() {
+	p.PatientName = html.EscapeString(strings.TrimSpace(p.PatientName))
+	p.PatientDateOfBirth = strings.TrimSpace(p.PatientDateOfBirth)
+	p.PatientGender = strings.TrimSpace(p.PatientGender)
+	p.PatientPhone = html.EscapeString(strings.TrimSpace(p.PatientPhone))
+	p.PatientAddress = html.EscapeString(strings.TrimSpace(p.PatientAddress))
+}
+
+// BeforeSave sanitizes prescription data before saving
+func (p *Prescription) BeforeSave() error {
+	p.PatientInfo.sanitize()
+	p.Diagnosis = html.EscapeString(strings.TrimSpace(p.Diagnosis))
+	p.Notes = html.EscapeString(strings.TrimSpace(p.Notes))
+
+	for i := range p.Items {
+		item := &p.Items[i]
+		item.DrugName = html.EscapeString(strings.TrimSpace(item.DrugName))
+		item.Dosage = html.EscapeString(strings.TrimSpace(item.Dosage))
+		item.Frequency = html.EscapeString(strings.TrimSpace(item.Frequency))
+		item.Duration = html.EscapeString(strings.TrimSpace(item.Duration))
+		item.Unit = html.EscapeString(strings.TrimSpace(item.Unit))
+		item.Instructions = html.EscapeString(strings.TrimSpace(item.Instructions))
+	}
+
+	if p.Status == "" {
+		p.Status = "active"
+	}
+
+	return nil
+}
+
+// Validate validates the prescription data
+func (p *Prescription) Validate() error {
+	if p.DoctorID == 0 {
+		return requiredError("doctor_id", "doctor ID is required")
+	}
+	if strings.TrimSpace(p.PatientName) == "" {
+		return requiredError("patient_name", "patient name is required")
+	}
+	if len(p.Items) == 0 {
+		return requiredError("items", "at least one drug is required")
+	}
+	for i, item := range p.Items {
+		if strings.TrimSpace(item.DrugName) == "" {
+			return requiredError(fmt.Sprintf("items[%d].drug_name", i), "drug name is required")
+		}
+		if item.Quantity < 0 {
+			return &ValidationError{Field: fmt.Sprintf("items[%d].quantity", i), Code: "gte", Param: "0", Message: "drug quantity cannot be negative"}
+		}
+	}
+
+	switch p.Status {
+	case "", "draft", "active", "completed", "cancelled":
+	default:
+		return oneOfError("status", "draft active completed cancelled", "status must be one of: draft, active, completed, cancelled")
+	}
+
+	return nil
+}
+
+// Create creates a new prescription together with its items
+func (p *Prescription) Create() error {
+	if err := p.Validate(); err != nil {
+		return validationError(err)
+	}
+	if err := p.BeforeSave(); err != nil {
+		return err
+	}
+
+	code, err := generateVerificationCode()
+	if err != nil {
+		return err
+	}
+	p.Code = code
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	dbType := getEnv("DB_TYPE", "postgres")
+
+	if dbType == "sqlite" {
+		query := `
+			INSERT INTO prescriptions (
+				code, doctor_id, patient_id, patient_name, patient_date_of_birth, patient_gender,
+				patient_phone, patient_address, diagnosis, notes, status, next_visit,
+				created_at, updated_at
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		`
+
+		result, err := tx.Exec(query,
+			p.Code, p.DoctorID, p.PatientID, p.PatientName, p.PatientDateOfBirth, p.PatientGender,
+			p.PatientPhone, p.PatientAddress, p.Diagnosis, p.Notes, p.Status, p.NextVisit,
+		)
+		if err != nil {
+			return err
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		p.ID = int(id)
+
+		selectQuery := `SELECT created_at, updated_at FROM prescriptions WHERE id = ?`
+		if err := tx.QueryRow(selectQuery, p.ID).Scan(&p.CreatedAt, &p.UpdatedAt); err != nil {
+			return err
+		}
+	} else {
+		query := `
+			INSERT INTO prescriptions (
+				code, doctor_id, patient_id, patient_name, patient_date_of_birth, patient_gender,
+				patient_phone, patient_address, diagnosis, notes, status, next_visit
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+			RETURNING id, created_at, updated_at
+		`
+
+		err := tx.QueryRow(query,
+			p.Code, p.DoctorID, p.PatientID, p.PatientName, p.PatientDateOfBirth, p.PatientGender,
+			p.PatientPhone, p.PatientAddress, p.Diagnosis, p.Notes, p.Status, p.NextVisit,
+		).Scan(&p.ID, &p.CreatedAt, &p.UpdatedAt)
+		if err != nil {
+			return err
+		}
+	}
+
+	var itemQuery string
+	if dbType == "sqlite" {
+		itemQuery = `
+			INSERT INTO prescription_items (
+				prescription_id, drug_name, dosage, frequency, duration, quantity, unit, instructions
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`
+	} else {
+		itemQuery = `
+			INSERT INTO prescription_items (
+				prescription_id, drug_name, dosage, frequency, duration, quantity, unit, instructions
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		`
+	}
+
+	for i := range p.Items {
+		item := &p.Items[i]
+		item.PrescriptionID = p.ID
+		result, err := tx.Exec(itemQuery,
+			item.PrescriptionID, item.DrugName, item.Dosage, item.Frequency,
+			item.Duration, item.Quantity, item.Unit, item.Instructions,
+		)
+		if err != nil {
+			return err
+		}
+		if dbType == "sqlite" {
+			if id, err := result.LastInsertId(); err == nil {
+				item.ID = int(id)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// PostgreSQL does not report LastInsertId, so reload the item IDs
+	if dbType != "sqlite" {
+		items, err := GetPrescriptionItems(p.ID)
+		if err != nil {
+			return err
+		}
+		p.Items = items
+	}
+
+	return nil
+}
+
+const prescriptionColumns = `
+	id, code, doctor_id, patient_id, patient_name, patient_date_of_birth, patient_gender,
+	patient_phone, patient_address, diagnosis, notes, status, next_visit, created_at, updated_at
+`
+
+// scanPrescription scans a prescription row selected with prescriptionColumns
+func scanPrescription(row interface{ Scan(...interface{}) error }) (*Prescription, error) {
+	p := &Prescription{}
+	err := row.Scan(
+		&p.ID, &p.Code, &p.DoctorID, &p.PatientID, &p.PatientName, &p.PatientDateOfBirth, &p.PatientGender,
+		&p.PatientPhone, &p.PatientAddress, &p.Diagnosis, &p.Notes, &p.Status, &p.NextVisit,
+		&p.CreatedAt, &p.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// GetPrescriptionByID retrieves a prescription and its items by ID
+func GetPrescriptionByID(id int) (*Prescription, error) {
+	query := "SELECT " + prescriptionColumns + " FROM prescriptions WHERE id = " + getPlaceholder(1)
+
+	p, err := scanPrescription(database.DB.QueryRow(query, id))
+	if err != nil {
+		return nil, err
+	}
+
+	p.Items, err = GetPrescriptionItems(p.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// GetPrescriptionByCode retrieves a prescription by its verification code
+func GetPrescriptionByCode(code string) (*Prescription, error) {
+	query := "SELECT " + prescriptionColumns + " FROM prescriptions WHERE code = " + getPlaceholder(1)
+
+	p, err := scanPrescription(database.DB.QueryRow(query, strings.ToUpper(code)))
+	if err != nil {
+		return nil, err
+	}
+
+	p.Items, err = GetPrescriptionItems(p.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// GetPrescriptionItems retrieves the drug lines of a prescription
+func GetPrescriptionItems(prescriptionID int) ([]PrescriptionItem, error) {
+	items := []PrescriptionItem{}
+
+	query := `
+		SELECT id, prescription_id, drug_name, dosage, frequency, duration, quantity, unit, instructions
+		FROM prescription_items
+		WHERE prescription_id = ` + getPlaceholder(1) + `
+		ORDER BY id
+	`
+
+	rows, err := database.DB.Query(query, prescriptionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item PrescriptionItem
+		err := rows.Scan(
+			&item.ID, &item.PrescriptionID, &item.DrugName, &item.Dosage, &item.Frequency,
+			&item.Duration, &item.Quantity, &item.Unit, &item.Instructions,
+		)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
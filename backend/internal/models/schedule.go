@@ -0,0 +1,617 @@
+package models
+
+import (
+	"database/sql"
+	"html"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dottrip/fpt-swp/internal/database"
+	"github.com/dottrip/fpt-swp/internal/rrule"
+)
+
+// Schedule event types
+const (
+	EventMeeting  = "meeting"
+	EventSupport  = "support"
+	EventTraining = "training"
+	EventPersonal = "personal"
+)
+
+// conflictHorizon bounds conflict detection for series without an end
+const conflictHorizon = 90 * 24 * time.Hour
+
+// maxConflicts bounds the conflicts reported for one event
+const maxConflicts = 20
+
+var (
+	clinicLocationOnce sync.Once
+	clinicLocation     *time.Location
+)
+
+// ClinicLocation is the time zone recurring events are expanded in, from
+// CLINIC_TIMEZONE (default Asia/Ho_Chi_Minh). A weekly 09:00 meeting stays at
+// 09:00 clinic time whatever zone the client sent.
+func ClinicLocation() *time.Location {
+	clinicLocationOnce.Do(func() {
+		loc, err := time.LoadLocation(getEnv("CLINIC_TIMEZONE", "Asia/Ho_Chi_Minh"))
+		if err != nil {
+			// No tzdata on the host; Vietnam has no daylight saving time
+			loc = time.FixedZone("ICT", 7*60*60)
+		}
+		clinicLocation = loc
+	})
+	return clinicLocation
+}
+
+// scheduleTime normalizes a timestamp for storage: UTC and truncated to
+// seconds, so values compare correctly as text in SQLite
+func scheduleTime(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Second)
+}
+
+// ScheduleAttendee is a user attending a schedule event
+type ScheduleAttendee struct {
+	UserID   int    `json:"user_id"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+// ScheduleEvent is a calendar event of the staff schedule. A recurring event
+// is stored once with its RRULE and expanded into occurrences when read.
+type ScheduleEvent struct {
+	ID            int                `json:"id"`
+	Title         string             `json:"title"`
+	Description   string             `json:"description"`
+	Type          string             `json:"type"` // meeting, support, training, personal
+	Location      string             `json:"location"`
+	StartAt       time.Time          `json:"start_at"`
+	EndAt         time.Time          `json:"end_at"`
+	RRule         string             `json:"rrule,omitempty"`
+	SeriesEndAt   *time.Time         `json:"series_end_at,omitempty"`
+	CreatedBy     int                `json:"created_by"`
+	CreatedByName string             `json:"created_by_name"`
+	Attendees     []ScheduleAttendee `json:"attendees"`
+	CreatedAt     time.Time          `json:"created_at"`
+	UpdatedAt     time.Time          `json:"updated_at"`
+
+	rule *rrule.Rule
+}
+
+// ScheduleEventRequest represents the request structure for creating or
+// updating an event. The creator always attends.
+type ScheduleEventRequest struct {
+	Title          string    `json:"title" binding:"required,max=255"`
+	Description    string    `json:"description"`
+	Type           string    `json:"type" binding:"omitempty,oneof=meeting support training personal"`
+	Location       string    `json:"location"`
+	StartAt        time.Time `json:"start_at" binding:"required"`
+	EndAt          time.Time `json:"end_at" binding:"required"`
+	RRule          string    `json:"rrule"`
+	AttendeeIDs    []int     `json:"attendee_ids" binding:"dive,gt=0"`
+	AllowConflicts bool      `json:"allow_conflicts"`
+}
+
+// ScheduleOccurrence is one entry of a schedule: an occurrence of an event or
+// a published shift. Date and times are in clinic time for calendar views.
+type ScheduleOccurrence struct {
+	Kind        string             `json:"kind"` // event or shift
+	EventID     int                `json:"event_id,omitempty"`
+	ShiftID     int                `json:"shift_id,omitempty"`
+	RosterID    int                `json:"roster_id,omitempty"`
+	Title       string             `json:"title"`
+	Description string             `json:"description,omitempty"`
+	Type        string             `json:"type"` // an event type, or shift
+	Location    string             `json:"location,omitempty"`
+	StartAt     time.Time          `json:"start_at"`
+	EndAt       time.Time          `json:"end_at"`
+	Date        string             `json:"date"`
+	StartTime   string             `json:"start_time"`
+	EndTime     string             `json:"end_time"`
+	Recurring   bool               `json:"recurring"`
+	Attendees   []ScheduleAttendee `json:"attendees,omitempty"`
+}
+
+// ScheduleConflict is an existing event occurrence that overlaps an event
+// for one of its attendees
+type ScheduleConflict struct {
+	UserID   int       `json:"user_id"`
+	Username string    `json:"username"`
+	EventID  int       `json:"event_id"`
+	Title    string    `json:"title"`
+	StartAt  time.Time `json:"start_at"`
+	EndAt    time.Time `json:"end_at"`
+}
+
+// IsValidEventType reports whether t is a known event type
+func IsValidEventType(t string) bool {
+	return t == EventMeeting || t == EventSupport || t == EventTraining || t == EventPersonal
+}
+
+// BeforeSave is a hook that gets called before saving the event
+func (e *ScheduleEvent) BeforeSave() error {
+	e.Title = html.EscapeString(strings.TrimSpace(e.Title))
+	e.Description = html.EscapeString(strings.TrimSpace(e.Description))
+	e.Location = html.EscapeString(strings.TrimSpace(e.Location))
+	return nil
+}
+
+// Validate validates the event, parses its recurrence rule and computes
+// when the series ends
+func (e *ScheduleEvent) Validate() error {
+	if strings.TrimSpace(e.Title) == "" {
+		return requiredError("title", "title is required")
+	}
+	if len([]rune(e.Title)) > 255 {
+		return maxError("title", 255, "title must be at most 255 characters")
+	}
+	if e.Type == "" {
+		e.Type = EventMeeting
+	}
+	if !IsValidEventType(e.Type) {
+		return oneOfError("type", "meeting support training personal", "type must be one of: meeting, support, training, personal")
+	}
+	if e.StartAt.IsZero() {
+		return requiredError("start_at", "start time is required")
+	}
+	if e.EndAt.IsZero() {
+		return requiredError("end_at", "end time is required")
+	}
+
+	e.StartAt, e.EndAt = scheduleTime(e.StartAt), scheduleTime(e.EndAt)
+	if !e.EndAt.After(e.StartAt) {
+		return afterError("end_at", "start_at", "end time must be after start time")
+	}
+	if e.EndAt.Sub(e.StartAt) > 24*time.Hour {
+		return &ValidationError{Field: "end_at", Code: "max_hours", Param: "24", Message: "an event can last at most 24 hours"}
+	}
+
+	e.rule = nil
+	e.SeriesEndAt = &e.EndAt
+	e.RRule = strings.TrimSpace(e.RRule)
+	if e.RRule == "" {
+		return nil
+	}
+
+	rule, err := rrule.Parse(e.RRule)
+	if err != nil {
+		return &ValidationError{Field: "rrule", Code: "rrule", Message: err.Error()}
+	}
+	e.rule = rule
+	e.RRule = rule.String()
+
+	if last, ok := rule.End(e.localStart()); ok {
+		end := scheduleTime(last.Add(e.duration()))
+		e.SeriesEndAt = &end
+	} else {
+		e.SeriesEndAt = nil
+	}
+	return nil
+}
+
+func (e *ScheduleEvent) localStart() time.Time {
+	return e.StartAt.In(ClinicLocation())
+}
+
+func (e *ScheduleEvent) duration() time.Duration {
+	return e.EndAt.Sub(e.StartAt)
+}
+
+// parseRule parses the stored recurrence rule of a loaded event
+func (e *ScheduleEvent) parseRule() {
+	if e.RRule == "" {
+		return
+	}
+	if rule, err := rrule.Parse(e.RRule); err == nil {
+		e.rule = rule
+	}
+}
+
+// occurrenceStarts returns the starts of the occurrences overlapping [from, to)
+func (e *ScheduleEvent) occurrenceStarts(from, to time.Time) []time.Time {
+	if e.rule == nil {
+		if e.StartAt.Before(to) && e.EndAt.After(from) {
+			return []time.Time{e.StartAt}
+		}
+		return nil
+	}
+
+	starts := e.rule.Between(e.localStart(), e.duration(), from, to)
+	for i := range starts {
+		starts[i] = starts[i].UTC()
+	}
+	return starts
+}
+
+// Occurrences expands the event into the occurrences overlapping [from, to)
+func (e *ScheduleEvent) Occurrences(from, to time.Time) []ScheduleOccurrence {
+	occurrences := []ScheduleOccurrence{}
+	for _, start := range e.occurrenceStarts(from, to) {
+		occurrence := ScheduleOccurrence{
+			Kind:        "event",
+			EventID:     e.ID,
+			Title:       e.Title,
+			Description: e.Description,
+			Type:        e.Type,
+			Location:    e.Location,
+			Recurring:   e.rule != nil,
+			Attendees:   e.Attendees,
+		}
+		occurrence.setTimes(start, start.Add(e.duration()))
+		occurrences = append(occurrences, occurrence)
+	}
+	return occurrences
+}
+
+// setTimes sets the start and end of the occurrence with their clinic-time
+// calendar fields
+func (o *ScheduleOccurrence) setTimes(start, end time.Time) {
+	o.StartAt, o.EndAt = start.UTC(), end.UTC()
+	local := start.In(ClinicLocation())
+	o.Date = local.Format("2006-01-02")
+	o.StartTime = local.Format("15:04")
+	o.EndTime = end.In(ClinicLocation()).Format("15:04")
+}
+
+// Create saves the event with its attendees
+func (e *ScheduleEvent) Create(attendeeIDs []int) error {
+	if err := e.Validate(); err != nil {
+		return validationError(err)
+	}
+	if err := e.BeforeSave(); err != nil {
+		return err
+	}
+
+	now := scheduleTime(time.Now())
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if getEnv("DB_TYPE", "postgres") == "sqlite" {
+		query := `
+			INSERT INTO schedule_events (title, description, type, location, start_at, end_at, rrule,
+				series_end_at, created_by, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`
+
+		result, err := tx.Exec(query, e.Title, e.Description, e.Type, e.Location, e.StartAt, e.EndAt, e.RRule,
+			e.SeriesEndAt, e.CreatedBy, now, now)
+		if err != nil {
+			return err
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		e.ID = int(id)
+	} else {
+		query := `
+			INSERT INTO schedule_events (title, description, type, location, start_at, end_at, rrule,
+				series_end_at, created_by, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+			RETURNING id
+		`
+
+		err := tx.QueryRow(query, e.Title, e.Description, e.Type, e.Location, e.StartAt, e.EndAt, e.RRule,
+			e.SeriesEndAt, e.CreatedBy, now, now).Scan(&e.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := replaceAttendees(tx, e.ID, e.CreatedBy, attendeeIDs); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return e.reload()
+}
+
+// Update saves changes to the event and replaces its attendees. Changes
+// apply to the whole series.
+func (e *ScheduleEvent) Update(attendeeIDs []int) error {
+	if err := e.Validate(); err != nil {
+		return validationError(err)
+	}
+	if err := e.BeforeSave(); err != nil {
+		return err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := "UPDATE schedule_events SET title = " + getPlaceholder(1) + ", description = " + getPlaceholder(2) +
+		", type = " + getPlaceholder(3) + ", location = " + getPlaceholder(4) + ", start_at = " + getPlaceholder(5) +
+		", end_at = " + getPlaceholder(6) + ", rrule = " + getPlaceholder(7) + ", series_end_at = " + getPlaceholder(8) +
+		", updated_at = " + getPlaceholder(9) + " WHERE id = " + getPlaceholder(10)
+
+	_, err = tx.Exec(query, e.Title, e.Description, e.Type, e.Location, e.StartAt, e.EndAt, e.RRule,
+		e.SeriesEndAt, scheduleTime(time.Now()), e.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := replaceAttendees(tx, e.ID, e.CreatedBy, attendeeIDs); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return e.reload()
+}
+
+// replaceAttendees sets the attendees of an event; the creator always attends
+func replaceAttendees(tx *sql.Tx, eventID, creatorID int, attendeeIDs []int) error {
+	if _, err := tx.Exec("DELETE FROM schedule_event_attendees WHERE event_id = "+getPlaceholder(1), eventID); err != nil {
+		return err
+	}
+
+	insert := "INSERT INTO schedule_event_attendees (event_id, user_id) VALUES (" + getPlaceholder(1) + ", " + getPlaceholder(2) + ")"
+	for _, userID := range uniqueIDs(append([]int{creatorID}, attendeeIDs...)) {
+		if _, err := tx.Exec(insert, eventID, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// uniqueIDs removes zero and duplicate IDs, keeping the first occurrence
+func uniqueIDs(ids []int) []int {
+	seen := make(map[int]bool, len(ids))
+	unique := []int{}
+	for _, id := range ids {
+		if id != 0 && !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
+// Delete deletes the event series
+func (e *ScheduleEvent) Delete() error {
+	_, err := database.DB.Exec("DELETE FROM schedule_events WHERE id = "+getPlaceholder(1), e.ID)
+	return err
+}
+
+// reload refreshes the event from the database
+func (e *ScheduleEvent) reload() error {
+	fresh, err := GetScheduleEventByID(e.ID)
+	if err != nil {
+		return err
+	}
+	*e = *fresh
+	return nil
+}
+
+// HasAttendee reports whether the user attends the event
+func (e *ScheduleEvent) HasAttendee(userID int) bool {
+	for _, a := range e.Attendees {
+		if a.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// AttendeeIDs returns the user IDs of the attendees
+func (e *ScheduleEvent) AttendeeIDs() []int {
+	ids := make([]int, 0, len(e.Attendees))
+	for _, a := range e.Attendees {
+		ids = append(ids, a.UserID)
+	}
+	return ids
+}
+
+const scheduleEventColumns = `
+	e.id, e.title, e.description, e.type, e.location, e.start_at, e.end_at, e.rrule, e.series_end_at,
+	e.created_by, COALESCE(u.username, ''), e.created_at, e.updated_at`
+
+func scanScheduleEvent(row interface{ Scan(...interface{}) error }) (*ScheduleEvent, error) {
+	e := &ScheduleEvent{}
+	var rule sql.NullString
+	err := row.Scan(&e.ID, &e.Title, &e.Description, &e.Type, &e.Location, &e.StartAt, &e.EndAt, &rule,
+		&e.SeriesEndAt, &e.CreatedBy, &e.CreatedByName, &e.CreatedAt, &e.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	e.RRule = rule.String
+	e.StartAt, e.EndAt = e.StartAt.UTC(), e.EndAt.UTC()
+	e.parseRule()
+	return e, nil
+}
+
+// GetScheduleEventByID retrieves an event with its attendees
+func GetScheduleEventByID(id int) (*ScheduleEvent, error) {
+	query := `SELECT ` + scheduleEventColumns + `
+		FROM schedule_events e
+		LEFT JOIN users u ON u.id = e.created_by
+		WHERE e.id = ` + getPlaceholder(1)
+
+	e, err := scanScheduleEvent(database.DB.QueryRow(query, id))
+	if err != nil {
+		return nil, err
+	}
+
+	e.Attendees, err = getEventAttendees(e.ID)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func getEventAttendees(eventID int) ([]ScheduleAttendee, error) {
+	attendees := []ScheduleAttendee{}
+
+	query := `
+		SELECT a.user_id, COALESCE(u.username, ''), COALESCE(u.role, '')
+		FROM schedule_event_attendees a
+		LEFT JOIN users u ON u.id = a.user_id
+		WHERE a.event_id = ` + getPlaceholder(1) + `
+		ORDER BY u.username ASC`
+
+	rows, err := database.DB.Query(query, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a ScheduleAttendee
+		if err := rows.Scan(&a.UserID, &a.Username, &a.Role); err != nil {
+			return nil, err
+		}
+		attendees = append(attendees, a)
+	}
+
+	return attendees, rows.Err()
+}
+
+// GetScheduleEvents returns the events attended by userID (every event when
+// userID is 0) that have an occurrence overlapping [from, to)
+func GetScheduleEvents(userID int, from, to time.Time) ([]ScheduleEvent, error) {
+	events := []ScheduleEvent{}
+
+	query := `SELECT ` + scheduleEventColumns + `
+		FROM schedule_events e
+		LEFT JOIN users u ON u.id = e.created_by
+		WHERE e.start_at < ` + getPlaceholder(1) + `
+		AND (e.series_end_at IS NULL OR e.series_end_at > ` + getPlaceholder(2) + `)`
+	args := []interface{}{scheduleTime(to), scheduleTime(from)}
+
+	if userID != 0 {
+		args = append(args, userID)
+		query += " AND e.id IN (SELECT event_id FROM schedule_event_attendees WHERE user_id = " + getPlaceholder(len(args)) + ")"
+	}
+	query += " ORDER BY e.start_at ASC, e.id ASC"
+
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e, err := scanScheduleEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, *e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for i := range events {
+		attendees, err := getEventAttendees(events[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		events[i].Attendees = attendees
+	}
+
+	return events, nil
+}
+
+// GetScheduleOccurrences expands the events of userID (every event when
+// userID is 0) into occurrences overlapping [from, to), ordered by start
+func GetScheduleOccurrences(userID int, from, to time.Time) ([]ScheduleOccurrence, error) {
+	events, err := GetScheduleEvents(userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	occurrences := []ScheduleOccurrence{}
+	for i := range events {
+		occurrences = append(occurrences, events[i].Occurrences(from, to)...)
+	}
+	SortOccurrences(occurrences)
+	return occurrences, nil
+}
+
+// SortOccurrences orders occurrences by start time
+func SortOccurrences(occurrences []ScheduleOccurrence) {
+	sort.SliceStable(occurrences, func(i, j int) bool {
+		return occurrences[i].StartAt.Before(occurrences[j].StartAt)
+	})
+}
+
+// FindScheduleConflicts returns existing occurrences that overlap an
+// occurrence of e for one of attendeeIDs. Series without an end are checked
+// up to 90 days ahead. The event itself is ignored, so it can be re-checked
+// when updated.
+func FindScheduleConflicts(e *ScheduleEvent, attendeeIDs []int) ([]ScheduleConflict, error) {
+	conflicts := []ScheduleConflict{}
+
+	from := e.StartAt
+	to := from.Add(conflictHorizon)
+	if e.SeriesEndAt != nil && e.SeriesEndAt.Before(to) {
+		to = *e.SeriesEndAt
+	}
+	starts := e.occurrenceStarts(from, to)
+	if len(starts) == 0 {
+		return conflicts, nil
+	}
+
+	for _, userID := range uniqueIDs(attendeeIDs) {
+		events, err := GetScheduleEvents(userID, from, to)
+		if err != nil {
+			return nil, err
+		}
+
+		username := ""
+		for i := range events {
+			other := &events[i]
+			if other.ID == e.ID {
+				continue
+			}
+			for _, a := range other.Attendees {
+				if a.UserID == userID {
+					username = a.Username
+				}
+			}
+
+			for _, start := range other.occurrenceStarts(from, to) {
+				end := start.Add(other.duration())
+				if !overlapsAny(starts, e.duration(), start, end) {
+					continue
+				}
+
+				conflicts = append(conflicts, ScheduleConflict{
+					UserID:   userID,
+					Username: username,
+					EventID:  other.ID,
+					Title:    other.Title,
+					StartAt:  start,
+					EndAt:    end,
+				})
+				if len(conflicts) >= maxConflicts {
+					return conflicts, nil
+				}
+			}
+		}
+	}
+
+	return conflicts, nil
+}
+
+// overlapsAny reports whether [start, end) overlaps one of the occurrences
+// beginning at starts and lasting duration. starts must be sorted.
+func overlapsAny(starts []time.Time, duration time.Duration, start, end time.Time) bool {
+	// First occurrence that ends after start
+	i := sort.Search(len(starts), func(i int) bool { return starts[i].Add(duration).After(start) })
+	return i < len(starts) && starts[i].Before(end)
+}
@@ -0,0 +1,752 @@
+package models
+
+import (
+	"errors"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/dottrip/fpt-swp/internal/database"
+)
+
+// Roster statuses
+const (
+	RosterDraft     = "draft"
+	RosterPublished = "published"
+)
+
+// Swap request statuses
+const (
+	SwapPending   = "pending"
+	SwapApproved  = "approved"
+	SwapRejected  = "rejected"
+	SwapCancelled = "cancelled"
+)
+
+var (
+	// ErrShiftConflict is returned when a shift would overlap another shift of the same person
+	ErrShiftConflict = errors.New("shift overlaps another shift of the same staff member")
+	// ErrRosterPublished is returned when changing the shifts of a published roster
+	ErrRosterPublished = errors.New("roster is already published")
+	// ErrSwapNotPending is returned when deciding a swap request that was already decided
+	ErrSwapNotPending = errors.New("swap request is no longer pending")
+	// ErrSwapStale is returned when a shift changed hands after the swap was requested
+	ErrSwapStale = errors.New("shift has changed since the swap was requested")
+)
+
+// ShiftRoster is a set of shifts for a period. Staff only see a roster once
+// an admin publishes it.
+type ShiftRoster struct {
+	ID            int        `json:"id"`
+	Title         string     `json:"title"`
+	PeriodStart   time.Time  `json:"period_start"`
+	PeriodEnd     time.Time  `json:"period_end"`
+	Status        string     `json:"status"` // draft, published
+	CreatedBy     int        `json:"created_by"`
+	CreatedByName string     `json:"created_by_name"`
+	PublishedAt   *time.Time `json:"published_at,omitempty"`
+	ShiftCount    int        `json:"shift_count"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+
+	Shifts []Shift `json:"shifts,omitempty"`
+}
+
+// Shift is a block of work assigned to a staff member
+type Shift struct {
+	ID           int       `json:"id"`
+	RosterID     int       `json:"roster_id"`
+	RosterStatus string    `json:"roster_status"`
+	UserID       int       `json:"user_id"`
+	Username     string    `json:"username"`
+	StartAt      time.Time `json:"start_at"`
+	EndAt        time.Time `json:"end_at"`
+	Label        string    `json:"label"`
+}
+
+// ShiftInput represents one shift in a roster request
+type ShiftInput struct {
+	UserID  int       `json:"user_id" binding:"required"`
+	StartAt time.Time `json:"start_at" binding:"required"`
+	EndAt   time.Time `json:"end_at" binding:"required"`
+	Label   string    `json:"label" binding:"max=100"`
+}
+
+// ShiftRosterRequest represents the request structure for creating a roster
+type ShiftRosterRequest struct {
+	Title       string       `json:"title" binding:"required,max=255"`
+	PeriodStart time.Time    `json:"period_start" binding:"required"`
+	PeriodEnd   time.Time    `json:"period_end" binding:"required"`
+	Shifts      []ShiftInput `json:"shifts" binding:"dive"`
+}
+
+// ShiftSwapRequest asks to hand a shift to another staff member, optionally
+// taking one of their shifts in exchange. An admin approves or rejects it.
+type ShiftSwapRequest struct {
+	ID             int        `json:"id"`
+	ShiftID        int        `json:"shift_id"`
+	RequesterID    int        `json:"requester_id"`
+	RequesterName  string     `json:"requester_name"`
+	TargetUserID   int        `json:"target_user_id"`
+	TargetUserName string     `json:"target_user_name"`
+	TargetShiftID  *int       `json:"target_shift_id,omitempty"`
+	Reason         string     `json:"reason"`
+	Status         string     `json:"status"` // pending, approved, rejected, cancelled
+	DecidedBy      *int       `json:"decided_by,omitempty"`
+	DecidedAt      *time.Time `json:"decided_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+
+	Shift       *Shift `json:"shift,omitempty"`
+	TargetShift *Shift `json:"target_shift,omitempty"`
+}
+
+// ShiftSwapInput represents the request structure for requesting a swap
+type ShiftSwapInput struct {
+	TargetUserID  int    `json:"target_user_id" binding:"required"`
+	TargetShiftID *int   `json:"target_shift_id"`
+	Reason        string `json:"reason"`
+}
+
+// ShiftSwapFilter represents filters for listing swap requests
+type ShiftSwapFilter struct {
+	UserID int // requests made by or aimed at this user
+	Status string
+}
+
+// Validate validates the roster data
+func (r *ShiftRoster) Validate() error {
+	r.Title = strings.TrimSpace(r.Title)
+	if r.Title == "" {
+		return requiredError("title", "title is required")
+	}
+	if len([]rune(r.Title)) > 255 {
+		return maxError("title", 255, "title must be at most 255 characters")
+	}
+	if r.PeriodStart.IsZero() {
+		return requiredError("period_start", "roster period is required")
+	}
+	if r.PeriodEnd.IsZero() {
+		return requiredError("period_end", "roster period is required")
+	}
+	r.PeriodStart, r.PeriodEnd = scheduleTime(r.PeriodStart), scheduleTime(r.PeriodEnd)
+	if !r.PeriodEnd.After(r.PeriodStart) {
+		return afterError("period_end", "period_start", "period end must be after period start")
+	}
+	if r.PeriodEnd.Sub(r.PeriodStart) > 92*24*time.Hour {
+		return &ValidationError{Field: "period_end", Code: "max_days", Param: "92", Message: "a roster can cover at most 92 days"}
+	}
+	return nil
+}
+
+// validateShift checks a shift against the roster period
+func (r *ShiftRoster) validateShift(s *Shift) error {
+	if s.UserID == 0 {
+		return invalidError("shift_user_required", "shift user is required")
+	}
+	s.StartAt, s.EndAt = scheduleTime(s.StartAt), scheduleTime(s.EndAt)
+	if !s.EndAt.After(s.StartAt) {
+		return invalidError("shift_order", "shift end must be after shift start")
+	}
+	if s.EndAt.Sub(s.StartAt) > 24*time.Hour {
+		return invalidError("shift_max_hours", "a shift can last at most 24 hours")
+	}
+	if s.StartAt.Before(r.PeriodStart) || s.EndAt.After(r.PeriodEnd) {
+		return invalidError("shift_outside_roster", "shifts must fall within the roster period")
+	}
+	s.Label = html.EscapeString(strings.TrimSpace(s.Label))
+	return nil
+}
+
+// Create saves the roster as a draft with its shifts
+func (r *ShiftRoster) Create(shifts []ShiftInput) error {
+	if err := r.Validate(); err != nil {
+		return validationError(err)
+	}
+	r.Title = html.EscapeString(r.Title)
+
+	pending := make([]Shift, 0, len(shifts))
+	for _, input := range shifts {
+		s := Shift{UserID: input.UserID, StartAt: input.StartAt, EndAt: input.EndAt, Label: input.Label}
+		if err := r.validateShift(&s); err != nil {
+			return err
+		}
+		for _, other := range pending {
+			if other.UserID == s.UserID && other.StartAt.Before(s.EndAt) && s.StartAt.Before(other.EndAt) {
+				return ErrShiftConflict
+			}
+		}
+		pending = append(pending, s)
+	}
+
+	now := scheduleTime(time.Now())
+	r.Status = RosterDraft
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if getEnv("DB_TYPE", "postgres") == "sqlite" {
+		result, err := tx.Exec(`INSERT INTO shift_rosters (title, period_start, period_end, status, created_by, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`, r.Title, r.PeriodStart, r.PeriodEnd, r.Status, r.CreatedBy, now, now)
+		if err != nil {
+			return err
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		r.ID = int(id)
+	} else {
+		err := tx.QueryRow(`INSERT INTO shift_rosters (title, period_start, period_end, status, created_by, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`, r.Title, r.PeriodStart, r.PeriodEnd, r.Status, r.CreatedBy, now, now).Scan(&r.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	insert := "INSERT INTO shifts (roster_id, user_id, start_at, end_at, label) VALUES (" +
+		getPlaceholder(1) + ", " + getPlaceholder(2) + ", " + getPlaceholder(3) + ", " + getPlaceholder(4) + ", " + getPlaceholder(5) + ")"
+	for _, s := range pending {
+		if _, err := tx.Exec(insert, r.ID, s.UserID, s.StartAt, s.EndAt, s.Label); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return r.reload()
+}
+
+// AddShift adds a shift to a draft roster
+func (r *ShiftRoster) AddShift(input ShiftInput) (*Shift, error) {
+	if r.Status != RosterDraft {
+		return nil, ErrRosterPublished
+	}
+
+	s := &Shift{RosterID: r.ID, UserID: input.UserID, StartAt: input.StartAt, EndAt: input.EndAt, Label: input.Label}
+	if err := r.validateShift(s); err != nil {
+		return nil, err
+	}
+
+	overlapping, err := countOverlappingShifts(s.UserID, s.StartAt, s.EndAt, r.ID, 0)
+	if err != nil {
+		return nil, err
+	}
+	if overlapping > 0 {
+		return nil, ErrShiftConflict
+	}
+
+	if getEnv("DB_TYPE", "postgres") == "sqlite" {
+		result, err := database.DB.Exec("INSERT INTO shifts (roster_id, user_id, start_at, end_at, label) VALUES (?, ?, ?, ?, ?)",
+			r.ID, s.UserID, s.StartAt, s.EndAt, s.Label)
+		if err != nil {
+			return nil, err
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+		s.ID = int(id)
+	} else {
+		err := database.DB.QueryRow("INSERT INTO shifts (roster_id, user_id, start_at, end_at, label) VALUES ($1, $2, $3, $4, $5) RETURNING id",
+			r.ID, s.UserID, s.StartAt, s.EndAt, s.Label).Scan(&s.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return GetShiftByID(s.ID)
+}
+
+// DeleteShift removes a shift from a draft roster
+func (r *ShiftRoster) DeleteShift(shiftID int) error {
+	if r.Status != RosterDraft {
+		return ErrRosterPublished
+	}
+	_, err := database.DB.Exec("DELETE FROM shifts WHERE id = "+getPlaceholder(1)+" AND roster_id = "+getPlaceholder(2), shiftID, r.ID)
+	return err
+}
+
+// Publish makes the roster visible to staff. Shifts may not overlap shifts of
+// the same person in other published rosters.
+func (r *ShiftRoster) Publish() error {
+	if r.Status != RosterDraft {
+		return ErrRosterPublished
+	}
+
+	shifts, err := GetRosterShifts(r.ID)
+	if err != nil {
+		return err
+	}
+	for _, s := range shifts {
+		overlapping, err := countOverlappingShifts(s.UserID, s.StartAt, s.EndAt, 0, r.ID)
+		if err != nil {
+			return err
+		}
+		if overlapping > 0 {
+			return ErrShiftConflict
+		}
+	}
+
+	now := scheduleTime(time.Now())
+	query := "UPDATE shift_rosters SET status = '" + RosterPublished + "', published_at = " + getPlaceholder(1) +
+		", updated_at = " + getPlaceholder(2) + " WHERE id = " + getPlaceholder(3) + " AND status = '" + RosterDraft + "'"
+
+	result, err := database.DB.Exec(query, now, now, r.ID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrRosterPublished
+	}
+	return r.reload()
+}
+
+// countOverlappingShifts counts shifts of userID overlapping [start, end).
+// With rosterID set only that roster is checked; otherwise published rosters
+// other than excludeRosterID are.
+func countOverlappingShifts(userID int, start, end time.Time, rosterID, excludeRosterID int, excludeShiftIDs ...int) (int, error) {
+	query := `SELECT COUNT(*) FROM shifts s JOIN shift_rosters r ON r.id = s.roster_id
+		WHERE s.user_id = ` + getPlaceholder(1) + ` AND s.start_at < ` + getPlaceholder(2) + ` AND s.end_at > ` + getPlaceholder(3)
+	args := []interface{}{userID, end, start}
+
+	if rosterID != 0 {
+		args = append(args, rosterID)
+		query += " AND s.roster_id = " + getPlaceholder(len(args))
+	} else {
+		args = append(args, excludeRosterID)
+		query += " AND r.status = '" + RosterPublished + "' AND s.roster_id <> " + getPlaceholder(len(args))
+	}
+	for _, id := range excludeShiftIDs {
+		args = append(args, id)
+		query += " AND s.id <> " + getPlaceholder(len(args))
+	}
+
+	var count int
+	err := database.DB.QueryRow(query, args...).Scan(&count)
+	return count, err
+}
+
+// reload refreshes the roster from the database
+func (r *ShiftRoster) reload() error {
+	fresh, err := GetShiftRosterByID(r.ID)
+	if err != nil {
+		return err
+	}
+	*r = *fresh
+	return nil
+}
+
+const shiftRosterColumns = `
+	r.id, r.title, r.period_start, r.period_end, r.status, r.created_by, COALESCE(u.username, ''),
+	r.published_at, (SELECT COUNT(*) FROM shifts s WHERE s.roster_id = r.id), r.created_at, r.updated_at
+	FROM shift_rosters r
+	LEFT JOIN users u ON u.id = r.created_by`
+
+func scanShiftRoster(row interface{ Scan(...interface{}) error }) (*ShiftRoster, error) {
+	r := &ShiftRoster{}
+	err := row.Scan(&r.ID, &r.Title, &r.PeriodStart, &r.PeriodEnd, &r.Status, &r.CreatedBy, &r.CreatedByName,
+		&r.PublishedAt, &r.ShiftCount, &r.CreatedAt, &r.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetShiftRosterByID retrieves a roster
+func GetShiftRosterByID(id int) (*ShiftRoster, error) {
+	return scanShiftRoster(database.DB.QueryRow(`SELECT `+shiftRosterColumns+` WHERE r.id = `+getPlaceholder(1), id))
+}
+
+// GetShiftRosters lists rosters, newest period first. Only published rosters
+// are listed unless includeDrafts is set.
+func GetShiftRosters(includeDrafts bool) ([]ShiftRoster, error) {
+	rosters := []ShiftRoster{}
+
+	query := `SELECT ` + shiftRosterColumns
+	if !includeDrafts {
+		query += ` WHERE r.status = '` + RosterPublished + `'`
+	}
+	query += ` ORDER BY r.period_start DESC, r.id DESC`
+
+	rows, err := database.DB.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		r, err := scanShiftRoster(rows)
+		if err != nil {
+			return nil, err
+		}
+		rosters = append(rosters, *r)
+	}
+
+	return rosters, rows.Err()
+}
+
+const shiftColumns = `
+	s.id, s.roster_id, r.status, s.user_id, COALESCE(u.username, ''), s.start_at, s.end_at, s.label
+	FROM shifts s
+	JOIN shift_rosters r ON r.id = s.roster_id
+	LEFT JOIN users u ON u.id = s.user_id`
+
+func scanShift(row interface{ Scan(...interface{}) error }) (*Shift, error) {
+	s := &Shift{}
+	if err := row.Scan(&s.ID, &s.RosterID, &s.RosterStatus, &s.UserID, &s.Username, &s.StartAt, &s.EndAt, &s.Label); err != nil {
+		return nil, err
+	}
+	s.StartAt, s.EndAt = s.StartAt.UTC(), s.EndAt.UTC()
+	return s, nil
+}
+
+func queryShifts(where string, args ...interface{}) ([]Shift, error) {
+	shifts := []Shift{}
+
+	rows, err := database.DB.Query(`SELECT `+shiftColumns+` WHERE `+where+` ORDER BY s.start_at ASC, s.id ASC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		s, err := scanShift(rows)
+		if err != nil {
+			return nil, err
+		}
+		shifts = append(shifts, *s)
+	}
+
+	return shifts, rows.Err()
+}
+
+// GetShiftByID retrieves a shift
+func GetShiftByID(id int) (*Shift, error) {
+	return scanShift(database.DB.QueryRow(`SELECT `+shiftColumns+` WHERE s.id = `+getPlaceholder(1), id))
+}
+
+// GetRosterShifts returns the shifts of a roster
+func GetRosterShifts(rosterID int) ([]Shift, error) {
+	return queryShifts("s.roster_id = "+getPlaceholder(1), rosterID)
+}
+
+// GetPublishedShifts returns published shifts of userID (everyone when
+// userID is 0) overlapping [from, to)
+func GetPublishedShifts(userID int, from, to time.Time) ([]Shift, error) {
+	where := "r.status = '" + RosterPublished + "' AND s.start_at < " + getPlaceholder(1) + " AND s.end_at > " + getPlaceholder(2)
+	args := []interface{}{scheduleTime(to), scheduleTime(from)}
+	if userID != 0 {
+		args = append(args, userID)
+		where += " AND s.user_id = " + getPlaceholder(len(args))
+	}
+	return queryShifts(where, args...)
+}
+
+// Occurrence returns the shift as a schedule entry
+func (s *Shift) Occurrence() ScheduleOccurrence {
+	title := s.Label
+	if title == "" {
+		title = "Shift"
+	}
+	occurrence := ScheduleOccurrence{
+		Kind:     "shift",
+		ShiftID:  s.ID,
+		RosterID: s.RosterID,
+		Title:    title,
+		Type:     "shift",
+		Attendees: []ScheduleAttendee{
+			{UserID: s.UserID, Username: s.Username},
+		},
+	}
+	occurrence.setTimes(s.StartAt, s.EndAt)
+	return occurrence
+}
+
+// CreateSwapRequest asks to hand shift s, held by requesterID, to
+// input.TargetUserID. Only shifts of published rosters that have not started
+// can be swapped, and a shift has at most one pending request.
+func (s *Shift) CreateSwapRequest(requesterID int, input ShiftSwapInput) (*ShiftSwapRequest, error) {
+	if s.RosterStatus != RosterPublished {
+		return nil, invalidError("swap_unpublished", "only shifts of published rosters can be swapped")
+	}
+	if s.UserID != requesterID {
+		return nil, invalidError("swap_not_own", "you can only swap your own shifts")
+	}
+	if !s.StartAt.After(time.Now()) {
+		return nil, invalidError("shift_started", "shift has already started")
+	}
+	if input.TargetUserID == requesterID {
+		return nil, invalidError("swap_self", "cannot swap a shift with yourself")
+	}
+
+	if input.TargetShiftID != nil {
+		target, err := GetShiftByID(*input.TargetShiftID)
+		if err != nil {
+			return nil, &ValidationError{Field: "target_shift_id", Code: "exists", Message: "target shift not found"}
+		}
+		if target.UserID != input.TargetUserID || target.RosterStatus != RosterPublished {
+			return nil, &ValidationError{Field: "target_shift_id", Code: "target_shift", Message: "target shift must be a published shift of the target user"}
+		}
+		if !target.StartAt.After(time.Now()) {
+			return nil, &ValidationError{Field: "target_shift_id", Code: "shift_started", Message: "target shift has already started"}
+		}
+	}
+
+	var pending int
+	err := database.DB.QueryRow("SELECT COUNT(*) FROM shift_swap_requests WHERE shift_id = "+getPlaceholder(1)+
+		" AND status = '"+SwapPending+"'", s.ID).Scan(&pending)
+	if err != nil {
+		return nil, err
+	}
+	if pending > 0 {
+		return nil, invalidError("swap_pending", "this shift already has a pending swap request")
+	}
+
+	now := scheduleTime(time.Now())
+	reason := html.EscapeString(strings.TrimSpace(input.Reason))
+	var id int
+
+	if getEnv("DB_TYPE", "postgres") == "sqlite" {
+		result, err := database.DB.Exec(`INSERT INTO shift_swap_requests (shift_id, requester_id, target_user_id, target_shift_id,
+			reason, status, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			s.ID, requesterID, input.TargetUserID, input.TargetShiftID, reason, SwapPending, now, now)
+		if err != nil {
+			return nil, err
+		}
+		lastID, err := result.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+		id = int(lastID)
+	} else {
+		err := database.DB.QueryRow(`INSERT INTO shift_swap_requests (shift_id, requester_id, target_user_id, target_shift_id,
+			reason, status, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`,
+			s.ID, requesterID, input.TargetUserID, input.TargetShiftID, reason, SwapPending, now, now).Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return GetShiftSwapRequestByID(id)
+}
+
+const shiftSwapColumns = `
+	w.id, w.shift_id, w.requester_id, COALESCE(ru.username, ''), w.target_user_id, COALESCE(tu.username, ''),
+	w.target_shift_id, w.reason, w.status, w.decided_by, w.decided_at, w.created_at, w.updated_at
+	FROM shift_swap_requests w
+	LEFT JOIN users ru ON ru.id = w.requester_id
+	LEFT JOIN users tu ON tu.id = w.target_user_id`
+
+func scanShiftSwap(row interface{ Scan(...interface{}) error }) (*ShiftSwapRequest, error) {
+	w := &ShiftSwapRequest{}
+	err := row.Scan(&w.ID, &w.ShiftID, &w.RequesterID, &w.RequesterName, &w.TargetUserID, &w.TargetUserName,
+		&w.TargetShiftID, &w.Reason, &w.Status, &w.DecidedBy, &w.DecidedAt, &w.CreatedAt, &w.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// loadShifts attaches the shifts involved in the swap
+func (w *ShiftSwapRequest) loadShifts() {
+	if shift, err := GetShiftByID(w.ShiftID); err == nil {
+		w.Shift = shift
+	}
+	if w.TargetShiftID != nil {
+		if shift, err := GetShiftByID(*w.TargetShiftID); err == nil {
+			w.TargetShift = shift
+		}
+	}
+}
+
+// GetShiftSwapRequestByID retrieves a swap request with its shifts
+func GetShiftSwapRequestByID(id int) (*ShiftSwapRequest, error) {
+	w, err := scanShiftSwap(database.DB.QueryRow(`SELECT `+shiftSwapColumns+` WHERE w.id = `+getPlaceholder(1), id))
+	if err != nil {
+		return nil, err
+	}
+	w.loadShifts()
+	return w, nil
+}
+
+// GetShiftSwapRequests lists swap requests, newest first
+func GetShiftSwapRequests(filter ShiftSwapFilter) ([]ShiftSwapRequest, error) {
+	requests := []ShiftSwapRequest{}
+
+	query := `SELECT ` + shiftSwapColumns + ` WHERE 1=1`
+	args := []interface{}{}
+
+	if filter.UserID != 0 {
+		args = append(args, filter.UserID, filter.UserID)
+		query += " AND (w.requester_id = " + getPlaceholder(len(args)-1) + " OR w.target_user_id = " + getPlaceholder(len(args)) + ")"
+	}
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		query += " AND w.status = " + getPlaceholder(len(args))
+	}
+	query += " ORDER BY w.created_at DESC, w.id DESC LIMIT 200"
+
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		w, err := scanShiftSwap(rows)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, *w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for i := range requests {
+		requests[i].loadShifts()
+	}
+	return requests, nil
+}
+
+// Approve hands the shift to the target user, and the target shift to the
+// requester for an exchange. It fails with ErrShiftConflict if either would
+// end up with overlapping shifts and ErrSwapStale if a shift changed hands.
+func (w *ShiftSwapRequest) Approve(adminID int) error {
+	if w.Status != SwapPending {
+		return ErrSwapNotPending
+	}
+
+	shift, err := GetShiftByID(w.ShiftID)
+	if err != nil {
+		return err
+	}
+	if shift.UserID != w.RequesterID {
+		return ErrSwapStale
+	}
+
+	exclude := []int{shift.ID}
+	var target *Shift
+	if w.TargetShiftID != nil {
+		target, err = GetShiftByID(*w.TargetShiftID)
+		if err != nil {
+			return err
+		}
+		if target.UserID != w.TargetUserID {
+			return ErrSwapStale
+		}
+		exclude = append(exclude, target.ID)
+	}
+
+	overlapping, err := countOverlappingShifts(w.TargetUserID, shift.StartAt, shift.EndAt, 0, 0, exclude...)
+	if err != nil {
+		return err
+	}
+	if overlapping > 0 {
+		return ErrShiftConflict
+	}
+	if target != nil {
+		overlapping, err := countOverlappingShifts(w.RequesterID, target.StartAt, target.EndAt, 0, 0, exclude...)
+		if err != nil {
+			return err
+		}
+		if overlapping > 0 {
+			return ErrShiftConflict
+		}
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := scheduleTime(time.Now())
+	result, err := tx.Exec("UPDATE shift_swap_requests SET status = '"+SwapApproved+"', decided_by = "+getPlaceholder(1)+
+		", decided_at = "+getPlaceholder(2)+", updated_at = "+getPlaceholder(3)+
+		" WHERE id = "+getPlaceholder(4)+" AND status = '"+SwapPending+"'", adminID, now, now, w.ID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrSwapNotPending
+	}
+
+	reassign := "UPDATE shifts SET user_id = " + getPlaceholder(1) + " WHERE id = " + getPlaceholder(2) + " AND user_id = " + getPlaceholder(3)
+	moves := [][3]int{{w.TargetUserID, shift.ID, w.RequesterID}}
+	if target != nil {
+		moves = append(moves, [3]int{w.RequesterID, target.ID, w.TargetUserID})
+	}
+	for _, m := range moves {
+		result, err := tx.Exec(reassign, m[0], m[1], m[2])
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrSwapStale
+		}
+	}
+
+	// Other pending requests for the shifts that changed hands no longer apply
+	shiftIDs := []interface{}{now, now, w.ID, shift.ID}
+	cancel := "UPDATE shift_swap_requests SET status = '" + SwapCancelled + "', decided_at = " + getPlaceholder(1) +
+		", updated_at = " + getPlaceholder(2) + " WHERE id <> " + getPlaceholder(3) + " AND status = '" + SwapPending +
+		"' AND (shift_id = " + getPlaceholder(4)
+	if target != nil {
+		shiftIDs = append(shiftIDs, target.ID)
+		cancel += " OR shift_id = " + getPlaceholder(5)
+	}
+	if _, err := tx.Exec(cancel+")", shiftIDs...); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return w.reload()
+}
+
+// Decide rejects or cancels a pending swap request
+func (w *ShiftSwapRequest) Decide(status string, deciderID int) error {
+	if status != SwapRejected && status != SwapCancelled {
+		return oneOfError("status", "rejected cancelled", "status must be rejected or cancelled")
+	}
+
+	now := scheduleTime(time.Now())
+	query := "UPDATE shift_swap_requests SET status = " + getPlaceholder(1) + ", decided_by = " + getPlaceholder(2) +
+		", decided_at = " + getPlaceholder(3) + ", updated_at = " + getPlaceholder(4) +
+		" WHERE id = " + getPlaceholder(5) + " AND status = '" + SwapPending + "'"
+
+	result, err := database.DB.Exec(query, status, deciderID, now, now, w.ID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrSwapNotPending
+	}
+	return w.reload()
+}
+
+// reload refreshes the swap request from the database
+func (w *ShiftSwapRequest) reload() error {
+	fresh, err := GetShiftSwapRequestByID(w.ID)
+	if err != nil {
+		return err
+	}
+	*w = *fresh
+	return nil
+}
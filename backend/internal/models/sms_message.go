@@ -0,0 +1,286 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/dottrip/fpt-swp/internal/database"
+)
+
+// SMS delivery statuses
+const (
+	SMSQueued      = "queued"
+	SMSSent        = "sent"
+	SMSDelivered   = "delivered"
+	SMSUndelivered = "undelivered"
+	SMSFailed      = "failed"
+	SMSRateLimited = "rate_limited"
+)
+
+// SMSMessage records an SMS sent through the configured provider
+type SMSMessage struct {
+	ID                int        `json:"id"`
+	UserID            *int       `json:"user_id,omitempty"`
+	PhoneNumber       string     `json:"phone_number"` // E.164
+	Body              string     `json:"body"`
+	Provider          string     `json:"provider"`
+	ProviderMessageID string     `json:"provider_message_id,omitempty"`
+	Status            string     `json:"status"` // queued, sent, delivered, undelivered, failed, rate_limited
+	Error             string     `json:"error,omitempty"`
+	SentAt            *time.Time `json:"sent_at,omitempty"`
+	DeliveredAt       *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
+
+// SMSMessageFilter represents filters for the SMS log
+type SMSMessageFilter struct {
+	PhoneNumber string
+	Status      string
+	Limit       int
+	Offset      int
+}
+
+func smsNow() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
+}
+
+// MarkSent records that the provider accepted the message
+func (m *SMSMessage) MarkSent(providerMessageID string) error {
+	now := smsNow()
+	query := "UPDATE sms_messages SET status = '" + SMSSent + "', provider_message_id = " + getPlaceholder(1) +
+		", sent_at = " + getPlaceholder(2) + ", updated_at = " + getPlaceholder(3) + " WHERE id = " + getPlaceholder(4)
+
+	if _, err := database.DB.Exec(query, providerMessageID, now, now, m.ID); err != nil {
+		return err
+	}
+	m.Status, m.ProviderMessageID, m.SentAt, m.UpdatedAt = SMSSent, providerMessageID, &now, now
+	return nil
+}
+
+// MarkFailed records that the provider refused the message
+func (m *SMSMessage) MarkFailed(reason string) error {
+	now := smsNow()
+	reason = truncateRunes(reason, 500)
+	query := "UPDATE sms_messages SET status = '" + SMSFailed + "', error = " + getPlaceholder(1) +
+		", updated_at = " + getPlaceholder(2) + " WHERE id = " + getPlaceholder(3)
+
+	if _, err := database.DB.Exec(query, reason, now, m.ID); err != nil {
+		return err
+	}
+	m.Status, m.Error, m.UpdatedAt = SMSFailed, reason, now
+	return nil
+}
+
+func truncateRunes(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n])
+	}
+	return s
+}
+
+// SMSLimit caps the messages a number receives within a window
+type SMSLimit struct {
+	Window time.Duration
+	Limit  int // 0 disables the limit
+}
+
+// CreateWithinLimits records the message as queued, or as rate limited with
+// reason if its number already reached one of the limits, and reports
+// whether it is within them. Rejected and failed messages do not count
+// towards a limit. The check and the insert happen in one transaction that
+// holds a lock on the number, so concurrent sends cannot exceed a limit.
+func (m *SMSMessage) CreateWithinLimits(limits []SMSLimit, reason string) (bool, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// PostgreSQL needs the lock to see the other sends to the number; SQLite
+	// takes a database write lock with the insert
+	isSQLite := getEnv("DB_TYPE", "postgres") == "sqlite"
+	if !isSQLite {
+		if _, err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext($1))", m.PhoneNumber); err != nil {
+			return false, err
+		}
+	}
+
+	now := smsNow()
+	m.Status, m.Error = SMSQueued, ""
+	m.CreatedAt, m.UpdatedAt = now, now
+	if isSQLite {
+		result, err := tx.Exec(`INSERT INTO sms_messages (user_id, phone_number, body, provider, status, error, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, m.UserID, m.PhoneNumber, m.Body, m.Provider, m.Status, m.Error, now, now)
+		if err != nil {
+			return false, err
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return false, err
+		}
+		m.ID = int(id)
+	} else {
+		err := tx.QueryRow(`INSERT INTO sms_messages (user_id, phone_number, body, provider, status, error, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`, m.UserID, m.PhoneNumber, m.Body, m.Provider, m.Status, m.Error, now, now).Scan(&m.ID)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	within := true
+	for _, limit := range limits {
+		if limit.Limit == 0 {
+			continue
+		}
+		var count int
+		err := tx.QueryRow("SELECT COUNT(*) FROM sms_messages WHERE phone_number = "+getPlaceholder(1)+
+			" AND created_at >= "+getPlaceholder(2)+" AND id <> "+getPlaceholder(3)+
+			" AND status NOT IN ('"+SMSRateLimited+"', '"+SMSFailed+"')",
+			m.PhoneNumber, now.Add(-limit.Window), m.ID).Scan(&count)
+		if err != nil {
+			return false, err
+		}
+		if count >= limit.Limit {
+			within = false
+			break
+		}
+	}
+
+	if !within {
+		reason = truncateRunes(reason, 500)
+		_, err := tx.Exec("UPDATE sms_messages SET status = '"+SMSRateLimited+"', error = "+getPlaceholder(1)+
+			" WHERE id = "+getPlaceholder(2), reason, m.ID)
+		if err != nil {
+			return false, err
+		}
+		m.Status, m.Error = SMSRateLimited, reason
+	}
+
+	return within, tx.Commit()
+}
+
+const smsMessageColumns = `id, user_id, phone_number, body, provider, provider_message_id, status, error,
+	sent_at, delivered_at, created_at, updated_at FROM sms_messages`
+
+func scanSMSMessage(row interface{ Scan(...interface{}) error }) (*SMSMessage, error) {
+	m := &SMSMessage{}
+	var providerID, errText sql.NullString
+	err := row.Scan(&m.ID, &m.UserID, &m.PhoneNumber, &m.Body, &m.Provider, &providerID, &m.Status, &errText,
+		&m.SentAt, &m.DeliveredAt, &m.CreatedAt, &m.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	m.ProviderMessageID, m.Error = providerID.String, errText.String
+	return m, nil
+}
+
+// GetSMSMessageByID retrieves a message
+func GetSMSMessageByID(id int) (*SMSMessage, error) {
+	return scanSMSMessage(database.DB.QueryRow("SELECT "+smsMessageColumns+" WHERE id = "+getPlaceholder(1), id))
+}
+
+// GetSMSMessageByProviderID retrieves a message by the ID the provider gave it
+func GetSMSMessageByProviderID(provider, providerMessageID string) (*SMSMessage, error) {
+	return scanSMSMessage(database.DB.QueryRow("SELECT "+smsMessageColumns+" WHERE provider = "+getPlaceholder(1)+
+		" AND provider_message_id = "+getPlaceholder(2), provider, providerMessageID))
+}
+
+// GetSMSMessages lists the SMS log, newest first
+func GetSMSMessages(filter SMSMessageFilter) ([]SMSMessage, error) {
+	messages := []SMSMessage{}
+
+	query := "SELECT " + smsMessageColumns + " WHERE 1=1"
+	args := []interface{}{}
+
+	if filter.PhoneNumber != "" {
+		args = append(args, filter.PhoneNumber)
+		query += " AND phone_number = " + getPlaceholder(len(args))
+	}
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		query += " AND status = " + getPlaceholder(len(args))
+	}
+
+	query += " ORDER BY id DESC"
+
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += " LIMIT " + getPlaceholder(len(args))
+		if filter.Offset > 0 {
+			args = append(args, filter.Offset)
+			query += " OFFSET " + getPlaceholder(len(args))
+		}
+	}
+
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		m, err := scanSMSMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, *m)
+	}
+
+	return messages, rows.Err()
+}
+
+// UpdateDeliveryStatus applies a delivery report. Reports can arrive out of
+// order, so a final status (delivered, undelivered) is never replaced.
+func (m *SMSMessage) UpdateDeliveryStatus(status, reason string) error {
+	now := smsNow()
+	query := "UPDATE sms_messages SET status = " + getPlaceholder(1) + ", error = " + getPlaceholder(2) +
+		", updated_at = " + getPlaceholder(3)
+	args := []interface{}{status, truncateRunes(reason, 500), now}
+
+	if status == SMSDelivered {
+		args = append(args, now)
+		query += ", delivered_at = " + getPlaceholder(len(args))
+	}
+
+	args = append(args, m.ID)
+	query += " WHERE id = " + getPlaceholder(len(args)) + " AND status NOT IN ('" + SMSDelivered + "', '" + SMSUndelivered + "')"
+
+	if _, err := database.DB.Exec(query, args...); err != nil {
+		return err
+	}
+
+	fresh, err := GetSMSMessageByID(m.ID)
+	if err != nil {
+		return err
+	}
+	*m = *fresh
+	return nil
+}
+
+// GetUserPhone returns the phone number SMS for a user go to: the user's own
+// number, or for doctors the phone of their doctor profile
+func GetUserPhone(userID int) (string, error) {
+	var phone sql.NullString
+	var email string
+	err := database.DB.QueryRow("SELECT phone, email FROM users WHERE id = "+getPlaceholder(1), userID).Scan(&phone, &email)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(phone.String) != "" {
+		return phone.String, nil
+	}
+
+	if doctor, err := GetDoctorByEmail(email); err == nil && doctor.Phone != "" {
+		return doctor.Phone, nil
+	}
+	return "", nil
+}
+
+// SetUserPhone stores a user's phone number, which callers normalize to E.164
+func SetUserPhone(userID int, phone string) error {
+	_, err := database.DB.Exec("UPDATE users SET phone = "+getPlaceholder(1)+", updated_at = "+getPlaceholder(2)+
+		" WHERE id = "+getPlaceholder(3), phone, smsNow(), userID)
+	return err
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConcurrentSMSStayWithinLimit(t *testing.T) {
+	useTestDB(t)
+	limits := []SMSLimit{{Window: time.Hour, Limit: 3}}
+
+	var wg sync.WaitGroup
+	results := make(chan bool, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m := &SMSMessage{PhoneNumber: "+84901234567", Body: "Lịch hẹn", Provider: "fake"}
+			within, err := m.CreateWithinLimits(limits, "rate limited")
+			if err != nil {
+				t.Errorf("CreateWithinLimits: %v", err)
+			}
+			results <- within
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	sent := 0
+	for within := range results {
+		if within {
+			sent++
+		}
+	}
+	if sent != 3 {
+		t.Errorf("%d of 10 concurrent messages were within a limit of 3", sent)
+	}
+
+	limited, err := GetSMSMessages(SMSMessageFilter{Status: SMSRateLimited})
+	if err != nil {
+		t.Fatalf("GetSMSMessages: %v", err)
+	}
+	if len(limited) != 7 {
+		t.Errorf("%d messages logged as rate limited, want 7", len(limited))
+	}
+}
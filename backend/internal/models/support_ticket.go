@@ -0,0 +1,548 @@
+package models
+
+import (
+	"errors"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/dottrip/fpt-swp/internal/database"
+)
+
+// Ticket statuses
+const (
+	TicketOpen       = "open"
+	TicketInProgress = "in_progress"
+	TicketResolved   = "resolved"
+	TicketClosed     = "closed"
+)
+
+// TicketCategories are the categories a support ticket can be filed under
+var TicketCategories = []string{"appointment", "medical", "billing", "technical", "other"}
+
+// SLATarget is how quickly a ticket must get its first staff reply and be resolved
+type SLATarget struct {
+	FirstResponse time.Duration
+	Resolution    time.Duration
+}
+
+// TicketSLA holds the SLA targets per priority
+var TicketSLA = map[string]SLATarget{
+	PriorityUrgent: {FirstResponse: time.Hour, Resolution: 4 * time.Hour},
+	PriorityHigh:   {FirstResponse: 4 * time.Hour, Resolution: 24 * time.Hour},
+	PriorityMedium: {FirstResponse: 8 * time.Hour, Resolution: 48 * time.Hour},
+	PriorityLow:    {FirstResponse: 24 * time.Hour, Resolution: 72 * time.Hour},
+}
+
+// ErrTicketClosed is returned when replying to a closed ticket
+var ErrTicketClosed = errors.New("ticket is closed")
+
+// SupportTicket represents a support request filed by a patient
+type SupportTicket struct {
+	ID                    int        `json:"id"`
+	PatientID             int        `json:"patient_id"`
+	PatientName           string     `json:"patient_name"`
+	PatientEmail          string     `json:"patient_email"`
+	Subject               string     `json:"subject"`
+	Description           string     `json:"description"`
+	Category              string     `json:"category"` // appointment, medical, billing, technical, other
+	Priority              string     `json:"priority"` // low, medium, high, urgent
+	Status                string     `json:"status"`   // open, in_progress, resolved, closed
+	AssignedTo            *int       `json:"assigned_to,omitempty"`
+	AssignedToName        string     `json:"assigned_to_name,omitempty"`
+	FirstResponseAt       *time.Time `json:"first_response_at,omitempty"`
+	FirstResponseDueAt    time.Time  `json:"first_response_due_at"`
+	ResolutionDueAt       time.Time  `json:"resolution_due_at"`
+	ResolvedAt            *time.Time `json:"resolved_at,omitempty"`
+	ClosedAt              *time.Time `json:"closed_at,omitempty"`
+	FirstResponseBreached bool       `json:"first_response_breached"`
+	ResolutionBreached    bool       `json:"resolution_breached"`
+	MessageCount          int        `json:"message_count"`
+	CreatedAt             time.Time  `json:"created_at"`
+	UpdatedAt             time.Time  `json:"updated_at"`
+
+	Messages []TicketMessage `json:"messages,omitempty"`
+}
+
+// TicketMessage is a reply in a ticket thread
+type TicketMessage struct {
+	ID         int       `json:"id"`
+	TicketID   int       `json:"ticket_id"`
+	AuthorID   int       `json:"author_id"`
+	AuthorName string    `json:"author_name"`
+	AuthorRole string    `json:"author_role"` // staff or patient
+	Body       string    `json:"body"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// SupportTicketRequest represents the request structure for filing a ticket
+type SupportTicketRequest struct {
+	Subject     string `json:"subject" binding:"required,max=255"`
+	Description string `json:"description" binding:"required"`
+	Category    string `json:"category" binding:"omitempty,oneof=appointment medical billing technical other"`
+	Priority    string `json:"priority" binding:"omitempty,oneof=low medium high urgent"`
+}
+
+// SupportTicketFilter represents filters for the ticket queue
+type SupportTicketFilter struct {
+	PatientID  int
+	Status     string
+	Priority   string
+	Category   string
+	AssignedTo int
+	Unassigned bool
+	Breached   bool
+	Limit      int
+	Offset     int
+}
+
+// isStaffRole reports whether a user role answers tickets
+func isStaffRole(role string) bool {
+	return role == "staff" || role == "admin"
+}
+
+// ticketNow returns the current time truncated to seconds, so timestamps
+// written by the API compare correctly as text in SQLite
+func ticketNow() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
+}
+
+// BeforeSave is a hook that gets called before saving the ticket
+func (t *SupportTicket) BeforeSave() error {
+	t.Subject = html.EscapeString(strings.TrimSpace(t.Subject))
+	t.Description = html.EscapeString(strings.TrimSpace(t.Description))
+	return nil
+}
+
+// Validate validates the ticket data
+func (t *SupportTicket) Validate() error {
+	if t.PatientID == 0 {
+		return requiredError("patient_id", "patient ID is required")
+	}
+	if strings.TrimSpace(t.Subject) == "" {
+		return requiredError("subject", "subject is required")
+	}
+	if len([]rune(t.Subject)) > 255 {
+		return maxError("subject", 255, "subject must be at most 255 characters")
+	}
+	if strings.TrimSpace(t.Description) == "" {
+		return requiredError("description", "description is required")
+	}
+	if t.Category == "" {
+		t.Category = "other"
+	}
+	if !IsValidTicketCategory(t.Category) {
+		return oneOfError("category", "appointment medical billing technical other", "category must be one of: appointment, medical, billing, technical, other")
+	}
+	if t.Priority == "" {
+		t.Priority = PriorityMedium
+	}
+	if !IsValidPriority(t.Priority) {
+		return oneOfError("priority", "low medium high urgent", "priority must be low, medium, high, or urgent")
+	}
+	return nil
+}
+
+// IsValidTicketCategory reports whether category is a known ticket category
+func IsValidTicketCategory(category string) bool {
+	for _, c := range TicketCategories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+// applySLA sets the due dates of the ticket from its priority and creation time
+func (t *SupportTicket) applySLA(created time.Time) {
+	target := TicketSLA[t.Priority]
+	t.FirstResponseDueAt = created.Add(target.FirstResponse)
+	t.ResolutionDueAt = created.Add(target.Resolution)
+}
+
+// computeBreaches sets the SLA breach flags
+func (t *SupportTicket) computeBreaches(now time.Time) {
+	if t.FirstResponseAt != nil {
+		t.FirstResponseBreached = t.FirstResponseAt.After(t.FirstResponseDueAt)
+	} else {
+		t.FirstResponseBreached = t.Status != TicketResolved && t.Status != TicketClosed && now.After(t.FirstResponseDueAt)
+	}
+
+	if t.ResolvedAt != nil {
+		t.ResolutionBreached = t.ResolvedAt.After(t.ResolutionDueAt)
+	} else {
+		t.ResolutionBreached = t.Status != TicketClosed && now.After(t.ResolutionDueAt)
+	}
+}
+
+// Create files a new ticket, with the description as the first message of the thread
+func (t *SupportTicket) Create() error {
+	if err := t.Validate(); err != nil {
+		return validationError(err)
+	}
+	if err := t.BeforeSave(); err != nil {
+		return err
+	}
+
+	now := ticketNow()
+	t.Status = TicketOpen
+	t.applySLA(now)
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	dbType := getEnv("DB_TYPE", "postgres")
+
+	if dbType == "sqlite" {
+		query := `
+			INSERT INTO support_tickets (patient_id, subject, description, category, priority, status,
+				first_response_due_at, resolution_due_at, last_activity_at, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`
+
+		result, err := tx.Exec(query, t.PatientID, t.Subject, t.Description, t.Category, t.Priority, t.Status,
+			t.FirstResponseDueAt, t.ResolutionDueAt, now, now, now)
+		if err != nil {
+			return err
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		t.ID = int(id)
+	} else {
+		query := `
+			INSERT INTO support_tickets (patient_id, subject, description, category, priority, status,
+				first_response_due_at, resolution_due_at, last_activity_at, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+			RETURNING id
+		`
+
+		err := tx.QueryRow(query, t.PatientID, t.Subject, t.Description, t.Category, t.Priority, t.Status,
+			t.FirstResponseDueAt, t.ResolutionDueAt, now, now, now).Scan(&t.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	messageQuery := "INSERT INTO support_ticket_messages (ticket_id, author_id, body, created_at) VALUES (" +
+		getPlaceholder(1) + ", " + getPlaceholder(2) + ", " + getPlaceholder(3) + ", " + getPlaceholder(4) + ")"
+	if _, err := tx.Exec(messageQuery, t.ID, t.PatientID, t.Description, now); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	t.CreatedAt, t.UpdatedAt = now, now
+	t.MessageCount = 1
+	return nil
+}
+
+const supportTicketColumns = `
+	t.id, t.patient_id, COALESCE(p.username, ''), COALESCE(p.email, ''), t.subject, t.description,
+	t.category, t.priority, t.status, t.assigned_to, COALESCE(a.username, ''), t.first_response_at,
+	t.first_response_due_at, t.resolution_due_at, t.resolved_at, t.closed_at,
+	(SELECT COUNT(*) FROM support_ticket_messages m WHERE m.ticket_id = t.id),
+	t.created_at, t.updated_at`
+
+const supportTicketJoins = `
+	FROM support_tickets t
+	LEFT JOIN users p ON p.id = t.patient_id
+	LEFT JOIN users a ON a.id = t.assigned_to`
+
+// scanSupportTicket scans a row selected with supportTicketColumns
+func scanSupportTicket(row interface{ Scan(...interface{}) error }, now time.Time) (*SupportTicket, error) {
+	t := &SupportTicket{}
+	err := row.Scan(
+		&t.ID, &t.PatientID, &t.PatientName, &t.PatientEmail, &t.Subject, &t.Description,
+		&t.Category, &t.Priority, &t.Status, &t.AssignedTo, &t.AssignedToName, &t.FirstResponseAt,
+		&t.FirstResponseDueAt, &t.ResolutionDueAt, &t.ResolvedAt, &t.ClosedAt,
+		&t.MessageCount, &t.CreatedAt, &t.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	t.computeBreaches(now)
+	return t, nil
+}
+
+// GetSupportTicketByID retrieves a ticket by ID
+func GetSupportTicketByID(id int) (*SupportTicket, error) {
+	query := `SELECT ` + supportTicketColumns + supportTicketJoins + ` WHERE t.id = ` + getPlaceholder(1)
+	return scanSupportTicket(database.DB.QueryRow(query, id), ticketNow())
+}
+
+// GetSupportTickets lists tickets. Active tickets come first, ordered by the
+// resolution deadline, so the queue shows what needs attention soonest.
+func GetSupportTickets(filter SupportTicketFilter) ([]SupportTicket, error) {
+	tickets := []SupportTicket{}
+	now := ticketNow()
+
+	query := `SELECT ` + supportTicketColumns + supportTicketJoins + ` WHERE 1=1`
+	args := []interface{}{}
+
+	if filter.PatientID != 0 {
+		args = append(args, filter.PatientID)
+		query += " AND t.patient_id = " + getPlaceholder(len(args))
+	}
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		query += " AND t.status = " + getPlaceholder(len(args))
+	}
+	if filter.Priority != "" {
+		args = append(args, filter.Priority)
+		query += " AND t.priority = " + getPlaceholder(len(args))
+	}
+	if filter.Category != "" {
+		args = append(args, filter.Category)
+		query += " AND t.category = " + getPlaceholder(len(args))
+	}
+	if filter.AssignedTo != 0 {
+		args = append(args, filter.AssignedTo)
+		query += " AND t.assigned_to = " + getPlaceholder(len(args))
+	}
+	if filter.Unassigned {
+		query += " AND t.assigned_to IS NULL"
+	}
+	if filter.Breached {
+		args = append(args, now, now)
+		query += ` AND (
+			(t.first_response_at IS NULL AND t.status IN ('open', 'in_progress') AND t.first_response_due_at < ` + getPlaceholder(len(args)-1) + `)
+			OR t.first_response_at > t.first_response_due_at
+			OR (t.resolved_at IS NULL AND t.status IN ('open', 'in_progress') AND t.resolution_due_at < ` + getPlaceholder(len(args)) + `)
+			OR t.resolved_at > t.resolution_due_at)`
+	}
+
+	query += " ORDER BY CASE WHEN t.status IN ('open', 'in_progress') THEN 0 ELSE 1 END, t.resolution_due_at ASC, t.id ASC"
+
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += " LIMIT " + getPlaceholder(len(args))
+		if filter.Offset > 0 {
+			args = append(args, filter.Offset)
+			query += " OFFSET " + getPlaceholder(len(args))
+		}
+	}
+
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		t, err := scanSupportTicket(rows, now)
+		if err != nil {
+			return nil, err
+		}
+		tickets = append(tickets, *t)
+	}
+
+	return tickets, rows.Err()
+}
+
+// GetTicketMessages returns the thread of a ticket in chronological order
+func GetTicketMessages(ticketID int) ([]TicketMessage, error) {
+	messages := []TicketMessage{}
+
+	query := `
+		SELECT m.id, m.ticket_id, m.author_id, COALESCE(u.username, ''), COALESCE(u.role, ''), m.body, m.created_at
+		FROM support_ticket_messages m
+		LEFT JOIN users u ON u.id = m.author_id
+		WHERE m.ticket_id = ` + getPlaceholder(1) + `
+		ORDER BY m.created_at ASC, m.id ASC`
+
+	rows, err := database.DB.Query(query, ticketID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m TicketMessage
+		var role string
+		if err := rows.Scan(&m.ID, &m.TicketID, &m.AuthorID, &m.AuthorName, &role, &m.Body, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		m.AuthorRole = "patient"
+		if isStaffRole(role) {
+			m.AuthorRole = "staff"
+		}
+		messages = append(messages, m)
+	}
+
+	return messages, rows.Err()
+}
+
+// Reply adds a message to the ticket thread. The first staff reply stops the
+// first-response timer and starts work on an open ticket; a patient reply to a
+// resolved ticket reopens it.
+func (t *SupportTicket) Reply(author *User, body string) (*TicketMessage, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return nil, requiredError("message", "message is required")
+	}
+	if len([]rune(body)) > 5000 {
+		return nil, &ValidationError{Field: "message", Code: "max", Param: "5000", Message: "message must be at most 5000 characters"}
+	}
+	if t.Status == TicketClosed {
+		return nil, ErrTicketClosed
+	}
+
+	now := ticketNow()
+	message := &TicketMessage{
+		TicketID:   t.ID,
+		AuthorID:   author.ID,
+		AuthorName: author.Username,
+		AuthorRole: "patient",
+		Body:       html.EscapeString(body),
+		CreatedAt:  now,
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if getEnv("DB_TYPE", "postgres") == "sqlite" {
+		result, err := tx.Exec("INSERT INTO support_ticket_messages (ticket_id, author_id, body, created_at) VALUES (?, ?, ?, ?)",
+			t.ID, author.ID, message.Body, now)
+		if err != nil {
+			return nil, err
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+		message.ID = int(id)
+	} else {
+		err := tx.QueryRow("INSERT INTO support_ticket_messages (ticket_id, author_id, body, created_at) VALUES ($1, $2, $3, $4) RETURNING id",
+			t.ID, author.ID, message.Body, now).Scan(&message.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	update := "UPDATE support_tickets SET last_activity_at = " + getPlaceholder(1) + ", updated_at = " + getPlaceholder(2)
+	args := []interface{}{now, now}
+
+	if isStaffRole(author.Role) {
+		message.AuthorRole = "staff"
+		if t.FirstResponseAt == nil {
+			args = append(args, now)
+			update += ", first_response_at = " + getPlaceholder(len(args))
+		}
+		if t.Status == TicketOpen {
+			update += ", status = '" + TicketInProgress + "'"
+		}
+	} else if t.Status == TicketResolved {
+		update += ", status = '" + TicketOpen + "', resolved_at = NULL"
+	}
+
+	args = append(args, t.ID)
+	update += " WHERE id = " + getPlaceholder(len(args))
+	if _, err := tx.Exec(update, args...); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return message, t.reload()
+}
+
+// Assign gives the ticket to a staff member and starts work on it if it was open
+func (t *SupportTicket) Assign(staffID int) error {
+	now := ticketNow()
+	query := "UPDATE support_tickets SET assigned_to = " + getPlaceholder(1) +
+		", status = CASE WHEN status = '" + TicketOpen + "' THEN '" + TicketInProgress + "' ELSE status END" +
+		", updated_at = " + getPlaceholder(2) + ", last_activity_at = " + getPlaceholder(3) +
+		" WHERE id = " + getPlaceholder(4)
+
+	if _, err := database.DB.Exec(query, staffID, now, now, t.ID); err != nil {
+		return err
+	}
+	return t.reload()
+}
+
+// SetStatus moves the ticket to status, recording when it was resolved or closed
+func (t *SupportTicket) SetStatus(status string) error {
+	if status != TicketOpen && status != TicketInProgress && status != TicketResolved && status != TicketClosed {
+		return oneOfError("status", "open in_progress resolved closed", "status must be one of: open, in_progress, resolved, closed")
+	}
+
+	now := ticketNow()
+	query := "UPDATE support_tickets SET status = " + getPlaceholder(1) + ", updated_at = " + getPlaceholder(2) +
+		", last_activity_at = " + getPlaceholder(3)
+	args := []interface{}{status, now, now}
+
+	switch status {
+	case TicketResolved:
+		args = append(args, now)
+		query += ", resolved_at = " + getPlaceholder(len(args)) + ", closed_at = NULL"
+	case TicketClosed:
+		args = append(args, now)
+		query += ", closed_at = " + getPlaceholder(len(args))
+	default:
+		query += ", resolved_at = NULL, closed_at = NULL"
+	}
+
+	args = append(args, t.ID)
+	query += " WHERE id = " + getPlaceholder(len(args))
+
+	if _, err := database.DB.Exec(query, args...); err != nil {
+		return err
+	}
+	return t.reload()
+}
+
+// SetPriority changes the priority and recomputes the SLA due dates from the
+// ticket's creation time
+func (t *SupportTicket) SetPriority(priority string) error {
+	if !IsValidPriority(priority) {
+		return oneOfError("priority", "low medium high urgent", "priority must be low, medium, high, or urgent")
+	}
+
+	t.Priority = priority
+	t.applySLA(t.CreatedAt)
+
+	query := "UPDATE support_tickets SET priority = " + getPlaceholder(1) + ", first_response_due_at = " + getPlaceholder(2) +
+		", resolution_due_at = " + getPlaceholder(3) + ", updated_at = " + getPlaceholder(4) + " WHERE id = " + getPlaceholder(5)
+
+	if _, err := database.DB.Exec(query, priority, t.FirstResponseDueAt, t.ResolutionDueAt, ticketNow(), t.ID); err != nil {
+		return err
+	}
+	return t.reload()
+}
+
+// reload refreshes the ticket from the database
+func (t *SupportTicket) reload() error {
+	fresh, err := GetSupportTicketByID(t.ID)
+	if err != nil {
+		return err
+	}
+	*t = *fresh
+	return nil
+}
+
+// CloseIdleResolvedTickets closes resolved tickets without activity for idle.
+// It returns the number of tickets closed.
+func CloseIdleResolvedTickets(idle time.Duration) (int64, error) {
+	now := ticketNow()
+	query := "UPDATE support_tickets SET status = '" + TicketClosed + "', closed_at = " + getPlaceholder(1) +
+		", updated_at = " + getPlaceholder(2) + " WHERE status = '" + TicketResolved + "' AND last_activity_at < " + getPlaceholder(3)
+
+	result, err := database.DB.Exec(query, now, now, now.Add(-idle))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
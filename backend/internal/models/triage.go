@@ -0,0 +1,83 @@
+package models
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/dottrip/fpt-swp/internal/textutil"
+)
+
+// Consultation priorities, from least to most urgent
+const (
+	PriorityLow    = "low"
+	PriorityMedium = "medium"
+	PriorityHigh   = "high"
+	PriorityUrgent = "urgent"
+)
+
+// priorityRank orders priorities for the queue; higher is served first
+var priorityRank = map[string]int{
+	PriorityLow:    1,
+	PriorityMedium: 2,
+	PriorityHigh:   3,
+	PriorityUrgent: 4,
+}
+
+// IsValidPriority reports whether p is a known priority
+func IsValidPriority(p string) bool {
+	_, ok := priorityRank[p]
+	return ok
+}
+
+// triageRule raises a request to priority when its symptoms mention any of
+// the keywords. Keywords are written without diacritics because symptoms are
+// folded before matching, so "khó thở" and "kho tho" both match. Keywords
+// match whole words; a trailing "*" also matches longer words ("pregnan*"
+// matches "pregnancy").
+type triageRule struct {
+	priority string
+	keywords []string
+}
+
+// triageRules are checked from most to least urgent; the first match wins
+var triageRules = []triageRule{
+	{PriorityUrgent, []string{
+		"kho tho", "ngat tho", "dau nguc", "tuc nguc", "bat tinh", "ngat xiu", "co giat",
+		"dot quy", "liet nua nguoi", "meo mieng", "chay mau nhieu", "xuat huyet", "ngo doc",
+		"tu tu", "chest pain", "can't breathe", "shortness of breath", "unconscious",
+		"seizure*", "stroke", "severe bleeding", "poison*", "suicid*",
+	}},
+	{PriorityHigh, []string{
+		"sot cao", "non ra mau", "di ngoai ra mau", "dau bung du doi", "dau dau du doi",
+		"chay mau", "gay xuong", "bi bong", "di ung", "phu mat", "mang thai", "co thai",
+		"high fever", "vomiting blood", "severe pain", "bleeding", "fracture*", "burn*",
+		"allergi*", "pregnan*",
+	}},
+	{PriorityMedium, []string{
+		"sot", "dau", "non", "tieu chay", "ho keo dai", "chong mat", "phat ban", "nhiem trung",
+		"fever*", "pain*", "vomit*", "diarrh*", "dizz*", "rash*", "infection*",
+	}},
+}
+
+// TriagePriority assigns a priority to a consultation request from its
+// symptom description. Requests that match no rule get low priority.
+func TriagePriority(symptoms string) string {
+	words := strings.FieldsFunc(textutil.Fold(symptoms), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\''
+	})
+	text := " " + strings.Join(words, " ") + " "
+
+	for _, rule := range triageRules {
+		for _, keyword := range rule.keywords {
+			pattern := " " + keyword + " "
+			if strings.HasSuffix(keyword, "*") {
+				pattern = " " + strings.TrimSuffix(keyword, "*")
+			}
+			if strings.Contains(text, pattern) {
+				return rule.priority
+			}
+		}
+	}
+
+	return PriorityLow
+}
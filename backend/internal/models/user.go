@@ -1,7 +1,6 @@
 package models
 
 import (
-	"errors"
 	"fmt"
 	"html"
 	"os"
@@ -42,16 +41,16 @@ func (u *User) BeforeSave() error {
 // Validate validates the user data
 func (u *User) Validate() error {
 	if u.Username == "" {
-		return errors.New("username is required")
+		return requiredError("username", "username is required")
 	}
 	if u.Email == "" {
-		return errors.New("email is required")
+		return requiredError("email", "email is required")
 	}
 	if u.Password == "" {
-		return errors.New("password is required")
+		return requiredError("password", "password is required")
 	}
 	if len(u.Password) < 6 {
-		return errors.New("password must be at least 6 characters")
+		return &ValidationError{Field: "password", Code: "min", Param: "6", Message: "password must be at least 6 characters"}
 	}
 	return nil
 }
@@ -77,7 +76,7 @@ func getEnv(key, defaultValue string) string {
 // Create creates a new user in the database
 func (u *User) Create() error {
 	if err := u.Validate(); err != nil {
-		return err
+		return validationError(err)
 	}
 
 	// Set default role if not specified
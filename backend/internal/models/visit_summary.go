@@ -0,0 +1,165 @@
+package models
+
+import (
+	"html"
+	"strings"
+	"time"
+
+	"github.com/dottrip/fpt-swp/internal/database"
+)
+
+// VisitSummary represents the summary a doctor writes after a visit
+type VisitSummary struct {
+	ID             int    `json:"id"`
+	Code           string `json:"code"` // public verification code
+	DoctorID       int    `json:"doctor_id"`
+	PrescriptionID *int   `json:"prescription_id,omitempty"`
+	PatientInfo
+	VisitDate      time.Time `json:"visit_date"`
+	ChiefComplaint string    `json:"chief_complaint"`
+	Findings       string    `json:"findings"`
+	Diagnosis      string    `json:"diagnosis"`
+	TreatmentPlan  string    `json:"treatment_plan"`
+	FollowUpDate   string    `json:"follow_up_date"`
+	Notes          string    `json:"notes"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// VisitSummaryRequest represents the request structure for creating a visit summary
+type VisitSummaryRequest struct {
+	DoctorID       int  `json:"doctor_id" binding:"required"`
+	PrescriptionID *int `json:"prescription_id"`
+	PatientInfo
+	VisitDate      *time.Time `json:"visit_date"`
+	ChiefComplaint string     `json:"chief_complaint"`
+	Findings       string     `json:"findings"`
+	Diagnosis      string     `json:"diagnosis" binding:"required"`
+	TreatmentPlan  string     `json:"treatment_plan"`
+	FollowUpDate   string     `json:"follow_up_date"`
+	Notes          string     `json:"notes"`
+}
+
+// BeforeSave sanitizes visit summary data before saving
+func (v *VisitSummary) BeforeSave() error {
+	v.PatientInfo.sanitize()
+	v.ChiefComplaint = html.EscapeString(strings.TrimSpace(v.ChiefComplaint))
+	v.Findings = html.EscapeString(strings.TrimSpace(v.Findings))
+	v.Diagnosis = html.EscapeString(strings.TrimSpace(v.Diagnosis))
+	v.TreatmentPlan = html.EscapeString(strings.TrimSpace(v.TreatmentPlan))
+	v.FollowUpDate = strings.TrimSpace(v.FollowUpDate)
+	v.Notes = html.EscapeString(strings.TrimSpace(v.Notes))
+
+	if v.VisitDate.IsZero() {
+		v.VisitDate = time.Now()
+	}
+
+	return nil
+}
+
+// Validate validates the visit summary data
+func (v *VisitSummary) Validate() error {
+	if v.DoctorID == 0 {
+		return requiredError("doctor_id", "doctor ID is required")
+	}
+	if strings.TrimSpace(v.PatientName) == "" {
+		return requiredError("patient_name", "patient name is required")
+	}
+	if strings.TrimSpace(v.Diagnosis) == "" {
+		return requiredError("diagnosis", "diagnosis is required")
+	}
+	return nil
+}
+
+// Create creates a new visit summary in the database
+func (v *VisitSummary) Create() error {
+	if err := v.Validate(); err != nil {
+		return validationError(err)
+	}
+	if err := v.BeforeSave(); err != nil {
+		return err
+	}
+
+	code, err := generateVerificationCode()
+	if err != nil {
+		return err
+	}
+	v.Code = code
+
+	dbType := getEnv("DB_TYPE", "postgres")
+
+	if dbType == "sqlite" {
+		query := `
+			INSERT INTO visit_summaries (
+				code, doctor_id, prescription_id, patient_id, patient_name, patient_date_of_birth,
+				patient_gender, patient_phone, patient_address, visit_date, chief_complaint,
+				findings, diagnosis, treatment_plan, follow_up_date, notes, created_at, updated_at
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		`
+
+		result, err := database.DB.Exec(query,
+			v.Code, v.DoctorID, v.PrescriptionID, v.PatientID, v.PatientName, v.PatientDateOfBirth,
+			v.PatientGender, v.PatientPhone, v.PatientAddress, v.VisitDate, v.ChiefComplaint,
+			v.Findings, v.Diagnosis, v.TreatmentPlan, v.FollowUpDate, v.Notes,
+		)
+		if err != nil {
+			return err
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		v.ID = int(id)
+
+		selectQuery := `SELECT created_at, updated_at FROM visit_summaries WHERE id = ?`
+		return database.DB.QueryRow(selectQuery, v.ID).Scan(&v.CreatedAt, &v.UpdatedAt)
+	}
+
+	query := `
+		INSERT INTO visit_summaries (
+			code, doctor_id, prescription_id, patient_id, patient_name, patient_date_of_birth,
+			patient_gender, patient_phone, patient_address, visit_date, chief_complaint,
+			findings, diagnosis, treatment_plan, follow_up_date, notes
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+		RETURNING id, created_at, updated_at
+	`
+
+	return database.DB.QueryRow(query,
+		v.Code, v.DoctorID, v.PrescriptionID, v.PatientID, v.PatientName, v.PatientDateOfBirth,
+		v.PatientGender, v.PatientPhone, v.PatientAddress, v.VisitDate, v.ChiefComplaint,
+		v.Findings, v.Diagnosis, v.TreatmentPlan, v.FollowUpDate, v.Notes,
+	).Scan(&v.ID, &v.CreatedAt, &v.UpdatedAt)
+}
+
+const visitSummaryColumns = `
+	id, code, doctor_id, prescription_id, patient_id, patient_name, patient_date_of_birth,
+	patient_gender, patient_phone, patient_address, visit_date, chief_complaint, findings,
+	diagnosis, treatment_plan, follow_up_date, notes, created_at, updated_at
+`
+
+// scanVisitSummary scans a visit summary row selected with visitSummaryColumns
+func scanVisitSummary(row interface{ Scan(...interface{}) error }) (*VisitSummary, error) {
+	v := &VisitSummary{}
+	err := row.Scan(
+		&v.ID, &v.Code, &v.DoctorID, &v.PrescriptionID, &v.PatientID, &v.PatientName, &v.PatientDateOfBirth,
+		&v.PatientGender, &v.PatientPhone, &v.PatientAddress, &v.VisitDate, &v.ChiefComplaint, &v.Findings,
+		&v.Diagnosis, &v.TreatmentPlan, &v.FollowUpDate, &v.Notes, &v.CreatedAt, &v.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// GetVisitSummaryByID retrieves a visit summary by ID
+func GetVisitSummaryByID(id int) (*VisitSummary, error) {
+	query := "SELECT " + visitSummaryColumns + " FROM visit_summaries WHERE id = " + getPlaceholder(1)
+	return scanVisitSummary(database.DB.QueryRow(query, id))
+}
+
+// GetVisitSummaryByCode retrieves a visit summary by its verification code
+func GetVisitSummaryByCode(code string) (*VisitSummary, error) {
+	query := "SELECT " + visitSummaryColumns + " FROM visit_summaries WHERE code = " + getPlaceholder(1)
+	return scanVisitSummary(database.DB.QueryRow(query, strings.ToUpper(code)))
+}
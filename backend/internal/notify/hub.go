@@ -0,0 +1,162 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+
+	"github.com/dottrip/fpt-swp/internal/models"
+	"github.com/dottrip/fpt-swp/internal/realtime"
+)
+
+// busChannel is the bus channel used for notification fan-out
+const busChannel = "notification_events"
+
+// Stream event types
+const (
+	StreamNotification = "notification"
+	StreamRead         = "read"
+)
+
+// StreamEvent is pushed to the open streams of a user
+type StreamEvent struct {
+	Type           string               `json:"type"`
+	UserID         int                  `json:"user_id"`
+	Notification   *models.Notification `json:"notification,omitempty"`
+	NotificationID int                  `json:"notification_id,omitempty"`
+}
+
+// Hub tracks the notification streams open on this replica and delivers bus
+// events to the streams of the event's user
+type Hub struct {
+	bus     realtime.Bus
+	mu      sync.RWMutex
+	streams map[int]map[chan StreamEvent]struct{} // keyed by user ID
+}
+
+// DefaultHub is the hub used by Notify and the stream handler
+var DefaultHub *Hub
+
+// Init creates DefaultHub on the bus matching the configured database
+func Init() {
+	bus, err := realtime.New(busChannel)
+	if err != nil {
+		log.Fatal("Failed to start notification event bus:", err)
+	}
+
+	DefaultHub = NewHub(bus)
+	go DefaultHub.Run()
+}
+
+// NewHub creates a hub on top of bus
+func NewHub(bus realtime.Bus) *Hub {
+	return &Hub{
+		bus:     bus,
+		streams: make(map[int]map[chan StreamEvent]struct{}),
+	}
+}
+
+// Run delivers bus events to local streams until the bus is closed
+func (h *Hub) Run() {
+	for payload := range h.bus.Messages() {
+		var event StreamEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			log.Printf("notify: invalid event payload: %v", err)
+			continue
+		}
+
+		if !h.hasStreams(event.UserID) {
+			continue
+		}
+
+		// Notifications too large for the bus arrive as references
+		if event.Type == StreamNotification && event.Notification == nil && event.NotificationID > 0 {
+			notification, err := models.GetNotificationByID(event.NotificationID)
+			if err != nil {
+				log.Printf("notify: failed to load notification %d: %v", event.NotificationID, err)
+				continue
+			}
+			event.Notification = notification
+		}
+
+		h.dispatch(event)
+	}
+}
+
+// Publish sends an event to every replica
+func (h *Hub) Publish(event StreamEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	err = h.bus.Publish(payload)
+	if errors.Is(err, realtime.ErrPayloadTooLarge) && event.Notification != nil {
+		// Send a reference and let each replica load the notification itself
+		ref := event
+		ref.NotificationID = event.Notification.ID
+		ref.Notification = nil
+		if payload, err = json.Marshal(ref); err != nil {
+			return err
+		}
+		err = h.bus.Publish(payload)
+	}
+
+	return err
+}
+
+// PublishNotification pushes a new notification to its user's streams
+func (h *Hub) PublishNotification(n *models.Notification) error {
+	return h.Publish(StreamEvent{Type: StreamNotification, UserID: n.UserID, Notification: n})
+}
+
+// PublishRead tells a user's other streams that notifications were read so
+// they can refresh their unread counts. notificationID is 0 for mark-all.
+func (h *Hub) PublishRead(userID, notificationID int) error {
+	return h.Publish(StreamEvent{Type: StreamRead, UserID: userID, NotificationID: notificationID})
+}
+
+// Subscribe opens a stream for userID. The returned function closes it.
+func (h *Hub) Subscribe(userID int) (<-chan StreamEvent, func()) {
+	ch := make(chan StreamEvent, 16)
+
+	h.mu.Lock()
+	if h.streams[userID] == nil {
+		h.streams[userID] = make(map[chan StreamEvent]struct{})
+	}
+	h.streams[userID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		if streams, ok := h.streams[userID]; ok {
+			delete(streams, ch)
+			if len(streams) == 0 {
+				delete(h.streams, userID)
+			}
+		}
+	}
+}
+
+func (h *Hub) hasStreams(userID int) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.streams[userID]) > 0
+}
+
+// dispatch delivers an event to the local streams of its user. Slow streams
+// miss events rather than block the hub; clients catch up with Last-Event-ID.
+func (h *Hub) dispatch(event StreamEvent) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for ch := range h.streams[event.UserID] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
@@ -0,0 +1,125 @@
+// Package notify delivers notifications to users. Notify checks the user's
+// preferences for the event's category and fans the event out to the in-app
+// notification center (stored and pushed over Server-Sent Events), email and
+// SMS.
+package notify
+
+import (
+	"fmt"
+	"html"
+	"log"
+
+	"github.com/dottrip/fpt-swp/internal/models"
+)
+
+// Delivery channels
+const (
+	ChannelInApp = "in_app"
+	ChannelEmail = "email"
+	ChannelSMS   = "sms"
+)
+
+// Event is something a user should be told about
+type Event struct {
+	Category string // one of models.NotificationCategories
+	Title    string
+	Body     string
+	Link     string // path in the web app the notification opens
+}
+
+// Sender delivers events over an external channel such as email or SMS
+type Sender interface {
+	Send(user *models.User, event Event) error
+}
+
+// SenderFunc adapts a function to the Sender interface
+type SenderFunc func(user *models.User, event Event) error
+
+// Send calls f
+func (f SenderFunc) Send(user *models.User, event Event) error {
+	return f(user, event)
+}
+
+// logSender logs events for a channel that has no provider configured
+func logSender(channel string) Sender {
+	return SenderFunc(func(user *models.User, event Event) error {
+		log.Printf("notify: %s to user %d (no provider configured): %s", channel, user.ID, event.Title)
+		return nil
+	})
+}
+
+// Email and SMS deliver the external channels. They only log until a
+// provider is configured.
+var (
+	Email Sender = logSender(ChannelEmail)
+	SMS   Sender = logSender(ChannelSMS)
+)
+
+// Notify delivers event to userID on every channel the user enabled for the
+// event's category. The in-app notification is stored before Notify returns;
+// email and SMS are sent in the background. It returns the stored in-app
+// notification, or nil if the user turned in-app delivery off.
+func Notify(userID int, event Event) (*models.Notification, error) {
+	if !models.IsValidNotificationCategory(event.Category) {
+		return nil, fmt.Errorf("notify: unknown category %q", event.Category)
+	}
+
+	user, err := models.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	preference, err := models.GetNotificationPreference(userID, event.Category)
+	if err != nil {
+		return nil, err
+	}
+
+	var notification *models.Notification
+	if preference.InApp {
+		notification = &models.Notification{
+			UserID:   userID,
+			Category: event.Category,
+			Title:    event.Title,
+			Body:     event.Body,
+			Link:     event.Link,
+		}
+		if err := notification.Create(); err != nil {
+			return nil, err
+		}
+		if DefaultHub != nil {
+			if err := DefaultHub.PublishNotification(notification); err != nil {
+				log.Printf("notify: failed to push notification %d: %v", notification.ID, err)
+			}
+		}
+	}
+
+	// Subjects and titles quoted in events are stored HTML-escaped; external
+	// channels get plain text
+	event.Title = html.UnescapeString(event.Title)
+	event.Body = html.UnescapeString(event.Body)
+
+	if preference.Email {
+		go send(ChannelEmail, Email, user, event)
+	}
+	if preference.SMS {
+		go send(ChannelSMS, SMS, user, event)
+	}
+
+	return notification, nil
+}
+
+// NotifyAsync calls Notify in the background and logs failures, for callers
+// that should not fail or wait because a notification could not be sent
+func NotifyAsync(userID int, event Event) {
+	go func() {
+		if _, err := Notify(userID, event); err != nil {
+			log.Printf("notify: failed to notify user %d: %v", userID, err)
+		}
+	}()
+}
+
+func send(channel string, sender Sender, user *models.User, event Event) {
+	if err := sender.Send(user, event); err != nil {
+		log.Printf("notify: %s delivery to user %d failed: %v", channel, user.ID, err)
+	}
+}
@@ -0,0 +1,28 @@
+package notify
+
+import (
+	"context"
+	"time"
+
+	"github.com/dottrip/fpt-swp/internal/models"
+	"github.com/dottrip/fpt-swp/internal/sms"
+	"github.com/dottrip/fpt-swp/internal/templates"
+)
+
+// SMSSender sends events as text messages through the sms package. Users
+// without a phone number on file are skipped.
+func SMSSender() Sender {
+	return SenderFunc(func(user *models.User, event Event) error {
+		phone, err := models.GetUserPhone(user.ID)
+		if err != nil || phone == "" {
+			return err
+		}
+
+		body := templates.Default.Message(templates.DefaultLocale, "sms.notification", event)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		_, err = sms.Send(ctx, user.ID, phone, body)
+		return err
+	})
+}
@@ -0,0 +1,331 @@
+// Package openapi builds the OpenAPI 3.1 document of the API from a registry
+// of operations. Request and response bodies are given as Go values whose
+// types are reflected into JSON schemas using the same json and binding tags
+// gin uses, so the document follows the structs as they change. Missing
+// compares the registry with the routes actually registered on the router.
+package openapi
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/dottrip/fpt-swp/internal/response"
+	"github.com/gin-gonic/gin"
+)
+
+// Version is the OpenAPI version of generated documents
+const Version = "3.1.0"
+
+// Auth is how an operation authenticates
+type Auth int
+
+const (
+	// Public operations need no credentials
+	Public Auth = iota
+	// Bearer operations need a JWT in the Authorization header
+	Bearer
+	// QueryToken operations take the JWT in ?token=, for WebSocket and
+	// EventSource clients that cannot set headers
+	QueryToken
+)
+
+// Operation documents one route
+type Operation struct {
+	Method      string
+	Path        string // gin syntax, e.g. /api/doctors/:id
+	Handler     gin.HandlerFunc
+	Tag         string
+	Summary     string
+	Description string
+	Auth        Auth
+	Query       []Param
+	Header      []Param
+	Form        []Param     // multipart/form-data fields
+	Request     interface{} // JSON request body, e.g. models.DoctorRequest{}
+	Consumes    string      // media type of Request; defaults to application/json
+	Response    interface{} // data member of the success envelope
+	List        bool        // the success envelope carries list meta
+	Raw         bool        // Response is the whole body, not wrapped in the envelope
+	Status      int         // success status; defaults to 200
+	Produces    string      // media type of a non-JSON success response, e.g. application/pdf
+}
+
+// Param is a query, path or form parameter
+type Param struct {
+	Name        string
+	Type        string // string (the default), integer, boolean or file
+	Format      string
+	Description string
+	Required    bool
+	Enum        []string
+}
+
+// Info describes the API
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// Document is an OpenAPI document
+type Document struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       Info                             `json:"info"`
+	Tags       []tag                            `json:"tags,omitempty"`
+	Paths      map[string]map[string]*operation `json:"paths"`
+	Components components                       `json:"components"`
+}
+
+type tag struct {
+	Name string `json:"name"`
+}
+
+type components struct {
+	Schemas         map[string]*Schema         `json:"schemas"`
+	Responses       map[string]*responseObject `json:"responses"`
+	SecuritySchemes map[string]interface{}     `json:"securitySchemes"`
+}
+
+type operation struct {
+	Tags        []string                   `json:"tags,omitempty"`
+	Summary     string                     `json:"summary,omitempty"`
+	Description string                     `json:"description,omitempty"`
+	OperationID string                     `json:"operationId"`
+	Parameters  []parameter                `json:"parameters,omitempty"`
+	RequestBody *requestBody               `json:"requestBody,omitempty"`
+	Responses   map[string]*responseObject `json:"responses"`
+	Security    []map[string][]string      `json:"security"`
+}
+
+type parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type requestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]mediaType `json:"content"`
+}
+
+type mediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type responseObject struct {
+	Ref         string               `json:"$ref,omitempty"`
+	Description string               `json:"description,omitempty"`
+	Content     map[string]mediaType `json:"content,omitempty"`
+}
+
+// Build generates the document for ops
+func Build(info Info, ops []Operation) (*Document, error) {
+	doc := &Document{
+		OpenAPI: Version,
+		Info:    info,
+		Paths:   map[string]map[string]*operation{},
+	}
+	g := newGenerator()
+
+	doc.Components.SecuritySchemes = map[string]interface{}{
+		"bearerAuth": map[string]string{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+		"queryToken": map[string]string{"type": "apiKey", "in": "query", "name": "token"},
+	}
+	doc.Components.Responses = map[string]*responseObject{
+		"Error": {
+			Description: "Error",
+			Content: map[string]mediaType{
+				"application/json": {Schema: objectSchema(map[string]*Schema{
+					"success": {Type: "boolean", Enum: []interface{}{false}},
+					"error":   g.schema(reflect.TypeOf(response.Error{})),
+				}, "success", "error")},
+			},
+		},
+	}
+	metaSchema := g.schema(reflect.TypeOf(response.Meta{}))
+
+	ids := map[string]int{}
+	tags := map[string]bool{}
+
+	for _, op := range ops {
+		method := strings.ToLower(op.Method)
+		path := ginPathToOpenAPI(op.Path)
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = map[string]*operation{}
+		}
+		if doc.Paths[path][method] != nil {
+			return nil, fmt.Errorf("openapi: %s %s is documented twice", op.Method, op.Path)
+		}
+
+		o := &operation{
+			Summary:     op.Summary,
+			Description: op.Description,
+			OperationID: operationID(op, ids),
+			Responses:   map[string]*responseObject{"default": {Ref: "#/components/responses/Error"}},
+			Security:    []map[string][]string{},
+		}
+		if op.Tag != "" {
+			o.Tags = []string{op.Tag}
+			tags[op.Tag] = true
+		}
+
+		switch op.Auth {
+		case Bearer:
+			o.Security = append(o.Security, map[string][]string{"bearerAuth": {}})
+		case QueryToken:
+			o.Security = append(o.Security, map[string][]string{"queryToken": {}}, map[string][]string{"bearerAuth": {}})
+		}
+
+		for _, name := range pathParams(op.Path) {
+			p := Param{Name: name, Required: true}
+			if name == "id" || strings.HasSuffix(name, "Id") {
+				p.Type = "integer"
+			}
+			o.Parameters = append(o.Parameters, p.parameter("path"))
+		}
+		for _, p := range op.Query {
+			o.Parameters = append(o.Parameters, p.parameter("query"))
+		}
+		for _, p := range op.Header {
+			o.Parameters = append(o.Parameters, p.parameter("header"))
+		}
+
+		switch {
+		case op.Request != nil:
+			consumes := op.Consumes
+			if consumes == "" {
+				consumes = "application/json"
+			}
+			o.RequestBody = &requestBody{
+				Required: true,
+				Content:  map[string]mediaType{consumes: {Schema: g.schema(reflect.TypeOf(op.Request))}},
+			}
+		case len(op.Form) > 0:
+			properties := map[string]*Schema{}
+			var required []string
+			for _, p := range op.Form {
+				properties[p.Name] = p.schema()
+				if p.Required {
+					required = append(required, p.Name)
+				}
+			}
+			o.RequestBody = &requestBody{
+				Required: true,
+				Content:  map[string]mediaType{"multipart/form-data": {Schema: objectSchema(properties, required...)}},
+			}
+		}
+
+		status := op.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		success := &responseObject{Description: http.StatusText(status)}
+		switch {
+		case op.Produces != "":
+			success.Content = map[string]mediaType{op.Produces: {Schema: &Schema{Type: "string"}}}
+		case op.Raw:
+			success.Content = map[string]mediaType{"application/json": {Schema: g.schema(reflect.TypeOf(op.Response))}}
+		case status != http.StatusSwitchingProtocols:
+			properties := map[string]*Schema{
+				"success": {Type: "boolean", Enum: []interface{}{true}},
+				"message": {Type: "string"},
+			}
+			if op.Response != nil {
+				properties["data"] = g.schema(reflect.TypeOf(op.Response))
+			}
+			if op.List {
+				properties["meta"] = metaSchema
+			}
+			success.Content = map[string]mediaType{"application/json": {Schema: objectSchema(properties, "success")}}
+		}
+		o.Responses[fmt.Sprint(status)] = success
+
+		doc.Paths[path][method] = o
+	}
+
+	for name := range tags {
+		doc.Tags = append(doc.Tags, tag{Name: name})
+	}
+	sort.Slice(doc.Tags, func(i, j int) bool { return doc.Tags[i].Name < doc.Tags[j].Name })
+	doc.Components.Schemas = g.components
+
+	return doc, nil
+}
+
+// Missing returns the routes that have no operation in doc
+func Missing(doc *Document, routes gin.RoutesInfo) gin.RoutesInfo {
+	var missing gin.RoutesInfo
+	for _, route := range routes {
+		if doc.Paths[ginPathToOpenAPI(route.Path)][strings.ToLower(route.Method)] == nil {
+			missing = append(missing, route)
+		}
+	}
+	return missing
+}
+
+// ginPathToOpenAPI converts /doctors/:id to /doctors/{id}
+func ginPathToOpenAPI(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// pathParams lists the parameter names in a gin path
+func pathParams(path string) []string {
+	var names []string
+	for _, segment := range strings.Split(path, "/") {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			names = append(names, segment[1:])
+		}
+	}
+	return names
+}
+
+// operationID names an operation after its handler, numbering handlers that
+// serve several routes
+func operationID(op Operation, seen map[string]int) string {
+	id := strings.ToLower(op.Method) + ginPathToOpenAPI(op.Path)
+	if op.Handler != nil {
+		name := runtime.FuncForPC(reflect.ValueOf(op.Handler).Pointer()).Name()
+		id = name[strings.LastIndex(name, ".")+1:]
+	}
+	seen[id]++
+	if n := seen[id]; n > 1 {
+		id = fmt.Sprintf("%s%d", id, n)
+	}
+	return id
+}
+
+func (p Param) schema() *Schema {
+	s := &Schema{Type: p.Type, Format: p.Format}
+	switch p.Type {
+	case "":
+		s.Type = "string"
+	case "file":
+		s.Type, s.Format = "string", "binary"
+	}
+	for _, value := range p.Enum {
+		s.Enum = append(s.Enum, value)
+	}
+	return s
+}
+
+func (p Param) parameter(in string) parameter {
+	return parameter{
+		Name:        p.Name,
+		In:          in,
+		Description: p.Description,
+		Required:    p.Required,
+		Schema:      p.schema(),
+	}
+}
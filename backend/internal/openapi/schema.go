@@ -0,0 +1,248 @@
+package openapi
+
+import (
+	"encoding/json"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schema is a JSON schema
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 interface{}        `json:"type,omitempty"` // a type name, or a list for nullable values
+	Format               string             `json:"format,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// generator reflects Go types into schemas, collecting named structs as
+// components
+type generator struct {
+	components map[string]*Schema
+	names      map[reflect.Type]string
+}
+
+func newGenerator() *generator {
+	return &generator{components: map[string]*Schema{}, names: map[reflect.Type]string{}}
+}
+
+func objectSchema(properties map[string]*Schema, required ...string) *Schema {
+	return &Schema{Type: "object", Properties: properties, Required: required}
+}
+
+// schema returns the schema of t, a reference for named structs
+func (g *generator) schema(t reflect.Type) *Schema {
+	if t == nil {
+		return &Schema{}
+	}
+
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case rawMessageType:
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		s := g.schema(t.Elem())
+		if name, ok := s.Type.(string); ok {
+			s.Type = []string{name, "null"}
+		}
+		return s
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + g.component(t)}
+	default:
+		// interface{} and anything else JSON can hold
+		return &Schema{}
+	}
+}
+
+// component registers a named struct and returns its component name.
+// Structs of the same name in different packages are prefixed with their
+// package name.
+func (g *generator) component(t reflect.Type) string {
+	if name, ok := g.names[t]; ok {
+		return name
+	}
+
+	name := exportName(t.Name())
+	if _, taken := g.components[name]; taken {
+		name = exportName(path.Base(t.PkgPath())) + name
+	}
+	g.names[t] = name
+	g.components[name] = &Schema{} // placeholder for recursive types
+	*g.components[name] = *g.structSchema(t)
+	return name
+}
+
+// structSchema describes the JSON object encoding/json produces for t
+func (g *generator) structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, omit := jsonName(field)
+		if omit {
+			continue
+		}
+
+		// Embedded structs without a JSON name are flattened
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				inner := g.structSchema(embedded)
+				for key, value := range inner.Properties {
+					s.Properties[key] = value
+				}
+				s.Required = append(s.Required, inner.Required...)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property := g.schema(field.Type)
+		if applyBinding(property, field) {
+			s.Required = append(s.Required, name)
+		}
+		s.Properties[name] = property
+	}
+
+	return s
+}
+
+// jsonName returns the JSON name of a field, and whether it is skipped
+func jsonName(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", true
+	}
+	name, _, _ := strings.Cut(tag, ",")
+	return name, false
+}
+
+// applyBinding adds the validator rules of a field's binding tag to its
+// schema and reports whether the field is required
+func applyBinding(s *Schema, field reflect.StructField) bool {
+	tag := field.Tag.Get("binding")
+	if tag == "" || s.Ref != "" {
+		return strings.Contains(tag, "required")
+	}
+
+	kind := field.Type.Kind()
+	if kind == reflect.Ptr {
+		kind = field.Type.Elem().Kind()
+	}
+
+	required := false
+	for _, rule := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(rule, "=")
+		switch name {
+		case "dive":
+			// Rules after dive apply to elements
+			return required
+		case "required":
+			required = true
+		case "email":
+			s.Format = "email"
+		case "url":
+			s.Format = "uri"
+		case "datetime":
+			if param == "2006-01-02" {
+				s.Format = "date"
+			}
+		case "oneof":
+			for _, value := range strings.Fields(param) {
+				if n, err := strconv.Atoi(value); err == nil && kind != reflect.String {
+					s.Enum = append(s.Enum, n)
+				} else {
+					s.Enum = append(s.Enum, value)
+				}
+			}
+		case "min", "gte", "max", "lte", "len":
+			n, err := strconv.Atoi(param)
+			if err != nil {
+				continue
+			}
+			lower := name == "min" || name == "gte" || name == "len"
+			upper := name == "max" || name == "lte" || name == "len"
+			switch kind {
+			case reflect.String:
+				if lower {
+					s.MinLength = &n
+				}
+				if upper {
+					s.MaxLength = &n
+				}
+			case reflect.Slice, reflect.Array:
+				if lower {
+					s.MinItems = &n
+				}
+				if upper {
+					s.MaxItems = &n
+				}
+			default:
+				f := float64(n)
+				if lower {
+					s.Minimum = &f
+				}
+				if upper {
+					s.Maximum = &f
+				}
+			}
+		}
+	}
+	return required
+}
+
+// exportName capitalizes the first letter of a type or package name
+func exportName(name string) string {
+	if name == "" {
+		return name
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
@@ -0,0 +1,189 @@
+// Package pageviews counts views of blog posts. A visitor viewing a post
+// again within a window counts once, and requests from bots and link
+// previews do not count. Views are kept in memory and written in batches by
+// Flush, so reading a post never waits on a write; views not yet flushed
+// when the process is killed without a final Flush are lost.
+package pageviews
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dottrip/fpt-swp/internal/models"
+)
+
+// Default counts the views of every request; set by Init
+var Default = NewCounter(30 * time.Minute)
+
+// View is one request to read a post
+type View struct {
+	PostID    int
+	Visitor   string // identifies the visitor, e.g. a Fingerprint
+	Referrer  string // Referer header, if any
+	UserAgent string
+	At        time.Time
+}
+
+// Counter deduplicates and buffers views. It is safe for concurrent use.
+// Deduplication is per process: with several replicas a visitor may count
+// once on each.
+type Counter struct {
+	window  time.Duration
+	maxSeen int
+
+	mu      sync.Mutex
+	seen    map[seenKey]time.Time // when each visitor's view of a post last counted
+	pending map[countKey]int
+}
+
+type seenKey struct {
+	postID  int
+	visitor string
+}
+
+type countKey struct {
+	postID   int
+	day      string
+	referrer string
+}
+
+// maxSeen bounds how many visitor and post pairs a Counter remembers
+// between flushes
+const maxSeen = 100000
+
+// NewCounter returns a counter that counts a visitor's views of a post at
+// most once per window
+func NewCounter(window time.Duration) *Counter {
+	return &Counter{
+		window:  window,
+		maxSeen: maxSeen,
+		seen:    map[seenKey]time.Time{},
+		pending: map[countKey]int{},
+	}
+}
+
+// Init sets up Default from the environment: BLOG_VIEW_WINDOW_MINUTES is
+// how long a visitor's repeated views of a post count once (default 30)
+func Init() {
+	minutes, err := strconv.Atoi(getEnv("BLOG_VIEW_WINDOW_MINUTES", "30"))
+	if err != nil || minutes <= 0 {
+		log.Printf("pageviews: invalid BLOG_VIEW_WINDOW_MINUTES, using 30")
+		minutes = 30
+	}
+	Default = NewCounter(time.Duration(minutes) * time.Minute)
+}
+
+// Record counts the view unless it comes from a bot or the visitor's last
+// counted view of the post is within the window, and reports whether it
+// counted
+func (c *Counter) Record(v View) bool {
+	if IsBot(v.UserAgent) {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := seenKey{v.PostID, v.Visitor}
+	if last, ok := c.seen[key]; ok && v.At.Sub(last) < c.window {
+		return false
+	}
+	if len(c.seen) >= c.maxSeen {
+		c.forget(v.At)
+	}
+	c.seen[key] = v.At
+
+	day := v.At.In(models.ClinicLocation()).Format("2006-01-02")
+	c.pending[countKey{v.PostID, day, ReferrerHost(v.Referrer)}]++
+	return true
+}
+
+// Flush writes the views counted since the last flush and forgets visitors
+// whose window has passed. Views that fail to write are kept for the next
+// flush. It returns how many views it wrote.
+func (c *Counter) Flush() (int, error) {
+	c.mu.Lock()
+	pending := c.pending
+	c.pending = map[countKey]int{}
+	c.forget(time.Now())
+	c.mu.Unlock()
+
+	counts := make([]models.BlogPostViewCount, 0, len(pending))
+	total := 0
+	for key, views := range pending {
+		counts = append(counts, models.BlogPostViewCount{PostID: key.postID, Day: key.day, Referrer: key.referrer, Views: views})
+		total += views
+	}
+
+	if err := models.AddBlogPostViews(counts); err != nil {
+		c.mu.Lock()
+		for key, views := range pending {
+			c.pending[key] += views
+		}
+		c.mu.Unlock()
+		return 0, err
+	}
+	return total, nil
+}
+
+// forget drops the visitors whose window has passed by now. If that leaves
+// the counter full, as under a flood of new visitors, it forgets everyone:
+// some repeat views then count again, but memory stays bounded. c.mu must
+// be held.
+func (c *Counter) forget(now time.Time) {
+	for key, last := range c.seen {
+		if now.Sub(last) >= c.window {
+			delete(c.seen, key)
+		}
+	}
+	if len(c.seen) >= c.maxSeen {
+		c.seen = map[seenKey]time.Time{}
+	}
+}
+
+// botPattern matches the user agents of crawlers, link previews, monitors
+// and HTTP libraries
+var botPattern = regexp.MustCompile(`(?i)bot|crawl|spider|slurp|archiver|fetcher|scanner|monitor|preview|facebookexternalhit|whatsapp|embedly|lighthouse|headless|phantomjs|curl|wget|python|java/|go-http-client|okhttp|axios|node-fetch|httpclient|postman`)
+
+// IsBot reports whether a user agent belongs to a bot rather than a person.
+// Requests without one are treated as bots.
+func IsBot(userAgent string) bool {
+	return strings.TrimSpace(userAgent) == "" || botPattern.MatchString(userAgent)
+}
+
+// Fingerprint identifies a visitor by a hash of what their requests carry,
+// e.g. the client IP, without storing it
+func Fingerprint(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:16])
+}
+
+// ReferrerHost returns the host name a Referer header names, lowercased and
+// without "www.", or "" if it names none
+func ReferrerHost(referer string) string {
+	u, err := url.Parse(strings.TrimSpace(referer))
+	if err != nil || u.Hostname() == "" {
+		return ""
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	if len(host) > 255 {
+		return ""
+	}
+	return host
+}
+
+// getEnv gets an environment variable or returns a default value
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,25 @@
+package pageviews
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestCounterBoundsVisitors(t *testing.T) {
+	c := NewCounter(30 * time.Minute)
+	c.maxSeen = 10
+
+	now := time.Now()
+	for i := 0; i < 25; i++ {
+		c.Record(View{PostID: 1, Visitor: strconv.Itoa(i), UserAgent: "Mozilla/5.0", At: now})
+		if len(c.seen) > c.maxSeen {
+			t.Fatalf("after %d visitors the counter remembers %d, want at most %d", i+1, len(c.seen), c.maxSeen)
+		}
+	}
+
+	// A repeat view within the window still counts once while there is room
+	if c.Record(View{PostID: 1, Visitor: "24", UserAgent: "Mozilla/5.0", At: now.Add(time.Minute)}) {
+		t.Error("a repeat view within the window counted")
+	}
+}
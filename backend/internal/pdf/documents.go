@@ -0,0 +1,65 @@
+package pdf
+
+import (
+	"io"
+
+	"github.com/dottrip/fpt-swp/internal/models"
+)
+
+// WritePrescription renders a prescription as a PDF
+func WritePrescription(w io.Writer, clinic Clinic, doctor *models.Doctor, p *models.Prescription, verifyURL string) error {
+	d := newDocument(clinic, "ĐƠN THUỐC")
+
+	d.fields("Mã đơn", p.Code, "Ngày kê", p.CreatedAt.Local().Format(dateLayout))
+	d.doctor(doctor)
+	d.patient(p.PatientInfo)
+
+	d.section("Chẩn đoán")
+	d.field("Chẩn đoán", text(p.Diagnosis))
+
+	d.items(p.Items)
+
+	if p.Notes != "" || p.NextVisit != "" {
+		d.section("Lời dặn")
+		d.field("Ghi chú", text(p.Notes))
+		d.field("Tái khám", formatDate(p.NextVisit))
+	}
+
+	if err := d.verification(p.Code, verifyURL, p.CreatedAt.Local(), doctor); err != nil {
+		return err
+	}
+
+	return d.output(w)
+}
+
+// WriteVisitSummary renders a visit summary as a PDF. items are the drug lines
+// of the linked prescription, if any.
+func WriteVisitSummary(w io.Writer, clinic Clinic, doctor *models.Doctor, v *models.VisitSummary, items []models.PrescriptionItem, verifyURL string) error {
+	d := newDocument(clinic, "TÓM TẮT KHÁM BỆNH")
+
+	d.fields("Mã phiếu", v.Code, "Ngày khám", v.VisitDate.Local().Format(dateLayout))
+	d.doctor(doctor)
+	d.patient(v.PatientInfo)
+
+	d.section("Kết quả khám")
+	d.field("Lý do khám", text(v.ChiefComplaint))
+	d.field("Khám lâm sàng", text(v.Findings))
+	d.field("Chẩn đoán", text(v.Diagnosis))
+	d.field("Hướng điều trị", text(v.TreatmentPlan))
+
+	if len(items) > 0 {
+		d.items(items)
+	}
+
+	if v.Notes != "" || v.FollowUpDate != "" {
+		d.section("Lời dặn")
+		d.field("Ghi chú", text(v.Notes))
+		d.field("Tái khám", formatDate(v.FollowUpDate))
+	}
+
+	if err := d.verification(v.Code, verifyURL, v.VisitDate.Local(), doctor); err != nil {
+		return err
+	}
+
+	return d.output(w)
+}
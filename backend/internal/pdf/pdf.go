@@ -0,0 +1,330 @@
+// Package pdf renders printable clinical documents (prescriptions and visit
+// summaries) entirely in Go. Fonts are embedded so Vietnamese diacritics
+// render the same on every server.
+package pdf
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dottrip/fpt-swp/internal/models"
+	"github.com/jung-kurt/gofpdf"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+//go:embed fonts/DejaVuSans.ttf
+var fontRegular []byte
+
+//go:embed fonts/DejaVuSans-Bold.ttf
+var fontBold []byte
+
+const (
+	fontFamily   = "DejaVu"
+	pageMargin   = 15.0
+	lineHeight   = 6.0
+	qrSize       = 30.0
+	dateLayout   = "02/01/2006"
+	clinicColorR = 23
+	clinicColorG = 92
+	clinicColorB = 155
+)
+
+// Clinic holds the clinic details printed in the document header
+type Clinic struct {
+	Name    string
+	Address string
+	Phone   string
+	Email   string
+}
+
+// ClinicFromEnv builds the clinic header from environment variables
+func ClinicFromEnv() Clinic {
+	return Clinic{
+		Name:    getEnv("CLINIC_NAME", "Phòng khám Medical"),
+		Address: getEnv("CLINIC_ADDRESS", ""),
+		Phone:   getEnv("CLINIC_PHONE", ""),
+		Email:   getEnv("CLINIC_EMAIL", ""),
+	}
+}
+
+// getEnv gets an environment variable or returns a default value
+func getEnv(key, defaultValue string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+// text undoes the HTML escaping applied by the models before saving
+func text(s string) string {
+	return html.UnescapeString(s)
+}
+
+// document wraps gofpdf with the helpers shared by every clinical document
+type document struct {
+	pdf    *gofpdf.Fpdf
+	clinic Clinic
+}
+
+// newDocument creates an A4 document with the embedded fonts and clinic header
+func newDocument(clinic Clinic, title string) *document {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(pageMargin, pageMargin, pageMargin)
+	pdf.SetAutoPageBreak(true, pageMargin+10)
+	pdf.AddUTF8FontFromBytes(fontFamily, "", fontRegular)
+	pdf.AddUTF8FontFromBytes(fontFamily, "B", fontBold)
+	pdf.SetTitle(title, true)
+	pdf.SetCreator(clinic.Name, true)
+	pdf.AliasNbPages("{nb}")
+
+	d := &document{pdf: pdf, clinic: clinic}
+	pdf.SetHeaderFunc(d.header)
+	pdf.SetFooterFunc(d.footer)
+	pdf.AddPage()
+
+	pdf.SetFont(fontFamily, "B", 15)
+	pdf.CellFormat(0, 10, title, "", 1, "C", false, 0, "")
+	pdf.Ln(2)
+
+	return d
+}
+
+// header prints the clinic name and contact details on every page
+func (d *document) header() {
+	pdf := d.pdf
+	pdf.SetTextColor(clinicColorR, clinicColorG, clinicColorB)
+	pdf.SetFont(fontFamily, "B", 14)
+	pdf.CellFormat(0, 7, strings.ToUpper(d.clinic.Name), "", 1, "L", false, 0, "")
+
+	pdf.SetTextColor(80, 80, 80)
+	pdf.SetFont(fontFamily, "", 9)
+	if d.clinic.Address != "" {
+		pdf.CellFormat(0, 4.5, "Địa chỉ: "+d.clinic.Address, "", 1, "L", false, 0, "")
+	}
+
+	var contacts []string
+	if d.clinic.Phone != "" {
+		contacts = append(contacts, "Điện thoại: "+d.clinic.Phone)
+	}
+	if d.clinic.Email != "" {
+		contacts = append(contacts, "Email: "+d.clinic.Email)
+	}
+	if len(contacts) > 0 {
+		pdf.CellFormat(0, 4.5, strings.Join(contacts, "   "), "", 1, "L", false, 0, "")
+	}
+
+	pdf.SetTextColor(0, 0, 0)
+	pdf.SetDrawColor(clinicColorR, clinicColorG, clinicColorB)
+	pdf.SetLineWidth(0.5)
+	y := pdf.GetY() + 2
+	width, _ := pdf.GetPageSize()
+	pdf.Line(pageMargin, y, width-pageMargin, y)
+	pdf.SetLineWidth(0.2)
+	pdf.SetDrawColor(0, 0, 0)
+	pdf.SetY(y + 4)
+}
+
+// footer prints the page number
+func (d *document) footer() {
+	pdf := d.pdf
+	pdf.SetY(-pageMargin)
+	pdf.SetFont(fontFamily, "", 8)
+	pdf.SetTextColor(120, 120, 120)
+	pdf.CellFormat(0, 5, fmt.Sprintf("Trang %d/{nb}", pdf.PageNo()), "", 0, "C", false, 0, "")
+	pdf.SetTextColor(0, 0, 0)
+}
+
+// section prints a bold section heading
+func (d *document) section(title string) {
+	d.pdf.Ln(2)
+	d.pdf.SetFont(fontFamily, "B", 11)
+	d.pdf.CellFormat(0, 7, title, "", 1, "L", false, 0, "")
+}
+
+// field prints a "label: value" line, wrapping long values
+func (d *document) field(label, value string) {
+	if strings.TrimSpace(value) == "" {
+		return
+	}
+	pdf := d.pdf
+	pdf.SetFont(fontFamily, "B", 10)
+	labelWidth := pdf.GetStringWidth(label+": ") + 1
+	pdf.CellFormat(labelWidth, lineHeight, label+":", "", 0, "L", false, 0, "")
+	pdf.SetFont(fontFamily, "", 10)
+	pdf.MultiCell(0, lineHeight, value, "", "L", false)
+}
+
+// fields prints several label/value pairs on one line
+func (d *document) fields(pairs ...string) {
+	pdf := d.pdf
+	width, _ := pdf.GetPageSize()
+	columnWidth := (width - 2*pageMargin) / float64(len(pairs)/2)
+
+	for i := 0; i+1 < len(pairs); i += 2 {
+		label, value := pairs[i], pairs[i+1]
+		if value == "" {
+			value = "—"
+		}
+		pdf.SetFont(fontFamily, "B", 10)
+		labelWidth := pdf.GetStringWidth(label+": ") + 1
+		pdf.CellFormat(labelWidth, lineHeight, label+":", "", 0, "L", false, 0, "")
+		pdf.SetFont(fontFamily, "", 10)
+		pdf.CellFormat(columnWidth-labelWidth, lineHeight, value, "", 0, "L", false, 0, "")
+	}
+	pdf.Ln(lineHeight)
+}
+
+// doctor prints the issuing doctor block
+func (d *document) doctor(doctor *models.Doctor) {
+	d.section("Thông tin bác sĩ")
+	d.fields("Bác sĩ", text(doctor.Name), "Chuyên khoa", text(doctor.Specialty))
+	d.fields("Số chứng chỉ hành nghề", text(doctor.LicenseNumber))
+}
+
+// patient prints the patient block
+func (d *document) patient(p models.PatientInfo) {
+	d.section("Thông tin bệnh nhân")
+	d.fields("Họ tên", text(p.PatientName), "Giới tính", genderLabel(p.PatientGender))
+	d.fields("Ngày sinh", formatDate(p.PatientDateOfBirth), "Điện thoại", text(p.PatientPhone))
+	d.field("Địa chỉ", text(p.PatientAddress))
+}
+
+// items prints the itemized drug table
+func (d *document) items(items []models.PrescriptionItem) {
+	pdf := d.pdf
+	d.section("Chỉ định dùng thuốc")
+
+	headers := []string{"STT", "Tên thuốc", "Liều dùng", "Cách dùng", "Thời gian", "Số lượng"}
+	widths := []float64{10, 58, 25, 35, 25, 27}
+	const cellHeight = 5.5
+
+	pdf.SetFont(fontFamily, "B", 9)
+	pdf.SetFillColor(230, 238, 247)
+	for i, h := range headers {
+		pdf.CellFormat(widths[i], 7, h, "1", 0, "C", true, 0, "")
+	}
+	pdf.Ln(-1)
+
+	pdf.SetFont(fontFamily, "", 9)
+	for i, item := range items {
+		quantity := ""
+		if item.Quantity > 0 {
+			quantity = strings.TrimSpace(fmt.Sprintf("%d %s", item.Quantity, text(item.Unit)))
+		}
+		name := text(item.DrugName)
+		if item.Instructions != "" {
+			name += "\n" + text(item.Instructions)
+		}
+		cells := []string{
+			fmt.Sprintf("%d", i+1), name, text(item.Dosage), text(item.Frequency),
+			text(item.Duration), quantity,
+		}
+
+		// Work out the tallest cell so the whole row shares one height
+		lines := 1
+		for j, cell := range cells {
+			n := 0
+			for _, part := range strings.Split(cell, "\n") {
+				n += len(pdf.SplitText(part, widths[j]-2))
+			}
+			if n > lines {
+				lines = n
+			}
+		}
+		rowHeight := float64(lines) * cellHeight
+
+		_, pageHeight := pdf.GetPageSize()
+		_, _, _, bottom := pdf.GetMargins()
+		if pdf.GetY()+rowHeight > pageHeight-bottom-10 {
+			pdf.AddPage()
+		}
+
+		x, y := pdf.GetXY()
+		for j, cell := range cells {
+			pdf.Rect(x, y, widths[j], rowHeight, "D")
+			pdf.SetXY(x, y)
+			align := "L"
+			if j == 0 || j == len(cells)-1 {
+				align = "C"
+			}
+			pdf.MultiCell(widths[j], cellHeight, cell, "", align, false)
+			x += widths[j]
+		}
+		pdf.SetXY(pageMargin, y+rowHeight)
+	}
+}
+
+// verification prints the QR code that links to the public verification page
+// next to the doctor's signature block
+func (d *document) verification(code, verifyURL string, issuedAt time.Time, doctor *models.Doctor) error {
+	pdf := d.pdf
+
+	_, pageHeight := pdf.GetPageSize()
+	_, _, _, bottom := pdf.GetMargins()
+	if pdf.GetY()+qrSize+15 > pageHeight-bottom {
+		pdf.AddPage()
+	}
+	pdf.Ln(6)
+
+	png, err := qrcode.Encode(verifyURL, qrcode.Medium, 256)
+	if err != nil {
+		return err
+	}
+	pdf.RegisterImageOptionsReader("verify-qr", gofpdf.ImageOptions{ImageType: "PNG"}, bytes.NewReader(png))
+
+	top := pdf.GetY()
+	pdf.ImageOptions("verify-qr", pageMargin, top, qrSize, qrSize, false, gofpdf.ImageOptions{ImageType: "PNG"}, 0, verifyURL)
+
+	pdf.SetXY(pageMargin, top+qrSize)
+	pdf.SetFont(fontFamily, "", 8)
+	pdf.CellFormat(qrSize+40, 4, "Quét mã để xác minh tài liệu", "", 2, "L", false, 0, "")
+	pdf.CellFormat(qrSize+40, 4, "Mã xác minh: "+code, "", 0, "L", false, 0, "")
+
+	width, _ := pdf.GetPageSize()
+	signX := width - pageMargin - 70
+	pdf.SetXY(signX, top)
+	pdf.SetFont(fontFamily, "", 10)
+	pdf.CellFormat(70, lineHeight, fmt.Sprintf("Ngày %02d tháng %02d năm %d",
+		issuedAt.Day(), int(issuedAt.Month()), issuedAt.Year()), "", 2, "C", false, 0, "")
+	pdf.SetFont(fontFamily, "B", 10)
+	pdf.CellFormat(70, lineHeight, "Bác sĩ điều trị", "", 2, "C", false, 0, "")
+	pdf.SetY(top + qrSize - lineHeight)
+	pdf.SetX(signX)
+	pdf.CellFormat(70, lineHeight, text(doctor.Name), "", 1, "C", false, 0, "")
+
+	return nil
+}
+
+// output writes the finished document
+func (d *document) output(w io.Writer) error {
+	return d.pdf.Output(w)
+}
+
+// genderLabel translates the stored gender value for display
+func genderLabel(gender string) string {
+	switch strings.ToLower(gender) {
+	case "male", "nam":
+		return "Nam"
+	case "female", "nữ", "nu":
+		return "Nữ"
+	case "":
+		return ""
+	default:
+		return "Khác"
+	}
+}
+
+// formatDate renders a YYYY-MM-DD value as DD/MM/YYYY, leaving other values untouched
+func formatDate(value string) string {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t.Format(dateLayout)
+	}
+	return value
+}
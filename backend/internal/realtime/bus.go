@@ -0,0 +1,209 @@
+// Package realtime provides the event bus used to fan real-time events out
+// to every API replica: Postgres LISTEN/NOTIFY in production, or an
+// in-memory bus for SQLite and single-node deployments.
+package realtime
+
+import (
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dottrip/fpt-swp/internal/database"
+	"github.com/lib/pq"
+)
+
+// MaxPayloadSize stays below Postgres' 8000 byte NOTIFY payload limit
+const MaxPayloadSize = 7900
+
+// compressedPrefix marks payloads that were gzipped to fit in a notification
+const compressedPrefix = "z:"
+
+// ErrPayloadTooLarge is returned when an event cannot fit in a notification
+var ErrPayloadTooLarge = errors.New("realtime: payload too large")
+
+// ErrBusFull is returned when the subscriber has fallen behind and its
+// buffer is full; the event is dropped rather than stalling the publisher
+var ErrBusFull = errors.New("realtime: subscriber buffer full, event dropped")
+
+// Bus delivers published payloads to every subscriber on every replica,
+// including the publishing one. A subscriber that falls behind loses events
+// instead of blocking publishers.
+type Bus interface {
+	Publish(payload []byte) error
+	Messages() <-chan []byte
+	Close() error
+}
+
+// New creates a bus for the named channel matching the configured database
+func New(channel string) (Bus, error) {
+	if getEnv("DB_TYPE", "postgres") == "sqlite" {
+		return NewMemoryBus(), nil
+	}
+	return NewPostgresBus(database.DB, database.PostgresDSN(), channel)
+}
+
+// getEnv gets an environment variable or returns a default value
+func getEnv(key, defaultValue string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+// memoryBus is an in-process Bus for SQLite and single-node deployments
+type memoryBus struct {
+	messages  chan []byte
+	closeOnce sync.Once
+}
+
+// NewMemoryBus creates an in-process bus
+func NewMemoryBus() Bus {
+	return &memoryBus{messages: make(chan []byte, 256)}
+}
+
+func (b *memoryBus) Publish(payload []byte) error {
+	select {
+	case b.messages <- payload:
+		return nil
+	default:
+		return ErrBusFull
+	}
+}
+
+func (b *memoryBus) Messages() <-chan []byte {
+	return b.messages
+}
+
+func (b *memoryBus) Close() error {
+	b.closeOnce.Do(func() { close(b.messages) })
+	return nil
+}
+
+// postgresBus uses LISTEN/NOTIFY so that events published on one replica
+// reach clients connected to any other replica
+type postgresBus struct {
+	db       *sql.DB
+	channel  string
+	listener *pq.Listener
+	messages chan []byte
+}
+
+// NewPostgresBus creates a bus backed by Postgres LISTEN/NOTIFY on channel.
+// dsn is used for the dedicated listener connection, db for publishing.
+func NewPostgresBus(db *sql.DB, dsn, channel string) (Bus, error) {
+	listener := pq.NewListener(dsn, 2*time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("realtime: %s listener event %d: %v", channel, ev, err)
+		}
+	})
+	if err := listener.Listen(channel); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	b := &postgresBus{
+		db:       db,
+		channel:  channel,
+		listener: listener,
+		messages: make(chan []byte, 256),
+	}
+	go b.receive()
+
+	return b, nil
+}
+
+// Publish sends payload with pg_notify. Payloads over the notification limit
+// are gzipped; ErrPayloadTooLarge is returned if they still do not fit.
+func (b *postgresBus) Publish(payload []byte) error {
+	message := string(payload)
+
+	if len(message) > MaxPayloadSize {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(payload); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		message = compressedPrefix + base64.StdEncoding.EncodeToString(buf.Bytes())
+		if len(message) > MaxPayloadSize {
+			return ErrPayloadTooLarge
+		}
+	}
+
+	_, err := b.db.Exec("SELECT pg_notify($1, $2)", b.channel, message)
+	return err
+}
+
+func (b *postgresBus) Messages() <-chan []byte {
+	return b.messages
+}
+
+func (b *postgresBus) Close() error {
+	return b.listener.Close()
+}
+
+// receive decodes notifications until the listener is closed
+func (b *postgresBus) receive() {
+	defer close(b.messages)
+
+	for {
+		select {
+		case n, ok := <-b.listener.Notify:
+			if !ok {
+				return
+			}
+			// A nil notification means the connection was re-established;
+			// anything sent while it was down is lost and clients resync over REST
+			if n == nil {
+				continue
+			}
+
+			payload, err := decodePayload(n.Extra)
+			if err != nil {
+				log.Printf("realtime: invalid %s notification: %v", b.channel, err)
+				continue
+			}
+			// Drop rather than stall the listener, whose own buffer would
+			// then fill and block every replica's notifications
+			select {
+			case b.messages <- payload:
+			default:
+				log.Printf("realtime: %s subscriber is behind, dropping notification", b.channel)
+			}
+		case <-time.After(90 * time.Second):
+			// Check the connection is still alive when the channel is quiet
+			go b.listener.Ping()
+		}
+	}
+}
+
+// decodePayload reverses the compression applied by Publish
+func decodePayload(message string) ([]byte, error) {
+	if !strings.HasPrefix(message, compressedPrefix) {
+		return []byte(message), nil
+	}
+
+	compressed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(message, compressedPrefix))
+	if err != nil {
+		return nil, err
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	return io.ReadAll(zr)
+}
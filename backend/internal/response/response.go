@@ -0,0 +1,90 @@
+// Package response defines the envelope every API response uses:
+//
+//	{"success": true, "message": "...", "data": ..., "meta": {"total": 42, "limit": 20, "offset": 0}}
+//	{"success": true, "data": [...], "meta": {"total": 42, "limit": 20, "next_cursor": "...", "has_more": true}}
+//	{"success": false, "error": {"code": "not_found", "message": "...", "request_id": "..."}}
+//
+// List endpoints page either by offset or, for stable paging while rows are
+// inserted, by an opaque cursor.
+package response
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrInvalidCursor is returned by DecodeCursor for a cursor it did not issue
+var ErrInvalidCursor = errors.New("response: invalid cursor")
+
+// Envelope is the body of every JSON response
+type Envelope struct {
+	Success bool        `json:"success"`
+	Message string      `json:"message,omitempty"`
+	Data    interface{} `json:"data,omitempty"`
+	Meta    *Meta       `json:"meta,omitempty"`
+	Error   *Error      `json:"error,omitempty"`
+}
+
+// Meta describes the page of a list response
+type Meta struct {
+	Total      int    `json:"total"`
+	Limit      int    `json:"limit,omitempty"`       // 0 for lists that are not paged
+	Offset     *int   `json:"offset,omitempty"`      // offset paging only
+	NextCursor string `json:"next_cursor,omitempty"` // cursor paging only; empty on the last page
+	HasMore    bool   `json:"has_more"`
+}
+
+// Error is the error member of a failed response
+type Error struct {
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+// OK writes a successful response with data
+func OK(c *gin.Context, status int, data interface{}) {
+	c.JSON(status, Envelope{Success: true, Data: data})
+}
+
+// Message writes a successful response with a message and optional data
+func Message(c *gin.Context, status int, message string, data interface{}) {
+	c.JSON(status, Envelope{Success: true, Message: message, Data: data})
+}
+
+// List writes a page of a list
+func List(c *gin.Context, data interface{}, meta Meta) {
+	c.JSON(http.StatusOK, Envelope{Success: true, Data: data, Meta: &meta})
+}
+
+// Fail writes a failed response
+func Fail(c *gin.Context, status int, err Error) {
+	c.JSON(status, Envelope{Success: false, Error: &err})
+}
+
+// Cursor is the position a cursor-paged list resumes from: the ID of the last
+// row of the previous page and the direction of the list
+type Cursor struct {
+	ID   int  `json:"id"`
+	Desc bool `json:"desc,omitempty"`
+}
+
+// EncodeCursor returns the opaque form of cursor handed to clients
+func EncodeCursor(cursor Cursor) string {
+	b, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor parses a cursor returned by EncodeCursor
+func DecodeCursor(s string) (Cursor, error) {
+	var cursor Cursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || json.Unmarshal(b, &cursor) != nil || cursor.ID <= 0 {
+		return Cursor{}, ErrInvalidCursor
+	}
+	return cursor, nil
+}
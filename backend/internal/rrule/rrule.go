@@ -0,0 +1,244 @@
+// Package rrule parses and expands a subset of iCalendar (RFC 5545)
+// recurrence rules: FREQ=DAILY, WEEKLY or MONTHLY with INTERVAL, COUNT,
+// UNTIL and, for weekly rules, BYDAY. That covers the recurring meetings,
+// trainings and support blocks of the staff calendar.
+package rrule
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Frequencies supported by the parser
+const (
+	Daily   = "DAILY"
+	Weekly  = "WEEKLY"
+	Monthly = "MONTHLY"
+)
+
+// maxOccurrences bounds expansion of a single rule
+const maxOccurrences = 5000
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// Rule is a parsed recurrence rule
+type Rule struct {
+	Freq     string
+	Interval int
+	Count    int       // 0 means unbounded
+	Until    time.Time // zero means unbounded
+	ByDay    []time.Weekday
+}
+
+// Parse parses an RRULE value such as "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=10".
+// A leading "RRULE:" is accepted.
+func Parse(value string) (*Rule, error) {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "RRULE:")
+	if value == "" {
+		return nil, errors.New("rrule: empty rule")
+	}
+
+	r := &Rule{Interval: 1}
+
+	for _, part := range strings.Split(value, ";") {
+		key, val, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("rrule: invalid part %q", part)
+		}
+
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			switch f := strings.ToUpper(val); f {
+			case Daily, Weekly, Monthly:
+				r.Freq = f
+			default:
+				return nil, fmt.Errorf("rrule: unsupported FREQ %q", val)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 1 || n > 365 {
+				return nil, fmt.Errorf("rrule: invalid INTERVAL %q", val)
+			}
+			r.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 1 || n > maxOccurrences {
+				return nil, fmt.Errorf("rrule: invalid COUNT %q", val)
+			}
+			r.Count = n
+		case "UNTIL":
+			until, err := parseUntil(val)
+			if err != nil {
+				return nil, err
+			}
+			r.Until = until
+		case "BYDAY":
+			for _, day := range strings.Split(val, ",") {
+				wd, ok := weekdays[strings.ToUpper(strings.TrimSpace(day))]
+				if !ok {
+					return nil, fmt.Errorf("rrule: unsupported BYDAY %q", day)
+				}
+				r.ByDay = append(r.ByDay, wd)
+			}
+		case "WKST":
+			// Weeks always start on Monday
+		default:
+			return nil, fmt.Errorf("rrule: unsupported part %q", key)
+		}
+	}
+
+	if r.Freq == "" {
+		return nil, errors.New("rrule: FREQ is required")
+	}
+	if r.Count > 0 && !r.Until.IsZero() {
+		return nil, errors.New("rrule: COUNT and UNTIL cannot both be set")
+	}
+	if len(r.ByDay) > 0 && r.Freq != Weekly {
+		return nil, errors.New("rrule: BYDAY is only supported with FREQ=WEEKLY")
+	}
+
+	sort.Slice(r.ByDay, func(i, j int) bool { return mondayIndex(r.ByDay[i]) < mondayIndex(r.ByDay[j]) })
+
+	return r, nil
+}
+
+func parseUntil(val string) (time.Time, error) {
+	for _, layout := range []string{"20060102T150405Z", "20060102T150405", "20060102"} {
+		if t, err := time.Parse(layout, val); err == nil {
+			if layout == "20060102" {
+				// A date-only UNTIL includes that whole day
+				t = t.Add(24*time.Hour - time.Second)
+			}
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("rrule: invalid UNTIL %q", val)
+}
+
+// mondayIndex numbers weekdays from Monday (0) to Sunday (6)
+func mondayIndex(d time.Weekday) int {
+	return (int(d) + 6) % 7
+}
+
+// String formats the rule back into RRULE syntax
+func (r *Rule) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, d := range r.ByDay {
+			days[i] = strings.ToUpper(d.String()[:2])
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+	return strings.Join(parts, ";")
+}
+
+// iterate calls fn with each occurrence start in order, beginning with
+// dtstart, until fn returns false or the rule ends. Occurrences are computed
+// in dtstart's location, so a 09:00 meeting stays at 09:00 local time.
+func (r *Rule) iterate(dtstart time.Time, fn func(time.Time) bool) {
+	emitted := 0
+	emit := func(t time.Time) bool {
+		if t.Before(dtstart) {
+			return true
+		}
+		if !r.Until.IsZero() && t.After(r.Until) {
+			return false
+		}
+		if r.Count > 0 && emitted >= r.Count {
+			return false
+		}
+		if emitted >= maxOccurrences {
+			return false
+		}
+		emitted++
+		return fn(t)
+	}
+
+	y, m, d := dtstart.Date()
+	hh, mm, ss := dtstart.Clock()
+	loc := dtstart.Location()
+
+	switch r.Freq {
+	case Daily:
+		for i := 0; ; i++ {
+			if !emit(time.Date(y, m, d+i*r.Interval, hh, mm, ss, 0, loc)) {
+				return
+			}
+		}
+	case Weekly:
+		days := r.ByDay
+		if len(days) == 0 {
+			days = []time.Weekday{dtstart.Weekday()}
+		}
+		// Monday of the week containing dtstart
+		weekStart := d - mondayIndex(dtstart.Weekday())
+		for week := 0; ; week++ {
+			for _, day := range days {
+				t := time.Date(y, m, weekStart+week*7*r.Interval+mondayIndex(day), hh, mm, ss, 0, loc)
+				if !emit(t) {
+					return
+				}
+			}
+		}
+	case Monthly:
+		for i := 0; i < maxOccurrences*r.Interval; i++ {
+			month := m + time.Month(i*r.Interval)
+			t := time.Date(y, month, d, hh, mm, ss, 0, loc)
+			// Skip months without that day (e.g. the 31st) rather than rolling over
+			if t.Day() != d {
+				continue
+			}
+			if !emit(t) {
+				return
+			}
+		}
+	}
+}
+
+// Between returns the starts of occurrences of a rule beginning at dtstart
+// that last duration and overlap [from, to)
+func (r *Rule) Between(dtstart time.Time, duration time.Duration, from, to time.Time) []time.Time {
+	var starts []time.Time
+	r.iterate(dtstart, func(t time.Time) bool {
+		if !t.Before(to) {
+			return false
+		}
+		if t.Add(duration).After(from) {
+			starts = append(starts, t)
+		}
+		return true
+	})
+	return starts
+}
+
+// End returns the start of the last occurrence, or false if the rule
+// repeats forever
+func (r *Rule) End(dtstart time.Time) (time.Time, bool) {
+	if r.Count == 0 && r.Until.IsZero() {
+		return time.Time{}, false
+	}
+
+	var last time.Time
+	r.iterate(dtstart, func(t time.Time) bool {
+		last = t
+		return true
+	})
+	return last, true
+}
@@ -0,0 +1,138 @@
+// Package signaling relays WebRTC offers, answers and ICE candidates between
+// the doctor and patient of a consultation session. Media stays peer-to-peer;
+// the server only forwards signaling messages and tracks the session state.
+package signaling
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+
+	"github.com/dottrip/fpt-swp/internal/models"
+	"github.com/dottrip/fpt-swp/internal/realtime"
+)
+
+// busChannel is the bus channel used for signaling fan-out
+const busChannel = "signaling_events"
+
+// Signal types. Offer, answer, ICE candidate and hangup frames come from
+// clients and are relayed to the other participant; the rest are sent by the server.
+const (
+	SignalOffer        = "offer"
+	SignalAnswer       = "answer"
+	SignalICECandidate = "ice-candidate"
+	SignalHangup       = "hangup"
+	SignalPeerJoined   = "peer-joined"
+	SignalPeerLeft     = "peer-left"
+	SignalSessionState = "session-state"
+	SignalError        = "error"
+)
+
+// Signal is a signaling message scoped to a consultation session
+type Signal struct {
+	Type       string                      `json:"type"`
+	SessionID  int                         `json:"session_id"`
+	FromUserID int                         `json:"from_user_id,omitempty"`
+	Payload    json.RawMessage             `json:"payload,omitempty"`
+	Session    *models.ConsultationSession `json:"session,omitempty"`
+	Error      string                      `json:"error,omitempty"`
+}
+
+// Hub tracks the participants connected to this replica and delivers bus
+// signals to the other participants of the same session
+type Hub struct {
+	bus   realtime.Bus
+	mu    sync.RWMutex
+	peers map[int]map[*Peer]struct{} // keyed by session ID
+}
+
+// DefaultHub is the hub used by the HTTP handlers
+var DefaultHub *Hub
+
+// Init creates DefaultHub on the bus matching the configured database
+func Init() {
+	bus, err := realtime.New(busChannel)
+	if err != nil {
+		log.Fatal("Failed to start signaling event bus:", err)
+	}
+
+	DefaultHub = NewHub(bus)
+	go DefaultHub.Run()
+}
+
+// NewHub creates a hub on top of bus
+func NewHub(bus realtime.Bus) *Hub {
+	return &Hub{
+		bus:   bus,
+		peers: make(map[int]map[*Peer]struct{}),
+	}
+}
+
+// Run delivers bus signals to local peers until the bus is closed
+func (h *Hub) Run() {
+	for payload := range h.bus.Messages() {
+		var signal Signal
+		if err := json.Unmarshal(payload, &signal); err != nil {
+			log.Printf("signaling: invalid signal payload: %v", err)
+			continue
+		}
+		h.dispatch(signal)
+	}
+}
+
+// Publish sends a signal to every replica
+func (h *Hub) Publish(signal Signal) error {
+	payload, err := json.Marshal(signal)
+	if err != nil {
+		return err
+	}
+	return h.bus.Publish(payload)
+}
+
+func (h *Hub) register(p *Peer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.peers[p.sessionID] == nil {
+		h.peers[p.sessionID] = make(map[*Peer]struct{})
+	}
+	h.peers[p.sessionID][p] = struct{}{}
+}
+
+func (h *Hub) unregister(p *Peer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if peers, ok := h.peers[p.sessionID]; ok {
+		delete(peers, p)
+		if len(peers) == 0 {
+			delete(h.peers, p.sessionID)
+		}
+	}
+}
+
+// dispatch delivers a signal to the local peers of its session. Relayed
+// signals are not echoed back to the user who sent them.
+func (h *Hub) dispatch(signal Signal) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for p := range h.peers[signal.SessionID] {
+		if signal.FromUserID != 0 && p.userID == signal.FromUserID {
+			continue
+		}
+		p.deliver(signal)
+	}
+}
+
+// PublishState announces a session state change to both participants
+func (h *Hub) PublishState(session *models.ConsultationSession) {
+	err := h.Publish(Signal{
+		Type:      SignalSessionState,
+		SessionID: session.ID,
+		Session:   session,
+	})
+	if err != nil {
+		log.Printf("signaling: failed to publish state of session %d: %v", session.ID, err)
+	}
+}
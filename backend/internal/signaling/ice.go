@@ -0,0 +1,82 @@
+package signaling
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ICEServer is a STUN/TURN server entry in the shape expected by RTCPeerConnection
+type ICEServer struct {
+	URLs       []string `json:"urls"`
+	Username   string   `json:"username,omitempty"`
+	Credential string   `json:"credential,omitempty"`
+}
+
+// ICEConfig is returned to clients before they create a peer connection
+type ICEConfig struct {
+	ICEServers []ICEServer `json:"ice_servers"`
+	ExpiresAt  *time.Time  `json:"expires_at,omitempty"`
+}
+
+// getEnv gets an environment variable or returns a default value
+func getEnv(key, defaultValue string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+// splitURLs parses a comma-separated list of server URLs
+func splitURLs(value string) []string {
+	var urls []string
+	for _, url := range strings.Split(value, ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			urls = append(urls, url)
+		}
+	}
+	return urls
+}
+
+// ICEServersFor builds the ICE configuration for userID from STUN_URLS,
+// TURN_URLS and TURN_SECRET. TURN credentials follow the TURN REST API
+// convention (username "<expiry>:<user>", HMAC-SHA1 password) understood by
+// coturn's use-auth-secret mode, and expire after TURN_CREDENTIAL_TTL seconds.
+func ICEServersFor(userID int) ICEConfig {
+	config := ICEConfig{ICEServers: []ICEServer{}}
+
+	if stun := splitURLs(getEnv("STUN_URLS", "stun:stun.l.google.com:19302")); len(stun) > 0 {
+		config.ICEServers = append(config.ICEServers, ICEServer{URLs: stun})
+	}
+
+	turn := splitURLs(getEnv("TURN_URLS", ""))
+	secret := getEnv("TURN_SECRET", "")
+	if len(turn) == 0 || secret == "" {
+		return config
+	}
+
+	ttl, err := strconv.Atoi(getEnv("TURN_CREDENTIAL_TTL", "600"))
+	if err != nil || ttl <= 0 {
+		ttl = 600
+	}
+	expiresAt := time.Now().Add(time.Duration(ttl) * time.Second).UTC()
+
+	username := fmt.Sprintf("%d:%d", expiresAt.Unix(), userID)
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write([]byte(username))
+
+	config.ICEServers = append(config.ICEServers, ICEServer{
+		URLs:       turn,
+		Username:   username,
+		Credential: base64.StdEncoding.EncodeToString(mac.Sum(nil)),
+	})
+	config.ExpiresAt = &expiresAt
+
+	return config
+}
@@ -0,0 +1,191 @@
+package signaling
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/dottrip/fpt-swp/internal/models"
+	"github.com/dottrip/fpt-swp/internal/realtime"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	writeWait      = 10 * time.Second
+	pongWait       = 60 * time.Second
+	pingPeriod     = (pongWait * 9) / 10
+	maxFrameSize   = 64 * 1024
+	sendBufferSize = 64
+)
+
+// Upgrader upgrades signaling HTTP requests to WebSocket connections. Requests
+// are authenticated with a bearer token rather than cookies, so any origin may connect.
+var Upgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+	CheckOrigin:     func(r *http.Request) bool { return true },
+}
+
+// peerFrame is a frame sent by a participant
+type peerFrame struct {
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// Peer is the signaling connection of one participant of a session
+type Peer struct {
+	hub       *Hub
+	conn      *websocket.Conn
+	sessionID int
+	userID    int
+	send      chan Signal
+}
+
+// ServeConn runs a signaling session for userID, who must already have been
+// authorized as a participant of session, and blocks until the connection closes
+func (h *Hub) ServeConn(conn *websocket.Conn, session *models.ConsultationSession, userID int) {
+	p := &Peer{
+		hub:       h,
+		conn:      conn,
+		sessionID: session.ID,
+		userID:    userID,
+		send:      make(chan Signal, sendBufferSize),
+	}
+
+	h.register(p)
+	go p.writePump()
+
+	p.deliver(Signal{Type: SignalSessionState, SessionID: session.ID, Session: session})
+	p.publish(Signal{Type: SignalPeerJoined})
+
+	p.readPump()
+}
+
+// deliver queues a signal for the peer, dropping the connection if it cannot keep up
+func (p *Peer) deliver(signal Signal) {
+	select {
+	case p.send <- signal:
+	default:
+		log.Printf("signaling: dropping slow peer of user %d", p.userID)
+		p.conn.Close()
+	}
+}
+
+// publish sends a signal from this peer to the other participant
+func (p *Peer) publish(signal Signal) error {
+	signal.SessionID = p.sessionID
+	signal.FromUserID = p.userID
+	return p.hub.Publish(signal)
+}
+
+// readPump handles frames from the peer until the connection fails
+func (p *Peer) readPump() {
+	defer func() {
+		p.hub.unregister(p)
+		close(p.send)
+		p.conn.Close()
+		if err := p.publish(Signal{Type: SignalPeerLeft}); err != nil {
+			log.Printf("signaling: failed to announce departure from session %d: %v", p.sessionID, err)
+		}
+	}()
+
+	p.conn.SetReadLimit(maxFrameSize)
+	p.conn.SetReadDeadline(time.Now().Add(pongWait))
+	p.conn.SetPongHandler(func(string) error {
+		return p.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, data, err := p.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Printf("signaling: read error for user %d: %v", p.userID, err)
+			}
+			return
+		}
+
+		var frame peerFrame
+		if err := json.Unmarshal(data, &frame); err != nil {
+			p.deliver(Signal{Type: SignalError, SessionID: p.sessionID, Error: "invalid frame"})
+			continue
+		}
+
+		if err := p.handle(frame); err != nil {
+			message := "failed to relay signal"
+			if errors.Is(err, realtime.ErrPayloadTooLarge) {
+				message = "signal payload too large"
+			} else {
+				log.Printf("signaling: failed to handle %q frame in session %d: %v", frame.Type, p.sessionID, err)
+			}
+			p.deliver(Signal{Type: SignalError, SessionID: p.sessionID, Error: message})
+		}
+	}
+}
+
+// handle relays a frame and applies the session state transitions it implies:
+// an answer means the call is connected, a hangup means it is over
+func (p *Peer) handle(frame peerFrame) error {
+	switch frame.Type {
+	case SignalOffer, SignalICECandidate:
+		return p.publish(Signal{Type: frame.Type, Payload: frame.Payload})
+	case SignalAnswer:
+		if err := p.publish(Signal{Type: frame.Type, Payload: frame.Payload}); err != nil {
+			return err
+		}
+		session := &models.ConsultationSession{ID: p.sessionID}
+		started, err := session.Start()
+		if err != nil {
+			return err
+		}
+		if started {
+			p.hub.PublishState(session)
+		}
+		return nil
+	case SignalHangup:
+		if err := p.publish(Signal{Type: frame.Type}); err != nil {
+			return err
+		}
+		session := &models.ConsultationSession{ID: p.sessionID}
+		completed, err := session.Complete()
+		if err != nil {
+			return err
+		}
+		if completed {
+			p.hub.PublishState(session)
+		}
+		return nil
+	default:
+		p.deliver(Signal{Type: SignalError, SessionID: p.sessionID, Error: "unknown frame type"})
+		return nil
+	}
+}
+
+// writePump writes queued signals and keepalive pings to the connection
+func (p *Peer) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		p.conn.Close()
+	}()
+
+	for {
+		select {
+		case signal, ok := <-p.send:
+			p.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				p.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := p.conn.WriteJSON(signal); err != nil {
+				return
+			}
+		case <-ticker.C:
+			p.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := p.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
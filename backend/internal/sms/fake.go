@@ -0,0 +1,52 @@
+package sms
+
+import (
+	"context"
+	"strconv"
+	"sync"
+)
+
+// Fake records messages in memory instead of sending them. It is used with
+// SMS_DRIVER=fake in development and by tests.
+type Fake struct {
+	mu       sync.Mutex
+	messages []Message
+	// Err, when set, is returned by Send to simulate a gateway failure
+	Err error
+}
+
+// NewFake creates an empty fake provider
+func NewFake() *Fake {
+	return &Fake{}
+}
+
+// Name returns "fake"
+func (f *Fake) Name() string {
+	return "fake"
+}
+
+// Send records msg and returns a sequential provider ID
+func (f *Fake) Send(ctx context.Context, msg Message) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return "", f.Err
+	}
+	f.messages = append(f.messages, msg)
+	return "fake-" + strconv.Itoa(len(f.messages)), nil
+}
+
+// Messages returns a copy of the recorded messages
+func (f *Fake) Messages() []Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Message(nil), f.messages...)
+}
+
+// Reset forgets the recorded messages
+func (f *Fake) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.messages = nil
+}
@@ -0,0 +1,180 @@
+package sms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// HTTPConfig describes how to call an SMS gateway's HTTP API
+type HTTPConfig struct {
+	Name        string // recorded with each message, e.g. "esms" or "speedsms"
+	URL         string // may contain template actions, e.g. for GET gateways
+	Method      string
+	ContentType string
+	// BodyTemplate renders the request body with text/template. It gets .To,
+	// .Body, .Sender, .Reference and .CallbackURL, and the functions json
+	// (a JSON string literal) and urlquery.
+	BodyTemplate string
+	AuthType     string // none, basic, bearer or header
+	Username     string
+	Password     string
+	Token        string
+	AuthHeader   string // header carrying Token for the "header" auth type
+	// IDField is the dot-separated path of the message ID in the JSON
+	// response, e.g. "data.message_id"; empty if the gateway returns none
+	IDField     string
+	Sender      string // brand name registered with the gateway
+	CallbackURL string
+	Timeout     time.Duration
+}
+
+// HTTPProvider sends messages through a configurable HTTP API
+type HTTPProvider struct {
+	config HTTPConfig
+	url    *template.Template
+	body   *template.Template
+	client *http.Client
+}
+
+var templateFuncs = template.FuncMap{
+	"json": func(s string) (string, error) {
+		b, err := json.Marshal(s)
+		return string(b), err
+	},
+	"urlquery": url.QueryEscape,
+}
+
+// NewHTTPProvider creates a provider from config
+func NewHTTPProvider(config HTTPConfig) (*HTTPProvider, error) {
+	if config.URL == "" {
+		return nil, errors.New("sms: SMS_HTTP_URL is required")
+	}
+	if config.Method == "" {
+		config.Method = http.MethodPost
+	}
+	if config.Name == "" {
+		config.Name = "http"
+	}
+	switch config.AuthType {
+	case "", "none", "basic", "bearer", "header":
+	default:
+		return nil, fmt.Errorf("sms: unknown auth type %q", config.AuthType)
+	}
+
+	urlTemplate, err := template.New("url").Funcs(templateFuncs).Parse(config.URL)
+	if err != nil {
+		return nil, fmt.Errorf("sms: invalid URL template: %w", err)
+	}
+	bodyTemplate, err := template.New("body").Funcs(templateFuncs).Parse(config.BodyTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("sms: invalid body template: %w", err)
+	}
+
+	return &HTTPProvider{
+		config: config,
+		url:    urlTemplate,
+		body:   bodyTemplate,
+		client: &http.Client{Timeout: config.Timeout},
+	}, nil
+}
+
+// Name returns the configured provider name
+func (p *HTTPProvider) Name() string {
+	return p.config.Name
+}
+
+// Send renders the request and calls the gateway. Any 2xx response counts
+// as accepted.
+func (p *HTTPProvider) Send(ctx context.Context, msg Message) (string, error) {
+	data := struct {
+		Message
+		Sender      string
+		CallbackURL string
+	}{msg, p.config.Sender, p.config.CallbackURL}
+
+	var target, body bytes.Buffer
+	if err := p.url.Execute(&target, data); err != nil {
+		return "", err
+	}
+	if err := p.body.Execute(&body, data); err != nil {
+		return "", err
+	}
+
+	var reader io.Reader
+	if p.config.Method != http.MethodGet && body.Len() > 0 {
+		reader = &body
+	}
+
+	req, err := http.NewRequestWithContext(ctx, p.config.Method, target.String(), reader)
+	if err != nil {
+		return "", err
+	}
+	if reader != nil && p.config.ContentType != "" {
+		req.Header.Set("Content-Type", p.config.ContentType)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	switch p.config.AuthType {
+	case "basic":
+		req.SetBasicAuth(p.config.Username, p.config.Password)
+	case "bearer":
+		req.Header.Set("Authorization", "Bearer "+p.config.Token)
+	case "header":
+		req.Header.Set(p.config.AuthHeader, p.config.Token)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("sms: gateway returned %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+
+	return extractID(respBody, p.config.IDField), nil
+}
+
+// extractID reads the message ID at a dot-separated path of a JSON response
+func extractID(body []byte, path string) string {
+	if path == "" {
+		return ""
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return ""
+	}
+
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		value = object[key]
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return fmt.Sprintf("%.0f", v)
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,69 @@
+package sms
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// ErrInvalidPhone is returned for numbers that cannot be normalized
+var ErrInvalidPhone = errors.New("sms: invalid phone number")
+
+var (
+	phoneSeparators = strings.NewReplacer(" ", "", "-", "", ".", "", "(", "", ")", "")
+	e164Pattern     = regexp.MustCompile(`^\+[1-9][0-9]{7,14}$`)
+	// Vietnamese national numbers: 9 digits for mobiles (3x, 5x, 7x, 8x, 9x)
+	// and 10 digits for landlines (2xx)
+	vnNationalPattern = regexp.MustCompile(`^(?:[35789][0-9]{8}|2[0-9]{9})$`)
+)
+
+// legacyMobilePrefixes maps the 11-digit mobile prefixes retired in 2018 to
+// their 10-digit replacements, as still found in old patient records
+var legacyMobilePrefixes = map[string]string{
+	"120": "70", "121": "79", "122": "77", "126": "76", "128": "78",
+	"123": "83", "124": "84", "125": "85", "127": "81", "129": "82",
+	"162": "32", "163": "33", "164": "34", "165": "35", "166": "36", "167": "37", "168": "38", "169": "39",
+	"186": "56", "188": "58", "199": "59",
+}
+
+// NormalizePhone converts a phone number to E.164. Vietnamese numbers may be
+// written nationally ("0912 345 678"), with the country code ("84912345678",
+// "0084 912 345 678") or with a retired 11-digit prefix ("0168 xxx xxxx").
+// Other international numbers must already start with "+".
+func NormalizePhone(raw string) (string, error) {
+	number := phoneSeparators.Replace(strings.TrimSpace(raw))
+	if number == "" {
+		return "", ErrInvalidPhone
+	}
+
+	var national string
+	switch {
+	case strings.HasPrefix(number, "+84"):
+		national = number[3:]
+	case strings.HasPrefix(number, "+"):
+		if !e164Pattern.MatchString(number) {
+			return "", ErrInvalidPhone
+		}
+		return number, nil
+	case strings.HasPrefix(number, "0084"):
+		national = number[4:]
+	case strings.HasPrefix(number, "84") && len(number) >= 11:
+		national = number[2:]
+	case strings.HasPrefix(number, "0"):
+		national = number[1:]
+	default:
+		return "", ErrInvalidPhone
+	}
+
+	national = strings.TrimPrefix(national, "0")
+	if len(national) == 10 && national[0] == '1' {
+		if replacement, ok := legacyMobilePrefixes[national[:3]]; ok {
+			national = replacement + national[3:]
+		}
+	}
+
+	if !vnNationalPattern.MatchString(national) {
+		return "", ErrInvalidPhone
+	}
+	return "+84" + national, nil
+}
@@ -0,0 +1,189 @@
+// Package sms sends text messages through a pluggable provider: a generic
+// HTTP adapter that most Vietnamese SMS gateways fit, or an in-memory fake
+// for development and tests. Every message is logged in the database, which
+// also enforces per-number rate limits across replicas and stores delivery
+// reports posted back by the provider.
+package sms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dottrip/fpt-swp/internal/models"
+	"github.com/dottrip/fpt-swp/internal/textutil"
+)
+
+// ErrRateLimited is returned when a number has received too many messages
+var ErrRateLimited = errors.New("sms: rate limit exceeded for this number")
+
+// ErrNotConfigured is returned when no provider is configured
+var ErrNotConfigured = errors.New("sms: no provider configured")
+
+// Message is a text message handed to a provider
+type Message struct {
+	To        string // E.164
+	Body      string
+	Reference string // our message ID, echoed back in delivery reports
+}
+
+// Sender delivers messages to a provider. Send returns the provider's ID
+// for the message, used to match delivery reports.
+type Sender interface {
+	Name() string
+	Send(ctx context.Context, msg Message) (string, error)
+}
+
+// Default is the sender used by Send; nil means SMS is disabled
+var Default Sender
+
+// Init creates Default from the environment
+func Init() {
+	s, err := New()
+	if err != nil {
+		log.Fatal("Failed to initialize SMS provider:", err)
+	}
+	Default = s
+}
+
+// New creates the sender selected by SMS_DRIVER: "http", "fake", or "none"
+// (the default) to disable SMS
+func New() (Sender, error) {
+	switch driver := getEnv("SMS_DRIVER", "none"); driver {
+	case "none":
+		return nil, nil
+	case "fake":
+		return NewFake(), nil
+	case "http":
+		timeout, err := strconv.Atoi(getEnv("SMS_HTTP_TIMEOUT_SECONDS", "10"))
+		if err != nil || timeout <= 0 {
+			timeout = 10
+		}
+		return NewHTTPProvider(HTTPConfig{
+			Name:         getEnv("SMS_PROVIDER_NAME", "http"),
+			URL:          getEnv("SMS_HTTP_URL", ""),
+			Method:       getEnv("SMS_HTTP_METHOD", "POST"),
+			ContentType:  getEnv("SMS_HTTP_CONTENT_TYPE", "application/json"),
+			BodyTemplate: getEnv("SMS_HTTP_BODY_TEMPLATE", `{"to":{{json .To}},"message":{{json .Body}},"sender":{{json .Sender}}}`),
+			AuthType:     getEnv("SMS_HTTP_AUTH", "none"),
+			Username:     getEnv("SMS_HTTP_USERNAME", ""),
+			Password:     getEnv("SMS_HTTP_PASSWORD", ""),
+			Token:        getEnv("SMS_HTTP_TOKEN", ""),
+			AuthHeader:   getEnv("SMS_HTTP_AUTH_HEADER", "X-API-Key"),
+			IDField:      getEnv("SMS_HTTP_ID_FIELD", "id"),
+			Sender:       getEnv("SMS_SENDER_NAME", ""),
+			CallbackURL:  CallbackURL(),
+			Timeout:      time.Duration(timeout) * time.Second,
+		})
+	default:
+		return nil, fmt.Errorf("sms: unknown driver %q", driver)
+	}
+}
+
+// CallbackURL is the delivery report URL handed to providers that accept
+// one per message
+func CallbackURL() string {
+	base := strings.TrimRight(getEnv("PUBLIC_API_URL", "http://localhost:8080"), "/")
+	callback := base + "/api/sms/status-callback"
+	if secret := CallbackSecret(); secret != "" {
+		callback += "?token=" + url.QueryEscape(secret)
+	}
+	return callback
+}
+
+// CallbackSecret authenticates delivery reports, from SMS_CALLBACK_SECRET
+func CallbackSecret() string {
+	return getEnv("SMS_CALLBACK_SECRET", "")
+}
+
+// rateLimits are the per-number limits, from SMS_RATE_LIMIT_PER_HOUR
+// (default 5) and SMS_RATE_LIMIT_PER_DAY (default 20); 0 disables a limit
+func rateLimits() []models.SMSLimit {
+	limit := func(key, fallback string) int {
+		n, err := strconv.Atoi(getEnv(key, fallback))
+		if err != nil || n < 0 {
+			n, _ = strconv.Atoi(fallback)
+		}
+		return n
+	}
+
+	return []models.SMSLimit{
+		{Window: time.Hour, Limit: limit("SMS_RATE_LIMIT_PER_HOUR", "5")},
+		{Window: 24 * time.Hour, Limit: limit("SMS_RATE_LIMIT_PER_DAY", "20")},
+	}
+}
+
+// prepareBody strips diacritics when SMS_ASCII_ONLY is set; unaccented
+// messages fit 160 characters per segment instead of 70 and some gateways
+// only accept them
+func prepareBody(body string) string {
+	body = strings.TrimSpace(body)
+	if getEnv("SMS_ASCII_ONLY", "false") == "true" {
+		body = textutil.StripDiacritics(body)
+	}
+	return body
+}
+
+// Send normalizes the number, enforces its rate limits, logs the message and
+// hands it to Default. userID is 0 for messages not sent to a user account.
+func Send(ctx context.Context, userID int, phone, body string) (*models.SMSMessage, error) {
+	if Default == nil {
+		return nil, ErrNotConfigured
+	}
+
+	to, err := NormalizePhone(phone)
+	if err != nil {
+		return nil, err
+	}
+
+	body = prepareBody(body)
+	if body == "" {
+		return nil, errors.New("sms: empty message")
+	}
+
+	message := &models.SMSMessage{
+		PhoneNumber: to,
+		Body:        body,
+		Provider:    Default.Name(),
+		Status:      models.SMSQueued,
+	}
+	if userID != 0 {
+		message.UserID = &userID
+	}
+
+	within, err := message.CreateWithinLimits(rateLimits(), ErrRateLimited.Error())
+	if err != nil {
+		return nil, err
+	}
+	if !within {
+		return message, ErrRateLimited
+	}
+
+	providerID, err := Default.Send(ctx, Message{To: to, Body: body, Reference: strconv.Itoa(message.ID)})
+	if err != nil {
+		if markErr := message.MarkFailed(err.Error()); markErr != nil {
+			log.Printf("sms: failed to record failure of message %d: %v", message.ID, markErr)
+		}
+		return message, err
+	}
+
+	if err := message.MarkSent(providerID); err != nil {
+		return message, err
+	}
+	return message, nil
+}
+
+// getEnv gets an environment variable or returns a default value
+func getEnv(key, defaultValue string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
@@ -0,0 +1,49 @@
+package sms
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/dottrip/fpt-swp/internal/models"
+)
+
+// deliveryStatuses maps the status words gateways use in delivery reports,
+// including SMPP-style DLR states, to our statuses
+var deliveryStatuses = map[string]string{
+	"delivered":   models.SMSDelivered,
+	"delivrd":     models.SMSDelivered,
+	"success":     models.SMSDelivered,
+	"successful":  models.SMSDelivered,
+	"sent":        models.SMSSent,
+	"accepted":    models.SMSSent,
+	"acceptd":     models.SMSSent,
+	"enroute":     models.SMSSent,
+	"undelivered": models.SMSUndelivered,
+	"undeliv":     models.SMSUndelivered,
+	"expired":     models.SMSUndelivered,
+	"rejected":    models.SMSUndelivered,
+	"rejectd":     models.SMSUndelivered,
+	"deleted":     models.SMSUndelivered,
+	"failed":      models.SMSFailed,
+	"error":       models.SMSFailed,
+}
+
+// ParseDeliveryStatus maps a gateway's status to ours
+func ParseDeliveryStatus(raw string) (string, bool) {
+	status, ok := deliveryStatuses[strings.ToLower(strings.TrimSpace(raw))]
+	return status, ok
+}
+
+// FindMessage finds the message a delivery report refers to, by our
+// reference if the gateway echoes it or else by the provider's message ID
+func FindMessage(reference, providerMessageID string) (*models.SMSMessage, error) {
+	if id, err := strconv.Atoi(reference); err == nil {
+		return models.GetSMSMessageByID(id)
+	}
+
+	provider := "http"
+	if Default != nil {
+		provider = Default.Name()
+	}
+	return models.GetSMSMessageByProviderID(provider, providerMessageID)
+}
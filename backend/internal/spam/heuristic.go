@@ -0,0 +1,132 @@
+package spam
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/dottrip/fpt-swp/internal/textutil"
+	"golang.org/x/text/unicode/norm"
+)
+
+// DefaultBlocklist holds words common in spam on Vietnamese health sites.
+// They are spelled with diacritics so that "lô đề" does not also block
+// "lo để".
+var DefaultBlocklist = []string{
+	"casino", "cá độ", "lô đề", "nổ hũ", "vay tiền nhanh", "kiếm tiền online",
+	"viagra", "thuốc kích dục", "giảm cân cấp tốc",
+}
+
+// links matches URLs and bare domains such as "example.com/path"
+var links = regexp.MustCompile(`(?i)\bhttps?://|\bwww\.|\b[a-z0-9-]+\.(?:com|net|org|info|biz|xyz|top|vn|io|me)\b`)
+
+// HeuristicConfig tunes the heuristic classifier
+type HeuristicConfig struct {
+	MaxLinks   int           // comments with more links are spam; any link holds a comment
+	Blocklist  []string      // words or phrases that make a comment spam; see blockedPhrase
+	RateLimit  int           // comments per RateWindow before more are held; 0 disables
+	RateWindow time.Duration // period RateLimit counts over
+}
+
+// Heuristic classifies comments by their links, a blocklist and the
+// author's posting rate
+type Heuristic struct {
+	config    HeuristicConfig
+	blocklist []blockedPhrase
+}
+
+// blockedPhrase is a blocklist entry, matched against whole words of a
+// comment. A word written without diacritics matches with any diacritics,
+// so "lo de" blocks "lô đề" and "lo để" alike. A word written with them
+// matches only itself or the same word typed without any, as spammers
+// often do: "lô đề" blocks "lo de" but not "lo để".
+type blockedPhrase struct {
+	text  string
+	words []string
+}
+
+// NewHeuristic creates a heuristic classifier
+func NewHeuristic(config HeuristicConfig) *Heuristic {
+	h := &Heuristic{config: config}
+	for _, text := range config.Blocklist {
+		if words := splitWords(text); len(words) > 0 {
+			h.blocklist = append(h.blocklist, blockedPhrase{text: strings.Join(words, " "), words: words})
+		}
+	}
+	return h
+}
+
+// splitWords lower-cases s and splits it into words of letters and digits
+func splitWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(norm.NFC.String(s)), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// in reports whether the phrase occurs in words
+func (p blockedPhrase) in(words []string) bool {
+	for i := 0; i+len(p.words) <= len(words); i++ {
+		matched := true
+		for j, blocked := range p.words {
+			if !wordMatches(words[i+j], blocked) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// wordMatches compares a word of a comment with a blocked word
+func wordMatches(word, blocked string) bool {
+	if word == blocked {
+		return true
+	}
+	folded := textutil.Fold(word)
+	if blocked == textutil.Fold(blocked) {
+		return folded == blocked
+	}
+	return word == folded && folded == textutil.Fold(blocked)
+}
+
+// Name returns "heuristic"
+func (h *Heuristic) Name() string {
+	return "heuristic"
+}
+
+// Classify marks comments with a blocked word or too many links as spam,
+// and holds comments with a link or from an author posting too fast
+func (h *Heuristic) Classify(ctx context.Context, c Comment) (Result, error) {
+	words := splitWords(c.Body)
+	for _, phrase := range h.blocklist {
+		if phrase.in(words) {
+			return Result{Verdict: Spam, Reason: fmt.Sprintf("blocked word %q", phrase.text)}, nil
+		}
+	}
+
+	n := len(links.FindAllString(c.Body, -1))
+	if n > h.config.MaxLinks {
+		return Result{Verdict: Spam, Reason: fmt.Sprintf("%d links", n)}, nil
+	}
+
+	if h.config.RateLimit > 0 && c.CountRecent != nil {
+		recent, err := c.CountRecent(time.Now().Add(-h.config.RateWindow))
+		if err != nil {
+			return Result{}, err
+		}
+		if recent >= h.config.RateLimit {
+			return Result{Verdict: Suspicious, Reason: fmt.Sprintf("%d comments in %d minutes", recent+1, int(h.config.RateWindow.Minutes()))}, nil
+		}
+	}
+
+	if n > 0 {
+		return Result{Verdict: Suspicious, Reason: "contains a link"}, nil
+	}
+	return Result{Verdict: Ham}, nil
+}
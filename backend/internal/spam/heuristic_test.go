@@ -0,0 +1,45 @@
+package spam
+
+import (
+	"context"
+	"testing"
+)
+
+func TestHeuristicBlocklist(t *testing.T) {
+	h := NewHeuristic(HeuristicConfig{MaxLinks: 2, Blocklist: DefaultBlocklist})
+
+	for body, want := range map[string]Verdict{
+		"Chơi CÁ ĐỘ bóng đá, thắng lớn":             Spam,
+		"choi ca do bong da thang lon":              Spam,
+		"Soi cầu lô đề hôm nay":                     Spam,
+		"soi cau lo-de hom nay":                     Spam,
+		"Game nổ hũ uy tín":                         Spam,
+		"Vay tiền nhanh trong ngày":                 Spam,
+		"Bố tôi bị ca đột quỵ năm ngoái":            Ham,
+		"Tôi rất lo để con ở nhà một mình":          Ham,
+		"Ăn no hụt hơi có sao không?":               Ham,
+		"Bác sĩ có thể giải thích thêm về casinos?": Ham,
+	} {
+		result, err := h.Classify(context.Background(), Comment{Body: body})
+		if err != nil {
+			t.Fatalf("Classify(%q): %v", body, err)
+		}
+		if result.Verdict != want {
+			t.Errorf("Classify(%q) = %v (%s), want %v", body, result.Verdict, result.Reason, want)
+		}
+	}
+}
+
+func TestHeuristicBlocklistWithoutDiacritics(t *testing.T) {
+	h := NewHeuristic(HeuristicConfig{MaxLinks: 2, Blocklist: []string{"lo de"}})
+
+	for _, body := range []string{"lo de", "lô đề", "lo để"} {
+		result, err := h.Classify(context.Background(), Comment{Body: body})
+		if err != nil {
+			t.Fatalf("Classify(%q): %v", body, err)
+		}
+		if result.Verdict != Spam {
+			t.Errorf("Classify(%q) = %v, want Spam", body, result.Verdict)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+// Package spam classifies reader comments through a pluggable classifier.
+// The built-in heuristic looks at links, a blocklist of words and how fast
+// the author is posting; other classifiers (e.g. a hosted service) only need
+// to implement Classifier.
+package spam
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Verdict is what a classifier thinks of a comment
+type Verdict int
+
+const (
+	// Ham is a normal comment, published straight away
+	Ham Verdict = iota
+	// Suspicious comments are held for a moderator
+	Suspicious
+	// Spam is kept out of sight, in the moderation queue's spam list
+	Spam
+)
+
+// Comment is a comment handed to a classifier
+type Comment struct {
+	Body     string
+	AuthorID int
+	PostID   int
+	// CountRecent returns how many comments the author posted since a time,
+	// for classifiers that limit the rate; nil if unknown
+	CountRecent func(since time.Time) (int, error)
+}
+
+// Result is a classifier's verdict with the reason for it, shown to
+// moderators
+type Result struct {
+	Verdict Verdict
+	Reason  string
+}
+
+// Classifier decides whether comments are spam
+type Classifier interface {
+	Name() string
+	Classify(ctx context.Context, c Comment) (Result, error)
+}
+
+// Default is the classifier used for new comments; nil holds every comment
+// for a moderator
+var Default Classifier
+
+// Init creates Default from the environment
+func Init() {
+	c, err := New()
+	if err != nil {
+		log.Fatal("Failed to initialize spam classifier:", err)
+	}
+	Default = c
+}
+
+// New creates the classifier selected by SPAM_CLASSIFIER: "heuristic" (the
+// default), or "none" to hold every comment for a moderator
+func New() (Classifier, error) {
+	switch driver := getEnv("SPAM_CLASSIFIER", "heuristic"); driver {
+	case "none":
+		return nil, nil
+	case "heuristic":
+		config := HeuristicConfig{
+			MaxLinks:   envInt("SPAM_MAX_LINKS", 2),
+			RateLimit:  envInt("SPAM_RATE_LIMIT", 5),
+			RateWindow: time.Duration(envInt("SPAM_RATE_WINDOW_MINUTES", 10)) * time.Minute,
+			Blocklist:  DefaultBlocklist,
+		}
+		if list := getEnv("SPAM_BLOCKLIST", ""); list != "" {
+			config.Blocklist = strings.Split(list, ",")
+		}
+		return NewHeuristic(config), nil
+	default:
+		return nil, fmt.Errorf("spam: unknown classifier %q", driver)
+	}
+}
+
+// Classify classifies c with Default, holding it for a moderator if there
+// is no classifier or it fails
+func Classify(ctx context.Context, c Comment) Result {
+	if Default == nil {
+		return Result{Verdict: Suspicious, Reason: "no spam classifier"}
+	}
+	result, err := Default.Classify(ctx, c)
+	if err != nil {
+		log.Printf("spam: %s classifier failed: %v", Default.Name(), err)
+		return Result{Verdict: Suspicious, Reason: "spam classifier failed"}
+	}
+	return result
+}
+
+// envInt reads a non-negative integer setting
+func envInt(key string, fallback int) int {
+	n, err := strconv.Atoi(getEnv(key, strconv.Itoa(fallback)))
+	if err != nil || n < 0 {
+		return fallback
+	}
+	return n
+}
+
+// getEnv gets an environment variable or returns a default value
+func getEnv(key, defaultValue string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
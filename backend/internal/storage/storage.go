@@ -0,0 +1,85 @@
+// Package storage keeps uploaded files in a pluggable backend: the local
+// filesystem for development, or any S3-compatible object store (AWS S3,
+// MinIO, ...) in production.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+// ErrNotFound is returned when an object does not exist
+var ErrNotFound = errors.New("storage: object not found")
+
+// ErrInvalidKey is returned for keys that could escape the storage root
+var ErrInvalidKey = errors.New("storage: invalid key")
+
+// Storage stores objects by key. Keys are slash-separated relative paths.
+type Storage interface {
+	// Put stores size bytes read from r under key, replacing any existing object
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get opens the object stored under key
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the object; deleting a missing object is not an error
+	Delete(ctx context.Context, key string) error
+	// Exists reports whether an object is stored under key
+	Exists(ctx context.Context, key string) (bool, error)
+}
+
+// Default is the storage used by the HTTP handlers
+var Default Storage
+
+// Init creates Default from the environment
+func Init() {
+	s, err := New()
+	if err != nil {
+		log.Fatal("Failed to initialize file storage:", err)
+	}
+	Default = s
+}
+
+// New creates the storage selected by STORAGE_DRIVER ("local" or "s3")
+func New() (Storage, error) {
+	switch driver := getEnv("STORAGE_DRIVER", "local"); driver {
+	case "local":
+		return NewLocal(getEnv("STORAGE_LOCAL_PATH", "./data/uploads"))
+	case "s3":
+		return NewS3(S3Config{
+			Endpoint:  getEnv("S3_ENDPOINT", "https://s3.amazonaws.com"),
+			Region:    getEnv("S3_REGION", "us-east-1"),
+			Bucket:    getEnv("S3_BUCKET", ""),
+			AccessKey: getEnv("S3_ACCESS_KEY", ""),
+			SecretKey: getEnv("S3_SECRET_KEY", ""),
+			PathStyle: getEnv("S3_PATH_STYLE", "true") == "true",
+		})
+	default:
+		return nil, fmt.Errorf("storage: unknown driver %q", driver)
+	}
+}
+
+// validKey rejects empty, absolute and parent-relative keys
+func validKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return ErrInvalidKey
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return ErrInvalidKey
+		}
+	}
+	return nil
+}
+
+// getEnv gets an environment variable or returns a default value
+func getEnv(key, defaultValue string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
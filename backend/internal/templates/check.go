@@ -0,0 +1,38 @@
+package templates
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Check renders every message and email in every locale with the sample
+// data in fixtures.json. It reports templates missing from a locale and
+// templates that fail to render, e.g. because they use a variable the
+// fixture does not have. go test runs it on the embedded templates.
+func (s *Set) Check() error {
+	var errs []error
+
+	for _, locale := range Locales {
+		for _, key := range s.Messages() {
+			if s.messages[locale].Lookup(key) == nil {
+				errs = append(errs, fmt.Errorf("%s: message %q is missing", locale, key))
+				continue
+			}
+			if _, err := s.Render(locale, key, s.Fixture(key)); err != nil {
+				errs = append(errs, fmt.Errorf("%s: message %q: %w", locale, key, err))
+			}
+		}
+
+		for _, name := range s.emails {
+			if s.emailText[locale][name] == nil {
+				errs = append(errs, fmt.Errorf("%s: %s is missing", locale, name))
+				continue
+			}
+			if _, err := s.RenderEmail(locale, name, s.Fixture(name)); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %s: %w", locale, name, err))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,18 @@
+package templates
+
+import "testing"
+
+// TestEmbeddedTemplatesRender fails when a message or email is missing from
+// a locale or does not render with its fixture data
+func TestEmbeddedTemplatesRender(t *testing.T) {
+	set, err := Load("")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if err := set.Check(); err != nil {
+		t.Fatal(err)
+	}
+	if len(set.Messages()) == 0 || len(set.Emails()) == 0 {
+		t.Errorf("loaded %d messages and %d emails, want some of each", len(set.Messages()), len(set.Emails()))
+	}
+}
@@ -0,0 +1,317 @@
+// Package templates renders localized API messages, SMS and emails from
+// templates embedded in the binary. Any embedded file can be replaced by a
+// file with the same path under TEMPLATES_DIR, so a deployment can reword
+// messages without a rebuild.
+//
+// The files are laid out as:
+//
+//	layouts/email.html, layouts/email.txt  layouts shared by all emails
+//	<locale>/messages.txt                  API and SMS messages, one {{define}} per key
+//	<locale>/email/<name>.txt              the email's "subject" and plain-text "content"
+//	<locale>/email/<name>.html             the email's HTML "content"
+//	fixtures.json                          sample data for previews and Check
+//
+// Templates can call t (another message of the same locale), label (a
+// field's name for people), locale and clinicName. Missing map keys are errors rather than "<no value>".
+package templates
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+)
+
+//go:embed files
+var embedded embed.FS
+
+// DefaultLocale is used when a request asks for no supported locale, and as
+// the fallback for templates missing in a locale
+const DefaultLocale = "vi"
+
+// Locales are the supported locales
+var Locales = []string{"vi", "en"}
+
+// Email is a rendered email
+type Email struct {
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+	HTML    string `json:"html"`
+}
+
+// Set is a parsed set of templates for every locale
+type Set struct {
+	messages  map[string]*texttemplate.Template
+	emailText map[string]map[string]*texttemplate.Template
+	emailHTML map[string]map[string]*htmltemplate.Template
+	emails    []string
+	fixtures  map[string]interface{}
+}
+
+// Default is the set used by the handlers
+var Default *Set
+
+// Init loads Default from the embedded files and TEMPLATES_DIR
+func Init() {
+	s, err := Load(getEnv("TEMPLATES_DIR", ""))
+	if err != nil {
+		log.Fatal("Failed to load templates:", err)
+	}
+	Default = s
+}
+
+// Load parses the embedded templates, replacing those that have a file with
+// the same path under dir. An empty dir loads only the embedded files.
+func Load(dir string) (*Set, error) {
+	s := &Set{
+		messages:  map[string]*texttemplate.Template{},
+		emailText: map[string]map[string]*texttemplate.Template{},
+		emailHTML: map[string]map[string]*htmltemplate.Template{},
+	}
+	read := func(name string) ([]byte, error) {
+		if dir != "" {
+			data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+			if err == nil {
+				return data, nil
+			}
+			if !errors.Is(err, fs.ErrNotExist) {
+				return nil, err
+			}
+		}
+		return embedded.ReadFile(path.Join("files", name))
+	}
+
+	fixtures, err := read("fixtures.json")
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(fixtures, &s.fixtures); err != nil {
+		return nil, fmt.Errorf("templates: fixtures.json: %w", err)
+	}
+
+	layoutText, err := read("layouts/email.txt")
+	if err != nil {
+		return nil, err
+	}
+	layoutHTML, err := read("layouts/email.html")
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := embedded.ReadDir(path.Join("files", DefaultLocale, "email"))
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if name, ok := strings.CutSuffix(entry.Name(), ".txt"); ok {
+			s.emails = append(s.emails, "email/"+name)
+		}
+	}
+	sort.Strings(s.emails)
+
+	for _, locale := range Locales {
+		funcs := s.funcs(locale)
+
+		source, err := read(locale + "/messages.txt")
+		if err != nil {
+			return nil, err
+		}
+		messages, err := texttemplate.New(locale + "/messages.txt").Funcs(funcs).Option("missingkey=error").Parse(string(source))
+		if err != nil {
+			return nil, err
+		}
+		s.messages[locale] = messages
+
+		s.emailText[locale] = map[string]*texttemplate.Template{}
+		s.emailHTML[locale] = map[string]*htmltemplate.Template{}
+		for _, name := range s.emails {
+			text, err := read(locale + "/" + name + ".txt")
+			if errors.Is(err, fs.ErrNotExist) {
+				continue // falls back to DefaultLocale; reported by Check
+			} else if err != nil {
+				return nil, err
+			}
+			html, err := read(locale + "/" + name + ".html")
+			if err != nil {
+				return nil, fmt.Errorf("templates: %s/%s.html: %w", locale, name, err)
+			}
+
+			t, err := texttemplate.New("layouts/email.txt").Funcs(funcs).Option("missingkey=error").Parse(string(layoutText))
+			if err == nil {
+				_, err = t.New(locale + "/" + name + ".txt").Parse(string(text))
+			}
+			if err != nil {
+				return nil, err
+			}
+			h, err := htmltemplate.New("layouts/email.html").Funcs(htmltemplate.FuncMap(funcs)).Option("missingkey=error").Parse(string(layoutHTML))
+			if err == nil {
+				_, err = h.New(locale + "/" + name + ".html").Parse(string(html))
+			}
+			if err != nil {
+				return nil, err
+			}
+			s.emailText[locale][name], s.emailHTML[locale][name] = t, h
+		}
+	}
+
+	return s, nil
+}
+
+// funcs are the functions available to the templates of a locale
+func (s *Set) funcs(locale string) texttemplate.FuncMap {
+	return texttemplate.FuncMap{
+		"locale":     func() string { return locale },
+		"clinicName": func() string { return getEnv("CLINIC_NAME", "Phòng khám Medical") },
+		"t":          func(key string) (string, error) { return s.Render(locale, key, nil) },
+		// label names a field for people, from the "field.<name>" message
+		"label": func(field string) (string, error) {
+			if !s.HasMessage("field." + field) {
+				return field, nil
+			}
+			return s.Render(locale, "field."+field, nil)
+		},
+	}
+}
+
+// Render renders the message key in locale, falling back to DefaultLocale
+// if the locale does not define it
+func (s *Set) Render(locale, key string, data interface{}) (string, error) {
+	t := s.messages[locale].Lookup(key)
+	if t == nil {
+		t = s.messages[DefaultLocale].Lookup(key)
+	}
+	if t == nil {
+		return "", fmt.Errorf("templates: unknown message %q", key)
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// HasMessage reports whether the message key is defined
+func (s *Set) HasMessage(key string) bool {
+	return s.messages[DefaultLocale].Lookup(key) != nil
+}
+
+// Message renders a message like Render but never fails: errors are logged
+// and the key itself is returned, so a broken override cannot take down
+// the endpoint using it
+func (s *Set) Message(locale, key string, data interface{}) string {
+	message, err := s.Render(locale, key, data)
+	if err != nil {
+		log.Printf("templates: %v", err)
+		return key
+	}
+	return message
+}
+
+// RenderEmail renders the email name (e.g. "email/welcome") in locale,
+// falling back to DefaultLocale if the locale does not have it
+func (s *Set) RenderEmail(locale, name string, data interface{}) (*Email, error) {
+	text, html := s.emailText[locale][name], s.emailHTML[locale][name]
+	if text == nil {
+		locale = DefaultLocale
+		text, html = s.emailText[locale][name], s.emailHTML[locale][name]
+	}
+	if text == nil {
+		return nil, fmt.Errorf("templates: unknown email %q", name)
+	}
+
+	var subject, textBody, htmlBody bytes.Buffer
+	if err := text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, err
+	}
+	if err := text.Execute(&textBody, data); err != nil {
+		return nil, err
+	}
+	if err := html.Execute(&htmlBody, data); err != nil {
+		return nil, err
+	}
+
+	return &Email{
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    strings.TrimSpace(textBody.String()) + "\n",
+		HTML:    htmlBody.String(),
+	}, nil
+}
+
+// Messages returns the message keys defined in any locale
+func (s *Set) Messages() []string {
+	seen := map[string]bool{}
+	keys := []string{}
+	for _, locale := range Locales {
+		for _, t := range s.messages[locale].Templates() {
+			if name := t.Name(); name != s.messages[locale].Name() && !seen[name] {
+				seen[name] = true
+				keys = append(keys, name)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Emails returns the email names
+func (s *Set) Emails() []string {
+	return append([]string(nil), s.emails...)
+}
+
+// Fixture returns the sample data for a message key or email name, or nil
+// if it takes none
+func (s *Set) Fixture(name string) interface{} {
+	return s.fixtures[name]
+}
+
+// IsLocale reports whether locale is supported
+func IsLocale(locale string) bool {
+	for _, l := range Locales {
+		if l == locale {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchLocale picks the supported locale a client prefers from an
+// Accept-Language header, e.g. "en-US,en;q=0.9,vi;q=0.8"
+func MatchLocale(acceptLanguage string) string {
+	best, bestQ := DefaultLocale, 0.0
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		language, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if _, err := fmt.Sscanf(value, "%g", &q); err != nil {
+				continue
+			}
+		}
+
+		if IsLocale(language) && q > bestQ {
+			best, bestQ = language, q
+		}
+	}
+	return best
+}
+
+// getEnv gets an environment variable or returns a default value
+func getEnv(key, defaultValue string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
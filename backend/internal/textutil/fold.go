@@ -0,0 +1,37 @@
+// Package textutil holds text helpers shared by the models and handlers
+package textutil
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Fold lowercases s and strips Vietnamese diacritics ("Khó thở" becomes
+// "kho tho"), so text typed with or without accents compares equal.
+func Fold(s string) string {
+	return strings.ToLower(StripDiacritics(s))
+}
+
+// StripDiacritics removes Vietnamese diacritics and keeps the case ("Đặt
+// lịch" becomes "Dat lich"), for channels limited to plain ASCII letters.
+func StripDiacritics(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+
+	for _, r := range norm.NFD.String(s) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// Combining accent marks left over from decomposition
+		case r == 'đ':
+			b.WriteRune('d')
+		case r == 'Đ':
+			b.WriteRune('D')
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,36 @@
+package textutil
+
+import (
+	"regexp"
+	"strings"
+)
+
+// MaxSlugLength is the longest slug Slugify returns, in bytes
+const MaxSlugLength = 80
+
+var (
+	slugSeparators = regexp.MustCompile(`[^a-z0-9]+`)
+	slugPattern    = regexp.MustCompile(`^[a-z0-9]+(?:-[a-z0-9]+)*$`)
+)
+
+// Slugify turns a title into a URL path segment: Vietnamese diacritics are
+// transliterated, everything but letters and digits becomes a hyphen, and
+// long titles are cut at a word boundary ("Sức khỏe & Dinh dưỡng" becomes
+// "suc-khoe-dinh-duong"). It returns "" for titles without letters or digits.
+func Slugify(title string) string {
+	slug := strings.Trim(slugSeparators.ReplaceAllString(Fold(title), "-"), "-")
+	if len(slug) > MaxSlugLength {
+		slug = slug[:MaxSlugLength]
+		if cut := strings.LastIndexByte(slug, '-'); cut > 0 {
+			slug = slug[:cut]
+		}
+		slug = strings.TrimRight(slug, "-")
+	}
+	return slug
+}
+
+// IsSlug reports whether s is a well-formed slug: lowercase ASCII letters
+// and digits in words joined by single hyphens
+func IsSlug(s string) bool {
+	return slugPattern.MatchString(s)
+}
@@ -0,0 +1,32 @@
+package textutil
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Truncate shortens s to at most limit characters, cutting at the last
+// space before the limit when there is one and appending "…". Whitespace
+// runs are collapsed first. It counts runes of the NFC form rather than
+// bytes, so it never splits a character such as "ữ" in two.
+func Truncate(s string, limit int) string {
+	s = norm.NFC.String(strings.Join(strings.Fields(s), " "))
+
+	runes := []rune(s)
+	if len(runes) <= limit {
+		return s
+	}
+
+	cut := runes[:limit]
+	for i := len(cut) - 1; i > limit/2; i-- {
+		if unicode.IsSpace(cut[i]) {
+			cut = cut[:i]
+			break
+		}
+	}
+	return strings.TrimRightFunc(string(cut), func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsPunct(r)
+	}) + "…"
+}
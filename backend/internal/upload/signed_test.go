@@ -0,0 +1,72 @@
+package upload
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSignedURLRoundTrip(t *testing.T) {
+	t.Setenv("UPLOAD_URL_SECRET", "test-secret")
+
+	link, err := SignedURL(7, VariantThumbnail, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("SignedURL: %v", err)
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatalf("parse %q: %v", link, err)
+	}
+	query := u.Query()
+
+	if !VerifySignedURL(7, VariantThumbnail, query.Get("expires"), query.Get("signature")) {
+		t.Error("a freshly signed URL does not verify")
+	}
+	if VerifySignedURL(8, VariantThumbnail, query.Get("expires"), query.Get("signature")) {
+		t.Error("the signature verifies for another attachment")
+	}
+	if VerifySignedURL(7, VariantOriginal, query.Get("expires"), query.Get("signature")) {
+		t.Error("the signature verifies for another variant")
+	}
+}
+
+func TestSignedURLExpired(t *testing.T) {
+	t.Setenv("UPLOAD_URL_SECRET", "test-secret")
+
+	expires := time.Now().Add(-time.Minute).Unix()
+	sig, err := signature(7, VariantOriginal, expires)
+	if err != nil {
+		t.Fatalf("signature: %v", err)
+	}
+	if VerifySignedURL(7, VariantOriginal, strconv.FormatInt(expires, 10), sig) {
+		t.Error("an expired URL verifies")
+	}
+}
+
+func TestSignedURLWithoutSecret(t *testing.T) {
+	t.Setenv("UPLOAD_URL_SECRET", "")
+	t.Setenv("JWT_SECRET", "")
+
+	if _, err := SignedURL(7, VariantOriginal, time.Now().Add(time.Minute)); !errors.Is(err, ErrNoURLSecret) {
+		t.Errorf("SignedURL without a secret: got error %v, want ErrNoURLSecret", err)
+	}
+
+	// A signature made with an empty key must not be accepted either
+	expires := time.Now().Add(time.Minute).Unix()
+	if VerifySignedURL(7, VariantOriginal, strconv.FormatInt(expires, 10), forgedSignature(7, VariantOriginal, expires)) {
+		t.Error("a URL signed with an empty key verifies")
+	}
+}
+
+// forgedSignature signs like signature would with an empty key
+func forgedSignature(attachmentID int, variant string, expires int64) string {
+	mac := hmac.New(sha256.New, nil)
+	fmt.Fprintf(mac, "%d:%s:%d", attachmentID, variant, expires)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,98 @@
+package upload
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+
+	// Register decoders for the allowed image types
+	_ "image/gif"
+
+	_ "golang.org/x/image/webp"
+
+	"golang.org/x/image/draw"
+)
+
+// ThumbnailSize is the bounding box thumbnails are scaled into
+const ThumbnailSize = 320
+
+// maxImagePixels guards against decompression bombs: larger images are
+// stored but get no thumbnail
+const maxImagePixels = 40_000_000
+
+// ErrImageTooLarge is returned for images with too many pixels to decode safely
+var ErrImageTooLarge = errors.New("image dimensions are too large")
+
+// Thumbnail is a rendered preview of an image upload
+type Thumbnail struct {
+	Data        []byte
+	ContentType string
+	Width       int // dimensions of the original image
+	Height      int
+}
+
+// Key is the storage key of the thumbnail, shared by identical uploads
+func (t *Thumbnail) Key(f *File) string {
+	ext := ".jpg"
+	if t.ContentType == "image/png" {
+		ext = ".png"
+	}
+	return "thumbnails/" + f.SHA256[:2] + "/" + f.SHA256 + ext
+}
+
+// MakeThumbnail scales an image upload to fit ThumbnailSize. Images that may
+// be transparent are encoded as PNG, everything else as JPEG.
+func MakeThumbnail(f *File) (*Thumbnail, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(f.Data))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width*config.Height > maxImagePixels {
+		return nil, ErrImageTooLarge
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(f.Data))
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > ThumbnailSize || height > ThumbnailSize {
+		if width >= height {
+			height = height * ThumbnailSize / width
+			width = ThumbnailSize
+		} else {
+			width = width * ThumbnailSize / height
+			height = ThumbnailSize
+		}
+		if width < 1 {
+			width = 1
+		}
+		if height < 1 {
+			height = 1
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Src, nil)
+
+	thumb := &Thumbnail{Width: config.Width, Height: config.Height}
+	var buf bytes.Buffer
+
+	if f.ContentType == "image/png" || f.ContentType == "image/gif" {
+		thumb.ContentType = "image/png"
+		err = png.Encode(&buf, dst)
+	} else {
+		thumb.ContentType = "image/jpeg"
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 80})
+	}
+	if err != nil {
+		return nil, err
+	}
+	thumb.Data = buf.Bytes()
+
+	return thumb, nil
+}
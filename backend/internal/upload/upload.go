@@ -0,0 +1,199 @@
+// Package upload validates uploaded files before they are stored: it sniffs
+// the real content type, enforces per-context allowlists and size limits,
+// hashes the content for deduplication and renders image thumbnails.
+package upload
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// Upload contexts, describing what a file is attached to
+const (
+	ContextGeneral       = "general"
+	ContextChat          = "chat"
+	ContextTicket        = "ticket"
+	ContextMedicalRecord = "medical_record"
+	ContextBlog          = "blog"
+	ContextAvatar        = "avatar"
+)
+
+// Contexts returns every upload context
+func Contexts() []string {
+	return []string{ContextGeneral, ContextChat, ContextTicket, ContextMedicalRecord, ContextBlog, ContextAvatar}
+}
+
+var (
+	imageTypes    = []string{"image/jpeg", "image/png", "image/gif", "image/webp"}
+	documentTypes = []string{
+		"application/pdf",
+		"text/plain",
+		"application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+		"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		"application/msword",
+		"application/vnd.ms-excel",
+	}
+)
+
+// ErrTooLarge is returned for files over the context's size limit
+var ErrTooLarge = errors.New("file is too large")
+
+// ErrEmpty is returned for files without content
+var ErrEmpty = errors.New("file is empty")
+
+// ErrTypeNotAllowed is returned for files whose sniffed type is not allowed
+var ErrTypeNotAllowed = errors.New("file type is not allowed")
+
+// Policy limits what may be uploaded in a context
+type Policy struct {
+	MaxSize int64
+	Allowed []string
+}
+
+// PolicyFor returns the policy of an upload context. Blog images and avatars
+// must be images; everything else may also be a document. The size limit
+// comes from UPLOAD_MAX_SIZE_MB (avatars are capped at 5 MB).
+func PolicyFor(context string) (Policy, bool) {
+	maxSize := int64(maxSizeMB()) << 20
+
+	switch context {
+	case ContextBlog:
+		return Policy{MaxSize: maxSize, Allowed: imageTypes}, true
+	case ContextAvatar:
+		if maxSize > 5<<20 {
+			maxSize = 5 << 20
+		}
+		return Policy{MaxSize: maxSize, Allowed: imageTypes}, true
+	case ContextGeneral, ContextChat, ContextTicket, ContextMedicalRecord:
+		return Policy{MaxSize: maxSize, Allowed: append(append([]string{}, imageTypes...), documentTypes...)}, true
+	default:
+		return Policy{}, false
+	}
+}
+
+// IsPublic reports whether files of a context are shown to everyone (blog
+// images, avatars). They are served without a signed URL, so their URL can be
+// stored in fields like BlogPost.Thumbnail.
+func IsPublic(context string) bool {
+	return context == ContextBlog || context == ContextAvatar
+}
+
+// MaxUploadSize is the largest file any context accepts
+func MaxUploadSize() int64 {
+	return int64(maxSizeMB()) << 20
+}
+
+func maxSizeMB() int {
+	mb, err := strconv.Atoi(getEnv("UPLOAD_MAX_SIZE_MB", "10"))
+	if err != nil || mb <= 0 {
+		mb = 10
+	}
+	return mb
+}
+
+// File is a validated upload
+type File struct {
+	Filename    string
+	ContentType string
+	Size        int64
+	SHA256      string
+	Data        []byte
+}
+
+// Key is the storage key of the file's content. Keys derive from the hash,
+// so identical uploads share one stored object.
+func (f *File) Key() string {
+	return "files/" + f.SHA256[:2] + "/" + f.SHA256
+}
+
+// IsImage reports whether a thumbnail can be rendered for the file
+func (f *File) IsImage() bool {
+	return contains(imageTypes, f.ContentType)
+}
+
+// Inspect validates data uploaded as filename against policy. The declared
+// content type and extension are ignored; the type is sniffed from the bytes.
+func Inspect(data []byte, filename string, policy Policy) (*File, error) {
+	if int64(len(data)) > policy.MaxSize {
+		return nil, fmt.Errorf("%w (max %d MB)", ErrTooLarge, policy.MaxSize>>20)
+	}
+	if len(data) == 0 {
+		return nil, ErrEmpty
+	}
+
+	contentType := mimetype.Detect(data).String()
+	if i := strings.Index(contentType, ";"); i >= 0 {
+		contentType = contentType[:i]
+	}
+	if !contains(policy.Allowed, contentType) {
+		return nil, fmt.Errorf("%w: %s", ErrTypeNotAllowed, contentType)
+	}
+
+	sum := sha256.Sum256(data)
+
+	return &File{
+		Filename:    SanitizeFilename(filename),
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		SHA256:      hex.EncodeToString(sum[:]),
+		Data:        data,
+	}, nil
+}
+
+// Reader returns a reader over the file content
+func (f *File) Reader() *bytes.Reader {
+	return bytes.NewReader(f.Data)
+}
+
+// SanitizeFilename keeps the base name of a client supplied filename and
+// drops control and path characters
+func SanitizeFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+
+	if name == "" || name == "." {
+		return "file"
+	}
+	if runes := []rune(name); len(runes) > 200 {
+		ext := filepath.Ext(name)
+		if len([]rune(ext)) > 20 {
+			ext = ""
+		}
+		name = string(runes[:200-len([]rune(ext))]) + ext
+	}
+	return name
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// getEnv gets an environment variable or returns a default value
+func getEnv(key, defaultValue string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
@@ -0,0 +1,63 @@
+// Package validation registers the custom rules request bodies use in their
+// binding tags, and makes JSON binding reject fields the request type does
+// not declare, so clients cannot set server-owned fields such as view_count.
+package validation
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/dottrip/fpt-swp/internal/sms"
+	"github.com/dottrip/fpt-swp/internal/textutil"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// licensePattern matches practising certificate numbers as issued by the
+// Ministry of Health and provincial health departments: a serial number,
+// the issuer code and CCHN (chứng chỉ hành nghề) or, since 2024, GPHN
+// (giấy phép hành nghề), e.g. "000123/BYT-CCHN" or "0456/HCM-GPHN"
+var licensePattern = regexp.MustCompile(`^[0-9]{1,7}/[A-Z]{2,6}-(?:CCHN|GPHN)$`)
+
+// rules are the custom binding rules by tag
+var rules = map[string]validator.Func{
+	"vnphone":   isVietnamesePhone,
+	"vnlicense": isLicenseNumber,
+	"slug":      isSlug,
+}
+
+// Register adds the custom rules to gin's validator and turns on strict JSON
+// binding. Call it once at startup, before requests are served.
+func Register() error {
+	binding.EnableDecoderDisallowUnknownFields = true
+
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return errors.New("validation: gin is not using go-playground/validator")
+	}
+	for tag, rule := range rules {
+		if err := v.RegisterValidation(tag, rule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isVietnamesePhone reports whether the field is a Vietnamese mobile or
+// landline number, written nationally or with the country code
+func isVietnamesePhone(fl validator.FieldLevel) bool {
+	normalized, err := sms.NormalizePhone(fl.Field().String())
+	return err == nil && strings.HasPrefix(normalized, "+84")
+}
+
+// isLicenseNumber reports whether the field is a practising certificate
+// number. Letters may be in either case and surrounding spaces are ignored.
+func isLicenseNumber(fl validator.FieldLevel) bool {
+	return licensePattern.MatchString(strings.ToUpper(strings.TrimSpace(fl.Field().String())))
+}
+
+// isSlug reports whether the field is a URL slug such as "suc-khoe"
+func isSlug(fl validator.FieldLevel) bool {
+	return textutil.IsSlug(fl.Field().String())
+}
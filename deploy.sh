@@ -159,7 +159,7 @@ deploy_local() {
     cd frontend && npm install && npm run build && cd ..
     
     echo -e "${BLUE}Installing backend dependencies...${NC}"
-    cd backend && go mod download && go build -o main ./cmd/api/main.go && cd ..
+    cd backend && go mod download && go build -tags sqlite_fts5 -o main ./cmd/api/main.go && cd ..
     
     echo -e "${GREEN}✅ Local deployment completed${NC}"
     echo -e "${YELLOW}Run './run.sh' to start the application${NC}"
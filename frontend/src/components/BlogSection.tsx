@@ -102,7 +102,7 @@ const BlogSection: React.FC = () => {
                   </h3>
                   
                   <p className="text-gray-600 mb-6">
-                    {posts[0].excerpt || truncateText(posts[0].content, 200)}
+                    {posts[0].excerpt}
                   </p>
                   
                   <div className="flex items-center justify-between">
@@ -169,7 +169,7 @@ const BlogSection: React.FC = () => {
                   </h3>
                   
                   <p className="text-gray-600 text-sm mb-4">
-                    {post.excerpt || truncateText(post.content, 120)}
+                    {post.excerpt}
                   </p>
                   
                   <div className="flex items-center justify-between text-sm text-gray-500">
@@ -231,7 +231,7 @@ const AddDoctorModal: React.FC<AddDoctorModalProps> = ({ isOpen, onClose, onSucc
                   value={formData.license_number}
                   onChange={handleInputChange}
                   className="w-full px-3 py-2 border border-gray-300 rounded-lg focus:outline-none focus:ring-2 focus:ring-blue-500 focus:border-transparent"
-                  placeholder="BS12345"
+                  placeholder="000123/BYT-CCHN"
                   required
                 />
               </div>
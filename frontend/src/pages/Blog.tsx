@@ -55,7 +55,7 @@ const Blog = () => {
     try {
       const response = await blogApi.getCategories();
       if (response.success && response.data) {
-        setCategories(response.data);
+        setCategories(response.data.map(category => category.name));
       }
     } catch (error) {
       console.error('Error loading categories:', error);
@@ -87,11 +87,6 @@ const Blog = () => {
     });
   };
 
-  const truncateText = (text: string, maxLength: number) => {
-    if (text.length <= maxLength) return text;
-    return text.slice(0, maxLength) + '...';
-  };
-
   return (
     <div className="min-h-screen bg-white">
       <Header />
@@ -196,7 +191,7 @@ const Blog = () => {
                     {post.title}
                   </CardTitle>
                   <p className="text-gray-600 text-sm leading-relaxed">
-                    {post.excerpt || truncateText(post.content, 120)}
+                    {post.excerpt}
                   </p>
                 </CardHeader>
                 <CardContent>
@@ -23,7 +23,7 @@ const SignIn = () => {
       navigate('/dashboard'); // Chuyển hướng đến dashboard sau khi đăng nhập
     } catch (error: any) {
       console.error('Login failed:', error);
-      toast.error(error.response?.data?.error || 'Đăng nhập thất bại. Vui lòng thử lại.');
+      toast.error(error.response?.data?.error?.message || 'Đăng nhập thất bại. Vui lòng thử lại.');
     } finally {
       setLoading(false);
     }
@@ -58,7 +58,7 @@ const SignUp = () => {
       navigate('/dashboard'); // Chuyển hướng đến dashboard sau khi đăng ký
     } catch (error: any) {
       console.error('Registration failed:', error);
-      toast.error(error.response?.data?.error || 'Đăng ký thất bại. Vui lòng thử lại.');
+      toast.error(error.response?.data?.error?.message || 'Đăng ký thất bại. Vui lòng thử lại.');
     } finally {
       setLoading(false);
     }
@@ -68,7 +68,7 @@ const BlogManagement: React.FC = () => {
     try {
       const response = await blogApi.getCategories();
       if (response.success && response.data) {
-        setCategories(response.data);
+        setCategories(response.data.map(category => category.name));
       }
     } catch (error) {
       console.error('Error loading categories:', error);
@@ -126,7 +126,8 @@ const BlogManagement: React.FC = () => {
   const CreatePostModal = () => {
     const [formData, setFormData] = useState({
       title: '',
-      content: '',
+      slug: '',
+      content_markdown: '',
       excerpt: '',
       category: '',
       tags: '',
@@ -142,7 +143,8 @@ const BlogManagement: React.FC = () => {
           setShowCreateModal(false);
           setFormData({
             title: '',
-            content: '',
+            slug: '',
+            content_markdown: '',
             excerpt: '',
             category: '',
             tags: '',
@@ -188,6 +190,18 @@ const BlogManagement: React.FC = () => {
               />
             </div>
 
+            <div>
+              <label className="block text-sm font-medium text-gray-700 mb-1">Đường dẫn (slug)</label>
+              <input
+                type="text"
+                value={formData.slug}
+                onChange={(e) => setFormData({...formData, slug: e.target.value})}
+                className="w-full px-3 py-2 border border-gray-300 rounded-lg focus:outline-none focus:ring-2 focus:ring-blue-500"
+                placeholder="Để trống để tạo tự động từ tiêu đề"
+                pattern="[a-z0-9]+(-[a-z0-9]+)*"
+              />
+            </div>
+
             <div className="grid grid-cols-2 gap-4">
               <div>
                 <label className="block text-sm font-medium text-gray-700 mb-1">Danh mục</label>
@@ -239,13 +253,13 @@ const BlogManagement: React.FC = () => {
             </div>
 
             <div>
-              <label className="block text-sm font-medium text-gray-700 mb-1">Nội dung</label>
+              <label className="block text-sm font-medium text-gray-700 mb-1">Nội dung (Markdown)</label>
               <textarea
-                value={formData.content}
-                onChange={(e) => setFormData({...formData, content: e.target.value})}
+                value={formData.content_markdown}
+                onChange={(e) => setFormData({...formData, content_markdown: e.target.value})}
                 rows={10}
                 className="w-full px-3 py-2 border border-gray-300 rounded-lg focus:outline-none focus:ring-2 focus:ring-blue-500"
-                placeholder="Nội dung chi tiết của bài viết..."
+                placeholder="Nội dung chi tiết của bài viết... Hỗ trợ **đậm**, _nghiêng_, danh sách, liên kết và bảng"
                 required
               />
             </div>
@@ -278,7 +292,8 @@ const BlogManagement: React.FC = () => {
                       setShowCreateModal(false);
                       setFormData({
                         title: '',
-                        content: '',
+                        slug: '',
+                        content_markdown: '',
                         excerpt: '',
                         category: '',
                         tags: '',
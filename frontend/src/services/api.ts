@@ -45,8 +45,8 @@ export const authService = {
       const response = await api.post('/login', { email, password });
       
       // Lưu token và thông tin user vào localStorage
-      localStorage.setItem('token', response.data.token);
-      localStorage.setItem('user', JSON.stringify(response.data.user));
+      localStorage.setItem('token', response.data.data.token);
+      localStorage.setItem('user', JSON.stringify(response.data.data.user));
       
       return response.data;
     } catch (error) {
@@ -64,8 +64,8 @@ export const authService = {
       const response = await api.post('/register', userData);
       
       // Lưu token và thông tin user vào localStorage nếu đăng ký thành công
-      localStorage.setItem('token', response.data.token);
-      localStorage.setItem('user', JSON.stringify(response.data.user));
+      localStorage.setItem('token', response.data.data.token);
+      localStorage.setItem('user', JSON.stringify(response.data.data.user));
       
       return response.data;
     } catch (error) {
@@ -4,42 +4,166 @@ const API_BASE_URL = import.meta.env.VITE_API_URL || 'http://localhost:8080/api'
 export interface BlogPost {
   id: number;
   title: string;
-  content: string;
+  slug: string;
+  content_markdown: string;
+  content_html: string; // sanitized HTML rendered from content_markdown
   excerpt: string;
   thumbnail: string;
   author_id: number;
   author_name: string;
-  status: 'draft' | 'published' | 'archived';
-  category: string;
-  tags: string;
+  status: 'draft' | 'pending_review' | 'scheduled' | 'published' | 'archived';
+  category: string; // category name; a new one is created on save
+  tags: string; // comma-separated tag names; new ones are created on save
   view_count: number;
+  version: number;
   created_at: string;
   updated_at: string;
   published_at?: string;
+  publish_at?: string; // when a scheduled post goes live
+  unpublish_at?: string; // when a published post is archived
+  reviewer_id?: number; // doctor asked to review the post
+  medical_review?: BlogMedicalReview; // set while the current content is approved
+  comments_enabled: boolean;
+  comment_count: number; // approved comments
+  category_id: number | null;
+  category_slug?: string;
+  tag_list: BlogTermRef[]; // by name
+}
+
+export interface BlogTermRef {
+  id: number;
+  name: string;
+  slug: string;
+}
+
+// A category or tag
+export interface BlogTerm extends BlogTermRef {
+  description: string;
+  post_count: number; // published posts
+  created_at: string;
+  updated_at: string;
+}
+
+export interface BlogTermInput {
+  name: string;
+  slug?: string; // made from the name on create if empty, kept on rename
+  description?: string;
+}
+
+export interface BlogMedicalReview {
+  reviewer_id: number | null;
+  reviewer_name: string;
+  reviewed_at: string;
+  label?: string; // e.g. "Medically reviewed by Dr. X", in the requested language
+}
+
+export interface BlogReviewComment {
+  id: number;
+  post_id: number;
+  version: number; // version of the post the comment is about
+  author_id: number | null;
+  author_name: string;
+  action: 'comment' | 'submit' | 'approve' | 'request_changes';
+  body: string;
+  created_at: string;
+}
+
+export interface BlogComment {
+  id: number;
+  post_id: number;
+  post_title?: string; // in the moderation queue
+  parent_id: number | null; // comment replied to
+  author_id: number;
+  author_name: string;
+  body: string; // HTML-escaped
+  status: 'pending' | 'approved' | 'rejected' | 'spam';
+  spam_reason?: string; // why the spam filter held it; moderators only
+  moderated_by?: number;
+  moderated_at?: string;
+  created_at: string;
+  replies?: BlogComment[];
 }
 
 export interface BlogPostFilter {
   status?: string;
-  category?: string;
+  category?: string; // slug or name
+  tag?: string; // slug or name
   author_id?: number;
-  search?: string;
+  search?: string; // words, with or without accents
   limit?: number;
   offset?: number;
-  sort_by?: string;
+  cursor?: string;
+  sort_by?: string; // 'relevance' puts the best matches of search first
   sort_order?: 'asc' | 'desc';
 }
 
+// A post found by search, without its content. title_highlight and snippet
+// are HTML where only <mark> wraps the words found.
+export interface BlogSearchResult extends BlogPost {
+  title_highlight: string;
+  snippet: string;
+}
+
+export interface BlogSearchFilter {
+  q: string;
+  category?: string; // slug or name
+  tag?: string; // slug or name
+  limit?: number;
+  offset?: number;
+}
+
 export interface BlogStats {
   total_posts: number;
   published_posts: number;
   draft_posts: number;
+  scheduled_posts: number;
+  pending_review_posts: number;
   total_views: number;
+  views: BlogViewStats;
+}
+
+// Views counted in a range of days (YYYY-MM-DD, clinic time)
+export interface BlogViewStats {
+  from: string;
+  to: string;
+  total: number;
+  daily: { date: string; views: number }[];
+  top_posts: { post_id: number; title: string; slug: string; views: number }[];
+  referrers: { referrer: string; views: number }[]; // referrer is '' for direct visits
+}
+
+export interface BlogRevision {
+  id: number;
+  post_id: number;
+  version: number;
+  title: string;
+  content_markdown?: string; // only when fetching a single revision
+  excerpt?: string;
+  status: BlogPost['status'];
+  editor_id: number | null;
+  editor_name: string;
+  created_at: string;
+}
+
+export interface BlogRevisionDiff {
+  from: number;
+  to: number;
+  diff: string; // unified diff
+}
+
+export interface ListMeta {
+  total: number;
+  limit?: number;
+  offset?: number;
+  next_cursor?: string;
+  has_more: boolean;
 }
 
 export interface ApiResponse<T> {
   success: boolean;
   message?: string;
   data?: T;
+  meta?: ListMeta;
   error?: string;
 }
 
@@ -89,6 +213,11 @@ class BlogApiService {
             success: false,
             error: 'Forbidden - You do not have permission to access this resource',
           };
+        } else if (response.status === 412) {
+          return {
+            success: false,
+            error: 'This post was changed by someone else - Please reload it and try again',
+          };
         } else {
           return {
             success: false,
@@ -136,13 +265,72 @@ class BlogApiService {
     return this.request<BlogPost[]>(endpoint);
   }
 
+  // Published posts best matching q first
+  async search(filter: BlogSearchFilter): Promise<ApiResponse<BlogSearchResult[]>> {
+    const params = new URLSearchParams();
+    Object.entries(filter).forEach(([key, value]) => {
+      if (value !== undefined) {
+        params.append(key, value.toString());
+      }
+    });
+
+    return this.request<BlogSearchResult[]>(`/blog/search?${params.toString()}`);
+  }
+
   async getPublishedPost(id: number, incrementView = true): Promise<ApiResponse<BlogPost>> {
     const params = incrementView ? '?increment_view=true' : '';
     return this.request<BlogPost>(`/blog/posts/${id}${params}`);
   }
 
-  async getCategories(): Promise<ApiResponse<string[]>> {
-    return this.request<string[]>('/blog/categories');
+  // Old slugs of renamed posts redirect to the current one
+  async getPublishedPostBySlug(slug: string, incrementView = true): Promise<ApiResponse<BlogPost>> {
+    const params = incrementView ? '?increment_view=true' : '';
+    return this.request<BlogPost>(`/blog/posts/by-slug/${encodeURIComponent(slug)}${params}`);
+  }
+
+  // Address of the feed of the latest posts, or of a category's posts, for
+  // feed readers; not fetched by the app
+  feedUrl(format: 'rss' | 'atom' | 'json', categorySlug?: string): string {
+    const base = categorySlug ? `/blog/categories/${encodeURIComponent(categorySlug)}` : '/blog';
+    return `${API_BASE_URL}${base}/feed.${format}`;
+  }
+
+  async getCategories(): Promise<ApiResponse<BlogTerm[]>> {
+    return this.request<BlogTerm[]>('/blog/categories');
+  }
+
+  async getTags(): Promise<ApiResponse<BlogTerm[]>> {
+    return this.request<BlogTerm[]>('/blog/tags');
+  }
+
+  // kind is 'categories' or 'tags'; staff and admins only
+  async createTerm(kind: 'categories' | 'tags', input: BlogTermInput): Promise<ApiResponse<BlogTerm>> {
+    return this.request<BlogTerm>(`/blog/manage/${kind}`, {
+      method: 'POST',
+      body: JSON.stringify(input),
+    });
+  }
+
+  // Renaming shows the new name on every post filed under the term
+  async updateTerm(kind: 'categories' | 'tags', id: number, input: BlogTermInput): Promise<ApiResponse<BlogTerm>> {
+    return this.request<BlogTerm>(`/blog/manage/${kind}/${id}`, {
+      method: 'PUT',
+      body: JSON.stringify(input),
+    });
+  }
+
+  async deleteTerm(kind: 'categories' | 'tags', id: number): Promise<ApiResponse<void>> {
+    return this.request<void>(`/blog/manage/${kind}/${id}`, {
+      method: 'DELETE',
+    });
+  }
+
+  // Moves every post to intoId and deletes the term
+  async mergeTerm(kind: 'categories' | 'tags', id: number, intoId: number): Promise<ApiResponse<BlogTerm>> {
+    return this.request<BlogTerm>(`/blog/manage/${kind}/${id}/merge`, {
+      method: 'POST',
+      body: JSON.stringify({ into_id: intoId }),
+    });
   }
 
   // Protected blog management endpoints
@@ -169,10 +357,18 @@ class BlogApiService {
     });
   }
 
-  async updatePost(id: number, post: Partial<BlogPost>): Promise<ApiResponse<BlogPost>> {
+  // Sends only the changed fields as a JSON Merge Patch. With the version the
+  // changes are based on, the server refuses them (412) if the post has been
+  // changed since.
+  async updatePost(id: number, changes: Partial<BlogPost>, version?: number): Promise<ApiResponse<BlogPost>> {
+    const headers: Record<string, string> = { 'Content-Type': 'application/merge-patch+json' };
+    if (version !== undefined) {
+      headers['If-Match'] = `"${version}"`;
+    }
     return this.request<BlogPost>(`/blog/manage/posts/${id}`, {
-      method: 'PUT',
-      body: JSON.stringify(post),
+      method: 'PATCH',
+      headers,
+      body: JSON.stringify(changes),
     });
   }
 
@@ -194,8 +390,107 @@ class BlogApiService {
     });
   }
 
-  async getStats(): Promise<ApiResponse<BlogStats>> {
-    return this.request<BlogStats>('/blog/manage/stats');
+  async getRevisions(id: number): Promise<ApiResponse<BlogRevision[]>> {
+    return this.request<BlogRevision[]>(`/blog/manage/posts/${id}/revisions`);
+  }
+
+  async getRevision(id: number, version: number): Promise<ApiResponse<BlogRevision>> {
+    return this.request<BlogRevision>(`/blog/manage/posts/${id}/revisions/${version}`);
+  }
+
+  // Without `to`, compares with the current version
+  async diffRevisions(id: number, from: number, to?: number): Promise<ApiResponse<BlogRevisionDiff>> {
+    const params = new URLSearchParams({ from: from.toString() });
+    if (to !== undefined) {
+      params.append('to', to.toString());
+    }
+    return this.request<BlogRevisionDiff>(`/blog/manage/posts/${id}/revisions/diff?${params.toString()}`);
+  }
+
+  // Restoring is saved as a new revision, so it can be undone too
+  async restoreRevision(id: number, version: number): Promise<ApiResponse<BlogPost>> {
+    return this.request<BlogPost>(`/blog/manage/posts/${id}/revisions/${version}/restore`, {
+      method: 'POST',
+    });
+  }
+
+  async submitForReview(id: number, reviewerId: number, body = ''): Promise<ApiResponse<BlogPost>> {
+    return this.request<BlogPost>(`/blog/manage/posts/${id}/review/submit`, {
+      method: 'POST',
+      body: JSON.stringify({ reviewer_id: reviewerId, body }),
+    });
+  }
+
+  // Only the assigned doctor may approve or request changes
+  async approvePost(id: number, body = ''): Promise<ApiResponse<BlogPost>> {
+    return this.request<BlogPost>(`/blog/manage/posts/${id}/review/approve`, {
+      method: 'POST',
+      body: JSON.stringify({ body }),
+    });
+  }
+
+  async requestChanges(id: number, body: string): Promise<ApiResponse<BlogPost>> {
+    return this.request<BlogPost>(`/blog/manage/posts/${id}/review/request-changes`, {
+      method: 'POST',
+      body: JSON.stringify({ body }),
+    });
+  }
+
+  async getReviewComments(id: number): Promise<ApiResponse<BlogReviewComment[]>> {
+    return this.request<BlogReviewComment[]>(`/blog/manage/posts/${id}/review/comments`);
+  }
+
+  async addReviewComment(id: number, body: string): Promise<ApiResponse<BlogReviewComment>> {
+    return this.request<BlogReviewComment>(`/blog/manage/posts/${id}/review/comments`, {
+      method: 'POST',
+      body: JSON.stringify({ body }),
+    });
+  }
+
+  // Approved comments as threads; replies are nested under their parent
+  async getComments(postId: number): Promise<ApiResponse<BlogComment[]>> {
+    return this.request<BlogComment[]>(`/blog/posts/${postId}/comments`);
+  }
+
+  // Answers 202 with status "pending" when the comment waits for a moderator
+  async addComment(postId: number, body: string, parentId?: number): Promise<ApiResponse<BlogComment>> {
+    return this.request<BlogComment>(`/blog/posts/${postId}/comments`, {
+      method: 'POST',
+      body: JSON.stringify({ body, parent_id: parentId ?? null }),
+    });
+  }
+
+  // Staff and admins only; pending comments unless another status is given
+  async getModerationQueue(
+    status: BlogComment['status'] | 'all' = 'pending',
+    limit = 20,
+    offset = 0
+  ): Promise<ApiResponse<BlogComment[]>> {
+    const params = new URLSearchParams({ status, limit: limit.toString(), offset: offset.toString() });
+    return this.request<BlogComment[]>(`/blog/manage/comments?${params.toString()}`);
+  }
+
+  async moderateComment(id: number, action: 'approve' | 'reject' | 'spam'): Promise<ApiResponse<BlogComment>> {
+    return this.request<BlogComment>(`/blog/manage/comments/${id}/${action}`, {
+      method: 'POST',
+    });
+  }
+
+  // Marks the comment as spam and stops its author from commenting
+  async banCommenter(id: number, reason = ''): Promise<ApiResponse<{ user_id: number; rejected: number }>> {
+    return this.request<{ user_id: number; rejected: number }>(`/blog/manage/comments/${id}/ban`, {
+      method: 'POST',
+      body: JSON.stringify({ reason }),
+    });
+  }
+
+  // Views cover from..to (YYYY-MM-DD, both included), the last 30 days by default
+  async getStats(from?: string, to?: string): Promise<ApiResponse<BlogStats>> {
+    const params = new URLSearchParams();
+    if (from) params.append('from', from);
+    if (to) params.append('to', to);
+    const query = params.toString();
+    return this.request<BlogStats>(`/blog/manage/stats${query ? `?${query}` : ''}`);
   }
 }
 
@@ -21,6 +21,7 @@ export interface Doctor {
   consultation_price: number;
   patient_count: number;
   appointment_count: number;
+  version: number;
   created_at: string;
   updated_at: string;
 }
@@ -44,8 +45,9 @@ export interface CreateDoctorRequest {
   consultation_price?: number;
 }
 
+// PUT replaces every field and must name the version it replaces
 export interface UpdateDoctorRequest extends CreateDoctorRequest {
-  id: number;
+  version: number;
 }
 
 export interface DoctorFilter {
@@ -54,16 +56,25 @@ export interface DoctorFilter {
   status?: string;
   limit?: number;
   offset?: number;
+  cursor?: string;
   sort_by?: string;
   sort_order?: 'asc' | 'desc';
 }
 
+export interface ListMeta {
+  total: number;
+  limit?: number;
+  offset?: number;
+  next_cursor?: string;
+  has_more: boolean;
+}
+
 export interface ApiResponse<T> {
   success: boolean;
   data?: T;
   error?: string;
   message?: string;
-  count?: number;
+  meta?: ListMeta;
 }
 
 // Doctor API service
@@ -78,6 +89,7 @@ export const doctorApi = {
       if (filter?.status) params.append('status', filter.status);
       if (filter?.limit) params.append('limit', filter.limit.toString());
       if (filter?.offset) params.append('offset', filter.offset.toString());
+      if (filter?.cursor !== undefined) params.append('cursor', filter.cursor);
       if (filter?.sort_by) params.append('sort_by', filter.sort_by);
       if (filter?.sort_order) params.append('sort_order', filter.sort_order);
 
@@ -87,7 +99,7 @@ export const doctorApi = {
       console.error('Error fetching doctors:', error);
       return {
         success: false,
-        error: error.response?.data?.error || 'Failed to fetch doctors'
+        error: error.response?.data?.error?.message || 'Failed to fetch doctors'
       };
     }
   },
@@ -101,7 +113,7 @@ export const doctorApi = {
       console.error('Error fetching doctor:', error);
       return {
         success: false,
-        error: error.response?.data?.error || 'Failed to fetch doctor'
+        error: error.response?.data?.error?.message || 'Failed to fetch doctor'
       };
     }
   },
@@ -115,13 +127,13 @@ export const doctorApi = {
       console.error('Error creating doctor:', error);
       return {
         success: false,
-        error: error.response?.data?.error || 'Failed to create doctor'
+        error: error.response?.data?.error?.message || 'Failed to create doctor'
       };
     }
   },
 
   // Update doctor
-  updateDoctor: async (id: number, doctorData: CreateDoctorRequest): Promise<ApiResponse<Doctor>> => {
+  updateDoctor: async (id: number, doctorData: UpdateDoctorRequest): Promise<ApiResponse<Doctor>> => {
     try {
       const response = await api.put(`/doctors/${id}`, doctorData);
       return response.data;
@@ -129,7 +141,7 @@ export const doctorApi = {
       console.error('Error updating doctor:', error);
       return {
         success: false,
-        error: error.response?.data?.error || 'Failed to update doctor'
+        error: error.response?.data?.error?.message || 'Failed to update doctor'
       };
     }
   },
@@ -143,7 +155,7 @@ export const doctorApi = {
       console.error('Error deleting doctor:', error);
       return {
         success: false,
-        error: error.response?.data?.error || 'Failed to delete doctor'
+        error: error.response?.data?.error?.message || 'Failed to delete doctor'
       };
     }
   },
@@ -157,7 +169,7 @@ export const doctorApi = {
       console.error('Error fetching specialties:', error);
       return {
         success: false,
-        error: error.response?.data?.error || 'Failed to fetch specialties'
+        error: error.response?.data?.error?.message || 'Failed to fetch specialties'
       };
     }
   }
@@ -81,7 +81,7 @@ start_backend() {
   
   if check_go; then
     echo -e "${BLUE}Running Go backend server...${NC}"
-    go run cmd/api/main.go
+    go run -tags sqlite_fts5 cmd/api/main.go
   else
     return 1
   fi
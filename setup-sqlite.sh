@@ -49,7 +49,7 @@ echo -e "${GREEN}✅ Created data directory${NC}"
 echo -e "${BLUE}Building and testing database connection...${NC}"
 
 # Build the application
-go build -o main cmd/api/main.go 2>/dev/null
+go build -tags sqlite_fts5 -o main cmd/api/main.go 2>/dev/null
 if [ $? -eq 0 ]; then
     echo -e "${GREEN}✅ Application built successfully${NC}"
     
@@ -87,7 +87,7 @@ echo -e "${GREEN}"
 echo "🎉 SQLite development database setup completed!"
 echo ""
 echo "Next steps:"
-echo "1. Start development server: go run cmd/api/main.go"
+echo "1. Start development server: go run -tags sqlite_fts5 cmd/api/main.go"
 echo "2. Or use: make dev (if available)"
 echo "3. The database file is located at: backend/data/medical_dev.db"
 echo ""